@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/output"
+)
+
+// Environment variables the --post-hook command receives in addition to the tool's environment
+const (
+	hookPatchFileEnv  = "RIGHTSIZER_PATCH_FILE"  // Path of the patch file, or of the first one
+	hookPatchFilesEnv = "RIGHTSIZER_PATCH_FILES" // Paths of all patch files, one per line
+	hookSummaryEnv    = "RIGHTSIZER_SUMMARY"     // The result as printed by the json output format
+)
+
+// runPostHook runs the --post-hook command through the shell once the results are written,
+// passing it the patch files and a JSON summary of the result, and reports its exit code. It
+// returns false if the hook couldn't be run or exited with a non-zero code.
+func runPostHook(ctx context.Context, command string, result output.Result, format string) bool {
+	summary, err := output.Summary(result)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error preparing the post-hook summary: %v\n", err)
+		return false
+	}
+
+	patchFiles := output.PatchFiles(result, format)
+	patchFile := ""
+	if len(patchFiles) > 0 {
+		patchFile = patchFiles[0]
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		hookPatchFileEnv+"="+patchFile,
+		hookPatchFilesEnv+"="+strings.Join(patchFiles, "\n"),
+		hookSummaryEnv+"="+string(summary),
+	)
+
+	fmt.Printf("Running post-hook: %s\n", command)
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		fmt.Println("Post-hook exited with code 0")
+		return true
+	case errors.As(err, &exitErr):
+		fmt.Fprintf(os.Stderr, "Post-hook exited with code %d\n", exitErr.ExitCode())
+	default:
+		fmt.Fprintf(os.Stderr, "Error running post-hook: %v\n", err)
+	}
+	return false
+}
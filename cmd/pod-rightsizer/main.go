@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -15,19 +20,208 @@ import (
 	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
 	"github.com/BogdanDolia/pod-rightsizer/pkg/output"
 	"github.com/BogdanDolia/pod-rightsizer/pkg/recommender"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // Config holds the CLI configuration
 type Config struct {
-	Target         string // Load test target
-	ServiceName    string // Kubernetes service name for metrics collection
-	Namespace      string
-	Duration       time.Duration
-	RPS            int
-	Concurrency    int
-	Margin         int
-	OutputFormat   string
-	KubeconfigPath string
+	Target             string // Load test target
+	ServiceName        string // Kubernetes service name for metrics collection
+	Namespace          string
+	Duration           time.Duration
+	RPS                int
+	RPSPerReplica      bool // Treat RPS as per replica and multiply it by the Deployment's replica count
+	Replicas           int  // Replica count RPS was multiplied by, set once it is read from the cluster
+	Concurrency        int
+	Margin             int
+	AdaptiveMargin     bool // Scale each resource's margin between MinMargin and MaxMargin with its usage variance
+	MinMargin          int
+	MaxMargin          int
+	OutputFormat       string
+	KubeconfigPath     string
+	PreviewInterval    time.Duration // Interval for advisory interim recommendations (0 disables)
+	HelmValuesPath     string        // Values path for the helm output format
+	AggregateWindow    time.Duration // Bucket width for smoothing samples before analysis (0 disables)
+	AggregateFunc      string        // How samples within a bucket are combined: mean or max
+	DedupSamples       bool          // Collapse consecutive identical samples, which repeat a single metrics-server scrape
+	SampleJitter       bool          // Randomize the first sample's offset and jitter each later one
+	RequiredCoverage   float64       // Fraction of running pods every sample must have metrics for, or no recommendation is made (0 disables)
+	Plan               bool          // Print what would be done and exit without load testing
+	LoadTestOnly       bool          // Only run the load test and report on it, without Kubernetes access
+	SummaryOnly        bool          // Don't print each collected metrics sample
+	PrintSelector      bool          // Print the pod label selector and how it was derived before listing pods
+	ExplainSelector    bool          // Trace each step of resolving the target to pods to stderr
+	ValidatePatch      bool          // Dry-run the generated patches against the API server before writing them
+	MetricsListen      string        // Address for a short-lived Prometheus /metrics endpoint (empty disables)
+	MetricsServeFor    time.Duration // How long the /metrics endpoint stays up after the run
+	Deployment         string        // Target Deployment name (resolved from the pods if empty)
+	ResourceName       string        // Deployment name the patch targets (guessed from the service name if empty)
+	PodTemplateHash    string        // Measure only pods with this pod-template-hash, or of the latest/previous revision (empty for all)
+	CompareAlgos       bool          // Show average-, peak-, and percentile-based recommendations side by side
+	CompareWithVPA     bool          // Show the recommendation of the workload's VerticalPodAutoscaler side by side
+	HPAHeadroom        float64       // Recommend an HPA target utilization keeping this fraction of the CPU request free (0 disables)
+	NoCPULimit         bool          // Never set a CPU limit in generated patches
+	ForceLimits        bool          // Set limits even if the workload currently runs without them
+	RequestsOnly       bool          // Size only requests and keep the current limits out of the patch
+	ColdStart          time.Duration // Size the limits to also cover the usage peak of this first part of the run (0 disables)
+	SaveResult         string        // Path to save the full result as JSON (empty disables)
+	SaveLoadResults    string        // Path every request's timestamp, latency, status, and error are streamed to (empty disables)
+	LatencyHDR         string        // Path the latency distribution is written to in the HdrHistogram format (empty disables)
+	ProbeTarget        bool          // Send a single request to the target before the load test and stop if it fails
+	AutoPortForward    bool          // Port-forward to a target pod and load test through localhost
+	RemotePort         int           // Pod port to forward to (derived from the target if 0)
+	Color              string        // Text output color mode: always, never, or auto
+	CompactJSON        bool          // Print the json output format on a single line
+	Strategy           string        // Name of the recommendation strategy
+	Percentile         float64       // Usage percentile for the percentile strategy
+	CPURequestStat     string        // Usage statistic the CPU request is sized from with the margin strategy
+	MemoryRequestStat  string        // Usage statistic the memory request is sized from with the margin strategy
+	TargetUtilization  float64       // Target request utilization percentage for the utilization strategy
+	IgnoreContainers   []string      // Container names or prefixes excluded from settings and metrics
+	ContainerImage     string        // Only containers whose image matches this substring or glob are sized (empty for all)
+	CombineContainers  string        // How the usage of a pod's remaining containers is combined: sum, max, or avg
+	LabelKey           string        // Label a target name or URL host is matched against to find its pods
+	ThrottleAware      bool          // Raise the CPU limit when usage is pinned at the current limit
+	MaxDownsize        float64       // Maximum percentage a request may drop below the current one per run (0 disables)
+	SkipIfWithin       float64       // Generate no patch if every value is within this percentage of the current one (0 disables)
+	NeverDownsize      bool          // Never recommend less than a current request or limit
+	ProbeAware         bool          // Keep CPU limit headroom for the workload's liveness and startup probes
+	MaxLimitRatio      float64       // Maximum memory limit as a multiple of the memory request (0 disables)
+	MemoryPeakSamples  int           // Samples that must reach a memory level for it to count as the peak
+	MaxCPU             float64       // Policy cap in cores no CPU value is recommended above (0 disables)
+	MaxMemory          float64       // Policy cap in Mi no memory value is recommended above (0 disables)
+	WarnMissingLimits  bool          // Report targeted containers without CPU or memory requests or limits
+	CollectNodeMetrics bool          // Sample the nodes hosting the target pods to detect node pressure
+	AppMetricsURL      string        // Prometheus endpoint of the application scraped for heap and GC metrics (empty disables)
+	HistoryFile        string        // Path of a history file each run appends its recommendation to (empty disables)
+	HistoryDecay       float64       // Blend the recommendation with earlier runs in the history file with this decay (0 disables)
+	PostHook           string        // Shell command run once the results are written (empty disables)
+	RecencyLinear      bool          // Weight samples linearly toward recent ones when averaging
+	RecencyDecay       float64       // Exponential decay per older sample when averaging (0 weights samples equally)
+	Iterations         int           // Number of load test runs whose samples are combined
+	Cooldown           time.Duration // Pause between iterations
+	ObserveAfter       time.Duration // How long metrics collection continues after the load stops
+	ExplicitFlags      map[string]bool
+	LoadTestOptions    loadtest.Options
+	Targets            []targetMapping // Independent targets load tested in parallel (empty for a single target)
+	SortBy             string          // Key the results of several targets are ordered by (empty keeps the services file order)
+	SortAscending      bool            // Order the results of several targets smallest first
+	Environments       []targetMapping // The same service in two namespaces, sized in turn and compared (empty disables)
+
+	// Probes found for ProbeAware, set once they are read from the cluster
+	Probes *kubernetes.ProbeSettings
+
+	// Writer for SaveLoadResults, set once the file is opened
+	LoadResults *loadtest.ResultWriter
+}
+
+// Exit codes for failure categories that automation may want to tell apart
+const (
+	exitFailure            = 1 // Any other error
+	exitClusterUnreachable = 3 // The Kubernetes API server couldn't be reached
+	exitMetricsUnavailable = 4 // metrics-server is missing or reported no metrics for the pods
+	exitNoPods             = 5 // No pods match the target
+	exitTargetUnreachable  = 6 // The load test target never responded
+	exitServiceUnavailable = 7 // Fail-fast aborted the load test on a low success rate
+)
+
+// exitCode returns the process exit code for the category of err
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, kubernetes.ErrClusterUnreachable):
+		return exitClusterUnreachable
+	case errors.Is(err, kubernetes.ErrMetricsUnavailable), errors.Is(err, kubernetes.ErrNoMetrics):
+		return exitMetricsUnavailable
+	case errors.Is(err, kubernetes.ErrNoPodsFound), errors.Is(err, kubernetes.ErrScaledToZero):
+		return exitNoPods
+	case errors.Is(err, loadtest.ErrTargetUnreachable):
+		return exitTargetUnreachable
+	case errors.Is(err, loadtest.ErrServiceUnavailable):
+		return exitServiceUnavailable
+	default:
+		return exitFailure
+	}
+}
+
+// stringList is a flag value that collects every occurrence of a repeatable flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// recommenderOptions builds the recommender options from the CLI configuration
+func (cfg Config) recommenderOptions() recommender.Options {
+	return recommender.Options{
+		Strategy:          cfg.Strategy,
+		Margin:            cfg.Margin,
+		AdaptiveMargin:    cfg.AdaptiveMargin,
+		MinMargin:         cfg.MinMargin,
+		MaxMargin:         cfg.MaxMargin,
+		RequestsOnly:      cfg.RequestsOnly,
+		ColdStartWindow:   cfg.ColdStart,
+		Percentile:        cfg.Percentile,
+		CPURequestStat:    cfg.CPURequestStat,
+		MemoryRequestStat: cfg.MemoryRequestStat,
+		TargetUtilization: cfg.TargetUtilization,
+		HPAHeadroom:       cfg.HPAHeadroom,
+		ThrottleAware:     cfg.ThrottleAware,
+		MaxDownsize:       cfg.MaxDownsize,
+		NeverDownsize:     cfg.NeverDownsize,
+		ProbeAware:        cfg.Probes != nil,
+		MaxLimitRatio:     cfg.MaxLimitRatio,
+		MemoryPeakSamples: cfg.MemoryPeakSamples,
+		MaxCPU:            cfg.MaxCPU,
+		MaxMemory:         cfg.MaxMemory,
+		RecencyLinear:     cfg.RecencyLinear,
+		RecencyDecay:      cfg.RecencyDecay,
+	}
+}
+
+// podOptions builds the recommender options with the per-pod samples the pod-peak strategy sizes
+// from, smoothed into the same time buckets as the other samples
+func (cfg Config) podOptions(podSamples map[string][]metrics.ResourceMetrics) recommender.Options {
+	opts := cfg.recommenderOptions()
+	if len(podSamples) == 0 {
+		return opts
+	}
+
+	opts.PodSamples = make(map[string][]metrics.ResourceMetrics, len(podSamples))
+	for name, samples := range podSamples {
+		if cfg.AggregateWindow > 0 {
+			if bucketed, err := metrics.BucketMetrics(samples, cfg.AggregateWindow, cfg.AggregateFunc); err == nil {
+				samples = bucketed
+			}
+		}
+		opts.PodSamples[name] = samples
+	}
+	return opts
+}
+
+// historyOptions adds the earlier recommendations of the service in the history file to opts, to
+// blend the recommendation with for --history-decay
+func (cfg Config) historyOptions(opts recommender.Options) recommender.Options {
+	if cfg.HistoryDecay == 0 {
+		return opts
+	}
+
+	records, err := output.ReadHistory(cfg.HistoryFile, cfg.Namespace, cfg.ServiceName)
+	if err != nil {
+		fmt.Printf("Note: could not read earlier runs to blend with: %v\n", err)
+		return opts
+	}
+	for _, record := range records {
+		opts.History = append(opts.History, record.Recommendation())
+	}
+	opts.HistoryDecay = cfg.HistoryDecay
+	return opts
 }
 
 func main() {
@@ -47,29 +241,397 @@ func main() {
 		cancel()
 	}()
 
+	// Only the load generator runs, e.g. against an endpoint outside any cluster
+	if cfg.LoadTestOnly {
+		runLoadTestOnly(ctx, cfg)
+		return
+	}
+
 	// Initialize Kubernetes client
 	k8sClient, err := kubernetes.NewClient(cfg.KubeconfigPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing Kubernetes client: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 
+	k8sClient.SetIgnoredContainers(cfg.IgnoreContainers)
+	k8sClient.SetContainerAggregation(cfg.CombineContainers)
+	k8sClient.SetLabelKey(cfg.LabelKey)
+	if cfg.ExplainSelector {
+		k8sClient.SetTrace(os.Stderr)
+	}
+
+	// Without metrics-server a single target still gets its current settings and a load test
+	// report, while the modes that only compare recommendations can't run at all
+	if err := k8sClient.MetricsError(); err != nil {
+		if len(cfg.Targets) > 0 || len(cfg.Environments) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v; only the current settings and the load test will be reported\n", err)
+	}
+
+	// Several independent services are sized concurrently, each with its own load and recommendation
+	if len(cfg.Targets) > 0 {
+		runTargets(ctx, cfg, k8sClient)
+		return
+	}
+
+	// The same service in two namespaces is sized under the same load and compared
+	if len(cfg.Environments) > 0 {
+		runEnvironments(ctx, cfg, k8sClient)
+		return
+	}
+
+	// A bare service name as target is resolved to the Service's actual in-cluster URL
+	if isServiceTarget(cfg) {
+		resolveServiceTarget(ctx, &cfg, k8sClient)
+	}
+
+	if cfg.PrintSelector {
+		printSelector(cfg, k8sClient)
+	}
+
+	// Measure only the pods of one ReplicaSet, e.g. the new version during a canary
+	if cfg.PodTemplateHash != "" {
+		selectRevision(ctx, cfg, k8sClient)
+	}
+
+	// Size the containers running an image, whatever their names
+	if cfg.ContainerImage != "" {
+		selectContainersByImage(ctx, cfg, k8sClient)
+	}
+
+	// Scale the load to the size of the Deployment before it is planned or generated
+	if cfg.RPSPerReplica {
+		if err := scaleRPSToReplicas(ctx, &cfg, k8sClient); err != nil {
+			fmt.Fprintf(os.Stderr, "Error scaling --rps to the replica count: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+	}
+
+	if cfg.Plan {
+		printPlan(ctx, cfg, k8sClient)
+		return
+	}
+
+	// Apply per-workload policy annotations as defaults for flags that weren't set explicitly
+	applyWorkloadPolicy(ctx, &cfg, k8sClient)
+
 	// Get initial resource settings to compare against
 	fmt.Println("Fetching current resource settings...")
-	currentSettings, err := k8sClient.GetResourceSettings(ctx, cfg.Namespace, cfg.ServiceName)
+	currentSettings, err := readCurrentSettings(ctx, cfg, k8sClient)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error getting current resource settings: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
+	}
+	if len(currentSettings.IgnoredContainers) > 0 {
+		fmt.Printf("Ignoring sidecar containers: %s\n", strings.Join(currentSettings.IgnoredContainers, ", "))
+	}
+
+	missingLimits, limitsAudited := auditLimits(ctx, cfg, k8sClient)
+	cfg.Probes = readProbes(ctx, cfg, k8sClient)
+
+	// A broad selector can match several Deployments, which are then sized separately
+	deploymentPods, err := k8sClient.GroupPodsByDeployment(ctx, cfg.Namespace, cfg.ServiceName)
+	if err != nil {
+		fmt.Printf("Note: could not group pods by Deployment: %v\n", err)
+	}
+	if len(deploymentPods) > 1 {
+		fmt.Printf("Warning: '%s' matches pods of %d Deployments (%s); each is sized separately\n",
+			cfg.ServiceName, len(deploymentPods), strings.Join(sortedNames(deploymentPods), ", "))
+	} else {
+		deploymentPods = nil
+	}
+
+	// Each of several Deployments has its own settings, so divergence is only checked within one
+	var divergence *kubernetes.SettingsDivergence
+	if deploymentPods == nil {
+		divergence = readDivergence(ctx, cfg, k8sClient)
 	}
 
+	containers := podContainers(ctx, cfg, k8sClient)
+
 	// Initialize metrics collector
 	fmt.Printf("Initializing metrics collector for service '%s' in namespace '%s'...\n",
 		cfg.ServiceName, cfg.Namespace)
 	metricsCollector := metrics.NewCollector(k8sClient, cfg.Namespace, cfg.ServiceName)
 
+	// Forward a local port to a target pod and load test through it if requested
+	if cfg.AutoPortForward {
+		target, stop, err := startPortForward(ctx, cfg, k8sClient)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error setting up port forward: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+		defer stop()
+		fmt.Printf("Load test target rewritten to %s\n", target)
+		cfg.Target = target
+		cfg.LoadTestOptions.TargetPort = 0 // The forwarded local port replaces it
+	}
+
 	// Initialize load tester
 	fmt.Println("Initializing load test...")
-	loadTester := loadtest.NewTester(cfg.Target, cfg.RPS, cfg.Concurrency)
+	openLoadResults(&cfg)
+	loadTester := newLoadTester(cfg)
+	if err := probeTarget(ctx, cfg, loadTester); err != nil {
+		closeLoadResults(cfg)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+
+	// Recommendations are only generated from measured usage
+	if err := k8sClient.MetricsError(); err != nil {
+		reportWithoutMetrics(ctx, cfg, loadTester, currentSettings, divergence, missingLimits, limitsAudited, err)
+		return
+	}
+
+	// Run the load test and collect metrics, repeating with a cooldown if requested
+	var iterations []iteration
+	for i := 1; i <= cfg.Iterations; i++ {
+		if cfg.Iterations > 1 {
+			fmt.Printf("\n===== Iteration %d/%d =====\n", i, cfg.Iterations)
+		}
+
+		it := runIteration(ctx, cfg, loadTester, metricsCollector, currentSettings, deploymentPods, containers)
+		if it.failed != nil {
+			fmt.Fprintf(os.Stderr, "Load test failed: %v. No recommendation is made from a failing service.\n", it.failed)
+			os.Exit(exitCode(it.failed))
+		}
+		if it.uncovered != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v (--require-metrics-for-all-pods). No recommendation is made from a subset of the pods.\n", it.uncovered)
+			os.Exit(exitCode(it.uncovered))
+		}
+		iterations = append(iterations, it)
+		if !it.finished || ctx.Err() != nil {
+			break
+		}
+
+		if i < cfg.Iterations && cfg.Cooldown > 0 {
+			fmt.Printf("Cooling down for %s before the next iteration...\n", cfg.Cooldown)
+			select {
+			case <-time.After(cfg.Cooldown):
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	closeLoadResults(cfg)
+	saveLatencyHistogram(cfg, mergedLoadTest(iterations))
+
+	// Combine the samples of all iterations
+	var allMetrics []metrics.ResourceMetrics
+	groupedMetrics := make(map[string][]metrics.ResourceMetrics)
+	containerMetrics := make(map[string][]metrics.ResourceMetrics)
+	podMetrics := make(map[string][]metrics.ResourceMetrics)
+	containerPodMetrics := make(map[string]map[string][]metrics.ResourceMetrics)
+	var nodeSamples []metrics.NodeMetrics
+	var appSamples []metrics.AppMetrics
+	duplicates, partial := 0, 0
+	for _, it := range iterations {
+		duplicates += it.duplicates
+		partial += it.partial
+		allMetrics = append(allMetrics, it.metrics...)
+		for name, samples := range it.groupedMetrics {
+			groupedMetrics[name] = append(groupedMetrics[name], samples...)
+		}
+		for name, samples := range it.perContainer {
+			containerMetrics[name] = append(containerMetrics[name], samples...)
+		}
+		for name, samples := range it.perPod {
+			podMetrics[name] = append(podMetrics[name], samples...)
+		}
+		for name, pods := range it.perContainerPod {
+			if containerPodMetrics[name] == nil {
+				containerPodMetrics[name] = make(map[string][]metrics.ResourceMetrics)
+			}
+			for pod, samples := range pods {
+				containerPodMetrics[name][pod] = append(containerPodMetrics[name][pod], samples...)
+			}
+		}
+		nodeSamples = append(nodeSamples, it.nodeSamples...)
+		appSamples = append(appSamples, it.appSamples...)
+	}
+
+	// Generate recommendations based on collected metrics
+	if len(allMetrics) == 0 {
+		fmt.Fprintf(os.Stderr, "No metrics collected. Cannot generate recommendations.\n")
+		os.Exit(exitMetricsUnavailable)
+	}
+
+	// Smooth the raw samples into fixed time buckets if requested
+	if cfg.AggregateWindow > 0 {
+		bucketed, err := metrics.BucketMetrics(allMetrics, cfg.AggregateWindow, cfg.AggregateFunc)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error aggregating metrics: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Aggregated %d samples into %d buckets of %s (%s)\n",
+			len(allMetrics), len(bucketed), cfg.AggregateWindow, cfg.AggregateFunc)
+		allMetrics = bucketed
+	}
+
+	fmt.Println("Analyzing metrics and generating recommendations...")
+	if cfg.Strategy == recommender.PodPeakStrategyName {
+		fmt.Printf("Sizing requests from the p%g of the peak usage of %d pods\n", cfg.Percentile, len(podMetrics))
+	}
+	recommendations, err := recommender.Generate(allMetrics, currentSettings, cfg.historyOptions(cfg.podOptions(podMetrics)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating recommendations: %v\n", err)
+		os.Exit(1)
+	}
+
+	omitCPULimit, omitMemoryLimit := omitLimits(cfg, currentSettings)
+
+	// Output results
+	result := output.Result{
+		Target:          cfg.Target,
+		ServiceName:     cfg.ServiceName,
+		Namespace:       cfg.Namespace,
+		Duration:        cfg.Duration,
+		RPS:             cfg.RPS,
+		Replicas:        cfg.Replicas,
+		CurrentSettings: currentSettings,
+		Metrics:         allMetrics,
+		Duplicates:      duplicates,
+		Partial:         partial,
+		Recommendations: recommendations,
+		LoadTest:        mergedLoadTest(iterations),
+		Deployment:      patchDeployment(cfg),
+		HelmValuesPath:  cfg.HelmValuesPath,
+		Color:           output.ColorEnabled(cfg.Color),
+		CompactJSON:     cfg.CompactJSON,
+		OmitCPULimit:    omitCPULimit,
+		OmitMemoryLimit: omitMemoryLimit,
+		Workloads:       workloadResults(ctx, cfg, k8sClient, deploymentPods, groupedMetrics, podMetrics),
+		Containers:      containerResults(cfg, containers, containerMetrics, containerPodMetrics),
+		Nodes:           metrics.SummarizeNodes(nodeSamples),
+		App:             metrics.SummarizeApp(appSamples),
+		Iterations:      iterationResults(cfg, iterations, currentSettings),
+		LimitsAudited:   limitsAudited,
+		MissingLimits:   missingLimits,
+		Divergence:      divergence,
+		Probes:          cfg.Probes,
+		SkipIfWithin:    cfg.SkipIfWithin,
+	}
+
+	if cfg.ColdStart > 0 && recommendations.ColdStart == nil {
+		fmt.Printf("Note: no samples were taken after the --measure-cold-start window of %s; all of them were sized as steady state.\n", cfg.ColdStart)
+	}
+	if result.OmitCPULimit && !cfg.NoCPULimit {
+		fmt.Println("Note: the workload has no CPU limit; the patch preserves that (use --force-limits to set one).")
+	}
+	if result.OmitMemoryLimit {
+		fmt.Println("Note: the workload has no memory limit; the patch preserves that (use --force-limits to set one).")
+	}
+
+	if cfg.CompareAlgos {
+		result.Comparisons = recommender.CompareAlgorithms(allMetrics, currentSettings, cfg.recommenderOptions())
+	}
+
+	if cfg.CompareWithVPA {
+		result.VPA = readVPA(ctx, cfg, k8sClient)
+	}
+
+	if cfg.HPAHeadroom > 0 {
+		result.HPA = readHPA(ctx, cfg, k8sClient)
+	}
+
+	if cfg.ValidatePatch && !result.Unchanged() {
+		validatePatches(ctx, cfg, k8sClient, &result)
+	}
+
+	output.PrintResults(os.Stdout, output.DiskFiles{}, result, cfg.OutputFormat)
+
+	if cfg.SaveResult != "" {
+		if err := output.SaveResult(cfg.SaveResult, result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving result: %v\n", err)
+		} else {
+			fmt.Printf("Full result saved to '%s'\n", cfg.SaveResult)
+		}
+	}
+
+	if cfg.HistoryFile != "" {
+		if err := output.AppendHistory(cfg.HistoryFile, result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error appending to history: %v\n", err)
+		} else {
+			fmt.Printf("Recommendation appended to history '%s'\n", cfg.HistoryFile)
+		}
+	}
+
+	hookFailed := cfg.PostHook != "" && !runPostHook(ctx, cfg.PostHook, result, cfg.OutputFormat)
+
+	if cfg.MetricsListen != "" {
+		serveMetrics(result, cfg.MetricsListen, cfg.MetricsServeFor)
+	}
+
+	if hookFailed {
+		os.Exit(exitFailure)
+	}
+}
+
+// isServiceTarget reports whether the target is the bare name of the --service-name Service,
+// either given as both or defaulted from one another, rather than a host of its own such as
+// api.internal that must be load tested as given
+func isServiceTarget(cfg Config) bool {
+	return cfg.Target == cfg.ServiceName && !strings.Contains(cfg.Target, ":") && !strings.Contains(cfg.ServiceName, "=")
+}
+
+// resolveServiceTarget replaces the target with the in-cluster URL of the Service named by
+// --service-name, including its port and scheme. The target is left unchanged if the Service
+// can't be read.
+func resolveServiceTarget(ctx context.Context, cfg *Config, k8sClient *kubernetes.Client) {
+	endpoint, err := k8sClient.GetServiceEndpoint(ctx, cfg.Namespace, cfg.ServiceName)
+	if err != nil {
+		fmt.Printf("Note: could not discover the port of Service %s, using target '%s': %v\n",
+			cfg.ServiceName, cfg.Target, err)
+		return
+	}
+
+	fmt.Printf("Resolved target '%s' to %s from Service %s\n", cfg.Target, endpoint.URL, cfg.ServiceName)
+	cfg.Target = endpoint.URL
+
+	// Port-forwarding goes to the pod, so it needs the container port behind the Service port
+	if cfg.RemotePort == 0 && endpoint.TargetPort > 0 {
+		cfg.RemotePort = endpoint.TargetPort
+	}
+}
+
+// iteration holds the samples and load test statistics collected by one load test run
+type iteration struct {
+	metrics         []metrics.ResourceMetrics
+	groupedMetrics  map[string][]metrics.ResourceMetrics            // Per-Deployment samples when the selector matched several
+	perContainer    map[string][]metrics.ResourceMetrics            // Per-container samples when the pod runs several containers
+	perPod          map[string][]metrics.ResourceMetrics            // Per-pod samples for the pod-peak strategy
+	perContainerPod map[string]map[string][]metrics.ResourceMetrics // Per-pod samples of each container for the pod-peak strategy
+	nodeSamples     []metrics.NodeMetrics
+	appSamples      []metrics.AppMetrics
+	duplicates      int // Samples collapsed because metrics-server hadn't refreshed between them
+	partial         int // Samples metrics-server reported for far fewer pods than were running
+	loadTest        *loadtest.Metrics
+	finished        bool
+	failed          error // Set if the service failed or never responded, so the samples must not be used
+	uncovered       error // Set if a sample lacked metrics for more pods than --require-metrics-for-all-pods allows
+}
+
+// runIteration runs the load test once while collecting metrics, and keeps collecting for a
+// short grace period afterwards
+func runIteration(
+	ctx context.Context,
+	cfg Config,
+	loadTester *loadtest.Tester,
+	metricsCollector *metrics.Collector,
+	currentSettings kubernetes.ResourceSettings,
+	deploymentPods map[string][]string,
+	containers []kubernetes.ContainerSettings,
+) iteration {
+	// Metrics collection stops shortly after the load test, independently of the parent context
+	collectCtx, stopCollecting := context.WithCancel(ctx)
+	defer stopCollecting()
+
+	var it iteration
+	grouped, byContainer, byPod := metrics.NewAggregator(), metrics.NewAggregator(), metrics.NewAggregator()
+	byContainerPod := metrics.NewAggregator()
 
 	// Run load test and collect metrics
 	fmt.Printf("Starting load test (%d RPS for %s)...\n", cfg.RPS, cfg.Duration)
@@ -78,19 +640,104 @@ func main() {
 	// Start metrics collection in a goroutine
 	go func() {
 		defer close(metricsChan)
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
+		appErrReported := false
+		ticks := metrics.NewSchedule(metrics.DefaultSampleInterval, cfg.SampleJitter, cfg.LoadTestOptions.Seed).Ticks(collectCtx)
 
 		for {
 			select {
-			case <-ctx.Done():
+			case <-collectCtx.Done():
 				return
-			case <-ticker.C:
-				m, err := metricsCollector.CollectMetrics(ctx)
+			case <-ticks:
+				m, err := metricsCollector.CollectMetrics(collectCtx)
+				if err != nil && collectCtx.Err() != nil {
+					return
+				}
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "Error collecting metrics: %v\n", err)
+					// A failed or empty sample has metrics for none of the pods
+					if cfg.RequiredCoverage > 0 && it.uncovered == nil {
+						it.uncovered = err
+						if !errors.Is(err, kubernetes.ErrNoMetrics) {
+							it.uncovered = fmt.Errorf("%w: %v", kubernetes.ErrNoMetrics, err)
+						}
+					}
 					continue
 				}
+
+				// A throttled or truncated metrics response can miss replicas without an error
+				if coverage, err := metricsCollector.Coverage(collectCtx); err == nil {
+					if coverage.Partial() {
+						fmt.Fprintf(os.Stderr, "Warning: metrics-server reported %d of %d running pods; this sample may be partial\n",
+							coverage.Reported, coverage.Running)
+						it.partial++
+					}
+					if cfg.RequiredCoverage > 0 && it.uncovered == nil {
+						it.uncovered = coverage.Require(cfg.RequiredCoverage)
+					}
+				}
+
+				if deploymentPods != nil {
+					samples, err := metricsCollector.CollectGroupedMetrics(collectCtx, deploymentPods)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error collecting per-Deployment metrics: %v\n", err)
+					}
+					for name, gm := range samples {
+						grouped.Add(name, gm)
+					}
+				}
+
+				if containers != nil {
+					samples, err := metricsCollector.CollectContainerMetrics(collectCtx)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error collecting per-container metrics: %v\n", err)
+					}
+					for name, cm := range samples {
+						byContainer.Add(name, cm)
+					}
+				}
+
+				// Pod-peak sizes each container from its busiest pod rather than its average
+				if containers != nil && cfg.Strategy == recommender.PodPeakStrategyName {
+					samples, err := metricsCollector.CollectPodContainerMetrics(collectCtx)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error collecting per-pod container metrics: %v\n", err)
+					}
+					for name, pods := range samples {
+						for pod, pm := range pods {
+							byContainerPod.Add(containerPodKey(name, pod), pm)
+						}
+					}
+				}
+
+				if cfg.Strategy == recommender.PodPeakStrategyName {
+					samples, err := metricsCollector.CollectPodMetrics(collectCtx)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error collecting per-pod metrics: %v\n", err)
+					}
+					for name, pm := range samples {
+						byPod.Add(name, pm)
+					}
+				}
+
+				if cfg.CollectNodeMetrics {
+					nodes, err := metricsCollector.CollectNodeMetrics(collectCtx)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error collecting node metrics: %v\n", err)
+					}
+					it.nodeSamples = append(it.nodeSamples, nodes...)
+				}
+
+				// The application endpoint is optional, so a missing one is only reported once
+				if cfg.AppMetricsURL != "" {
+					app, err := metrics.ScrapeAppMetrics(collectCtx, cfg.AppMetricsURL)
+					if err != nil && !appErrReported {
+						fmt.Fprintf(os.Stderr, "Note: could not scrape application metrics from %s: %v\n", cfg.AppMetricsURL, err)
+						appErrReported = true
+					} else if err == nil {
+						it.appSamples = append(it.appSamples, app)
+					}
+				}
+
 				metricsChan <- m
 			}
 		}
@@ -108,7 +755,6 @@ func main() {
 	}()
 
 	// Collect all metrics during the test
-	var allMetrics []metrics.ResourceMetrics
 	metricsCollectionDone := make(chan struct{})
 
 	wg.Add(1)
@@ -116,30 +762,44 @@ func main() {
 		defer wg.Done()
 		defer close(metricsCollectionDone)
 
+		lastPreview := time.Now()
 		for m := range metricsChan {
-			allMetrics = append(allMetrics, m)
-			fmt.Printf("Collected metrics - CPU: %.1fm, Memory: %.1fMi\n", m.CPUUsage*1000, m.MemoryUsage)
+			it.metrics = append(it.metrics, m)
+			if !cfg.SummaryOnly {
+				fmt.Printf("Collected metrics - CPU: %.1fm, Memory: %.1fMi\n", m.CPUUsage*1000, m.MemoryUsage)
+			}
+
+			// Periodically print an advisory recommendation based on the samples so far
+			if cfg.PreviewInterval > 0 && time.Since(lastPreview) >= cfg.PreviewInterval {
+				lastPreview = time.Now()
+				printPreview(it.metrics, currentSettings, cfg.recommenderOptions())
+			}
 		}
 	}()
 
 	// Wait for load test to complete or context cancellation
-	loadTestFinished := false
 	select {
 	case err := <-resultChan:
-		loadTestFinished = true
-		if err != nil {
+		it.finished = true
+		if errors.Is(err, loadtest.ErrServiceUnavailable) || errors.Is(err, loadtest.ErrTargetUnreachable) {
+			it.failed = err
+		} else if err != nil {
 			fmt.Fprintf(os.Stderr, "Load test failed: %v\n", err)
 		} else {
 			fmt.Println("Load test completed successfully.")
 		}
 
-		// Allow final metrics to be collected
-		select {
-		case <-time.After(5 * time.Second):
-		case <-ctx.Done():
+		// Keep collecting after the load stops to capture the post-load baseline, e.g. memory
+		// settling after GC, unless the samples are discarded anyway
+		if it.failed == nil && cfg.ObserveAfter > 0 {
+			fmt.Printf("Observing for %s after the load test...\n", cfg.ObserveAfter)
+			select {
+			case <-time.After(cfg.ObserveAfter):
+			case <-ctx.Done():
+			}
 		}
 
-		cancel() // Stop metrics collection
+		stopCollecting()
 	case <-ctx.Done():
 		fmt.Println("Operation was cancelled.")
 	}
@@ -151,80 +811,1405 @@ func main() {
 	wg.Wait()
 
 	// Handle case where load test was cancelled
-	if !loadTestFinished {
+	if !it.finished {
 		fmt.Println("Load test did not complete properly.")
 	}
 
-	// Generate recommendations based on collected metrics
-	if len(allMetrics) == 0 {
-		fmt.Fprintf(os.Stderr, "No metrics collected. Cannot generate recommendations.\n")
-		os.Exit(1)
+	it.groupedMetrics, it.perContainer, it.perPod = grouped.Snapshot(), byContainer.Snapshot(), byPod.Snapshot()
+	it.perContainerPod = splitContainerPods(byContainerPod.Snapshot())
+
+	// A reading repeated until metrics-server's next scrape would otherwise count several times
+	if cfg.DedupSamples {
+		it.metrics, it.duplicates = metrics.DedupMetrics(it.metrics)
+		for name, samples := range it.groupedMetrics {
+			it.groupedMetrics[name], _ = metrics.DedupMetrics(samples)
+		}
+		for name, samples := range it.perContainer {
+			it.perContainer[name], _ = metrics.DedupMetrics(samples)
+		}
+		for name, samples := range it.perPod {
+			it.perPod[name], _ = metrics.DedupMetrics(samples)
+		}
+		for _, pods := range it.perContainerPod {
+			for pod, samples := range pods {
+				pods[pod], _ = metrics.DedupMetrics(samples)
+			}
+		}
+		if it.duplicates > 0 {
+			fmt.Printf("Collapsed %d duplicate samples repeating an earlier metrics-server scrape\n", it.duplicates)
+		}
 	}
 
-	fmt.Println("Analyzing metrics and generating recommendations...")
-	recommendations := recommender.GenerateRecommendations(allMetrics, currentSettings, cfg.Margin)
+	it.loadTest = loadTester.Metrics()
+	return it
+}
 
-	// Output results
-	result := output.Result{
-		Target:          cfg.Target,
-		ServiceName:     cfg.ServiceName,
-		Namespace:       cfg.Namespace,
-		Duration:        cfg.Duration,
-		RPS:             cfg.RPS,
-		CurrentSettings: currentSettings,
-		Metrics:         allMetrics,
-		Recommendations: recommendations,
+// mergedLoadTest combines the load test metrics of every iteration
+func mergedLoadTest(iterations []iteration) *loadtest.Metrics {
+	runs := make([]*loadtest.Metrics, 0, len(iterations))
+	for _, it := range iterations {
+		runs = append(runs, it.loadTest)
 	}
-
-	output.PrintResults(result, cfg.OutputFormat)
+	return loadtest.MergeMetrics(runs...)
 }
 
-func parseFlags() Config {
-	var (
-		target         = flag.String("target", "", "Target service URL or identifier for load testing")
-		serviceName    = flag.String("service-name", "", "Kubernetes service name for metrics collection (defaults to target if not specified)")
-		namespace      = flag.String("namespace", "default", "Kubernetes namespace")
-		durationStr    = flag.String("duration", "5m", "Duration of the load test")
-		rps            = flag.Int("rps", 50, "Requests per second for load testing")
-		concurrency    = flag.Int("concurrency", 0, "Alternative to RPS, number of concurrent connections")
-		margin         = flag.Int("margin", 20, "Safety margin percentage to add to recommendations")
-		outputFormat   = flag.String("output-format", "text", "Output format: text, json, or yaml")
-		kubeconfigPath = flag.String("kubeconfig", "", "Path to kubeconfig file for external cluster access")
-	)
+// iterationResults sizes each iteration on its own samples so run-to-run variance is visible.
+// It returns nil for a single iteration.
+func iterationResults(cfg Config, iterations []iteration, currentSettings kubernetes.ResourceSettings) []output.IterationResult {
+	if len(iterations) < 2 {
+		return nil
+	}
 
-	flag.Parse()
+	var results []output.IterationResult
+	for i, it := range iterations {
+		samples := it.metrics
+		if cfg.AggregateWindow > 0 {
+			if bucketed, err := metrics.BucketMetrics(samples, cfg.AggregateWindow, cfg.AggregateFunc); err == nil {
+				samples = bucketed
+			}
+		}
+		if len(samples) == 0 {
+			continue
+		}
 
-	if *target == "" {
-		_, err := fmt.Fprintf(os.Stderr, "Error: --target parameter is required\n")
+		recommendations, err := recommender.Generate(samples, currentSettings, cfg.podOptions(it.perPod))
 		if err != nil {
-			return Config{}
+			continue
 		}
-		flag.Usage()
-		os.Exit(1)
+
+		results = append(results, output.IterationResult{
+			Iteration:       i + 1,
+			Samples:         len(samples),
+			Recommendations: recommendations,
+			LoadTest:        it.loadTest,
+		})
 	}
+	return results
+}
 
-	if *outputFormat != "text" && *outputFormat != "json" && *outputFormat != "yaml" {
-		_, err := fmt.Fprintf(os.Stderr, "Error: --output-format must be one of: text, json, yaml\n")
+// omitLimits reports whether the CPU and memory limits are left out of generated patches.
+// A "no limit" policy is preserved unless the user forces limits.
+func omitLimits(cfg Config, settings kubernetes.ResourceSettings) (bool, bool) {
+	omitCPULimit := cfg.NoCPULimit || (!settings.HasCPULimit && !cfg.ForceLimits)
+	omitMemoryLimit := !settings.HasMemoryLimit && !cfg.ForceLimits
+	return omitCPULimit, omitMemoryLimit
+}
+
+// workloadResults sizes each Deployment from the samples of its own pods, using the resource
+// settings of its first pod as the current settings
+func workloadResults(
+	ctx context.Context,
+	cfg Config,
+	k8sClient *kubernetes.Client,
+	deploymentPods map[string][]string,
+	groupedMetrics map[string][]metrics.ResourceMetrics,
+	podMetrics map[string][]metrics.ResourceMetrics,
+) []output.WorkloadResult {
+	var workloads []output.WorkloadResult
+	for _, name := range sortedNames(deploymentPods) {
+		samples := groupedMetrics[name]
+		if len(samples) == 0 {
+			fmt.Printf("Note: no metrics collected for Deployment %s, skipping it\n", name)
+			continue
+		}
+
+		settings, err := k8sClient.GetPodResourceSettings(ctx, cfg.Namespace, deploymentPods[name][0])
 		if err != nil {
-			return Config{}
+			fmt.Printf("Note: could not read resource settings of Deployment %s, skipping it: %v\n", name, err)
+			continue
 		}
-		flag.Usage()
-		os.Exit(1)
-	}
 
-	duration, err := time.ParseDuration(*durationStr)
-	if err != nil {
-		_, err := fmt.Fprintf(os.Stderr, "Error: invalid duration format: %v\n", err)
+		if cfg.AggregateWindow > 0 {
+			if bucketed, err := metrics.BucketMetrics(samples, cfg.AggregateWindow, cfg.AggregateFunc); err == nil {
+				samples = bucketed
+			}
+		}
+
+		ownPods := make(map[string][]metrics.ResourceMetrics)
+		for _, pod := range deploymentPods[name] {
+			if podSamples, ok := podMetrics[pod]; ok {
+				ownPods[pod] = podSamples
+			}
+		}
+
+		recommendations, err := recommender.Generate(samples, settings, cfg.podOptions(ownPods))
 		if err != nil {
-			return Config{}
+			fmt.Printf("Note: could not size Deployment %s, skipping it: %v\n", name, err)
+			continue
+		}
+
+		omitCPULimit, omitMemoryLimit := omitLimits(cfg, settings)
+		workloads = append(workloads, output.WorkloadResult{
+			Deployment:      name,
+			CurrentSettings: settings,
+			Metrics:         samples,
+			Recommendations: recommendations,
+			OmitCPULimit:    omitCPULimit,
+			OmitMemoryLimit: omitMemoryLimit,
+		})
+	}
+	return workloads
+}
+
+// podContainers returns the settings of the target pod's containers if it runs several that
+// aren't ignored, so each is sized and patched on its own. It returns nil for a single container.
+func podContainers(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) []kubernetes.ContainerSettings {
+	containers, err := k8sClient.GetContainerSettings(ctx, cfg.Namespace, cfg.ServiceName)
+	if err != nil {
+		fmt.Printf("Note: could not read the pod's containers, sizing the pod as a whole: %v\n", err)
+		return nil
+	}
+	if len(containers) < 2 {
+		return nil
+	}
+
+	names := make([]string, 0, len(containers))
+	for _, c := range containers {
+		names = append(names, c.Name)
+	}
+	fmt.Printf("The pod runs %d containers (%s); each is sized separately\n", len(containers), strings.Join(names, ", "))
+	return containers
+}
+
+// containerPodKey joins a container and pod name into one aggregator key; neither can contain "/"
+func containerPodKey(container, pod string) string {
+	return container + "/" + pod
+}
+
+// splitContainerPods splits samples keyed by containerPodKey by container and then by pod
+func splitContainerPods(samples map[string][]metrics.ResourceMetrics) map[string]map[string][]metrics.ResourceMetrics {
+	split := make(map[string]map[string][]metrics.ResourceMetrics)
+	for key, s := range samples {
+		container, pod, _ := strings.Cut(key, "/")
+		if split[container] == nil {
+			split[container] = make(map[string][]metrics.ResourceMetrics)
+		}
+		split[container][pod] = s
+	}
+	return split
+}
+
+// containerResults sizes each container of a multi-container pod from its own samples, and for
+// the pod-peak strategy from the samples of that container in each pod
+func containerResults(
+	cfg Config,
+	containers []kubernetes.ContainerSettings,
+	containerMetrics map[string][]metrics.ResourceMetrics,
+	containerPodMetrics map[string]map[string][]metrics.ResourceMetrics,
+) []output.ContainerResult {
+	var results []output.ContainerResult
+	for _, c := range containers {
+		samples := containerMetrics[c.Name]
+		if len(samples) == 0 {
+			fmt.Printf("Note: no metrics collected for container %s, leaving it out of the patch\n", c.Name)
+			continue
+		}
+
+		if cfg.AggregateWindow > 0 {
+			if bucketed, err := metrics.BucketMetrics(samples, cfg.AggregateWindow, cfg.AggregateFunc); err == nil {
+				samples = bucketed
+			}
+		}
+
+		if cfg.Strategy == recommender.PodPeakStrategyName && len(containerPodMetrics[c.Name]) == 0 {
+			fmt.Printf("Note: no per-pod metrics collected for container %s, sizing it from its average across pods\n", c.Name)
+		}
+
+		recommendations, err := recommender.Generate(samples, c.Settings, cfg.podOptions(containerPodMetrics[c.Name]))
+		if err != nil {
+			fmt.Printf("Note: could not size container %s, leaving it out of the patch: %v\n", c.Name, err)
+			continue
+		}
+
+		omitCPULimit, omitMemoryLimit := omitLimits(cfg, c.Settings)
+		results = append(results, output.ContainerResult{
+			Name:            c.Name,
+			CurrentSettings: c.Settings,
+			Metrics:         samples,
+			Recommendations: recommendations,
+			OmitCPULimit:    omitCPULimit,
+			OmitMemoryLimit: omitMemoryLimit,
+		})
+	}
+	return results
+}
+
+// sortedNames returns the keys of the map in sorted order
+func sortedNames(m map[string][]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// serveMetrics exposes the results on a short-lived /metrics endpoint so a scraper can
+// pick them up before the process exits
+func serveMetrics(result output.Result, addr string, serveFor time.Duration) {
+	content := output.GeneratePrometheusMetrics(result)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, content)
+	})
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	fmt.Printf("Serving results on http://%s/metrics for %s...\n", addr, serveFor)
+
+	stopCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serveErr:
+		fmt.Fprintf(os.Stderr, "Error serving metrics: %v\n", err)
+		return
+	case <-time.After(serveFor):
+	case <-stopCtx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+}
+
+// startPortForward forwards a local port to a pod matching the service and returns the load test
+// target rewritten to go through it, keeping the original scheme, path, and query
+func startPortForward(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) (string, func(), error) {
+	targetURL, err := loadtest.TargetURL(cfg.Target, cfg.LoadTestOptions)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid target: %v", err)
+	}
+
+	remotePort := cfg.RemotePort
+	if remotePort == 0 {
+		if port := targetURL.Port(); port != "" {
+			remotePort, err = strconv.Atoi(port)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid target port %q: %v", port, err)
+			}
+		} else if targetURL.Scheme == "https" {
+			remotePort = 443
+		} else {
+			remotePort = 80
+		}
+	}
+
+	localPort, stop, err := k8sClient.PortForward(ctx, cfg.Namespace, cfg.ServiceName, remotePort)
+	if err != nil {
+		return "", nil, err
+	}
+
+	targetURL.Host = fmt.Sprintf("localhost:%d", localPort)
+	return targetURL.String(), stop, nil
+}
+
+// readCurrentSettings reads the current resource settings from the target's pods. If there are
+// none because the target's Deployment is scaled to zero, it says so with guidance instead of a
+// bare "no pods found", and with --deployment falls back to the settings of the pod template.
+func readCurrentSettings(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) (kubernetes.ResourceSettings, error) {
+	settings, err := k8sClient.GetResourceSettings(ctx, cfg.Namespace, cfg.ServiceName)
+	if !errors.Is(err, kubernetes.ErrNoPodsFound) {
+		return settings, err
+	}
+
+	if cfg.Deployment != "" {
+		deployment, deployErr := k8sClient.GetDeployment(ctx, cfg.Namespace, cfg.Deployment)
+		if deployErr != nil || !kubernetes.ScaledToZero(deployment) {
+			return settings, err
+		}
+		fmt.Printf("Note: Deployment %s is scaled to zero; reading the current settings from its pod template. "+
+			"Usage can only be measured if the load scales it up, e.g. through KEDA or Knative.\n", cfg.Deployment)
+		return k8sClient.GetTemplateResourceSettings(ctx, cfg.Namespace, cfg.Deployment)
+	}
+
+	name, findErr := k8sClient.FindScaledToZero(ctx, cfg.Namespace, cfg.ServiceName)
+	if findErr != nil || name == "" {
+		return settings, err
+	}
+	return settings, fmt.Errorf("%w: deployment %s has no pods to measure; scale it up first "+
+		"(kubectl scale deployment/%s -n %s --replicas=1), or pass --deployment %s to read the current settings "+
+		"from its pod template if the load scales it up", kubernetes.ErrScaledToZero, name, name, cfg.Namespace, name)
+}
+
+// patchDeployment returns the name of the Deployment the patch targets: --deployment if given,
+// else --resource-name, or "" to guess it from the service name
+func patchDeployment(cfg Config) string {
+	if cfg.Deployment != "" {
+		if cfg.ResourceName != "" && cfg.ResourceName != cfg.Deployment {
+			fmt.Printf("Note: --resource-name %s is ignored; the patch targets the --deployment %s.\n", cfg.ResourceName, cfg.Deployment)
+		}
+		return cfg.Deployment
+	}
+	return cfg.ResourceName
+}
+
+// targetDeployment returns the Deployment named by --deployment, or the one owning the matched pods
+func targetDeployment(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) (*appsv1.Deployment, error) {
+	if cfg.Deployment != "" {
+		return k8sClient.GetDeployment(ctx, cfg.Namespace, cfg.Deployment)
+	}
+	return k8sClient.FindDeployment(ctx, cfg.Namespace, cfg.ServiceName)
+}
+
+// selectRevision restricts the client to the pods of the ReplicaSet selected by --pod-template-hash,
+// resolving "latest" and "previous" from the target Deployment's revisions
+func selectRevision(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) {
+	hash := cfg.PodTemplateHash
+	if hash == kubernetes.RevisionLatest || hash == kubernetes.RevisionPrevious {
+		deployment, err := targetDeployment(ctx, cfg, k8sClient)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving --pod-template-hash %s: %v\n", hash, err)
+			os.Exit(exitCode(err))
+		}
+
+		hash, err = k8sClient.ResolvePodTemplateHash(ctx, deployment, cfg.PodTemplateHash)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving --pod-template-hash %s: %v\n", cfg.PodTemplateHash, err)
+			os.Exit(exitCode(err))
+		}
+		fmt.Printf("Resolved %s revision of deployment %s to pod-template-hash %s\n", cfg.PodTemplateHash, deployment.Name, hash)
+	}
+
+	fmt.Printf("Measuring only pods with %s=%s\n", kubernetes.PodTemplateHashLabel, hash)
+	k8sClient.SetPodTemplateHash(hash)
+}
+
+// selectContainersByImage restricts settings and metrics to the containers whose image matches
+// --container-image, and reports which ones matched
+func selectContainersByImage(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) {
+	names, err := k8sClient.SelectContainersByImage(ctx, cfg.Namespace, cfg.ServiceName, cfg.ContainerImage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving --container-image %s: %v\n", cfg.ContainerImage, err)
+		os.Exit(exitCode(err))
+	}
+	fmt.Printf("Containers running an image matching %q: %s\n", cfg.ContainerImage, strings.Join(names, ", "))
+}
+
+// printSelector prints the namespace and label selector the target's pods are looked up with,
+// and how the selector was derived from the target
+func printSelector(cfg Config, k8sClient *kubernetes.Client) {
+	selector, derivation := k8sClient.DescribeSelector(cfg.ServiceName)
+	fmt.Printf("Pod selector: %s in namespace %s (%s)\n", selector, cfg.Namespace, derivation)
+}
+
+// validatePatches submits each generated patch to the API server as a dry run and records
+// whether it would be accepted, so schema or admission rejections surface before it is applied
+func validatePatches(ctx context.Context, cfg Config, k8sClient *kubernetes.Client, result *output.Result) {
+	patches, err := output.Patches(*result)
+	if err != nil {
+		fmt.Printf("Note: could not validate the patch: %v\n", err)
+		return
+	}
+
+	for _, p := range patches {
+		v := output.PatchValidation{Deployment: p.Deployment, Accepted: true}
+		if err := k8sClient.ValidatePatch(ctx, cfg.Namespace, p.Deployment, p.Patch); err != nil {
+			v.Accepted, v.Error = false, err.Error()
+		}
+		result.Validation = append(result.Validation, v)
+	}
+}
+
+// scaleRPSToReplicas multiplies the configured RPS by the replica count of the target Deployment,
+// so the same per-replica load gives services of different sizes a representative total
+func scaleRPSToReplicas(ctx context.Context, cfg *Config, k8sClient *kubernetes.Client) error {
+	deployment, err := targetDeployment(ctx, *cfg, k8sClient)
+	if err != nil {
+		return err
+	}
+
+	// The API server defaults unset replicas to 1
+	replicas := 1
+	if deployment.Spec.Replicas != nil {
+		replicas = int(*deployment.Spec.Replicas)
+	}
+	if replicas < 1 {
+		return fmt.Errorf("%w: deployment %s has no replicas to scale the load to; scale it up first", kubernetes.ErrScaledToZero, deployment.Name)
+	}
+
+	fmt.Printf("Scaling load to %d replicas of deployment %s: %d RPS per replica, %d RPS in total\n",
+		replicas, deployment.Name, cfg.RPS, cfg.RPS*replicas)
+	cfg.Replicas = replicas
+	cfg.RPS *= replicas
+	return nil
+}
+
+// applyWorkloadPolicy reads rightsizer annotations from the target Deployment and uses them
+// for any setting the user did not pass explicitly on the command line
+func applyWorkloadPolicy(ctx context.Context, cfg *Config, k8sClient *kubernetes.Client) {
+	deployment, err := targetDeployment(ctx, *cfg, k8sClient)
+	if err != nil {
+		fmt.Printf("Note: could not read workload annotations: %v\n", err)
+		return
+	}
+
+	policy, err := kubernetes.ParseWorkloadPolicy(deployment.Annotations)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring workload annotations on deployment %s: %v\n", deployment.Name, err)
+		return
+	}
+
+	if policy.Margin != nil && !cfg.ExplicitFlags["margin"] && !cfg.AdaptiveMargin {
+		margin, err := recommender.ParseMargin(*policy.Margin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring annotation %s on deployment %s: %v\n",
+				kubernetes.MarginAnnotation, deployment.Name, err)
+			return
+		}
+		cfg.Margin = margin
+		fmt.Printf("Using margin %d%% from annotation %s on deployment %s\n",
+			cfg.Margin, kubernetes.MarginAnnotation, deployment.Name)
+		warnHighMargin(cfg.Margin)
+	}
+}
+
+// warnHighMargin warns about a margin so high it's likely a mistake
+func warnHighMargin(margin int) {
+	if margin > recommender.HighMargin {
+		fmt.Fprintf(os.Stderr, "Warning: a margin of %d%% sizes resources at %.1fx usage; was a multiplier such as 1.2 meant?\n",
+			margin, 1+float64(margin)/100)
+	}
+}
+
+// readProbes reads the target's liveness and startup probes for --probe-aware. It returns nil if
+// the flag isn't set, the workload has no such probes, or they can't be read.
+func readProbes(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) *kubernetes.ProbeSettings {
+	if !cfg.ProbeAware {
+		return nil
+	}
+
+	probes, err := k8sClient.GetProbeSettings(ctx, cfg.Namespace, cfg.ServiceName)
+	if err != nil {
+		fmt.Printf("Note: could not read probe settings, sizing without probe headroom: %v\n", err)
+		return nil
+	}
+	if probes == nil {
+		fmt.Println("Note: the workload has no liveness or startup probes; --probe-aware has no effect")
+	}
+	return probes
+}
+
+// readDivergence reads the settings of the target container from every pod and returns the
+// requests and limits that differ between them, or nil if they agree or can't be read
+func readDivergence(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) *kubernetes.SettingsDivergence {
+	divergence, err := k8sClient.GetSettingsDivergence(ctx, cfg.Namespace, cfg.ServiceName)
+	if err != nil {
+		fmt.Printf("Note: could not compare resource settings across pods: %v\n", err)
+		return nil
+	}
+	if divergence != nil {
+		fmt.Printf("Warning: the resource settings of container %s differ across its %d pods; the baseline is read from one of them\n",
+			divergence.Container, divergence.Pods)
+	}
+	return divergence
+}
+
+// readVPA reads the recommendation of the VerticalPodAutoscaler targeting the workload for its
+// main container. It returns nil if there is none, since the comparison is optional.
+func readVPA(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) *kubernetes.VPARecommendation {
+	deployment, err := targetDeployment(ctx, cfg, k8sClient)
+	if err != nil {
+		fmt.Printf("Note: could not resolve the Deployment to compare with its VPA: %v\n", err)
+		return nil
+	}
+
+	containers, err := k8sClient.GetContainerSettings(ctx, cfg.Namespace, cfg.ServiceName)
+	if err != nil {
+		fmt.Printf("Note: could not read the pod's containers to compare with the VPA: %v\n", err)
+		return nil
+	}
+	if len(containers) == 0 {
+		fmt.Println("Note: the pod has no containers to compare with the VPA")
+		return nil
+	}
+
+	vpa, err := k8sClient.GetVPARecommendation(ctx, cfg.Namespace, deployment.Name, containers[0].Name)
+	if err != nil {
+		fmt.Printf("Note: no VPA recommendation to compare with: %v\n", err)
+		return nil
+	}
+	return vpa
+}
+
+// readHPA reads the HorizontalPodAutoscaler targeting the workload, so the recommended HPA target
+// can be compared with its current one and the HPA patch keeps its name and replica bounds. It
+// returns nil if there is none or it can't be read.
+func readHPA(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) *kubernetes.HPASettings {
+	deployment, err := targetDeployment(ctx, cfg, k8sClient)
+	if err != nil {
+		fmt.Printf("Note: could not resolve the Deployment to read its HPA: %v\n", err)
+		return nil
+	}
+
+	hpa, err := k8sClient.GetHPA(ctx, cfg.Namespace, deployment.Name)
+	if err != nil {
+		fmt.Printf("Note: could not read the HPA, the HPA patch creates a new one: %v\n", err)
+		return nil
+	}
+	return hpa
+}
+
+// printPlan resolves the selector and load target and prints what a real run would do,
+// without generating any load or collecting metrics
+func printPlan(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) {
+	fmt.Println("\n===== Pod Rightsizer Plan (dry run) =====")
+
+	selector, pods, err := k8sClient.ListPodNames(ctx, cfg.Namespace, cfg.ServiceName)
+	_, derivation := k8sClient.DescribeSelector(cfg.ServiceName)
+	fmt.Printf("\nNamespace: %s\n", cfg.Namespace)
+	fmt.Printf("Label selector: %s (%s)\n", selector, derivation)
+	if err != nil {
+		fmt.Printf("Pods to measure: unknown (%v)\n", err)
+	} else if len(pods) == 0 {
+		fmt.Println("Pods to measure: none - the selector matches no pods, a real run would fail")
+	} else {
+		fmt.Printf("Pods to measure (%d):\n", len(pods))
+		for _, name := range pods {
+			fmt.Printf("  - %s\n", name)
+		}
+	}
+
+	targetURL, err := loadtest.TargetURL(cfg.Target, cfg.LoadTestOptions)
+	if err != nil {
+		fmt.Printf("\nLoad test target: invalid (%v)\n", err)
+	} else {
+		fmt.Printf("\nLoad test target: %s\n", targetURL.String())
+	}
+
+	tester := loadtest.NewTester(cfg.Target, cfg.RPS, cfg.Concurrency, cfg.LoadTestOptions)
+	if cfg.Concurrency > 0 && tester.ExpectedRequests(cfg.Duration) > 0 {
+		fmt.Printf("Load: %d concurrent workers for up to %s (stopping after %d requests)\n",
+			cfg.Concurrency, cfg.Duration, tester.ExpectedRequests(cfg.Duration))
+	} else if cfg.Concurrency > 0 {
+		fmt.Printf("Load: %d concurrent workers for %s (request count depends on response time)\n",
+			cfg.Concurrency, cfg.Duration)
+	} else {
+		fmt.Printf("Load: %d RPS for %s (%d requests)\n", cfg.RPS, cfg.Duration, tester.ExpectedRequests(cfg.Duration))
+	}
+
+	if missing, audited := auditLimits(ctx, cfg, k8sClient); audited {
+		fmt.Printf("\nContainers missing requests/limits: %d\n", len(missing))
+		for _, m := range missing {
+			fmt.Printf("  - %s: no %s\n", m.Container, strings.Join(m.Missing, ", "))
+		}
+	}
+
+	fmt.Println("\nNo load was generated and no metrics were collected.")
+}
+
+// newLoadTester creates the load tester for the configured target. The tester builds its
+// transport from the connection and TLS flags in the load test options.
+func newLoadTester(cfg Config) *loadtest.Tester {
+	var testerOpts []loadtest.TesterOption
+	if cfg.LoadResults != nil {
+		testerOpts = append(testerOpts, loadtest.WithResultWriter(cfg.LoadResults))
+	}
+	return loadtest.NewTester(cfg.Target, cfg.RPS, cfg.Concurrency, cfg.LoadTestOptions, testerOpts...)
+}
+
+// openLoadResults creates the --save-load-results file the load tester streams every request's
+// result to, exiting if it can't be created
+func openLoadResults(cfg *Config) {
+	if cfg.SaveLoadResults == "" {
+		return
+	}
+
+	w, err := loadtest.NewResultWriter(cfg.SaveLoadResults)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating load results file: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.LoadResults = w
+}
+
+// closeLoadResults closes the --save-load-results file once the load tests are done
+func closeLoadResults(cfg Config) {
+	if cfg.LoadResults == nil {
+		return
+	}
+
+	if err := cfg.LoadResults.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving load results: %v\n", err)
+		return
+	}
+	fmt.Printf("Per-request load results saved to '%s'\n", cfg.SaveLoadResults)
+}
+
+// probeTarget sends a single request to the target if --validate-target-reachable is set, and
+// returns why the target can't be load tested if it fails
+func probeTarget(ctx context.Context, cfg Config, loadTester *loadtest.Tester) error {
+	if !cfg.ProbeTarget {
+		return nil
+	}
+
+	status, err := loadTester.Probe(ctx)
+	if err != nil {
+		return fmt.Errorf("target failed the reachability check: %w", err)
+	}
+	fmt.Printf("Target %s is reachable (HTTP %d)\n", cfg.Target, status)
+	return nil
+}
+
+// saveLatencyHistogram writes the latency distribution to the --latency-hdr file, if one is set
+func saveLatencyHistogram(cfg Config, m *loadtest.Metrics) {
+	if cfg.LatencyHDR == "" || m == nil {
+		return
+	}
+
+	if err := loadtest.SaveLatencyHistogram(cfg.LatencyHDR, m); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving latency histogram: %v\n", err)
+		return
+	}
+	fmt.Printf("Latency histogram saved to '%s'\n", cfg.LatencyHDR)
+	if m.LatencySampled {
+		fmt.Printf("Note: the histogram covers a sample of %d of the %d latencies (--latency-sampling)\n", len(m.Latencies), m.LatencyCount)
+	}
+}
+
+// runLoadTestOnly runs the load test without collecting metrics or recommending resources, and
+// prints its report
+func runLoadTestOnly(ctx context.Context, cfg Config) {
+	openLoadResults(&cfg)
+	loadTester := newLoadTester(cfg)
+	if err := probeTarget(ctx, cfg, loadTester); err != nil {
+		closeLoadResults(cfg)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+	err := loadTester.Run(ctx, cfg.Duration)
+	closeLoadResults(cfg)
+	saveLatencyHistogram(cfg, loadTester.Metrics())
+
+	if m := loadTester.Metrics(); m != nil {
+		output.PrintLoadTest(os.Stdout, cfg.Target, m, cfg.OutputFormat, cfg.CompactJSON)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Load test failed: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// reportWithoutMetrics runs the load test without collecting metrics, since metrics-server is
+// unavailable, and reports it along with the current settings. It exits with the metrics
+// unavailable code, as no recommendation was made.
+func reportWithoutMetrics(ctx context.Context, cfg Config, loadTester *loadtest.Tester, currentSettings kubernetes.ResourceSettings,
+	divergence *kubernetes.SettingsDivergence, missingLimits []kubernetes.MissingResources, limitsAudited bool, reason error) {
+	fmt.Printf("Starting load test (%d RPS for %s, without metrics collection)...\n", cfg.RPS, cfg.Duration)
+	err := loadTester.Run(ctx, cfg.Duration)
+	closeLoadResults(cfg)
+	saveLatencyHistogram(cfg, loadTester.Metrics())
+
+	output.PrintSettingsReport(os.Stdout, output.Result{
+		Target:          cfg.Target,
+		ServiceName:     cfg.ServiceName,
+		Namespace:       cfg.Namespace,
+		Duration:        cfg.Duration,
+		RPS:             cfg.RPS,
+		CurrentSettings: currentSettings,
+		LoadTest:        loadTester.Metrics(),
+		CompactJSON:     cfg.CompactJSON,
+		Divergence:      divergence,
+		LimitsAudited:   limitsAudited,
+		MissingLimits:   missingLimits,
+	}, cfg.OutputFormat, reason)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Load test failed: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+	os.Exit(exitCode(reason))
+}
+
+// auditLimits checks the targeted containers for unset requests and limits if
+// --warn-on-missing-limits is set, and reports whether the check ran. A failed check doesn't stop
+// the run.
+func auditLimits(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) ([]kubernetes.MissingResources, bool) {
+	if !cfg.WarnMissingLimits {
+		return nil, false
+	}
+
+	missing, err := k8sClient.FindMissingResources(ctx, cfg.Namespace, cfg.ServiceName)
+	if err != nil {
+		fmt.Printf("Note: could not check for missing requests/limits: %v\n", err)
+		return nil, false
+	}
+	return missing, true
+}
+
+// printPreview prints a one-line interim recommendation over the samples collected so far.
+// Previews are advisory only; the final recommendation printed at the end is authoritative.
+func printPreview(samples []metrics.ResourceMetrics, currentSettings kubernetes.ResourceSettings, opts recommender.Options) {
+	r, err := recommender.Generate(samples, currentSettings, opts)
+	if err != nil {
+		return
+	}
+	fmt.Printf("[preview, advisory] Interim recommendation from %d samples - CPU: %.0fm/%.0fm, Memory: %.0fMi/%.0fMi (request/limit)\n",
+		len(samples), r.CPURequest*1000, r.CPULimit*1000, r.MemoryRequest, r.MemoryLimit)
+}
+
+// loadTestFlags are the flags that configure only the load generator, and so are the only ones
+// --loadtest-only can be combined with
+var loadTestFlags = map[string]bool{
+	"loadtest-only": true, "target": true, "duration": true, "rps": true, "concurrency": true,
+	"output-format": true, "color": true, "compact-json": true, "total-requests": true, "think-time": true, "seed": true,
+	"fail-fast": true, "retry-on-status": true, "max-retries": true, "retry-backoff": true,
+	"body-template": true, "targets-file": true, "exclude-path": true, "resolve": true, "tls-min-version": true,
+	"tls-ciphers": true, "max-idle-conns": true, "max-conns-per-host": true, "concurrency-ramp": true,
+	"correct-omission": true, "save-load-results": true, "latency-hdr": true, "validate-target-reachable": true, "target-port": true,
+	"error-backoff": true, "error-backoff-exponential": true, "latency-sampling": true,
+}
+
+// rightsizingFlags returns the explicitly set flags that need Kubernetes access or only affect
+// rightsizing, in alphabetical order
+func rightsizingFlags(explicitFlags map[string]bool) []string {
+	var names []string
+	for name := range explicitFlags {
+		if !loadTestFlags[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func parseFlags() Config {
+	var (
+		target         = flag.String("target", "", "Target service URL or identifier for load testing")
+		targetPort     = flag.Int("target-port", 0, "Send load test requests to this port, replacing or adding to the target URL's port")
+		serviceName    = flag.String("service-name", "", "Kubernetes service name for metrics collection (defaults to target if not specified)")
+		namespace      = flag.String("namespace", "default", "Kubernetes namespace")
+		durationStr    = flag.String("duration", "5m", "Duration of the load test")
+		rps            = flag.Int("rps", 50, "Requests per second for load testing")
+		rpsPerReplica  = flag.Bool("rps-per-replica", false, "Treat --rps as the load per replica and multiply it by the target Deployment's current replica count")
+		concurrency    = flag.Int("concurrency", 0, "Alternative to RPS, number of concurrent connections")
+		marginStr      = flag.String("margin", "20", "Safety margin to add to recommendations: a percentage (20 or 20%) or a multiplier of usage (1.2 or 1.2x)")
+		adaptiveMargin = flag.Bool("adaptive-margin", false, "Scale the margin of CPU and memory with the variance of their usage, between --min-margin for steady usage and --max-margin for volatile usage, instead of applying --margin")
+		minMarginStr   = flag.String("min-margin", strconv.Itoa(recommender.DefaultMinMargin), "Margin for perfectly steady usage with --adaptive-margin, in any form --margin accepts")
+		maxMarginStr   = flag.String("max-margin", strconv.Itoa(recommender.DefaultMaxMargin), "Margin for highly variable usage with --adaptive-margin, in any form --margin accepts")
+		outputFormat   = flag.String("output-format", "text", "Output format: "+strings.Join(output.Formats, ", "))
+		kubeconfigPath = flag.String("kubeconfig", "", "Path to kubeconfig file for external cluster access")
+		previewStr     = flag.String("preview-interval", "0", "Print an advisory interim recommendation at this interval during the run (0 to disable)")
+		aggregateStr   = flag.String("aggregate-window", "0", "Bucket samples into windows of this width before analysis to smooth noise (0 to disable)")
+		requireAll     = flag.Bool("require-metrics-for-all-pods", false, "Refuse to make a recommendation if any sample lacks metrics for a running pod, e.g. during a scale-up")
+		podCoverage    = flag.Float64("required-pod-coverage", 100, "With --require-metrics-for-all-pods, the percentage of running pods every sample must have metrics for")
+		dedupSamples   = flag.Bool("scrape-interval-aware", false, "Collapse consecutive identical samples, which repeat one metrics-server scrape, so each scrape counts once")
+		aggregateFunc  = flag.String("aggregate-func", "mean", "How samples within an aggregate window are combined: mean or max")
+		loadTestOnly   = flag.Bool("loadtest-only", false, "Only run the load test and report latency, throughput, and status codes, without Kubernetes access or rightsizing")
+		validatePatch  = flag.Bool("validate", false, "Dry-run the generated patch against the API server (server-side, nothing is changed) and report whether it would be accepted")
+		labelKey       = flag.String("label-key", kubernetes.DefaultLabelKey, "Label a target name or URL host is matched against to find its pods, e.g. app.kubernetes.io/name or k8s-app")
+		printSelector  = flag.Bool("print-selector", false, "Print the pod label selector, namespace, and how the selector was derived from the target before listing pods")
+		explainSelect  = flag.Bool("explain-selector-resolution", false, "Trace to stderr how the target is resolved to pods: URL parsing, the selector built, the pods matched, and the pod current settings are read from")
+		summaryOnly    = flag.Bool("summary-only", false, "Don't print each collected metrics sample; load test progress and the final analysis are still shown")
+		plan           = flag.Bool("plan", false, "Print the resolved selector, pods, target, and request count, then exit without running")
+		tlsMinVersion  = flag.String("tls-min-version", "", "Minimum TLS version for HTTPS load targets: 1.2 or 1.3")
+		helmValuesPath = flag.String("helm-values-path", output.DefaultHelmValuesPath, "Dot-separated values path for the helm output format (e.g. app.resources)")
+		metricsListen  = flag.String("metrics-listen", "", "Serve the results on a short-lived Prometheus /metrics endpoint at this address (e.g. :9090)")
+		metricsServe   = flag.String("metrics-serve-for", "1m", "How long the --metrics-listen endpoint stays up after the run")
+		hpaHeadroom    = flag.Float64("hpa-headroom", 0, "Recommend an HPA target CPU utilization that keeps this fraction of the CPU request free for bursts, e.g. 0.3 for a 70% target, raise the CPU request to match it, and save an HPA patch (0 disables)")
+		compareVPA     = flag.Bool("compare-with-vpa", false, "Show the recommendation of the VerticalPodAutoscaler targeting the Deployment next to this run's, and warn if they diverge widely")
+		compareAlgos   = flag.Bool("compare-algorithms", false, "Also show what average-, peak-, and percentile-based sizing would recommend from the same samples")
+		noCPULimit     = flag.Bool("no-cpu-limit", false, "Never set a CPU limit in the generated patch (removes an existing one)")
+		forceLimits    = flag.Bool("force-limits", false, "Set limits in the generated patch even if the workload currently has none")
+		coldStart      = flag.Duration("measure-cold-start", 0, "Profile usage in this first part of the load test, e.g. 30s, as a cold start: size the limits to also cover its peak, and the requests from the steady state after it (0 disables)")
+		requestsOnly   = flag.Bool("requests-only", false, "Size only requests and leave the current limits out of the generated patch, so they stay unchanged")
+		saveLoadRes    = flag.String("save-load-results", "", "Stream every request's timestamp, latency, status, and error to this file, as CSV if it ends in .csv and as JSON lines otherwise")
+		latencyHDR     = flag.String("latency-hdr", "", "Write the latency percentile distribution to this file in the HdrHistogram .hgrm format, in milliseconds")
+		validateReach  = flag.Bool("validate-target-reachable", false, "Send a single request to the target before the load test and stop with the reason, e.g. DNS failure, connection refused, TLS error, or HTTP error status, if it fails")
+		saveResult     = flag.String("save-result", "", "Save the full result (samples, load test stats, recommendations) as versioned JSON to this path")
+		autoPortFwd    = flag.Bool("auto-port-forward", false, "Port-forward a local port to a target pod and load test through localhost")
+		remotePort     = flag.Int("remote-port", 0, "Pod port used by --auto-port-forward (defaults to the target URL's port, or 80/443)")
+		strategy       = flag.String("strategy", recommender.DefaultStrategy, "Recommendation strategy: "+strings.Join(recommender.StrategyNames(), ", "))
+		percentile     = flag.Float64("recommendation-percentile", 95, "Usage percentile (0-100) that requests are sized from with --strategy percentile or pod-peak")
+		cpuReqStat     = flag.String("cpu-request-stat", recommender.DefaultCPURequestStat, "Usage statistic the CPU request is sized from with --strategy margin: avg, peak, or a percentile such as p90")
+		memoryReqStat  = flag.String("memory-request-stat", recommender.DefaultMemoryRequestStat, "Usage statistic the memory request is sized from with --strategy margin: avg, peak, or a percentile such as p90")
+		targetUtil     = flag.Float64("target-utilization", 70, "Average utilization percentage of requests to aim for with --strategy utilization")
+		compactJSON    = flag.Bool("compact-json", false, "Print the json output format on a single line, for piping into jq or log ingestion, instead of indented")
+		color          = flag.String("color", "auto", "Colorize changes in the text output: always, never, or auto (only when stdout is a terminal)")
+		ignoreCtrs     = flag.String("ignore-containers", strings.Join(kubernetes.DefaultIgnoredContainers, ","), "Comma-separated container names or prefixes to exclude from settings and metrics (empty to include all)")
+		containerImage = flag.String("container-image", "", "Size only the containers whose image contains this substring, or matches it as a glob if it has * or ?, whatever the containers are named")
+		ctrAggregation = flag.String("container-aggregation", kubernetes.ContainerAggregationSum, "How the usage of a pod's containers that aren't ignored is combined: "+strings.Join(kubernetes.ContainerAggregations, ", "))
+		throttleAware  = flag.Bool("target-cpu-throttle-aware", false, "Raise the CPU limit above the current one if CPU usage is pinned at it (throttling)")
+		totalRequests  = flag.Int("total-requests", 0, "Stop the load test after this many requests, or at the end of --duration if that comes first (0 for no limit)")
+		skipIfWithin   = flag.Float64("skip-if-within", 0, "Generate no patch if every recommended value is within this percentage of the current setting (0 always generates one)")
+		maxDownsize    = flag.Float64("max-downsize", 0, "Maximum percentage a request may drop below the current request in a single run (0 for no limit)")
+		probeAware     = flag.Bool("probe-aware", false, "Keep the CPU limit at least 50% above peak CPU usage if the workload has liveness or startup probes, so throttling doesn't time them out")
+		neverDownsize  = flag.Bool("never-downsize", false, "Never recommend less than a current request or limit; only under-provisioning is corrected")
+		memPeakSamples = flag.Int("max-memory-samples-for-peak", 1, "Count a memory level as the peak the memory limit is sized from only if at least this many samples reach it, so a single spike such as a metrics-server glitch doesn't inflate the limit (1 uses the highest sample)")
+		maxLimitRatio  = flag.Float64("max-limit-request-ratio", 0, "Maximum memory limit as a multiple of the memory request; the request is raised to stay within it (0 for no limit)")
+		maxCPU         = flag.String("max-cpu", "", "Policy cap no CPU request or limit is recommended above, e.g. 2 or 500m (empty for no cap)")
+		maxMemory      = flag.String("max-memory", "", "Policy cap no memory request or limit is recommended above, e.g. 1Gi (empty for no cap)")
+		missingLimits  = flag.Bool("warn-on-missing-limits", false, "Report which targeted containers set no CPU or memory requests or limits")
+		appMetricsURL  = flag.String("app-metrics-url", "", "Also scrape heap and GC metrics from the application's Prometheus endpoint (e.g. http://myservice:9090/metrics); optional and non-fatal")
+		nodeMetrics    = flag.Bool("collect-node-metrics", false, "Also sample the nodes hosting the target pods and warn if they were saturated")
+		thinkTimeStr   = flag.String("think-time", loadtest.DefaultThinkTime.String(), "Pause between a concurrent worker's requests: fixed (e.g. 10ms) or exponentially distributed (e.g. exp:200ms)")
+		errBackoff     = flag.String("error-backoff", loadtest.DefaultErrorBackoff.String(), "Pause of a concurrency-mode worker after a failed request")
+		errBackoffExp  = flag.Bool("error-backoff-exponential", false, "Double --error-backoff for each consecutive failed request of a worker, up to "+loadtest.MaxErrorBackoff.String()+", resetting on success")
+		concRamp       = flag.String("concurrency-ramp", "0", "Start concurrency-mode workers gradually, adding them evenly over this window (0 starts them all at once)")
+		latencySample  = flag.Int("latency-sampling", loadtest.DefaultLatencySamples, "Latencies kept exactly for percentiles; past this many, a uniform random sample of that size is kept and percentiles are estimates (0 keeps every latency)")
+		correctCO      = flag.Bool("correct-omission", false, "In RPS mode, also report latency percentiles measured from each request's scheduled send time, correcting for coordinated omission")
+		sampleJitter   = flag.Bool("sample-jitter", false, "Start metrics sampling at a random offset and jitter each sample, so samples aren't phase-locked to periodic work of the service (drawn from --seed)")
+		seed           = flag.Int64("seed", 0, "Random seed for endpoint selection, think times, and body templates, for reproducible runs (0 seeds from the clock)")
+		postHook       = flag.String("post-hook", "", "Shell command to run after the results are written, e.g. to open a pull request; it gets the patch path in $RIGHTSIZER_PATCH_FILE and a JSON summary in $RIGHTSIZER_SUMMARY")
+		historyFile    = flag.String("history-file", "", "Append this run's recommendation to a history file: CSV if the name ends in .csv, JSON lines otherwise")
+		historyDecay   = flag.Float64("history-decay", 0, "Blend the recommendation with the service's earlier runs in --history-file, weighting each older run by this factor in (0, 1) more than the next (0 disables)")
+		recencyWeight  = flag.String("recency-weight", "none", "Weight later samples more when averaging for requests: none, linear, or an exponential decay factor in (0, 1) such as 0.9")
+		failFast       = flag.Bool("fail-fast", false, "Abort the load test if the success rate stays below 50% for 30s, instead of sizing from a failing service")
+		iterations     = flag.Int("iterations", 1, "Run the load test this many times and combine the samples, to average out run-to-run variance")
+		cooldownStr    = flag.String("cooldown", "0", "Pause between load test iterations (e.g. 2m)")
+		observeAfter   = flag.String("observe-after", "5s", "Keep collecting metrics for this long after the load test ends, to capture post-load memory plateaus")
+		retryOnStatus  = flag.String("retry-on-status", "", "Comma-separated status codes to retry like a resilient client (e.g. 503,502) instead of counting them as failures")
+		maxRetries     = flag.Int("max-retries", loadtest.DefaultMaxRetries, "Retries per request for --retry-on-status codes")
+		retryBackoff   = flag.String("retry-backoff", loadtest.DefaultRetryBackoff.String(), "Delay before the first retry, doubled for each further retry")
+		bodyTemplate   = flag.String("body-template", "", "Body to POST to the target, with {{randInt}} and {{uuid}} placeholders expanded per request to defeat caching")
+		templateHash   = flag.String("pod-template-hash", "", "Measure only the pods of one ReplicaSet: a pod-template-hash value, or latest/previous for the Deployment's current/prior revision")
+		deployment     = flag.String("deployment", "", "Name of the target Deployment (resolved from the matched pods if not specified)")
+		resourceName   = flag.String("resource-name", "", "Name of the Deployment the generated patch targets, when it differs from the service name (--deployment takes precedence)")
+		servicesFile   = flag.String("services-file", "", "File of 'url -> namespace/service' lines; each URL is load tested in parallel and its service sized separately (replaces --target)")
+		sortBy         = flag.String("sort-by", "", "Order the results of a --services-file run by "+strings.Join(output.SortKeys, ", ")+", largest first (default: services file order)")
+		sortOrder      = flag.String("sort-order", "desc", "Direction of --sort-by: desc or asc")
+		compareEnvs    = flag.String("compare-namespaces", "", "Two namespace/service pairs, e.g. staging/web,prod/web; each is load tested through its Service and the results are compared side by side (replaces --target)")
+		targetsFile    = flag.String("targets-file", "", "JSON file of weighted endpoints (method, path, body, headers, weight) to mix into the load")
+		maxIdleConns   = flag.Int("max-idle-conns", 0, "Idle keep-alive connections the load client keeps per host (0 uses Go's default of 2, which can bottleneck high RPS)")
+		maxConnsHost   = flag.Int("max-conns-per-host", 0, "Maximum connections the load client opens per host, and RPS-mode requests in flight (0 for no limit)")
+		tlsCiphers     = flag.String("tls-ciphers", "", "Comma-separated list of allowed TLS 1.2 cipher suites (e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)")
+	)
+
+	flag.BoolVar(plan, "dry-run", false, "Alias for --plan")
+
+	var resolveEntries stringList
+	var excludePaths stringList
+	flag.Var(&excludePaths, "exclude-path", "Leave endpoints whose path matches this path or glob (e.g. /admin/*) out of the --targets-file mix (repeatable)")
+	flag.Var(&resolveEntries, "resolve", "Connect to addr instead of resolving host:port, as host:port:addr (like curl; repeatable)")
+
+	flag.Parse()
+
+	// Record which flags were set explicitly so workload annotations don't override them
+	explicitFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicitFlags[f.Name] = true
+	})
+
+	if *target == "" && *servicesFile == "" && *compareEnvs == "" {
+		_, err := fmt.Fprintf(os.Stderr, "Error: --target, --services-file, or --compare-namespaces parameter is required\n")
+		if err != nil {
+			return Config{}
+		}
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if !output.IsValidFormat(*outputFormat) {
+		_, err := fmt.Fprintf(os.Stderr, "Error: --output-format must be one of: %s\n", strings.Join(output.Formats, ", "))
+		if err != nil {
+			return Config{}
+		}
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *rpsPerReplica && *concurrency > 0 {
+		fmt.Fprintf(os.Stderr, "Error: --rps-per-replica scales --rps and cannot be combined with --concurrency\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *loadTestOnly {
+		if rejected := rightsizingFlags(explicitFlags); len(rejected) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: --loadtest-only cannot be combined with Kubernetes or rightsizing flags: --%s\n",
+				strings.Join(rejected, ", --"))
+			flag.Usage()
+			os.Exit(1)
+		}
+		if !output.IsLoadTestFormat(*outputFormat) {
+			fmt.Fprintf(os.Stderr, "Error: --loadtest-only supports only these output formats: %s\n", strings.Join(output.LoadTestFormats, ", "))
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	duration, err := time.ParseDuration(*durationStr)
+	if err != nil {
+		_, err := fmt.Fprintf(os.Stderr, "Error: invalid duration format: %v\n", err)
+		if err != nil {
+			return Config{}
+		}
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	previewInterval, err := time.ParseDuration(*previewStr)
+	if err != nil || previewInterval < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --preview-interval: %s\n", *previewStr)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	aggregateWindow, err := time.ParseDuration(*aggregateStr)
+	if err != nil || aggregateWindow < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --aggregate-window: %s\n", *aggregateStr)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *podCoverage <= 0 || *podCoverage > 100 {
+		fmt.Fprintf(os.Stderr, "Error: --required-pod-coverage must be greater than 0 and at most 100\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if explicitFlags["required-pod-coverage"] && !*requireAll {
+		fmt.Fprintf(os.Stderr, "Error: --required-pod-coverage requires --require-metrics-for-all-pods\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	requiredCoverage := 0.0
+	if *requireAll {
+		requiredCoverage = *podCoverage / 100
+	}
+
+	if *aggregateFunc != "mean" && *aggregateFunc != "max" {
+		fmt.Fprintf(os.Stderr, "Error: --aggregate-func must be one of: mean, max\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if errs := validation.IsQualifiedName(*labelKey); len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: --label-key %q is not a valid label key: %s\n", *labelKey, strings.Join(errs, "; "))
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if !kubernetes.IsValidContainerAggregation(*ctrAggregation) {
+		fmt.Fprintf(os.Stderr, "Error: --container-aggregation must be one of: %s\n", strings.Join(kubernetes.ContainerAggregations, ", "))
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	metricsServeFor, err := time.ParseDuration(*metricsServe)
+	if err != nil || metricsServeFor <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --metrics-serve-for: %s\n", *metricsServe)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *color != "always" && *color != "never" && *color != "auto" {
+		fmt.Fprintf(os.Stderr, "Error: --color must be one of: always, never, auto\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if _, ok := recommender.Lookup(*strategy); !ok {
+		fmt.Fprintf(os.Stderr, "Error: --strategy must be one of: %s\n", strings.Join(recommender.StrategyNames(), ", "))
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *percentile <= 0 || *percentile > 100 {
+		fmt.Fprintf(os.Stderr, "Error: --recommendation-percentile must be in (0, 100]\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *targetUtil <= 0 || *targetUtil > 100 {
+		fmt.Fprintf(os.Stderr, "Error: --target-utilization must be in (0, 100]\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *totalRequests < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --total-requests must not be negative\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *skipIfWithin < 0 || *skipIfWithin >= 100 {
+		fmt.Fprintf(os.Stderr, "Error: --skip-if-within must be at least 0 and below 100\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *maxDownsize < 0 || *maxDownsize >= 100 {
+		fmt.Fprintf(os.Stderr, "Error: --max-downsize must be at least 0 and below 100\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *memPeakSamples < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --max-memory-samples-for-peak must be at least 1, got %d\n", *memPeakSamples)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *maxLimitRatio != 0 && *maxLimitRatio < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --max-limit-request-ratio must be at least 1, or 0 to disable\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var maxCPUCores float64
+	if *maxCPU != "" {
+		quantity, err := resource.ParseQuantity(*maxCPU)
+		if err != nil || quantity.Sign() <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: --max-cpu must be a positive CPU quantity such as 2 or 500m\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		maxCPUCores = float64(quantity.MilliValue()) / 1000
+	}
+
+	var maxMemoryMi float64
+	if *maxMemory != "" {
+		quantity, err := resource.ParseQuantity(*maxMemory)
+		if err != nil || quantity.Sign() <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: --max-memory must be a positive memory quantity such as 1Gi or 512Mi\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		maxMemoryMi = float64(quantity.Value()) / (1024 * 1024)
+	}
+
+	cpuRequestStat, err := recommender.ParseRequestStat(*cpuReqStat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --cpu-request-stat: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	memoryRequestStat, err := recommender.ParseRequestStat(*memoryReqStat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --memory-request-stat: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	margin, err := recommender.ParseMargin(*marginStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --margin: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	warnHighMargin(margin)
+
+	minMargin, err := recommender.ParseMargin(*minMarginStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --min-margin: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	maxMargin, err := recommender.ParseMargin(*maxMarginStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --max-margin: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if minMargin > maxMargin {
+		fmt.Fprintf(os.Stderr, "Error: --min-margin %d%% is above --max-margin %d%%\n", minMargin, maxMargin)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if !*adaptiveMargin && (explicitFlags["min-margin"] || explicitFlags["max-margin"]) {
+		fmt.Fprintf(os.Stderr, "Error: --min-margin and --max-margin bound the margin of --adaptive-margin and require it\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *adaptiveMargin && explicitFlags["margin"] {
+		fmt.Fprintf(os.Stderr, "Error: --adaptive-margin replaces --margin; bound it with --min-margin and --max-margin instead\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *adaptiveMargin {
+		warnHighMargin(maxMargin)
+	}
+
+	thinkTime, err := loadtest.ParseThinkTime(*thinkTimeStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --think-time: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	concurrencyRamp, err := time.ParseDuration(*concRamp)
+	if err != nil || concurrencyRamp < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --concurrency-ramp: %s\n", *concRamp)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if concurrencyRamp > 0 && *concurrency <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --concurrency-ramp requires --concurrency\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if concurrencyRamp > 0 && concurrencyRamp >= duration {
+		fmt.Fprintf(os.Stderr, "Error: --concurrency-ramp (%s) must be shorter than --duration (%s)\n", concurrencyRamp, duration)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if explicitFlags["target-port"] && (*targetPort < 1 || *targetPort > 65535) {
+		fmt.Fprintf(os.Stderr, "Error: --target-port must be between 1 and 65535, got %d\n", *targetPort)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *latencySample < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --latency-sampling must not be negative, got %d\n", *latencySample)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *correctCO && *concurrency > 0 {
+		fmt.Fprintf(os.Stderr, "Error: --correct-omission only applies to RPS mode and cannot be used with --concurrency\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var recencyLinear bool
+	var recencyDecay float64
+	switch *recencyWeight {
+	case "none":
+	case "linear":
+		recencyLinear = true
+	default:
+		recencyDecay, err = strconv.ParseFloat(*recencyWeight, 64)
+		if err != nil || recencyDecay <= 0 || recencyDecay >= 1 {
+			fmt.Fprintf(os.Stderr, "Error: --recency-weight must be none, linear, or a decay factor between 0 and 1\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	if *iterations < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --iterations must be at least 1\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	cooldown, err := time.ParseDuration(*cooldownStr)
+	if err != nil || cooldown < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --cooldown: %s\n", *cooldownStr)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	retryCodes, err := loadtest.ParseStatusCodes(*retryOnStatus)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --retry-on-status: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *maxRetries < 0 || *maxRetries > loadtest.MaxRetries {
+		fmt.Fprintf(os.Stderr, "Error: --max-retries must be between 0 and %d\n", loadtest.MaxRetries)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	retryBackoffDuration, err := time.ParseDuration(*retryBackoff)
+	if err != nil || retryBackoffDuration <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --retry-backoff: %s\n", *retryBackoff)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	errorBackoff, err := time.ParseDuration(*errBackoff)
+	if err != nil || errorBackoff <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --error-backoff: %s\n", *errBackoff)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if (explicitFlags["error-backoff"] || *errBackoffExp) && *concurrency <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --error-backoff and --error-backoff-exponential require --concurrency\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	observeAfterDuration, err := time.ParseDuration(*observeAfter)
+	if err != nil || observeAfterDuration < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --observe-after: %s\n", *observeAfter)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if err := loadtest.ValidateBodyTemplate(*bodyTemplate); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --body-template: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var endpoints []loadtest.Endpoint
+	if *targetsFile != "" {
+		endpoints, err = loadtest.LoadEndpoints(*targetsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --targets-file: %v\n", err)
+			os.Exit(1)
+		}
+
+		count := len(endpoints)
+		endpoints, err = loadtest.ExcludeEndpoints(endpoints, excludePaths)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --exclude-path: %v\n", err)
+			os.Exit(1)
+		}
+		if len(endpoints) < count {
+			fmt.Printf("Excluded %d of %d endpoints from the targets file\n", count-len(endpoints), count)
+		}
+	} else if len(excludePaths) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: --exclude-path requires --targets-file\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *maxIdleConns < 0 || *maxConnsHost < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --max-idle-conns and --max-conns-per-host must not be negative\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	minTLSVersion, err := loadtest.ParseTLSVersion(*tlsMinVersion)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --tls-min-version: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	cipherSuites, err := loadtest.ParseCipherSuites(*tlsCiphers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --tls-ciphers: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	resolve, err := loadtest.ParseResolve(resolveEntries)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --resolve: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var targets []targetMapping
+	if *servicesFile != "" {
+		if *plan || *autoPortFwd || *saveResult != "" || *metricsListen != "" || *iterations > 1 || *templateHash != "" ||
+			*appMetricsURL != "" || *saveLoadRes != "" || *latencyHDR != "" {
+			fmt.Fprintf(os.Stderr, "Error: --services-file cannot be combined with --plan, --auto-port-forward, --save-result, --metrics-listen, --iterations, --pod-template-hash, --app-metrics-url, --save-load-results, or --latency-hdr\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		targets, err = loadServicesFile(*servicesFile, *namespace)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --services-file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *coldStart < 0 || *coldStart > 0 && *coldStart >= duration {
+		fmt.Fprintf(os.Stderr, "Error: --measure-cold-start can't be negative and must be shorter than --duration, leaving a steady state to size the requests from\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *coldStart > 0 && *requestsOnly {
+		fmt.Fprintf(os.Stderr, "Error: --measure-cold-start sizes the limits around the cold start and cannot be combined with --requests-only\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *requestsOnly && (*noCPULimit || *forceLimits) {
+		fmt.Fprintf(os.Stderr, "Error: --requests-only keeps the current limits and cannot be combined with --no-cpu-limit or --force-limits\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *sortBy != "" && !output.IsValidSortKey(*sortBy) {
+		fmt.Fprintf(os.Stderr, "Error: --sort-by must be one of: %s\n", strings.Join(output.SortKeys, ", "))
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *sortOrder != "desc" && *sortOrder != "asc" {
+		fmt.Fprintf(os.Stderr, "Error: --sort-order must be desc or asc, got %q\n", *sortOrder)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if (*sortBy != "" || explicitFlags["sort-order"]) && *servicesFile == "" {
+		fmt.Fprintf(os.Stderr, "Error: --sort-by and --sort-order order the results of several targets and require --services-file\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *containerImage != "" && (*servicesFile != "" || *compareEnvs != "") {
+		fmt.Fprintf(os.Stderr, "Error: --container-image cannot be combined with --services-file or --compare-namespaces\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *historyDecay != 0 {
+		if *historyDecay < 0 || *historyDecay >= 1 {
+			fmt.Fprintf(os.Stderr, "Error: --history-decay must be between 0 and 1, got %g\n", *historyDecay)
+			flag.Usage()
+			os.Exit(1)
+		}
+		if *historyFile == "" {
+			fmt.Fprintf(os.Stderr, "Error: --history-decay blends with the runs recorded in --history-file and requires it\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	if *hpaHeadroom < 0 || *hpaHeadroom >= 1 {
+		fmt.Fprintf(os.Stderr, "Error: --hpa-headroom must be between 0 and 1, got %g\n", *hpaHeadroom)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *resourceName != "" {
+		if *servicesFile != "" || *compareEnvs != "" {
+			fmt.Fprintf(os.Stderr, "Error: --resource-name names the Deployment of a single target and cannot be combined with --services-file or --compare-namespaces\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if problems := validation.IsDNS1123Subdomain(*resourceName); len(problems) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid --resource-name %q: %s\n", *resourceName, strings.Join(problems, "; "))
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	var environments []targetMapping
+	if *compareEnvs != "" {
+		if *servicesFile != "" || *plan || *autoPortFwd || *saveResult != "" || *metricsListen != "" || *iterations > 1 ||
+			*templateHash != "" || *appMetricsURL != "" || *saveLoadRes != "" || *latencyHDR != "" {
+			fmt.Fprintf(os.Stderr, "Error: --compare-namespaces cannot be combined with --services-file, --plan, --auto-port-forward, --save-result, --metrics-listen, --iterations, --pod-template-hash, --app-metrics-url, --save-load-results, or --latency-hdr\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		// Each environment names its own namespace and service, and is reached through its Service
+		if explicitFlags["target"] || explicitFlags["namespace"] || explicitFlags["service-name"] {
+			fmt.Fprintf(os.Stderr, "Error: --compare-namespaces names the namespace and service of each environment and cannot be combined with --target, --namespace, or --service-name\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		environments, err = parseEnvironments(*compareEnvs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --compare-namespaces: %v\n", err)
+			flag.Usage()
+			os.Exit(1)
 		}
-		flag.Usage()
-		os.Exit(1)
 	}
 
 	// If service-name is not specified, use the target value
 	serviceNameValue := *serviceName
-	if serviceNameValue == "" {
+	if *servicesFile != "" {
+		fmt.Printf("Loaded %d targets from '%s'.\n", len(targets), *servicesFile)
+	} else if *compareEnvs != "" {
+		fmt.Printf("Comparing %s/%s and %s/%s.\n", environments[0].Namespace, environments[0].ServiceName,
+			environments[1].Namespace, environments[1].ServiceName)
+	} else if serviceNameValue == "" {
 		serviceNameValue = *target
 		fmt.Printf("Note: Using target value '%s' as service name for metrics collection.\n", serviceNameValue)
 		fmt.Printf("To specify a different service name, use the --service-name flag.\n")
@@ -234,14 +2219,107 @@ func parseFlags() Config {
 	}
 
 	return Config{
-		Target:         *target,
-		ServiceName:    serviceNameValue,
-		Namespace:      *namespace,
-		Duration:       duration,
-		RPS:            *rps,
-		Concurrency:    *concurrency,
-		Margin:         *margin,
-		OutputFormat:   *outputFormat,
-		KubeconfigPath: *kubeconfigPath,
+		Target:             *target,
+		ServiceName:        serviceNameValue,
+		Namespace:          *namespace,
+		Duration:           duration,
+		RPS:                *rps,
+		RPSPerReplica:      *rpsPerReplica,
+		Concurrency:        *concurrency,
+		Margin:             margin,
+		AdaptiveMargin:     *adaptiveMargin,
+		MinMargin:          minMargin,
+		MaxMargin:          maxMargin,
+		OutputFormat:       *outputFormat,
+		KubeconfigPath:     *kubeconfigPath,
+		PreviewInterval:    previewInterval,
+		HelmValuesPath:     *helmValuesPath,
+		AggregateWindow:    aggregateWindow,
+		AggregateFunc:      *aggregateFunc,
+		DedupSamples:       *dedupSamples,
+		SampleJitter:       *sampleJitter,
+		RequiredCoverage:   requiredCoverage,
+		Plan:               *plan,
+		LoadTestOnly:       *loadTestOnly,
+		SummaryOnly:        *summaryOnly,
+		PrintSelector:      *printSelector,
+		ExplainSelector:    *explainSelect,
+		ValidatePatch:      *validatePatch,
+		MetricsListen:      *metricsListen,
+		MetricsServeFor:    metricsServeFor,
+		Deployment:         *deployment,
+		ResourceName:       *resourceName,
+		PodTemplateHash:    *templateHash,
+		CompareAlgos:       *compareAlgos,
+		CompareWithVPA:     *compareVPA,
+		HPAHeadroom:        *hpaHeadroom,
+		NoCPULimit:         *noCPULimit,
+		ForceLimits:        *forceLimits,
+		RequestsOnly:       *requestsOnly,
+		ColdStart:          *coldStart,
+		SaveResult:         *saveResult,
+		SaveLoadResults:    *saveLoadRes,
+		LatencyHDR:         *latencyHDR,
+		ProbeTarget:        *validateReach,
+		AutoPortForward:    *autoPortFwd,
+		RemotePort:         *remotePort,
+		Color:              *color,
+		CompactJSON:        *compactJSON,
+		Strategy:           *strategy,
+		Percentile:         *percentile,
+		CPURequestStat:     cpuRequestStat,
+		MemoryRequestStat:  memoryRequestStat,
+		TargetUtilization:  *targetUtil,
+		IgnoreContainers:   kubernetes.ParseContainerList(*ignoreCtrs),
+		ContainerImage:     *containerImage,
+		CombineContainers:  *ctrAggregation,
+		LabelKey:           *labelKey,
+		ThrottleAware:      *throttleAware,
+		MaxDownsize:        *maxDownsize,
+		SkipIfWithin:       *skipIfWithin,
+		NeverDownsize:      *neverDownsize,
+		ProbeAware:         *probeAware,
+		MaxLimitRatio:      *maxLimitRatio,
+		MemoryPeakSamples:  *memPeakSamples,
+		MaxCPU:             maxCPUCores,
+		MaxMemory:          maxMemoryMi,
+		WarnMissingLimits:  *missingLimits,
+		CollectNodeMetrics: *nodeMetrics,
+		AppMetricsURL:      *appMetricsURL,
+		HistoryFile:        *historyFile,
+		HistoryDecay:       *historyDecay,
+		PostHook:           *postHook,
+		RecencyLinear:      recencyLinear,
+		RecencyDecay:       recencyDecay,
+		Iterations:         *iterations,
+		Cooldown:           cooldown,
+		ObserveAfter:       observeAfterDuration,
+		Targets:            targets,
+		SortBy:             *sortBy,
+		SortAscending:      *sortOrder == "asc",
+		Environments:       environments,
+		ExplicitFlags:      explicitFlags,
+		LoadTestOptions: loadtest.Options{
+			TLSMinVersion:   minTLSVersion,
+			TLSCipherSuites: cipherSuites,
+			MaxIdleConns:    *maxIdleConns,
+			MaxConnsPerHost: *maxConnsHost,
+			Endpoints:       endpoints,
+			Resolve:         resolve,
+			ThinkTime:       &thinkTime,
+			BodyTemplate:    *bodyTemplate,
+			Seed:            *seed,
+			FailFast:        *failFast,
+			TotalRequests:   *totalRequests,
+			RetryOnStatus:   retryCodes,
+			MaxRetries:      *maxRetries,
+			RetryBackoff:    retryBackoffDuration,
+			ConcurrencyRamp: concurrencyRamp,
+			CorrectOmission: *correctCO,
+			TargetPort:      *targetPort,
+			ErrorBackoff:    errorBackoff,
+			ErrorBackoffExp: *errBackoffExp,
+			LatencySamples:  *latencySample,
+		},
 	}
 }
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/kubernetes"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/output"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/recommender"
+)
+
+// targetMapping maps a load test URL to the service whose pods it exercises
+type targetMapping struct {
+	URL         string
+	Namespace   string
+	ServiceName string
+}
+
+// loadServicesFile reads "url -> namespace/service" mappings, one per line. Blank lines and lines
+// starting with # are skipped, and a service without a namespace uses defaultNamespace.
+func loadServicesFile(path, defaultNamespace string) ([]targetMapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var targets []targetMapping
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		url, service, ok := strings.Cut(line, "->")
+		url, service = strings.TrimSpace(url), strings.TrimSpace(service)
+		if !ok || url == "" || service == "" {
+			return nil, fmt.Errorf("line %d: expected 'url -> namespace/service', got %q", lineNum, line)
+		}
+
+		namespace := defaultNamespace
+		if ns, name, found := strings.Cut(service, "/"); found {
+			namespace, service = ns, name
+		}
+		if namespace == "" || service == "" {
+			return nil, fmt.Errorf("line %d: invalid service %q", lineNum, service)
+		}
+
+		targets = append(targets, targetMapping{URL: url, Namespace: namespace, ServiceName: service})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets in %s", path)
+	}
+	return targets, nil
+}
+
+// runTargets load tests every target of the services file in parallel, each with its own load
+// tester and metrics collector, and prints the recommendations together
+func runTargets(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) {
+	fmt.Printf("Load testing %d targets in parallel...\n", len(cfg.Targets))
+
+	results := make([]*output.Result, len(cfg.Targets))
+	var wg sync.WaitGroup
+	for i, target := range cfg.Targets {
+		wg.Add(1)
+		go func(i int, target targetMapping) {
+			defer wg.Done()
+
+			result, err := sizeTarget(ctx, cfg, k8sClient, target)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error sizing %s/%s: %v\n", target.Namespace, target.ServiceName, err)
+				return
+			}
+			results[i] = &result
+		}(i, target)
+	}
+	wg.Wait()
+
+	var sized []output.Result
+	for _, r := range results {
+		if r != nil {
+			sized = append(sized, *r)
+		}
+	}
+	if len(sized) == 0 {
+		fmt.Fprintf(os.Stderr, "No target could be sized.\n")
+		os.Exit(exitFailure)
+	}
+
+	output.SortResults(sized, cfg.SortBy, cfg.SortAscending)
+	output.PrintMultiResults(os.Stdout, output.DiskFiles{}, sized, cfg.OutputFormat)
+
+	hookFailed := finishTargets(ctx, cfg, sized)
+	if len(sized) < len(cfg.Targets) || hookFailed {
+		os.Exit(exitFailure)
+	}
+}
+
+// finishTargets appends the results of several sized targets to the history file and runs the
+// post-hook once per target, each time with that target's patch and summary. It reports whether
+// any hook failed.
+func finishTargets(ctx context.Context, cfg Config, sized []output.Result) bool {
+	if cfg.HistoryFile != "" {
+		for _, r := range sized {
+			if err := output.AppendHistory(cfg.HistoryFile, r); err != nil {
+				fmt.Fprintf(os.Stderr, "Error appending to history: %v\n", err)
+			}
+		}
+		fmt.Printf("Recommendations appended to history '%s'\n", cfg.HistoryFile)
+	}
+
+	hookFailed := false
+	if cfg.PostHook != "" {
+		for _, r := range sized {
+			if !runPostHook(ctx, cfg.PostHook, r, cfg.OutputFormat) {
+				hookFailed = true
+			}
+		}
+	}
+	return hookFailed
+}
+
+// parseEnvironments parses the two comma-separated namespace/service pairs of
+// --compare-namespaces. Each environment is load tested through its Service, so its URL is
+// resolved once the cluster can be reached.
+func parseEnvironments(value string) ([]targetMapping, error) {
+	var environments []targetMapping
+	for _, env := range strings.Split(value, ",") {
+		namespace, service, ok := strings.Cut(strings.TrimSpace(env), "/")
+		if !ok || namespace == "" || service == "" {
+			return nil, fmt.Errorf("expected namespace/service, got %q", env)
+		}
+		environments = append(environments, targetMapping{URL: service, Namespace: namespace, ServiceName: service})
+	}
+	if len(environments) != 2 {
+		return nil, fmt.Errorf("expected two namespace/service pairs, got %d", len(environments))
+	}
+	return environments, nil
+}
+
+// runEnvironments sizes the same service in each environment of --compare-namespaces in turn,
+// under the same load, and prints their settings, usage, and recommendations side by side
+func runEnvironments(ctx context.Context, cfg Config, k8sClient *kubernetes.Client) {
+	var results []output.Result
+	for _, env := range cfg.Environments {
+		fmt.Printf("\nSizing %s/%s...\n", env.Namespace, env.ServiceName)
+
+		// Load reaches each environment through its own Service
+		envCfg := cfg
+		envCfg.Target, envCfg.Namespace, envCfg.ServiceName = env.URL, env.Namespace, env.ServiceName
+		if isServiceTarget(envCfg) {
+			resolveServiceTarget(ctx, &envCfg, k8sClient)
+			env.URL = envCfg.Target
+		}
+
+		result, err := sizeTarget(ctx, cfg, k8sClient, env)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error sizing %s/%s: %v\n", env.Namespace, env.ServiceName, err)
+			os.Exit(exitCode(err))
+		}
+		results = append(results, result)
+	}
+
+	output.PrintEnvironmentComparison(os.Stdout, output.DiskFiles{}, results, cfg.OutputFormat)
+
+	if finishTargets(ctx, cfg, results) {
+		os.Exit(exitFailure)
+	}
+}
+
+// sizeTarget runs the load test against a single target of the services file and generates the
+// recommendation for its service
+func sizeTarget(ctx context.Context, cfg Config, k8sClient *kubernetes.Client, target targetMapping) (output.Result, error) {
+	cfg.Target, cfg.Namespace, cfg.ServiceName = target.URL, target.Namespace, target.ServiceName
+
+	if cfg.PrintSelector {
+		printSelector(cfg, k8sClient)
+	}
+
+	// Each target gets the per-replica load times its own replica count
+	if cfg.RPSPerReplica {
+		if err := scaleRPSToReplicas(ctx, &cfg, k8sClient); err != nil {
+			return output.Result{}, fmt.Errorf("error scaling --rps to the replica count: %w", err)
+		}
+	}
+
+	currentSettings, err := readCurrentSettings(ctx, cfg, k8sClient)
+	if err != nil {
+		return output.Result{}, fmt.Errorf("error getting current resource settings: %w", err)
+	}
+
+	missingLimits, limitsAudited := auditLimits(ctx, cfg, k8sClient)
+	divergence := readDivergence(ctx, cfg, k8sClient)
+	cfg.Probes = readProbes(ctx, cfg, k8sClient)
+
+	containers := podContainers(ctx, cfg, k8sClient)
+
+	metricsCollector := metrics.NewCollector(k8sClient, cfg.Namespace, cfg.ServiceName)
+	loadTester := newLoadTester(cfg)
+	if err := probeTarget(ctx, cfg, loadTester); err != nil {
+		return output.Result{}, err
+	}
+
+	it := runIteration(ctx, cfg, loadTester, metricsCollector, currentSettings, nil, containers)
+	if it.failed != nil {
+		return output.Result{}, fmt.Errorf("load test failed: %w", it.failed)
+	}
+	if it.uncovered != nil {
+		return output.Result{}, fmt.Errorf("%w (--require-metrics-for-all-pods)", it.uncovered)
+	}
+	if len(it.metrics) == 0 {
+		return output.Result{}, fmt.Errorf("%w: no metrics collected", kubernetes.ErrNoMetrics)
+	}
+
+	samples := it.metrics
+	if cfg.AggregateWindow > 0 {
+		samples, err = metrics.BucketMetrics(samples, cfg.AggregateWindow, cfg.AggregateFunc)
+		if err != nil {
+			return output.Result{}, fmt.Errorf("error aggregating metrics: %v", err)
+		}
+	}
+
+	recommendations, err := recommender.Generate(samples, currentSettings, cfg.historyOptions(cfg.podOptions(it.perPod)))
+	if err != nil {
+		return output.Result{}, fmt.Errorf("error generating recommendations: %v", err)
+	}
+
+	omitCPULimit, omitMemoryLimit := omitLimits(cfg, currentSettings)
+	result := output.Result{
+		Target:          cfg.Target,
+		ServiceName:     cfg.ServiceName,
+		Namespace:       cfg.Namespace,
+		Duration:        cfg.Duration,
+		RPS:             cfg.RPS,
+		Replicas:        cfg.Replicas,
+		CurrentSettings: currentSettings,
+		Metrics:         samples,
+		Duplicates:      it.duplicates,
+		Partial:         it.partial,
+		Recommendations: recommendations,
+		LoadTest:        it.loadTest,
+		HelmValuesPath:  cfg.HelmValuesPath,
+		Color:           output.ColorEnabled(cfg.Color),
+		CompactJSON:     cfg.CompactJSON,
+		OmitCPULimit:    omitCPULimit,
+		OmitMemoryLimit: omitMemoryLimit,
+		FilePrefix:      output.TargetFilePrefix(cfg.Namespace, cfg.ServiceName),
+		LimitsAudited:   limitsAudited,
+		MissingLimits:   missingLimits,
+		Divergence:      divergence,
+		Probes:          cfg.Probes,
+		Containers:      containerResults(cfg, containers, it.perContainer, it.perContainerPod),
+		SkipIfWithin:    cfg.SkipIfWithin,
+	}
+
+	if cfg.CompareAlgos {
+		result.Comparisons = recommender.CompareAlgorithms(samples, currentSettings, cfg.recommenderOptions())
+	}
+
+	if cfg.CompareWithVPA {
+		result.VPA = readVPA(ctx, cfg, k8sClient)
+	}
+
+	if cfg.HPAHeadroom > 0 {
+		result.HPA = readHPA(ctx, cfg, k8sClient)
+	}
+
+	if cfg.ValidatePatch && !result.Unchanged() {
+		validatePatches(ctx, cfg, k8sClient, &result)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,78 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MissingResources names the requests and limits a targeted container doesn't set
+type MissingResources struct {
+	Container string   `json:"container"`
+	Missing   []string `json:"missing"` // e.g. "cpu limit", "memory request"
+}
+
+// Missing returns the requests and limits that aren't set at all, as opposed to set to zero
+func (s ResourceSettings) Missing() []string {
+	var missing []string
+	if !s.HasCPURequest {
+		missing = append(missing, "cpu request")
+	}
+	if !s.HasCPULimit {
+		missing = append(missing, "cpu limit")
+	}
+	if !s.HasMemoryRequest {
+		missing = append(missing, "memory request")
+	}
+	if !s.HasMemoryLimit {
+		missing = append(missing, "memory limit")
+	}
+	return missing
+}
+
+// Inconsistencies describes requests set above their limits, which the API server rejects for
+// new pods, so such a workload may fail to schedule or roll out
+func (s ResourceSettings) Inconsistencies() []string {
+	var problems []string
+	if s.HasCPURequest && s.HasCPULimit && s.CPURequest > s.CPULimit {
+		problems = append(problems, fmt.Sprintf("current CPU request %.0fm exceeds the CPU limit %.0fm; new pods may be rejected or unschedulable",
+			s.CPURequest*1000, s.CPULimit*1000))
+	}
+	if s.HasMemoryRequest && s.HasMemoryLimit && s.MemoryRequest > s.MemoryLimit {
+		problems = append(problems, fmt.Sprintf("current memory request %.0fMi exceeds the memory limit %.0fMi; new pods may be rejected or unschedulable",
+			s.MemoryRequest, s.MemoryLimit))
+	}
+	return problems
+}
+
+// FindMissingResources checks every container of the target's pods that isn't ignored for unset
+// CPU and memory requests and limits. Like GetResourceSettings it reads the first matching pod,
+// and containers that set all of them are left out.
+func (c *Client) FindMissingResources(ctx context.Context, namespace, target string) ([]MissingResources, error) {
+	selector := c.podSelector(target)
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	if len(pods.Items) == 0 {
+		return nil, fmt.Errorf("%w matching the target: %s", ErrNoPodsFound, target)
+	}
+
+	var result []MissingResources
+	containers := pods.Items[0].Spec.Containers
+	for i := range containers {
+		if c.isIgnoredContainer(containers[i].Name) {
+			continue
+		}
+		if missing := settingsFromContainer(&containers[i]).Missing(); len(missing) > 0 {
+			result = append(result, MissingResources{Container: containers[i].Name, Missing: missing})
+		}
+	}
+
+	return result, nil
+}
@@ -3,10 +3,16 @@ package kubernetes
 import (
 	"context"
 	"fmt"
+	"io"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -15,17 +21,68 @@ import (
 )
 
 // ResourceSettings represents the resource requests and limits
+// CPU values are in cores and memory values in Mi.
 type ResourceSettings struct {
-	CPURequest    float64
-	CPULimit      float64
-	MemoryRequest float64
-	MemoryLimit   float64
+	CPURequest    float64 `json:"cpuRequest"`
+	CPULimit      float64 `json:"cpuLimit"`
+	MemoryRequest float64 `json:"memoryRequest"`
+	MemoryLimit   float64 `json:"memoryLimit"`
+
+	// Whether each value is actually set on the container, distinguishing "unset" from zero
+	HasCPURequest    bool `json:"hasCPURequest"`
+	HasCPULimit      bool `json:"hasCPULimit"`
+	HasMemoryRequest bool `json:"hasMemoryRequest"`
+	HasMemoryLimit   bool `json:"hasMemoryLimit"`
+
+	// Containers skipped as sidecars when reading the settings and aggregating metrics
+	IgnoredContainers []string `json:"ignoredContainers,omitempty"`
+
+	// Requests and limits of resources other than cpu and memory, such as nvidia.com/gpu or
+	// hugepages-2Mi, as quantity strings. Patches carry them over unchanged.
+	OtherRequests map[string]string `json:"otherRequests,omitempty"`
+	OtherLimits   map[string]string `json:"otherLimits,omitempty"`
 }
 
 // Client provides methods to interact with Kubernetes
 type Client struct {
-	clientset     *kubernetes.Clientset
+	config        *rest.Config
+	clientset     kubernetes.Interface
 	metricsClient *metricsv.Clientset
+	dynamicClient dynamic.Interface // Reads custom resources such as VerticalPodAutoscalers
+
+	ignoredContainers []string
+	podTemplateHash   string    // Only pods of the ReplicaSet with this hash are measured (empty for all)
+	containerAgg      string    // How the usage of a pod's containers is combined (empty for sum)
+	labelKey          string    // Label a bare name or URL host is matched against (empty for app)
+	trace             io.Writer // Receives the selector resolution trace (nil for none)
+	tracedMetrics     sync.Map  // Targets whose metrics lookups were traced, which repeat every sample
+
+	// Names of the containers selected by image, across the target's pods (nil selects all)
+	imageContainers map[string]bool
+
+	// Why pod and node metrics can't be read, when metrics-server is unavailable and
+	// metricsClient is nil
+	metricsErr error
+
+	// Serializes the trace lines of targets resolved in parallel
+	traceMu sync.Mutex
+}
+
+// DefaultLabelKey is the label a target's name or URL host is matched against by default
+const DefaultLabelKey = "app"
+
+// SetLabelKey sets the label a target that isn't a label selector is matched against, e.g.
+// app.kubernetes.io/name or k8s-app on clusters that don't set the bare app label
+func (c *Client) SetLabelKey(key string) {
+	c.labelKey = key
+}
+
+// selectorLabelKey returns the configured label key, or DefaultLabelKey if none is set
+func (c *Client) selectorLabelKey() string {
+	if c.labelKey == "" {
+		return DefaultLabelKey
+	}
+	return c.labelKey
 }
 
 // NewClient creates a new Kubernetes client
@@ -47,13 +104,30 @@ func NewClient(kubeconfigPath string) (*Client, error) {
 	}
 
 	// If we need to use kubeconfig file
+	contextName := "in-cluster"
 	if config == nil {
 		config, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
 		if err != nil {
 			return nil, fmt.Errorf("error building kubeconfig: %v", err)
 		}
+		contextName = currentContextName(kubeconfigPath)
 	}
 
+	// Fail early with an actionable message if the API server can't be reached
+	probeConfig := rest.CopyConfig(config)
+	probeConfig.Timeout = connectivityTimeout
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(probeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error creating discovery client: %v", err)
+	}
+	if _, err := discoveryClient.ServerVersion(); err != nil {
+		return nil, fmt.Errorf("%w at %s (context %q): %v", ErrClusterUnreachable, config.Host, contextName, err)
+	}
+
+	// Without metrics-server the current settings can still be read and the load test run, so
+	// only the calls that need metrics fail, with the reason found here
+	metricsErr := checkMetricsAPI(discoveryClient)
+
 	// Create clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -61,21 +135,45 @@ func NewClient(kubeconfigPath string) (*Client, error) {
 	}
 
 	// Create metrics client
-	metricsClient, err := metricsv.NewForConfig(config)
+	var metricsClient *metricsv.Clientset
+	if metricsErr == nil {
+		metricsClient, err = metricsv.NewForConfig(config)
+		if err != nil {
+			metricsClient, metricsErr = nil, fmt.Errorf("%w: error creating Metrics client: %v", ErrMetricsUnavailable, err)
+		}
+	}
+
+	// Create dynamic client for custom resources
+	dynamicClient, err := dynamic.NewForConfig(config)
 	if err != nil {
-		return nil, fmt.Errorf("error creating Metrics client: %v", err)
+		return nil, fmt.Errorf("error creating dynamic client: %v", err)
 	}
 
 	return &Client{
+		config:        config,
 		clientset:     clientset,
 		metricsClient: metricsClient,
+		metricsErr:    metricsErr,
+		dynamicClient: dynamicClient,
 	}, nil
 }
 
+// MetricsError returns why pod and node metrics can't be read, wrapping ErrMetricsUnavailable,
+// or nil if metrics-server is available. Everything else the client does works without it.
+func (c *Client) MetricsError() error {
+	if c.metricsClient != nil {
+		return nil
+	}
+	if c.metricsErr != nil {
+		return c.metricsErr
+	}
+	return fmt.Errorf("%w: no metrics client", ErrMetricsUnavailable)
+}
+
 // GetResourceSettings retrieves the current resource settings for pods matching the target
 func (c *Client) GetResourceSettings(ctx context.Context, namespace, target string) (ResourceSettings, error) {
 	// Handle different target formats (service name, deployment name, or label selector)
-	selector := extractSelector(target)
+	selector := c.traceResolution("current settings", namespace, target)
 
 	// Get pods using the selector
 	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
@@ -85,34 +183,57 @@ func (c *Client) GetResourceSettings(ctx context.Context, namespace, target stri
 		return ResourceSettings{}, fmt.Errorf("error listing pods: %v", err)
 	}
 
+	if c.trace != nil {
+		names := make([]string, 0, len(pods.Items))
+		for _, pod := range pods.Items {
+			names = append(names, pod.Name)
+		}
+		c.traceMatched("pods", names)
+	}
+
 	if len(pods.Items) == 0 {
-		return ResourceSettings{}, fmt.Errorf("no pods found matching the target: %s", target)
+		return ResourceSettings{}, fmt.Errorf("%w matching the target: %s", ErrNoPodsFound, target)
 	}
 
 	// Just use the first pod to get resource settings
-	pod := pods.Items[0]
-	settings := ResourceSettings{}
+	return c.settingsFromPod(pods.Items[0])
+}
 
-	// Find the main container
-	if len(pod.Spec.Containers) == 0 {
-		return ResourceSettings{}, fmt.Errorf("pod has no containers")
+// GetPodResourceSettings retrieves the current resource settings of the named pod
+func (c *Client) GetPodResourceSettings(ctx context.Context, namespace, podName string) (ResourceSettings, error) {
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return ResourceSettings{}, fmt.Errorf("error getting pod %s: %v", podName, err)
 	}
 
-	container := pod.Spec.Containers[0]
+	return c.settingsFromPod(*pod)
+}
 
-	// Parse CPU request
-	if val, ok := container.Resources.Requests.Cpu().AsInt64(); ok {
-		settings.CPURequest = float64(val) / 1000
-	} else {
-		settings.CPURequest = float64(container.Resources.Requests.Cpu().MilliValue()) / 1000
+// settingsFromPod reads the resource settings of the pod's main container
+func (c *Client) settingsFromPod(pod corev1.Pod) (ResourceSettings, error) {
+	// Find the main container, skipping sidecars
+	if len(pod.Spec.Containers) == 0 {
+		return ResourceSettings{}, fmt.Errorf("pod has no containers")
 	}
 
-	// Parse CPU limit
-	if val, ok := container.Resources.Limits.Cpu().AsInt64(); ok {
-		settings.CPULimit = float64(val) / 1000
-	} else {
-		settings.CPULimit = float64(container.Resources.Limits.Cpu().MilliValue()) / 1000
+	container, ignored := c.selectContainer(pod.Spec.Containers)
+	if container == nil {
+		return ResourceSettings{}, fmt.Errorf("all containers of pod %s are ignored: %s", pod.Name, strings.Join(ignored, ", "))
 	}
+	settings := settingsFromContainer(container)
+	settings.IgnoredContainers = ignored
+	c.tracef("  settings read from container %s of pod %s", container.Name, pod.Name)
+
+	return settings, nil
+}
+
+// settingsFromContainer reads the resource requests and limits of a container
+func settingsFromContainer(container *corev1.Container) ResourceSettings {
+	settings := ResourceSettings{}
+
+	// Parse CPU request and limit in cores, via millicores so "2" and "500m" both read correctly
+	settings.CPURequest = float64(container.Resources.Requests.Cpu().MilliValue()) / 1000
+	settings.CPULimit = float64(container.Resources.Limits.Cpu().MilliValue()) / 1000
 
 	// Parse Memory request
 	settings.MemoryRequest = float64(container.Resources.Requests.Memory().Value()) / (1024 * 1024)
@@ -120,53 +241,146 @@ func (c *Client) GetResourceSettings(ctx context.Context, namespace, target stri
 	// Parse Memory limit
 	settings.MemoryLimit = float64(container.Resources.Limits.Memory().Value()) / (1024 * 1024)
 
-	return settings, nil
+	// Record which values are set at all
+	_, settings.HasCPURequest = container.Resources.Requests[corev1.ResourceCPU]
+	_, settings.HasCPULimit = container.Resources.Limits[corev1.ResourceCPU]
+	_, settings.HasMemoryRequest = container.Resources.Requests[corev1.ResourceMemory]
+	_, settings.HasMemoryLimit = container.Resources.Limits[corev1.ResourceMemory]
+
+	settings.OtherRequests = otherResources(container.Resources.Requests)
+	settings.OtherLimits = otherResources(container.Resources.Limits)
+
+	return settings
+}
+
+// otherResources returns the quantities of the resources in the list other than cpu and memory,
+// or nil if there are none
+func otherResources(list corev1.ResourceList) map[string]string {
+	var other map[string]string
+	for name, quantity := range list {
+		if name == corev1.ResourceCPU || name == corev1.ResourceMemory {
+			continue
+		}
+		if other == nil {
+			other = make(map[string]string)
+		}
+		other[string(name)] = quantity.String()
+	}
+	return other
+}
+
+// ListPodNames returns the label selector resolved from the target and the names of the pods it matches
+func (c *Client) ListPodNames(ctx context.Context, namespace, target string) (string, []string, error) {
+	selector := c.podSelector(target)
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return selector, nil, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	names := make([]string, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+
+	return selector, names, nil
+}
+
+// PodUsage is the CPU (in cores) and memory (in Mi) usage of a single pod
+type PodUsage struct {
+	CPU    float64
+	Memory float64
 }
 
 // GetPodMetrics retrieves current metrics for pods in the namespace matching the target
 func (c *Client) GetPodMetrics(ctx context.Context, namespace, target string) (float64, float64, error) {
+	usage, err := c.GetPodUsage(ctx, namespace, target)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Calculate averages across pods
+	avgCPU, avgMemory := AverageUsage(usage)
+	return avgCPU, avgMemory, nil
+}
+
+// GetPodUsage retrieves the current usage of each pod matching the target, keyed by pod name
+func (c *Client) GetPodUsage(ctx context.Context, namespace, target string) (map[string]PodUsage, error) {
 	// Handle different target formats (service name, deployment name, or label selector)
-	selector := extractSelector(target)
+	selector := c.podSelector(target)
+	trace := false
+	if c.trace != nil {
+		_, traced := c.tracedMetrics.LoadOrStore(namespace+"/"+target, true)
+		trace = !traced
+	}
+	if trace {
+		c.traceResolution("metrics", namespace, target)
+	}
 
 	// Get pod metrics
-	podMetrics, err := c.metricsClient.MetricsV1beta1().PodMetricses(namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: selector,
-	})
+	podMetrics, err := c.listPodMetrics(ctx, namespace, selector)
 	if err != nil {
-		return 0, 0, fmt.Errorf("error getting pod metrics: %v", err)
+		return nil, err
 	}
 
-	if len(podMetrics.Items) == 0 {
-		return 0, 0, fmt.Errorf("no metrics found for target: %s", target)
+	if trace {
+		names := make([]string, 0, len(podMetrics))
+		for _, pod := range podMetrics {
+			names = append(names, pod.Name)
+		}
+		c.traceMatched("pods with metrics", names)
 	}
 
-	var totalCPU float64
-	var totalMemory float64
-	var podCount int
+	if len(podMetrics) == 0 {
+		return nil, fmt.Errorf("%w for target: %s", ErrNoMetrics, target)
+	}
 
-	// Sum up metrics across all pods
-	for _, pod := range podMetrics.Items {
+	// Combine metrics across the containers of each pod
+	usage := make(map[string]PodUsage, len(podMetrics))
+	for _, pod := range podMetrics {
+		var containers []PodUsage
 		for _, container := range pod.Containers {
-			cpuQuantity := container.Usage.Cpu()
-			memQuantity := container.Usage.Memory()
+			if c.isIgnoredContainer(container.Name) {
+				continue
+			}
 
-			// Convert CPU to cores (as float)
-			cpuValue := float64(cpuQuantity.MilliValue()) / 1000
+			containers = append(containers, PodUsage{
+				// Convert CPU to cores (as float)
+				CPU: float64(container.Usage.Cpu().MilliValue()) / 1000,
+				// Convert memory to Mi
+				Memory: float64(container.Usage.Memory().Value()) / (1024 * 1024),
+			})
+		}
+		usage[pod.Name] = combineContainerUsage(containers, c.containerAgg)
+	}
 
-			// Convert memory to Mi
-			memoryValue := float64(memQuantity.Value()) / (1024 * 1024)
+	return usage, nil
+}
 
-			totalCPU += cpuValue
-			totalMemory += memoryValue
-		}
-		podCount++
+// checkMetricsAPI verifies that the metrics.k8s.io API served by metrics-server is registered
+func checkMetricsAPI(discoveryClient discovery.DiscoveryInterface) error {
+	if _, err := discoveryClient.ServerResourcesForGroupVersion(metricsGroupVersion); err != nil {
+		return fmt.Errorf("%w in this cluster (%s API not registered: %v); "+
+			"install metrics-server and retry", ErrMetricsUnavailable, metricsGroupVersion, err)
 	}
+	return nil
+}
 
-	// Calculate averages
-	avgCPU := totalCPU / float64(podCount)
-	avgMemory := totalMemory / float64(podCount)
+// metricsGroupVersion is the API group version served by metrics-server
+const metricsGroupVersion = "metrics.k8s.io/v1beta1"
 
-	return avgCPU, avgMemory, nil
+// connectivityTimeout bounds the startup connectivity check
+const connectivityTimeout = 10 * time.Second
+
+// currentContextName returns the current context of the kubeconfig file, or "unknown"
+func currentContextName(kubeconfigPath string) string {
+	rawConfig, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil || rawConfig.CurrentContext == "" {
+		return "unknown"
+	}
+	return rawConfig.CurrentContext
 }
 
 // Note: YAML patch generation functionality has been centralized in the output package
@@ -174,24 +388,30 @@ func (c *Client) GetPodMetrics(ctx context.Context, namespace, target string) (f
 
 // Helper functions
 
-// extractSelector attempts to create a label selector from the target
-func extractSelector(target string) string {
-	// If target is a URL, extract the host part
-	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
-		parts := strings.Split(target, "//")
-		if len(parts) > 1 {
-			hostPort := strings.Split(parts[1], ":")
-			target = hostPort[0]
-		}
-	}
+// extractSelector attempts to create a label selector from the target, matching a name or URL
+// host against labelKey
+func extractSelector(target, labelKey string) string {
+	target = selectorHost(target)
 
 	// If target already looks like a selector, return it
 	if strings.Contains(target, "=") {
 		return target
 	}
 
-	// Default to app=target as a common label pattern
-	return fmt.Sprintf("app=%s", target)
+	// Default to <labelKey>=target, app=target unless configured otherwise
+	return fmt.Sprintf("%s=%s", labelKey, target)
+}
+
+// selectorHost returns the host part of a URL target, or the target unchanged if it isn't a URL
+func selectorHost(target string) string {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		parts := strings.Split(target, "//")
+		if len(parts) > 1 {
+			hostPort := strings.Split(parts[1], ":")
+			return hostPort[0]
+		}
+	}
+	return target
 }
 
 // extractResourceName gets a resource name from the target
@@ -0,0 +1,516 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+func TestGetResourceSettingsCPU(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myservice-1", Namespace: "default", Labels: map[string]string{"app": "myservice"}},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: "app",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("500m"),
+						corev1.ResourceMemory: resource.MustParse("256Mi"),
+					},
+					Limits: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("2"),
+						corev1.ResourceMemory: resource.MustParse("1Gi"),
+						"nvidia.com/gpu":      resource.MustParse("1"),
+					},
+				},
+			}},
+		},
+	}
+	c := &Client{clientset: fake.NewSimpleClientset(pod)}
+
+	settings, err := c.GetResourceSettings(context.Background(), "default", "myservice")
+	if err != nil {
+		t.Fatalf("GetResourceSettings returned an error: %v", err)
+	}
+
+	if settings.CPURequest != 0.5 {
+		t.Errorf("CPU request 500m: got %v cores, want 0.5", settings.CPURequest)
+	}
+	if settings.CPULimit != 2.0 {
+		t.Errorf("CPU limit 2: got %v cores, want 2.0", settings.CPULimit)
+	}
+	if settings.MemoryRequest != 256 || settings.MemoryLimit != 1024 {
+		t.Errorf("memory: got %vMi/%vMi, want 256Mi/1024Mi", settings.MemoryRequest, settings.MemoryLimit)
+	}
+	if settings.OtherLimits["nvidia.com/gpu"] != "1" || settings.OtherRequests != nil {
+		t.Errorf("other resources: got requests %v, limits %v, want only the GPU limit", settings.OtherRequests, settings.OtherLimits)
+	}
+}
+
+func TestDescribeSelector(t *testing.T) {
+	c := &Client{}
+	tests := []struct {
+		target, selector, derivation string
+	}{
+		{"myservice", "app=myservice", "app=<name> from the name 'myservice'"},
+		{"http://myservice:8080", "app=myservice", "app=<host> from the host of the URL 'http://myservice:8080'"},
+		{"tier=web", "tier=web", "'tier=web' used as a label selector"},
+	}
+	for _, tt := range tests {
+		selector, derivation := c.DescribeSelector(tt.target)
+		if selector != tt.selector || derivation != tt.derivation {
+			t.Errorf("%s: got %q (%s), want %q (%s)", tt.target, selector, derivation, tt.selector, tt.derivation)
+		}
+	}
+
+	c.SetPodTemplateHash("abc123")
+	if selector, derivation := c.DescribeSelector("myservice"); selector != "app=myservice,pod-template-hash=abc123" ||
+		derivation != "app=<name> from the name 'myservice', narrowed to pod-template-hash=abc123" {
+		t.Errorf("with a pod-template-hash: got %q (%s)", selector, derivation)
+	}
+
+	c = &Client{}
+	c.SetLabelKey("app.kubernetes.io/name")
+	if selector, derivation := c.DescribeSelector("http://myservice:8080"); selector != "app.kubernetes.io/name=myservice" ||
+		derivation != "app.kubernetes.io/name=<host> from the host of the URL 'http://myservice:8080'" {
+		t.Errorf("with a label key: got %q (%s)", selector, derivation)
+	}
+}
+
+func TestSelectorTrace(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myservice-1", Namespace: "default", Labels: map[string]string{"app": "myservice"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "istio-proxy"}, {Name: "app"}}},
+	}
+	c := &Client{clientset: fake.NewSimpleClientset(pod)}
+	c.SetIgnoredContainers([]string{"istio-proxy"})
+
+	var trace bytes.Buffer
+	c.SetTrace(&trace)
+	if _, err := c.GetResourceSettings(context.Background(), "default", "http://myservice:8080/api"); err != nil {
+		t.Fatalf("GetResourceSettings returned an error: %v", err)
+	}
+
+	for _, want := range []string{
+		`current settings: target "http://myservice:8080/api" in namespace default`,
+		`parsed as a URL with host "myservice"`,
+		"selector: app=myservice",
+		"matched 1 pods: myservice-1",
+		"settings read from container app of pod myservice-1",
+	} {
+		if !strings.Contains(trace.String(), want) {
+			t.Errorf("trace is missing %q:\n%s", want, trace.String())
+		}
+	}
+
+	c.SetTrace(nil)
+	trace.Reset()
+	c.GetResourceSettings(context.Background(), "default", "myservice")
+	if trace.Len() != 0 {
+		t.Errorf("trace written after it was disabled:\n%s", trace.String())
+	}
+}
+
+func TestSelectContainersByImage(t *testing.T) {
+	pod := func(name, container string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "myservice"}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "proxy", Image: "docker.io/envoyproxy/envoy:v1.28"},
+				{Name: container, Image: "registry.example.com/shop/checkout:v2.1"},
+			}},
+		}
+	}
+	c := &Client{clientset: fake.NewSimpleClientset(pod("myservice-1", "app-x1"), pod("myservice-2", "app-y2"))}
+
+	if _, err := c.SelectContainersByImage(context.Background(), "default", "myservice", "shop/payments"); err == nil {
+		t.Error("expected an error for an image no container runs")
+	}
+
+	names, err := c.SelectContainersByImage(context.Background(), "default", "myservice", "*/checkout:v2*")
+	if err != nil {
+		t.Fatalf("SelectContainersByImage returned an error: %v", err)
+	}
+	if strings.Join(names, ",") != "app-x1,app-y2" {
+		t.Errorf("got containers %v, want app-x1 and app-y2", names)
+	}
+	if c.isIgnoredContainer("app-y2") || !c.isIgnoredContainer("proxy") {
+		t.Error("only the containers running the image should be selected")
+	}
+
+	settings, err := c.GetResourceSettings(context.Background(), "default", "myservice")
+	if err != nil {
+		t.Fatalf("GetResourceSettings returned an error: %v", err)
+	}
+	if len(settings.IgnoredContainers) != 1 || settings.IgnoredContainers[0] != "proxy" {
+		t.Errorf("got ignored containers %v, want the proxy", settings.IgnoredContainers)
+	}
+
+	for _, tt := range []struct {
+		pattern string
+		want    bool
+	}{
+		{"checkout", true},
+		{"checkout:v3", false},
+		{"registry.example.com/*", true},
+		{"*checkout:v?.1", true},
+		{"checkout*", false},
+	} {
+		if got := ImageMatches("registry.example.com/shop/checkout:v2.1", tt.pattern); got != tt.want {
+			t.Errorf("ImageMatches(%q): got %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestCombineContainerUsage(t *testing.T) {
+	containers := []PodUsage{{CPU: 0.3, Memory: 100}, {CPU: 0.1, Memory: 300}}
+	tests := []struct {
+		aggregation string
+		want        PodUsage
+	}{
+		{"", PodUsage{CPU: 0.4, Memory: 400}},
+		{ContainerAggregationSum, PodUsage{CPU: 0.4, Memory: 400}},
+		{ContainerAggregationMax, PodUsage{CPU: 0.3, Memory: 300}},
+		{ContainerAggregationAvg, PodUsage{CPU: 0.2, Memory: 200}},
+	}
+	for _, tt := range tests {
+		got := combineContainerUsage(containers, tt.aggregation)
+		if math.Abs(got.CPU-tt.want.CPU) > 1e-9 || math.Abs(got.Memory-tt.want.Memory) > 1e-9 {
+			t.Errorf("%q: got %+v, want %+v", tt.aggregation, got, tt.want)
+		}
+	}
+
+	if got := combineContainerUsage(nil, ContainerAggregationAvg); got != (PodUsage{}) {
+		t.Errorf("no containers: got %+v, want zero usage", got)
+	}
+}
+
+func TestPodContainerUsage(t *testing.T) {
+	pod := func(name, appCPU string) metricsapi.PodMetrics {
+		return metricsapi.PodMetrics{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Containers: []metricsapi.ContainerMetrics{
+				{Name: "app", Usage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(appCPU), corev1.ResourceMemory: resource.MustParse("64Mi")}},
+				{Name: "istio-proxy", Usage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m"), corev1.ResourceMemory: resource.MustParse("32Mi")}},
+			},
+		}
+	}
+	c := &Client{ignoredContainers: DefaultIgnoredContainers}
+
+	// Each pod keeps its own reading, so pod-peak can size the container from the busiest pod
+	// rather than from the average of 0.5 cores
+	usage := c.podContainerUsage([]metricsapi.PodMetrics{pod("myservice-1", "900m"), pod("myservice-2", "100m")})
+	if len(usage) != 1 || usage["app"] == nil {
+		t.Fatalf("got containers %v, want only app", usage)
+	}
+	if got := usage["app"]["myservice-1"]; got != (PodUsage{CPU: 0.9, Memory: 64}) {
+		t.Errorf("myservice-1: got %+v, want 0.9 cores and 64 MiB", got)
+	}
+	if got := usage["app"]["myservice-2"]; got != (PodUsage{CPU: 0.1, Memory: 64}) {
+		t.Errorf("myservice-2: got %+v, want 0.1 cores and 64 MiB", got)
+	}
+}
+
+func TestValidatePatch(t *testing.T) {
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "myservice", Namespace: "default"}}
+	clientset := fake.NewSimpleClientset(deployment)
+	c := &Client{clientset: clientset}
+
+	patch := []byte(`{"spec":{"template":{"spec":{"containers":[{"name":"app","resources":{"requests":{"cpu":"100m"}}}]}}}}`)
+	if err := c.ValidatePatch(context.Background(), "default", "myservice", patch); err != nil {
+		t.Fatalf("valid patch: unexpected error: %v", err)
+	}
+
+	actions := clientset.Actions()
+	action, ok := actions[len(actions)-1].(k8stesting.PatchAction)
+	if !ok || action.GetName() != "myservice" || action.GetPatchType() != types.StrategicMergePatchType {
+		t.Errorf("got action %+v, want a strategic merge patch of myservice", actions[len(actions)-1])
+	}
+
+	if err := c.ValidatePatch(context.Background(), "default", "other", patch); err == nil {
+		t.Error("patch of a missing Deployment: got nil, want an error")
+	}
+}
+
+func TestScaledToZero(t *testing.T) {
+	deployment := func(name string, replicas int32) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{
+						Name: "app",
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")},
+						},
+					}}},
+				},
+			},
+		}
+	}
+	c := &Client{clientset: fake.NewSimpleClientset(deployment("idle", 0), deployment("busy", 2))}
+
+	for target, want := range map[string]string{"idle": "idle", "http://idle:8080": "idle", "busy": "", "missing": ""} {
+		if got, err := c.FindScaledToZero(context.Background(), "default", target); err != nil || got != want {
+			t.Errorf("%s: got %q (%v), want %q", target, got, err, want)
+		}
+	}
+
+	settings, err := c.GetTemplateResourceSettings(context.Background(), "default", "idle")
+	if err != nil || settings.CPURequest != 0.25 || !settings.HasCPURequest || settings.HasMemoryRequest {
+		t.Errorf("template settings: got %+v (%v), want only a 250m CPU request", settings, err)
+	}
+}
+
+func TestMetricsCoverage(t *testing.T) {
+	pod := func(name string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "myservice"}},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+	c := &Client{clientset: fake.NewSimpleClientset(
+		pod("myservice-1", corev1.PodRunning),
+		pod("myservice-2", corev1.PodRunning),
+		pod("myservice-3", corev1.PodRunning),
+		pod("myservice-4", corev1.PodRunning),
+		pod("myservice-5", corev1.PodPending),
+	)}
+
+	running, err := c.CountRunningPods(context.Background(), "default", "myservice")
+	if err != nil || running != 4 {
+		t.Fatalf("CountRunningPods: got %d (%v), want 4", running, err)
+	}
+
+	if (MetricsCoverage{Reported: 2, Running: running}).Partial() {
+		t.Error("2 of 4 pods reported: got partial, want complete")
+	}
+	if !(MetricsCoverage{Reported: 1, Running: running}).Partial() {
+		t.Error("1 of 4 pods reported: got complete, want partial")
+	}
+
+	// Strict mode names the pods without metrics
+	if err := (MetricsCoverage{Reported: 3, Running: running}).Require(1); !errors.Is(err, ErrNoMetrics) ||
+		err.Error() != "no metrics found for 1 of 4 running pods" {
+		t.Errorf("Require(1) with 3 of 4 pods: got %v", err)
+	}
+	if err := (MetricsCoverage{Reported: 3, Running: running}).Require(0.75); err != nil {
+		t.Errorf("Require(0.75) with 3 of 4 pods: got %v, want nil", err)
+	}
+
+	cpu, memory := AverageUsage(map[string]PodUsage{"a": {CPU: 0.1, Memory: 100}, "b": {CPU: 0.3, Memory: 300}})
+	if math.Abs(cpu-0.2) > 1e-9 || memory != 200 {
+		t.Errorf("AverageUsage: got %v cores, %vMi, want 0.2 cores, 200Mi", cpu, memory)
+	}
+}
+
+func TestMetricsUnavailable(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "myservice-1", Namespace: "default", Labels: map[string]string{"app": "myservice"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "app",
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			},
+		}}},
+	}
+	reason := fmt.Errorf("%w in this cluster", ErrMetricsUnavailable)
+	c := &Client{clientset: fake.NewSimpleClientset(pod), metricsErr: reason}
+
+	// Settings are still read
+	settings, err := c.GetResourceSettings(context.Background(), "default", "myservice")
+	if err != nil || settings.CPURequest != 0.1 {
+		t.Fatalf("GetResourceSettings: got %+v, %v; want the 100m CPU request", settings, err)
+	}
+
+	// Only the calls that need metrics fail, with the reason
+	if err := c.MetricsError(); err != reason {
+		t.Errorf("MetricsError: got %v, want %v", err, reason)
+	}
+	if _, err := c.GetPodUsage(context.Background(), "default", "myservice"); !errors.Is(err, ErrMetricsUnavailable) {
+		t.Errorf("GetPodUsage: got %v, want ErrMetricsUnavailable", err)
+	}
+	if _, err := c.GetNodeUsage(context.Background(), "default", "myservice"); !errors.Is(err, ErrMetricsUnavailable) {
+		t.Errorf("GetNodeUsage: got %v, want ErrMetricsUnavailable", err)
+	}
+}
+
+func TestGetSettingsDivergence(t *testing.T) {
+	pod := func(name, cpu, memoryLimit string) *corev1.Pod {
+		resources := corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu), corev1.ResourceMemory: resource.MustParse("128Mi")},
+		}
+		if memoryLimit != "" {
+			resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(memoryLimit)}
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "myservice"}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "istio-proxy", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")}}},
+				{Name: "app", Resources: resources},
+			}},
+		}
+	}
+
+	// Pods that agree, apart from an ignored sidecar, don't diverge
+	c := &Client{clientset: fake.NewSimpleClientset(pod("myservice-1", "200m", "256Mi"), pod("myservice-2", "200m", "256Mi"))}
+	c.SetIgnoredContainers([]string{"istio-proxy"})
+	if d, err := c.GetSettingsDivergence(context.Background(), "default", "myservice"); err != nil || d != nil {
+		t.Fatalf("agreeing pods: got %+v, %v; want no divergence", d, err)
+	}
+
+	// Mid-rollout, two pods run the new CPU request and one doesn't set the memory limit
+	c = &Client{clientset: fake.NewSimpleClientset(
+		pod("myservice-1", "100m", "256Mi"), pod("myservice-2", "200m", "256Mi"), pod("myservice-3", "200m", ""))}
+	c.SetIgnoredContainers([]string{"istio-proxy"})
+	d, err := c.GetSettingsDivergence(context.Background(), "default", "myservice")
+	if err != nil {
+		t.Fatalf("GetSettingsDivergence returned an error: %v", err)
+	}
+	if d == nil || d.Container != "app" || d.Pods != 3 || d.Variants != 3 || len(d.Resources) != 2 {
+		t.Fatalf("got %+v, want container app with 3 variants across 3 pods and 2 differing values", d)
+	}
+	if cpu := d.Resources[0]; cpu.Resource != "cpu request" || cpu.Min != 0.1 || cpu.Max != 0.2 || cpu.Mode != 0.2 || cpu.Unset != 0 {
+		t.Errorf("cpu request: got %+v, want 100m to 200m, mostly 200m", cpu)
+	}
+	if memory := d.Resources[1]; memory.Resource != "memory limit" || memory.Min != 256 || memory.Max != 256 || memory.Unset != 1 {
+		t.Errorf("memory limit: got %+v, want 256Mi with 1 pod unset", memory)
+	}
+}
+
+func TestGetServiceEndpoint(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "web"},
+			Ports: []corev1.ServicePort{
+				{Name: "metrics", Port: 9090, TargetPort: intstr.FromInt(9090)},
+				{Name: "http", Port: 80, TargetPort: intstr.FromString("web")},
+			},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:  "app",
+			Ports: []corev1.ContainerPort{{Name: "web", ContainerPort: 8080}},
+		}}},
+	}
+	c := &Client{clientset: fake.NewSimpleClientset(svc, pod)}
+
+	// The http port is preferred, and its named target port resolved through the pods
+	endpoint, err := c.GetServiceEndpoint(context.Background(), "default", "web")
+	if err != nil {
+		t.Fatalf("GetServiceEndpoint returned an error: %v", err)
+	}
+	if endpoint.URL != "http://web.default.svc:80" || endpoint.TargetPort != 8080 {
+		t.Errorf("got %+v, want http://web.default.svc:80 routing to 8080", endpoint)
+	}
+
+	if _, err := c.GetServiceEndpoint(context.Background(), "default", "missing"); err == nil {
+		t.Error("expected an error for a missing Service")
+	}
+}
+
+func TestGetVPARecommendation(t *testing.T) {
+	vpa := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "autoscaling.k8s.io/v1",
+		"kind":       "VerticalPodAutoscaler",
+		"metadata":   map[string]interface{}{"name": "myservice-vpa", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"targetRef":    map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": "myservice"},
+			"updatePolicy": map[string]interface{}{"updateMode": "Off"},
+		},
+		"status": map[string]interface{}{
+			"recommendation": map[string]interface{}{
+				"containerRecommendations": []interface{}{
+					map[string]interface{}{
+						"containerName": "app",
+						"target":        map[string]interface{}{"cpu": "250m", "memory": "256Mi"},
+						"lowerBound":    map[string]interface{}{"cpu": "100m", "memory": "128Mi"},
+						"upperBound":    map[string]interface{}{"cpu": "1", "memory": "1Gi"},
+					},
+					map[string]interface{}{
+						"containerName": "worker",
+						"target":        map[string]interface{}{"cpu": "50m", "memory": "64Mi"},
+					},
+				},
+			},
+		},
+	}}
+	c := &Client{dynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{vpaResource: "VerticalPodAutoscalerList"}, vpa)}
+
+	rec, err := c.GetVPARecommendation(context.Background(), "default", "myservice", "app")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := VPARecommendation{
+		VPA: "myservice-vpa", Container: "app",
+		CPUTarget: 0.25, MemoryTarget: 256,
+		CPULowerBound: 0.1, CPUUpperBound: 1,
+		MemoryLowerBound: 128, MemoryUpperBound: 1024,
+	}
+	if *rec != want {
+		t.Errorf("got %+v, want %+v", *rec, want)
+	}
+
+	if _, err := c.GetVPARecommendation(context.Background(), "default", "other", "app"); err == nil {
+		t.Error("Deployment without a VPA: got nil, want an error")
+	}
+
+	// A VPA's only recommendation is for another container
+	single := vpa.DeepCopy()
+	_ = unstructured.SetNestedSlice(single.Object, []interface{}{map[string]interface{}{
+		"containerName": "worker",
+		"target":        map[string]interface{}{"cpu": "50m", "memory": "64Mi"},
+	}}, "status", "recommendation", "containerRecommendations")
+	c = &Client{dynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{vpaResource: "VerticalPodAutoscalerList"}, single)}
+	if rec, err := c.GetVPARecommendation(context.Background(), "default", "myservice", "app"); err == nil {
+		t.Errorf("container without a VPA recommendation: got %+v, want an error", *rec)
+	}
+}
+
+func TestProbeSettings(t *testing.T) {
+	container := &corev1.Container{
+		Name:           "app",
+		LivenessProbe:  &corev1.Probe{TimeoutSeconds: 3},
+		ReadinessProbe: &corev1.Probe{TimeoutSeconds: 1},
+		StartupProbe:   &corev1.Probe{},
+	}
+
+	// The startup probe's unset timeout defaults to 1s, and readiness probes don't count
+	probes := probeSettings(container)
+	if probes == nil || probes.Timeout != time.Second || len(probes.Probes) != 2 {
+		t.Fatalf("got %+v, want liveness and startup probes with a 1s timeout", probes)
+	}
+	if got := probes.String(); got != "liveness and startup probe (timeout 1s)" {
+		t.Errorf("String: got %q", got)
+	}
+
+	if probes := probeSettings(&corev1.Container{Name: "app", ReadinessProbe: &corev1.Probe{}}); probes != nil {
+		t.Errorf("readiness probe only: got %+v, want nil", probes)
+	}
+}
@@ -0,0 +1,297 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+// DefaultIgnoredContainers are the name prefixes of common service mesh sidecars, whose usage
+// shouldn't be attributed to the application
+var DefaultIgnoredContainers = []string{
+	"istio-proxy",
+	"istio-init",
+	"linkerd-proxy",
+	"linkerd-init",
+	"consul-dataplane",
+	"envoy-sidecar",
+}
+
+// How the usage of a pod's containers is combined into the pod's usage
+const (
+	ContainerAggregationSum = "sum" // Total of the containers, for sizing the pod as a whole
+	ContainerAggregationMax = "max" // Busiest container, for sizing each of several similar containers
+	ContainerAggregationAvg = "avg" // Average container, for containers sharing the load evenly
+)
+
+// ContainerAggregations lists the supported ways of combining container usage
+var ContainerAggregations = []string{ContainerAggregationSum, ContainerAggregationMax, ContainerAggregationAvg}
+
+// IsValidContainerAggregation reports whether aggregation is one of ContainerAggregations
+func IsValidContainerAggregation(aggregation string) bool {
+	for _, a := range ContainerAggregations {
+		if a == aggregation {
+			return true
+		}
+	}
+	return false
+}
+
+// SetContainerAggregation sets how the usage of a pod's containers that aren't ignored is
+// combined: sum (the default), max, or avg. CPU and memory are combined independently.
+func (c *Client) SetContainerAggregation(aggregation string) {
+	c.containerAgg = aggregation
+}
+
+// combineContainerUsage combines the usage of a pod's containers with the given aggregation,
+// summing them if it is empty
+func combineContainerUsage(containers []PodUsage, aggregation string) PodUsage {
+	var combined PodUsage
+	for _, u := range containers {
+		switch aggregation {
+		case ContainerAggregationMax:
+			if u.CPU > combined.CPU {
+				combined.CPU = u.CPU
+			}
+			if u.Memory > combined.Memory {
+				combined.Memory = u.Memory
+			}
+		default:
+			combined.CPU += u.CPU
+			combined.Memory += u.Memory
+		}
+	}
+
+	if aggregation == ContainerAggregationAvg && len(containers) > 0 {
+		combined.CPU /= float64(len(containers))
+		combined.Memory /= float64(len(containers))
+	}
+	return combined
+}
+
+// ParseContainerList splits a comma-separated list of container names or prefixes
+func ParseContainerList(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// SetIgnoredContainers sets the container names or prefixes that are skipped when reading
+// resource settings and aggregating metrics
+func (c *Client) SetIgnoredContainers(prefixes []string) {
+	c.ignoredContainers = prefixes
+}
+
+// isIgnoredContainer reports whether the container name matches one of the ignored prefixes, or
+// isn't one of the containers selected by image
+func (c *Client) isIgnoredContainer(name string) bool {
+	if c.imageContainers != nil && !c.imageContainers[name] {
+		return true
+	}
+	for _, prefix := range c.ignoredContainers {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageMatches reports whether a container image matches pattern: a glob in which * matches any
+// characters, including "/", and ? a single one if it contains either, and a substring otherwise
+func ImageMatches(image, pattern string) bool {
+	if !strings.ContainsAny(pattern, "*?") {
+		return strings.Contains(image, pattern)
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String()).MatchString(image)
+}
+
+// SelectContainersByImage restricts settings and metrics to the containers whose image matches
+// pattern (see ImageMatches), for pods whose container names are generated or vary between
+// pods. It resolves the names of the matching containers across all pods of the target and
+// returns them; containers with other names are then skipped like ignored ones.
+func (c *Client) SelectContainersByImage(ctx context.Context, namespace, target, pattern string) ([]string, error) {
+	selector := c.podSelector(target)
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	if len(pods.Items) == 0 {
+		return nil, fmt.Errorf("%w matching the target: %s", ErrNoPodsFound, target)
+	}
+
+	selected := make(map[string]bool)
+	var names, images []string
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			if !ImageMatches(container.Image, pattern) {
+				images = append(images, container.Image)
+				continue
+			}
+			if !selected[container.Name] {
+				selected[container.Name] = true
+				names = append(names, container.Name)
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no container of the target's pods runs an image matching %q (images: %s)",
+			pattern, strings.Join(uniqueStrings(images), ", "))
+	}
+
+	c.imageContainers = selected
+	return names, nil
+}
+
+// uniqueStrings returns the strings without repeats, in order of first appearance
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// selectContainer returns the first container that isn't ignored, along with the names of the
+// ignored ones
+func (c *Client) selectContainer(containers []corev1.Container) (*corev1.Container, []string) {
+	var selected *corev1.Container
+	var ignored []string
+	for i := range containers {
+		if c.isIgnoredContainer(containers[i].Name) {
+			ignored = append(ignored, containers[i].Name)
+			continue
+		}
+		if selected == nil {
+			selected = &containers[i]
+		}
+	}
+	return selected, ignored
+}
+
+// ContainerSettings are the resource settings of one container of the target's pods
+type ContainerSettings struct {
+	Name     string
+	Settings ResourceSettings
+}
+
+// GetContainerSettings reads the resource settings of each container of the first pod matching
+// the target that isn't ignored, in pod spec order
+func (c *Client) GetContainerSettings(ctx context.Context, namespace, target string) ([]ContainerSettings, error) {
+	selector := c.podSelector(target)
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	if len(pods.Items) == 0 {
+		return nil, fmt.Errorf("%w matching the target: %s", ErrNoPodsFound, target)
+	}
+
+	var settings []ContainerSettings
+	containers := pods.Items[0].Spec.Containers
+	for i := range containers {
+		if c.isIgnoredContainer(containers[i].Name) {
+			continue
+		}
+		settings = append(settings, ContainerSettings{
+			Name:     containers[i].Name,
+			Settings: settingsFromContainer(&containers[i]),
+		})
+	}
+
+	return settings, nil
+}
+
+// GetContainerUsage retrieves the usage of each container of the pods matching the target that
+// isn't ignored, keyed by container name and averaged across the pods running it
+func (c *Client) GetContainerUsage(ctx context.Context, namespace, target string) (map[string]PodUsage, error) {
+	byPod, err := c.GetPodContainerUsage(ctx, namespace, target)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]PodUsage, len(byPod))
+	for name, pods := range byPod {
+		var total PodUsage
+		for _, u := range pods {
+			total.CPU += u.CPU
+			total.Memory += u.Memory
+		}
+		usage[name] = PodUsage{CPU: total.CPU / float64(len(pods)), Memory: total.Memory / float64(len(pods))}
+	}
+
+	return usage, nil
+}
+
+// GetPodContainerUsage retrieves the usage of each container of the pods matching the target
+// that isn't ignored, keyed by container name and then by pod name, so that each container can
+// be sized from the peak of its busiest pod
+func (c *Client) GetPodContainerUsage(ctx context.Context, namespace, target string) (map[string]map[string]PodUsage, error) {
+	selector := c.podSelector(target)
+
+	podMetrics, err := c.listPodMetrics(ctx, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(podMetrics) == 0 {
+		return nil, fmt.Errorf("%w for target: %s", ErrNoMetrics, target)
+	}
+
+	return c.podContainerUsage(podMetrics), nil
+}
+
+// podContainerUsage splits the pod metrics by container that isn't ignored and then by pod
+func (c *Client) podContainerUsage(podMetrics []metricsapi.PodMetrics) map[string]map[string]PodUsage {
+	usage := make(map[string]map[string]PodUsage)
+	for _, pod := range podMetrics {
+		for _, container := range pod.Containers {
+			if c.isIgnoredContainer(container.Name) {
+				continue
+			}
+			if usage[container.Name] == nil {
+				usage[container.Name] = make(map[string]PodUsage)
+			}
+			usage[container.Name][pod.Name] = PodUsage{
+				CPU:    float64(container.Usage.Cpu().MilliValue()) / 1000,
+				Memory: float64(container.Usage.Memory().Value()) / (1024 * 1024),
+			}
+		}
+	}
+	return usage
+}
@@ -0,0 +1,98 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+// MetricsPageSize is how many pod metrics are requested per page, so large namespaces are read
+// in several requests instead of one response the API server may cut short
+const MetricsPageSize = 500
+
+// MinMetricsCoverage is the share of the running pods metrics-server must report for a sample
+// to be considered complete
+const MinMetricsCoverage = 0.5
+
+// MetricsCoverage compares the pods metrics-server reported usage for with the running pods
+type MetricsCoverage struct {
+	Reported int
+	Running  int
+}
+
+// Partial reports whether metrics-server reported far fewer pods than are running, so the
+// sample likely misses some replicas
+func (c MetricsCoverage) Partial() bool {
+	return !c.Covers(MinMetricsCoverage)
+}
+
+// Covers reports whether metrics-server reported at least the given fraction of the running pods
+func (c MetricsCoverage) Covers(fraction float64) bool {
+	return float64(c.Reported) >= float64(c.Running)*fraction
+}
+
+// Require returns an ErrNoMetrics error naming the count of pods without metrics if fewer than
+// the given fraction of the running pods were reported
+func (c MetricsCoverage) Require(fraction float64) error {
+	if c.Covers(fraction) {
+		return nil
+	}
+	return fmt.Errorf("%w for %d of %d running pods", ErrNoMetrics, c.Running-c.Reported, c.Running)
+}
+
+// listPodMetrics lists the metrics of the pods matching the selector page by page
+func (c *Client) listPodMetrics(ctx context.Context, namespace, selector string) ([]metricsapi.PodMetrics, error) {
+	if err := c.MetricsError(); err != nil {
+		return nil, err
+	}
+
+	var items []metricsapi.PodMetrics
+	opts := metav1.ListOptions{LabelSelector: selector, Limit: MetricsPageSize}
+	for {
+		page, err := c.metricsClient.MetricsV1beta1().PodMetricses(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error getting pod metrics: %v", err)
+		}
+		items = append(items, page.Items...)
+
+		if page.Continue == "" {
+			return items, nil
+		}
+		opts.Continue = page.Continue
+	}
+}
+
+// CountRunningPods counts the running pods matching the target
+func (c *Client) CountRunningPods(ctx context.Context, namespace, target string) (int, error) {
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: c.podSelector(target),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	running := 0
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			running++
+		}
+	}
+	return running, nil
+}
+
+// AverageUsage averages the usage of the pods, or returns zero usage if there are none
+func AverageUsage(usage map[string]PodUsage) (float64, float64) {
+	if len(usage) == 0 {
+		return 0, 0
+	}
+
+	var totalCPU, totalMemory float64
+	for _, u := range usage {
+		totalCPU += u.CPU
+		totalMemory += u.Memory
+	}
+	return totalCPU / float64(len(usage)), totalMemory / float64(len(usage))
+}
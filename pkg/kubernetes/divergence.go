@@ -0,0 +1,117 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ResourceSpread is how one request or limit of the target container varies across pods. CPU
+// values are in cores and memory values in Mi; pods that don't set it are counted separately.
+type ResourceSpread struct {
+	Resource string  `json:"resource"` // e.g. "cpu request"
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	Mode     float64 `json:"mode"` // Value the most pods run with
+	Unset    int     `json:"unset,omitempty"`
+}
+
+// SettingsDivergence describes the requests and limits that differ between the pods running the
+// target container, e.g. mid-rollout or during a canary, when a single pod's settings are no
+// reliable baseline
+type SettingsDivergence struct {
+	Container string           `json:"container"`
+	Pods      int              `json:"pods"`
+	Variants  int              `json:"variants"`  // Number of distinct combinations of requests and limits
+	Resources []ResourceSpread `json:"resources"` // Only the requests and limits that differ
+}
+
+// GetSettingsDivergence reads the resource settings of the main container of every pod matching
+// the target, which GetResourceSettings only reads from the first pod, and reports those that
+// differ between pods. It returns nil if all pods agree.
+func (c *Client) GetSettingsDivergence(ctx context.Context, namespace, target string) (*SettingsDivergence, error) {
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: c.podSelector(target),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	var name string
+	var settings []ResourceSettings
+	for _, pod := range pods.Items {
+		container, _ := c.selectContainer(pod.Spec.Containers)
+		if container == nil {
+			continue
+		}
+		if name == "" {
+			name = container.Name
+		}
+		settings = append(settings, settingsFromContainer(container))
+	}
+
+	fields := []struct {
+		resource string
+		value    func(ResourceSettings) (float64, bool)
+	}{
+		{"cpu request", func(s ResourceSettings) (float64, bool) { return s.CPURequest, s.HasCPURequest }},
+		{"cpu limit", func(s ResourceSettings) (float64, bool) { return s.CPULimit, s.HasCPULimit }},
+		{"memory request", func(s ResourceSettings) (float64, bool) { return s.MemoryRequest, s.HasMemoryRequest }},
+		{"memory limit", func(s ResourceSettings) (float64, bool) { return s.MemoryLimit, s.HasMemoryLimit }},
+	}
+
+	divergence := &SettingsDivergence{Container: name, Pods: len(settings)}
+	variants := make(map[string]bool)
+	for _, s := range settings {
+		variants[fmt.Sprintf("%v/%v %v/%v %v/%v %v/%v", s.CPURequest, s.HasCPURequest, s.CPULimit, s.HasCPULimit,
+			s.MemoryRequest, s.HasMemoryRequest, s.MemoryLimit, s.HasMemoryLimit)] = true
+	}
+	divergence.Variants = len(variants)
+
+	for _, f := range fields {
+		var values []float64
+		unset := 0
+		for _, s := range settings {
+			if v, ok := f.value(s); ok {
+				values = append(values, v)
+			} else {
+				unset++
+			}
+		}
+		if spread, diverges := resourceSpread(f.resource, values, unset); diverges {
+			divergence.Resources = append(divergence.Resources, spread)
+		}
+	}
+
+	if len(divergence.Resources) == 0 {
+		return nil, nil
+	}
+	return divergence, nil
+}
+
+// resourceSpread summarizes the values pods set for a resource, and reports whether they differ,
+// including between pods that set it and pods that don't
+func resourceSpread(resource string, values []float64, unset int) (ResourceSpread, bool) {
+	spread := ResourceSpread{Resource: resource, Unset: unset}
+	if len(values) == 0 {
+		return spread, false
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	spread.Min, spread.Max = sorted[0], sorted[len(sorted)-1]
+
+	// The most common value, the lowest of those tied
+	counts := make(map[float64]int, len(sorted))
+	for _, v := range sorted {
+		counts[v]++
+		if counts[v] > counts[spread.Mode] {
+			spread.Mode = v
+		}
+	}
+
+	return spread, spread.Min != spread.Max || unset > 0
+}
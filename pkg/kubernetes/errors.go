@@ -0,0 +1,12 @@
+package kubernetes
+
+import "errors"
+
+// Error categories returned by the client, wrapped with details. Use errors.Is to test for them.
+var (
+	ErrClusterUnreachable = errors.New("cannot reach cluster")
+	ErrMetricsUnavailable = errors.New("metrics-server not available")
+	ErrNoPodsFound        = errors.New("no pods found")
+	ErrNoMetrics          = errors.New("no metrics found")
+	ErrScaledToZero       = errors.New("deployment scaled to zero")
+)
@@ -0,0 +1,49 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HPASettings is the scaling configuration of the HorizontalPodAutoscaler targeting a Deployment
+type HPASettings struct {
+	Name        string `json:"name"`
+	MinReplicas int32  `json:"minReplicas"`
+	MaxReplicas int32  `json:"maxReplicas"`
+	CPUTarget   int32  `json:"cpuTarget,omitempty"` // averageUtilization percentage of the CPU request (0 if it doesn't scale on CPU utilization)
+	Metrics     int    `json:"metrics"`             // Number of metrics it scales on
+}
+
+// GetHPA finds the HorizontalPodAutoscaler targeting the Deployment. It returns nil without an
+// error if there is none.
+func (c *Client) GetHPA(ctx context.Context, namespace, deployment string) (*HPASettings, error) {
+	hpas, err := c.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing HorizontalPodAutoscalers: %v", err)
+	}
+
+	for _, hpa := range hpas.Items {
+		ref := hpa.Spec.ScaleTargetRef
+		if ref.Kind != "Deployment" || ref.Name != deployment {
+			continue
+		}
+
+		settings := &HPASettings{Name: hpa.Name, MinReplicas: 1, MaxReplicas: hpa.Spec.MaxReplicas, Metrics: len(hpa.Spec.Metrics)}
+		if hpa.Spec.MinReplicas != nil {
+			settings.MinReplicas = *hpa.Spec.MinReplicas
+		}
+		for _, m := range hpa.Spec.Metrics {
+			if m.Type == autoscalingv2.ResourceMetricSourceType && m.Resource != nil && m.Resource.Name == corev1.ResourceCPU &&
+				m.Resource.Target.Type == autoscalingv2.UtilizationMetricType && m.Resource.Target.AverageUtilization != nil {
+				settings.CPUTarget = *m.Resource.Target.AverageUtilization
+			}
+		}
+		return settings, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,69 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NodeUsage is the usage and allocatable capacity of a node.
+// CPU values are in cores and memory values in Mi.
+type NodeUsage struct {
+	Node              string
+	CPUUsage          float64
+	MemoryUsage       float64
+	CPUAllocatable    float64
+	MemoryAllocatable float64
+}
+
+// GetNodeUsage retrieves the current usage of the nodes hosting the pods matching the target
+func (c *Client) GetNodeUsage(ctx context.Context, namespace, target string) ([]NodeUsage, error) {
+	if err := c.MetricsError(); err != nil {
+		return nil, err
+	}
+
+	selector := c.podSelector(target)
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	nodeNames := make(map[string]bool)
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != "" {
+			nodeNames[pod.Spec.NodeName] = true
+		}
+	}
+
+	usage := make([]NodeUsage, 0, len(nodeNames))
+	for name := range nodeNames {
+		node, err := c.clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting node %s: %v", name, err)
+		}
+
+		nodeMetrics, err := c.metricsClient.MetricsV1beta1().NodeMetricses().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting node metrics for %s: %v", name, err)
+		}
+
+		usage = append(usage, NodeUsage{
+			Node:              name,
+			CPUUsage:          float64(nodeMetrics.Usage.Cpu().MilliValue()) / 1000,
+			MemoryUsage:       float64(nodeMetrics.Usage.Memory().Value()) / (1024 * 1024),
+			CPUAllocatable:    float64(node.Status.Allocatable.Cpu().MilliValue()) / 1000,
+			MemoryAllocatable: float64(node.Status.Allocatable.Memory().Value()) / (1024 * 1024),
+		})
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Node < usage[j].Node
+	})
+
+	return usage, nil
+}
@@ -0,0 +1,85 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// PortForward forwards a random local port to remotePort on a running pod matching the target.
+// It returns the local port and a function that tears the forward down.
+func (c *Client) PortForward(ctx context.Context, namespace, target string, remotePort int) (int, func(), error) {
+	selector := c.podSelector(target)
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	var podName string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			podName = pod.Name
+			break
+		}
+	}
+	if podName == "" {
+		return 0, nil, fmt.Errorf("%w: none of the pods matching the target %s is running", ErrNoPodsFound, target)
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(c.config)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error creating port-forward transport: %v", err)
+	}
+
+	url := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("portforward").
+		URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+
+	stopChan := make(chan struct{})
+	readyChan := make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"localhost"},
+		[]string{fmt.Sprintf("0:%d", remotePort)}, stopChan, readyChan, io.Discard, io.Discard)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error creating port forward to pod %s: %v", podName, err)
+	}
+
+	forwardErr := make(chan error, 1)
+	go func() {
+		forwardErr <- forwarder.ForwardPorts()
+	}()
+
+	select {
+	case <-readyChan:
+	case err := <-forwardErr:
+		return 0, nil, fmt.Errorf("error forwarding to pod %s port %d: %v", podName, remotePort, err)
+	case <-ctx.Done():
+		close(stopChan)
+		return 0, nil, ctx.Err()
+	}
+
+	ports, err := forwarder.GetPorts()
+	if err != nil || len(ports) == 0 {
+		close(stopChan)
+		return 0, nil, fmt.Errorf("error getting forwarded port: %v", err)
+	}
+
+	fmt.Printf("Forwarding localhost:%d -> pod %s port %d\n", ports[0].Local, podName, remotePort)
+
+	stop := func() {
+		close(stopChan)
+	}
+	return int(ports[0].Local), stop, nil
+}
@@ -0,0 +1,80 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ProbeSettings describes the probes of the main container that restart it when they time
+// out. Readiness probes only take a pod out of rotation, so they aren't included.
+type ProbeSettings struct {
+	Container string        `json:"container"`
+	Probes    []string      `json:"probes"`  // "liveness" and/or "startup"
+	Timeout   time.Duration `json:"timeout"` // Shortest timeout among them, in nanoseconds
+}
+
+// String describes the probes for messages, e.g. "liveness probe (timeout 1s)"
+func (p ProbeSettings) String() string {
+	return fmt.Sprintf("%s probe (timeout %s)", strings.Join(p.Probes, " and "), p.Timeout)
+}
+
+// GetProbeSettings reads the liveness and startup probes of the main container of the first
+// pod matching the target. It returns nil if the container has neither.
+func (c *Client) GetProbeSettings(ctx context.Context, namespace, target string) (*ProbeSettings, error) {
+	selector := c.podSelector(target)
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	if len(pods.Items) == 0 {
+		return nil, fmt.Errorf("%w matching the target: %s", ErrNoPodsFound, target)
+	}
+
+	container, _ := c.selectContainer(pods.Items[0].Spec.Containers)
+	if container == nil {
+		return nil, fmt.Errorf("all containers of pod %s are ignored", pods.Items[0].Name)
+	}
+
+	return probeSettings(container), nil
+}
+
+// probeSettings collects the liveness and startup probes of a container, or returns nil if
+// it has neither
+func probeSettings(container *corev1.Container) *ProbeSettings {
+	settings := &ProbeSettings{Container: container.Name}
+	for _, p := range []struct {
+		name  string
+		probe *corev1.Probe
+	}{
+		{"liveness", container.LivenessProbe},
+		{"startup", container.StartupProbe},
+	} {
+		if p.probe == nil {
+			continue
+		}
+
+		// The API server defaults an unset timeout to one second
+		timeout := time.Second
+		if p.probe.TimeoutSeconds > 0 {
+			timeout = time.Duration(p.probe.TimeoutSeconds) * time.Second
+		}
+		if len(settings.Probes) == 0 || timeout < settings.Timeout {
+			settings.Timeout = timeout
+		}
+		settings.Probes = append(settings.Probes, p.name)
+	}
+
+	if len(settings.Probes) == 0 {
+		return nil
+	}
+	return settings
+}
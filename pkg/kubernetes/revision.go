@@ -0,0 +1,107 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PodTemplateHashLabel is the label the Deployment controller sets on a ReplicaSet and its pods
+const PodTemplateHashLabel = "pod-template-hash"
+
+// revisionAnnotation holds the Deployment revision a ReplicaSet belongs to
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// Symbolic pod template hash values, resolved from the Deployment's ReplicaSets
+const (
+	RevisionLatest   = "latest"
+	RevisionPrevious = "previous"
+)
+
+// SetPodTemplateHash restricts settings, metrics, and pod lookups to the pods of the ReplicaSet
+// with the given pod-template-hash, e.g. the new version during a canary or rolling update
+func (c *Client) SetPodTemplateHash(hash string) {
+	c.podTemplateHash = hash
+}
+
+// podSelector returns the label selector for the target, narrowed to the configured
+// pod-template-hash if one is set
+func (c *Client) podSelector(target string) string {
+	selector := extractSelector(target, c.selectorLabelKey())
+	if c.podTemplateHash != "" {
+		selector += "," + PodTemplateHashLabel + "=" + c.podTemplateHash
+	}
+	return selector
+}
+
+// DescribeSelector returns the label selector pods of the target are listed with, and how it was
+// derived from the target, to explain a selector that matches no pods
+func (c *Client) DescribeSelector(target string) (string, string) {
+	selector := c.podSelector(target)
+
+	var derivation string
+	switch host := selectorHost(target); {
+	case strings.Contains(host, "="):
+		derivation = fmt.Sprintf("'%s' used as a label selector", host)
+	case host != target:
+		derivation = fmt.Sprintf("%s=<host> from the host of the URL '%s'", c.selectorLabelKey(), target)
+	default:
+		derivation = fmt.Sprintf("%s=<name> from the name '%s'", c.selectorLabelKey(), target)
+	}
+	if c.podTemplateHash != "" {
+		derivation += ", narrowed to " + PodTemplateHashLabel + "=" + c.podTemplateHash
+	}
+
+	return selector, derivation
+}
+
+// ResolvePodTemplateHash returns the pod-template-hash of the Deployment's ReplicaSet for the
+// given revision: "latest" for the current one, "previous" for the one before it. Any other
+// value is returned unchanged as a literal hash.
+func (c *Client) ResolvePodTemplateHash(ctx context.Context, deployment *appsv1.Deployment, revision string) (string, error) {
+	if revision != RevisionLatest && revision != RevisionPrevious {
+		return revision, nil
+	}
+
+	replicaSets, err := c.clientset.AppsV1().ReplicaSets(deployment.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error listing replicasets: %v", err)
+	}
+
+	// Order the Deployment's own ReplicaSets from the newest revision to the oldest
+	type revisioned struct {
+		revision int64
+		hash     string
+	}
+	var owned []revisioned
+	for _, rs := range replicaSets.Items {
+		if ownerName(rs.OwnerReferences, "Deployment") != deployment.Name {
+			continue
+		}
+		rev, err := strconv.ParseInt(rs.Annotations[revisionAnnotation], 10, 64)
+		if err != nil {
+			continue
+		}
+		owned = append(owned, revisioned{revision: rev, hash: rs.Labels[PodTemplateHashLabel]})
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		return owned[i].revision > owned[j].revision
+	})
+
+	index := 0
+	if revision == RevisionPrevious {
+		index = 1
+	}
+	if len(owned) <= index || owned[index].hash == "" {
+		return "", fmt.Errorf("deployment %s has no %s revision", deployment.Name, revision)
+	}
+
+	return owned[index].hash, nil
+}
@@ -0,0 +1,91 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ServiceEndpoint is how a Service is reached from inside the cluster
+type ServiceEndpoint struct {
+	URL        string // In-cluster URL of the Service, e.g. http://web.default.svc:8080
+	TargetPort int    // Container port the Service port routes to (0 if it couldn't be resolved)
+}
+
+// GetServiceEndpoint builds the in-cluster URL of a Service from its ports. A port named http or
+// https is preferred, otherwise the first port is used. Named target ports are resolved through
+// the container ports of the Service's pods.
+func (c *Client) GetServiceEndpoint(ctx context.Context, namespace, service string) (ServiceEndpoint, error) {
+	svc, err := c.clientset.CoreV1().Services(namespace).Get(ctx, service, metav1.GetOptions{})
+	if err != nil {
+		return ServiceEndpoint{}, fmt.Errorf("error getting service %s: %v", service, err)
+	}
+
+	if len(svc.Spec.Ports) == 0 {
+		return ServiceEndpoint{}, fmt.Errorf("service %s has no ports", service)
+	}
+
+	port := svc.Spec.Ports[0]
+	for _, p := range svc.Spec.Ports {
+		if p.Name == "http" || p.Name == "https" {
+			port = p
+			break
+		}
+	}
+
+	scheme := "http"
+	if port.Port == 443 || strings.HasPrefix(port.Name, "https") {
+		scheme = "https"
+	}
+
+	targetPort, err := c.resolveTargetPort(ctx, namespace, svc, port)
+	if err != nil {
+		return ServiceEndpoint{}, err
+	}
+
+	return ServiceEndpoint{
+		URL:        fmt.Sprintf("%s://%s.%s.svc:%d", scheme, svc.Name, namespace, port.Port),
+		TargetPort: targetPort,
+	}, nil
+}
+
+// resolveTargetPort returns the container port a Service port routes to, looking up named
+// target ports in the containers of the Service's pods
+func (c *Client) resolveTargetPort(ctx context.Context, namespace string, svc *corev1.Service, port corev1.ServicePort) (int, error) {
+	if port.TargetPort.Type == intstr.Int {
+		if port.TargetPort.IntVal == 0 {
+			// An unset target port defaults to the Service port
+			return int(port.Port), nil
+		}
+		return int(port.TargetPort.IntVal), nil
+	}
+
+	if len(svc.Spec.Selector) == 0 {
+		return 0, nil
+	}
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	name := port.TargetPort.StrVal
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			for _, containerPort := range container.Ports {
+				if containerPort.Name == name {
+					return int(containerPort.ContainerPort), nil
+				}
+			}
+		}
+	}
+
+	return 0, nil
+}
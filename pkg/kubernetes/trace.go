@@ -0,0 +1,61 @@
+package kubernetes
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SetTrace makes the client explain to w how each target is resolved to pods: the target as
+// given, how it was parsed, the selector built from it, the pods it matched, and which pod and
+// container the current settings were read from. Metrics lookups, which repeat every sample, are
+// traced once per target. Nil, the default, disables the trace.
+func (c *Client) SetTrace(w io.Writer) {
+	c.trace = w
+}
+
+// tracef writes a line of the selector resolution trace, if it is enabled
+func (c *Client) tracef(format string, args ...interface{}) {
+	if c.trace == nil {
+		return
+	}
+	c.traceMu.Lock()
+	defer c.traceMu.Unlock()
+	fmt.Fprintf(c.trace, "[selector] "+format+"\n", args...)
+}
+
+// traceResolution returns the label selector for the target like podSelector, tracing each step
+// of deriving it for the given lookup
+func (c *Client) traceResolution(lookup, namespace, target string) string {
+	selector := c.podSelector(target)
+	if c.trace == nil {
+		return selector
+	}
+
+	c.tracef("%s: target %q in namespace %s", lookup, target, namespace)
+	host := selectorHost(target)
+	if host != target {
+		c.tracef("  parsed as a URL with host %q", host)
+	} else {
+		c.tracef("  not a URL, used as a name or label selector")
+	}
+	if strings.Contains(host, "=") {
+		c.tracef("  %q contains '=', used as a label selector as is", host)
+	} else {
+		c.tracef("  matched against label %s: %s=%s", c.selectorLabelKey(), c.selectorLabelKey(), host)
+	}
+	if c.podTemplateHash != "" {
+		c.tracef("  narrowed to %s=%s", PodTemplateHashLabel, c.podTemplateHash)
+	}
+	c.tracef("  selector: %s", selector)
+	return selector
+}
+
+// traceMatched traces the pods a selector matched
+func (c *Client) traceMatched(what string, names []string) {
+	if len(names) == 0 {
+		c.tracef("  matched no %s", what)
+		return
+	}
+	c.tracef("  matched %d %s: %s", len(names), what, strings.Join(names, ", "))
+}
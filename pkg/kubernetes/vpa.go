@@ -0,0 +1,104 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// vpaResource is the VerticalPodAutoscaler custom resource. It is read as unstructured data, so
+// the VPA client libraries aren't needed and clusters without VPA only fail the lookup.
+var vpaResource = schema.GroupVersionResource{Group: "autoscaling.k8s.io", Version: "v1", Resource: "verticalpodautoscalers"}
+
+// VPARecommendation is the recommendation a VerticalPodAutoscaler computed from a container's
+// usage history. CPU values are in cores and memory values in Mi; bounds that aren't reported
+// are zero.
+type VPARecommendation struct {
+	VPA              string  `json:"vpa"`
+	Container        string  `json:"container"`
+	CPUTarget        float64 `json:"cpuTarget"`
+	MemoryTarget     float64 `json:"memoryTarget"`
+	CPULowerBound    float64 `json:"cpuLowerBound"`
+	CPUUpperBound    float64 `json:"cpuUpperBound"`
+	MemoryLowerBound float64 `json:"memoryLowerBound"`
+	MemoryUpperBound float64 `json:"memoryUpperBound"`
+}
+
+// GetVPARecommendation finds the VerticalPodAutoscaler targeting the Deployment and returns its
+// recommendation for the container, matched by name. VPAs in recommend-only mode ("Off") are read
+// like any other.
+func (c *Client) GetVPARecommendation(ctx context.Context, namespace, deployment, container string) (*VPARecommendation, error) {
+	vpas, err := c.dynamicClient.Resource(vpaResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing VerticalPodAutoscalers: %v", err)
+	}
+
+	for _, vpa := range vpas.Items {
+		kind, _, _ := unstructured.NestedString(vpa.Object, "spec", "targetRef", "kind")
+		name, _, _ := unstructured.NestedString(vpa.Object, "spec", "targetRef", "name")
+		if kind != "Deployment" || name != deployment {
+			continue
+		}
+
+		recommendations, _, _ := unstructured.NestedSlice(vpa.Object, "status", "recommendation", "containerRecommendations")
+		if len(recommendations) == 0 {
+			return nil, fmt.Errorf("VerticalPodAutoscaler %s has no recommendation yet", vpa.GetName())
+		}
+
+		for _, r := range recommendations {
+			rec, ok := r.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			containerName, _, _ := unstructured.NestedString(rec, "containerName")
+			if containerName != container {
+				continue
+			}
+			return vpaRecommendation(vpa.GetName(), containerName, rec)
+		}
+		return nil, fmt.Errorf("VerticalPodAutoscaler %s has no recommendation for container %s", vpa.GetName(), container)
+	}
+
+	return nil, fmt.Errorf("no VerticalPodAutoscaler targets deployment %s", deployment)
+}
+
+// vpaRecommendation converts a container recommendation of a VPA's status
+func vpaRecommendation(vpa, container string, rec map[string]interface{}) (*VPARecommendation, error) {
+	result := &VPARecommendation{VPA: vpa, Container: container}
+	fields := []struct {
+		bound  string
+		cpu    *float64
+		memory *float64
+	}{
+		{"target", &result.CPUTarget, &result.MemoryTarget},
+		{"lowerBound", &result.CPULowerBound, &result.MemoryLowerBound},
+		{"upperBound", &result.CPUUpperBound, &result.MemoryUpperBound},
+	}
+
+	for _, f := range fields {
+		values, _, _ := unstructured.NestedStringMap(rec, f.bound)
+		if cpu, ok := values["cpu"]; ok {
+			q, err := resource.ParseQuantity(cpu)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CPU %s %q in VerticalPodAutoscaler %s: %v", f.bound, cpu, vpa, err)
+			}
+			*f.cpu = float64(q.MilliValue()) / 1000
+		}
+		if memory, ok := values["memory"]; ok {
+			q, err := resource.ParseQuantity(memory)
+			if err != nil {
+				return nil, fmt.Errorf("invalid memory %s %q in VerticalPodAutoscaler %s: %v", f.bound, memory, vpa, err)
+			}
+			*f.memory = float64(q.Value()) / (1024 * 1024)
+		}
+	}
+
+	if result.CPUTarget == 0 && result.MemoryTarget == 0 {
+		return nil, fmt.Errorf("VerticalPodAutoscaler %s has no target for container %s", vpa, container)
+	}
+	return result, nil
+}
@@ -0,0 +1,189 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// FieldManager identifies pod-rightsizer as the author of changes it submits to the API server
+const FieldManager = "pod-rightsizer"
+
+// Annotations recognized on the target Deployment
+const (
+	// MarginAnnotation sets the safety margin for the workload, e.g. "30", in any form --margin accepts
+	MarginAnnotation = "rightsizer.io/margin"
+)
+
+// WorkloadPolicy holds per-workload settings read from Deployment annotations.
+// Nil fields were not set on the workload.
+type WorkloadPolicy struct {
+	Margin *string // Unparsed, so it's normalized like the --margin flag
+}
+
+// GetDeployment retrieves a Deployment by name
+func (c *Client) GetDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	deployment, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting deployment %s: %v", name, err)
+	}
+	return deployment, nil
+}
+
+// FindDeployment resolves the Deployment that owns the pods matching the target by following
+// the first pod's ReplicaSet owner reference
+func (c *Client) FindDeployment(ctx context.Context, namespace, target string) (*appsv1.Deployment, error) {
+	selector := c.podSelector(target)
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	if len(pods.Items) == 0 {
+		return nil, fmt.Errorf("%w matching the target: %s", ErrNoPodsFound, target)
+	}
+
+	replicaSetName := ownerName(pods.Items[0].OwnerReferences, "ReplicaSet")
+	if replicaSetName == "" {
+		return nil, fmt.Errorf("pod %s is not owned by a ReplicaSet", pods.Items[0].Name)
+	}
+
+	replicaSet, err := c.clientset.AppsV1().ReplicaSets(namespace).Get(ctx, replicaSetName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting replicaset %s: %v", replicaSetName, err)
+	}
+
+	deploymentName := ownerName(replicaSet.OwnerReferences, "Deployment")
+	if deploymentName == "" {
+		return nil, fmt.Errorf("replicaset %s is not owned by a Deployment", replicaSetName)
+	}
+
+	return c.GetDeployment(ctx, namespace, deploymentName)
+}
+
+// ScaledToZero reports whether the Deployment is scaled to zero replicas, e.g. by KEDA or Knative
+// while idle, so it has no pods to measure or read settings from
+func ScaledToZero(deployment *appsv1.Deployment) bool {
+	return deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == 0
+}
+
+// FindScaledToZero returns the name of a Deployment scaled to zero whose pod template the target's
+// selector matches, or "" if there is none. It explains why a target matches no pods although
+// its workload exists.
+func (c *Client) FindScaledToZero(ctx context.Context, namespace, target string) (string, error) {
+	// The pod-template-hash is only set on pods, never on the template
+	selector, err := labels.Parse(extractSelector(target, c.selectorLabelKey()))
+	if err != nil {
+		return "", fmt.Errorf("invalid selector for target %s: %v", target, err)
+	}
+
+	deployments, err := c.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error listing deployments: %v", err)
+	}
+
+	for i := range deployments.Items {
+		deployment := &deployments.Items[i]
+		if ScaledToZero(deployment) && selector.Matches(labels.Set(deployment.Spec.Template.Labels)) {
+			return deployment.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// GetTemplateResourceSettings reads the resource settings from the Deployment's pod template
+// rather than a running pod, for a Deployment without any pods such as one scaled to zero
+func (c *Client) GetTemplateResourceSettings(ctx context.Context, namespace, name string) (ResourceSettings, error) {
+	deployment, err := c.GetDeployment(ctx, namespace, name)
+	if err != nil {
+		return ResourceSettings{}, err
+	}
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: deployment.Name},
+		Spec:       deployment.Spec.Template.Spec,
+	}
+	return c.settingsFromPod(pod)
+}
+
+// GroupPodsByDeployment returns the names of the pods matching the target grouped by the name of
+// the Deployment that owns them. Pods that aren't owned by a Deployment are left out.
+func (c *Client) GroupPodsByDeployment(ctx context.Context, namespace, target string) (map[string][]string, error) {
+	selector := c.podSelector(target)
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %v", err)
+	}
+
+	groups := make(map[string][]string)
+	deploymentOf := make(map[string]string) // ReplicaSet name -> Deployment name
+	for _, pod := range pods.Items {
+		replicaSetName := ownerName(pod.OwnerReferences, "ReplicaSet")
+		if replicaSetName == "" {
+			continue
+		}
+
+		deploymentName, ok := deploymentOf[replicaSetName]
+		if !ok {
+			replicaSet, err := c.clientset.AppsV1().ReplicaSets(namespace).Get(ctx, replicaSetName, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("error getting replicaset %s: %v", replicaSetName, err)
+			}
+			deploymentName = ownerName(replicaSet.OwnerReferences, "Deployment")
+			deploymentOf[replicaSetName] = deploymentName
+		}
+
+		if deploymentName != "" {
+			groups[deploymentName] = append(groups[deploymentName], pod.Name)
+		}
+	}
+
+	return groups, nil
+}
+
+// ValidatePatch submits a strategic merge patch of a Deployment as a server-side dry run, so the
+// API server runs defaulting, validation, and admission webhooks such as LimitRange checks
+// without persisting anything. It returns the server's reason if the patch would be rejected.
+func (c *Client) ValidatePatch(ctx context.Context, namespace, deployment string, patch []byte) error {
+	_, err := c.clientset.AppsV1().Deployments(namespace).Patch(ctx, deployment, types.StrategicMergePatchType, patch,
+		metav1.PatchOptions{
+			DryRun:       []string{metav1.DryRunAll},
+			FieldManager: FieldManager,
+		})
+	return err
+}
+
+// ParseWorkloadPolicy reads the recognized rightsizer annotations
+func ParseWorkloadPolicy(annotations map[string]string) (WorkloadPolicy, error) {
+	var policy WorkloadPolicy
+
+	if value, ok := annotations[MarginAnnotation]; ok {
+		if value == "" {
+			return WorkloadPolicy{}, fmt.Errorf("empty %s annotation", MarginAnnotation)
+		}
+		policy.Margin = &value
+	}
+
+	return policy, nil
+}
+
+// ownerName returns the name of the controlling owner of the given kind, if any
+func ownerName(owners []metav1.OwnerReference, kind string) string {
+	for _, owner := range owners {
+		if owner.Kind == kind && owner.Controller != nil && *owner.Controller {
+			return owner.Name
+		}
+	}
+	return ""
+}
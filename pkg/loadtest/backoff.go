@@ -0,0 +1,29 @@
+package loadtest
+
+import "time"
+
+// Error back-off defaults for concurrent workers
+const (
+	DefaultErrorBackoff = 100 * time.Millisecond // Pause of a worker after a failed request
+	MaxErrorBackoff     = 30 * time.Second       // Cap on the exponential error back-off
+)
+
+// errorBackoff returns how long a concurrent worker pauses after its failures-th consecutive
+// failed request (1 for the first). The pause is fixed unless it grows exponentially.
+func (t *Tester) errorBackoff(failures int) time.Duration {
+	backoff := t.opts.ErrorBackoff
+	if backoff <= 0 {
+		backoff = DefaultErrorBackoff
+	}
+	if !t.opts.ErrorBackoffExp {
+		return backoff
+	}
+
+	for i := 1; i < failures && backoff < MaxErrorBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > MaxErrorBackoff {
+		backoff = MaxErrorBackoff
+	}
+	return backoff
+}
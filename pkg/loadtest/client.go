@@ -0,0 +1,40 @@
+package loadtest
+
+import "net/http"
+
+// TesterOption customizes how a Tester sends its requests, for library users whose needs go
+// beyond what Options configures
+type TesterOption func(*Tester)
+
+// WithTransport sends requests through the given round tripper, e.g. one adding tracing or
+// mTLS. The connection pool, TLS, and resolve settings of Options don't apply to it.
+func WithTransport(transport http.RoundTripper) TesterOption {
+	return func(t *Tester) {
+		client := *t.client
+		client.Transport = transport
+		t.client = &client
+	}
+}
+
+// WithClient sends requests through the given client, including its timeout and transport
+func WithClient(client *http.Client) TesterOption {
+	return func(t *Tester) {
+		t.client = client
+	}
+}
+
+// WithHeaders adds the headers to every request, replacing default ones such as User-Agent.
+// Headers of a weighted endpoint take precedence over them.
+func WithHeaders(headers http.Header) TesterOption {
+	return func(t *Tester) {
+		t.headers = headers.Clone()
+	}
+}
+
+// WithResultWriter streams the result of every request to w as it's collected. Buffered
+// results are flushed at the end of each run; closing w is up to the caller.
+func WithResultWriter(w *ResultWriter) TesterOption {
+	return func(t *Tester) {
+		t.resultWriter = w
+	}
+}
@@ -0,0 +1,97 @@
+package loadtest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// recordingTransport answers every request with 200 OK and records the requests' headers
+type recordingTransport struct {
+	mu      sync.Mutex
+	headers []http.Header
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.headers = append(rt.headers, req.Header.Clone())
+	rt.mu.Unlock()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader("ok")),
+		Header:     make(http.Header),
+		Request:    req,
+	}, nil
+}
+
+func TestTesterWithTransport(t *testing.T) {
+	transport := &recordingTransport{}
+	tester := NewTester("http://service.invalid", 0, 1, Options{TotalRequests: 3, ThinkTime: &ThinkTime{}},
+		WithTransport(transport),
+		WithHeaders(http.Header{"Authorization": {"Bearer token"}, "User-Agent": {"custom"}}))
+
+	if err := tester.Run(context.Background(), 5*time.Second); err != nil {
+		t.Fatalf("Run returned an error: %v", err)
+	}
+
+	if len(transport.headers) != 3 {
+		t.Fatalf("expected 3 requests through the custom transport, got %d", len(transport.headers))
+	}
+	for _, h := range transport.headers {
+		if h.Get("Authorization") != "Bearer token" || h.Get("User-Agent") != "custom" {
+			t.Errorf("custom headers were not applied: %v", h)
+		}
+	}
+}
+
+// roundTripFunc answers requests with a function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestProbe(t *testing.T) {
+	respond := func(status int) roundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header), Request: req}, nil
+		}
+	}
+	fail := func(err error) roundTripFunc {
+		return func(*http.Request) (*http.Response, error) { return nil, err }
+	}
+
+	tests := []struct {
+		name      string
+		transport roundTripFunc
+		wantErr   error
+		wantKind  string
+	}{
+		{"ok", respond(http.StatusOK), nil, ""},
+		{"http error", respond(http.StatusServiceUnavailable), ErrServiceUnavailable, "HTTP 503"},
+		{"dns", fail(&net.DNSError{Err: "no such host", Name: "service.invalid", IsNotFound: true}), ErrTargetUnreachable, failureDNS},
+		{"refused", fail(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), ErrTargetUnreachable, failureRefused},
+		{"tls", fail(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), ErrTargetUnreachable, failureTLS},
+	}
+	for _, tt := range tests {
+		tester := NewTester("http://service.invalid", 1, 0, Options{}, WithTransport(tt.transport))
+		_, err := tester.Probe(context.Background())
+		if !errors.Is(err, tt.wantErr) || tt.wantErr == nil && err != nil {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil && !strings.Contains(err.Error(), tt.wantKind) {
+			t.Errorf("%s: error %q doesn't name %q", tt.name, err, tt.wantKind)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package loadtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// Endpoint describes one request in a weighted mix of traffic against the target
+type Endpoint struct {
+	Method  string            `json:"method"`  // HTTP method (default GET)
+	Path    string            `json:"path"`    // Path and optional query, resolved against the target URL
+	Body    string            `json:"body"`    // Optional request body
+	Headers map[string]string `json:"headers"` // Optional request headers
+	Weight  int               `json:"weight"`  // Relative selection weight (default 1)
+}
+
+// LoadEndpoints reads a JSON targets file containing an array of endpoints, e.g.
+//
+//	[
+//	  {"path": "/health", "weight": 3},
+//	  {"method": "POST", "path": "/orders", "body": "{\"id\": 1}",
+//	   "headers": {"Content-Type": "application/json"}, "weight": 1}
+//	]
+func LoadEndpoints(path string) ([]Endpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading targets file: %v", err)
+	}
+
+	var endpoints []Endpoint
+	if err := json.Unmarshal(data, &endpoints); err != nil {
+		return nil, fmt.Errorf("error parsing targets file %s: %v", path, err)
+	}
+
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("targets file %s contains no endpoints", path)
+	}
+
+	for i := range endpoints {
+		ep := &endpoints[i]
+		if ep.Method == "" {
+			ep.Method = "GET"
+		}
+		ep.Method = strings.ToUpper(ep.Method)
+		if ep.Weight == 0 {
+			ep.Weight = 1
+		}
+		if ep.Weight < 0 {
+			return nil, fmt.Errorf("endpoint %d (%s %s) has a negative weight", i, ep.Method, ep.Path)
+		}
+		if _, err := url.Parse(ep.Path); err != nil {
+			return nil, fmt.Errorf("endpoint %d has an invalid path %q: %v", i, ep.Path, err)
+		}
+	}
+
+	return endpoints, nil
+}
+
+// ExcludeEndpoints removes the endpoints whose path, without its query, matches one of the
+// patterns, either exactly or as a glob such as "/admin/*". The remaining weights keep their
+// relative proportions. It fails if a pattern is malformed or nothing would be left to test.
+func ExcludeEndpoints(endpoints []Endpoint, patterns []string) ([]Endpoint, error) {
+	if len(patterns) == 0 {
+		return endpoints, nil
+	}
+
+	var kept []Endpoint
+	for _, ep := range endpoints {
+		excluded, err := matchesAny(ep.Path, patterns)
+		if err != nil {
+			return nil, err
+		}
+		if !excluded {
+			kept = append(kept, ep)
+		}
+	}
+
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("excluding %s leaves no endpoints", strings.Join(patterns, ", "))
+	}
+	return kept, nil
+}
+
+// matchesAny reports whether the endpoint path, without its query, matches one of the patterns
+func matchesAny(endpointPath string, patterns []string) (bool, error) {
+	p, _, _ := strings.Cut(endpointPath, "?")
+	for _, pattern := range patterns {
+		if p == pattern {
+			return true, nil
+		}
+		matched, err := path.Match(pattern, p)
+		if err != nil {
+			return false, fmt.Errorf("invalid exclude pattern %q: %v", pattern, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// pickEndpoint selects an endpoint with probability proportional to its weight.
+// It returns nil when no endpoints are configured.
+func (t *Tester) pickEndpoint() *Endpoint {
+	if len(t.endpoints) == 0 {
+		return nil
+	}
+
+	total := 0
+	for _, ep := range t.endpoints {
+		total += ep.Weight
+	}
+
+	t.randMu.Lock()
+	n := t.rand.Intn(total)
+	t.randMu.Unlock()
+
+	for i := range t.endpoints {
+		n -= t.endpoints[i].Weight
+		if n < 0 {
+			return &t.endpoints[i]
+		}
+	}
+	return &t.endpoints[len(t.endpoints)-1]
+}
+
+// endpointURL resolves the endpoint's path against the target URL
+func endpointURL(targetURL *url.URL, ep *Endpoint) *url.URL {
+	if ep.Path == "" {
+		return targetURL
+	}
+
+	ref, err := url.Parse(ep.Path)
+	if err != nil {
+		// Paths are validated when the targets file is loaded
+		return targetURL
+	}
+	return targetURL.ResolveReference(ref)
+}
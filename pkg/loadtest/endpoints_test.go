@@ -0,0 +1,26 @@
+package loadtest
+
+import "testing"
+
+func TestExcludeEndpoints(t *testing.T) {
+	endpoints := []Endpoint{
+		{Method: "GET", Path: "/health", Weight: 3},
+		{Method: "GET", Path: "/admin/users?page=2", Weight: 1},
+		{Method: "POST", Path: "/orders", Weight: 2},
+	}
+
+	kept, err := ExcludeEndpoints(endpoints, []string{"/admin/*", "/health"})
+	if err != nil {
+		t.Fatalf("ExcludeEndpoints returned an error: %v", err)
+	}
+	if len(kept) != 1 || kept[0].Path != "/orders" {
+		t.Errorf("expected only /orders to remain, got %+v", kept)
+	}
+
+	if _, err := ExcludeEndpoints(endpoints, []string{"/*", "/admin/*"}); err == nil {
+		t.Error("expected an error when every endpoint is excluded")
+	}
+	if _, err := ExcludeEndpoints(endpoints, []string{"/[a-"}); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+}
@@ -0,0 +1,10 @@
+package loadtest
+
+import "errors"
+
+// Error categories returned by the load tester, wrapped with details. Use errors.Is to test for them.
+var (
+	ErrInvalidTarget      = errors.New("invalid target")
+	ErrTargetUnreachable  = errors.New("target unreachable")
+	ErrServiceUnavailable = errors.New("service appears unavailable") // Returned by Run when fail-fast aborted the test, and by Probe for an error status
+)
@@ -0,0 +1,77 @@
+package loadtest
+
+import (
+	"fmt"
+	"time"
+)
+
+// Fail-fast defaults
+const (
+	DefaultFailFastThreshold = 50.0             // Success rate percentage below which the service is considered failing
+	DefaultFailFastWindow    = 30 * time.Second // How long the success rate must stay below the threshold
+)
+
+// failFast tracks the success rate per second and trips once it has stayed below the threshold
+// for the whole window. Seconds without any results don't end a breach, since requests to a
+// hanging service only complete when they time out.
+type failFast struct {
+	threshold float64
+	window    time.Duration
+
+	bucketStart time.Time
+	requests    int
+	successes   int
+	belowSince  time.Time
+}
+
+// newFailFast returns a fail-fast monitor, or nil if fail-fast is disabled
+func newFailFast(opts Options) *failFast {
+	if !opts.FailFast {
+		return nil
+	}
+
+	ff := &failFast{threshold: opts.FailFastThreshold, window: opts.FailFastWindow}
+	if ff.threshold <= 0 {
+		ff.threshold = DefaultFailFastThreshold
+	}
+	if ff.window <= 0 {
+		ff.window = DefaultFailFastWindow
+	}
+	return ff
+}
+
+// record adds a result and reports whether the test should be aborted
+func (ff *failFast) record(r *Result, now time.Time) bool {
+	if ff == nil {
+		return false
+	}
+
+	if ff.bucketStart.IsZero() {
+		ff.bucketStart = now
+	}
+
+	// Evaluate the previous second once a result arrives after it
+	if now.Sub(ff.bucketStart) >= time.Second {
+		rate := float64(ff.successes) / float64(ff.requests) * 100.0
+		if rate < ff.threshold {
+			if ff.belowSince.IsZero() {
+				ff.belowSince = ff.bucketStart
+			}
+		} else {
+			ff.belowSince = time.Time{}
+		}
+		ff.bucketStart, ff.requests, ff.successes = now, 0, 0
+	}
+
+	ff.requests++
+	if r.Error == nil && r.StatusCode >= 200 && r.StatusCode < 400 {
+		ff.successes++
+	}
+
+	return !ff.belowSince.IsZero() && now.Sub(ff.belowSince) >= ff.window
+}
+
+// err describes why the test was aborted
+func (ff *failFast) err() error {
+	return fmt.Errorf("%w: success rate stayed below %.0f%% for %s", ErrServiceUnavailable, ff.threshold, ff.window)
+}
@@ -0,0 +1,83 @@
+package loadtest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// hdrTicksPerHalfDistance is how many percentile levels are reported between a level and the
+// level halfway to 100%, as in HdrHistogram's default percentile distribution output
+const hdrTicksPerHalfDistance = 5
+
+// WriteLatencyHistogram writes the latency distribution in the percentile distribution format
+// HdrHistogram's outputPercentileDistribution produces (.hgrm), with values in milliseconds, so
+// HdrHistogram tooling such as its plotter can read it. After a header line and a blank line,
+// each line holds a latency, the fraction of requests at or below it, their count, and
+// 1/(1-fraction). Levels get denser towards the tail, five per halving of the remaining
+// distance to 100%. The last line is the maximum at 1.0, and two "#[...]" lines summarize the
+// mean, standard deviation, maximum, and total count. Percentiles are exact over the latencies.
+func WriteLatencyHistogram(w io.Writer, latencies []time.Duration) error {
+	sorted := make([]float64, len(latencies))
+	var sum float64
+	for i, l := range latencies {
+		sorted[i] = float64(l.Microseconds()) / 1000.0
+		sum += sorted[i]
+	}
+	sort.Float64s(sorted)
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "%12s %14s %10s %14s\n\n", "Value", "Percentile", "TotalCount", "1/(1-Percentile)")
+
+	n := len(sorted)
+	if n == 0 {
+		fmt.Fprintf(b, "#[Mean    = %12.3f, StdDeviation   = %12.3f]\n", 0.0, 0.0)
+		fmt.Fprintf(b, "#[Max     = %12.3f, Total count    = %12d]\n", 0.0, 0)
+		return b.Flush()
+	}
+
+	for percentile := 0.0; ; {
+		rank := int(math.Ceil(percentile / 100 * float64(n)))
+		if rank < 1 {
+			rank = 1
+		}
+		value := sorted[rank-1]
+
+		// Count every latency equal to the value, as a histogram bucket would
+		count := sort.Search(n, func(i int) bool { return sorted[i] > value })
+		if count == n {
+			break
+		}
+		fmt.Fprintf(b, "%12.3f %2.12f %10d %14.2f\n", value, percentile/100, count, 1/(1-percentile/100))
+
+		halvings := math.Floor(math.Log2(100 / (100 - percentile)))
+		percentile += 100 / (hdrTicksPerHalfDistance * math.Pow(2, halvings+1))
+	}
+	fmt.Fprintf(b, "%12.3f %2.12f %10d\n", sorted[n-1], 1.0, n)
+
+	mean := sum / float64(n)
+	var variance float64
+	for _, v := range sorted {
+		variance += (v - mean) * (v - mean)
+	}
+	fmt.Fprintf(b, "#[Mean    = %12.3f, StdDeviation   = %12.3f]\n", mean, math.Sqrt(variance/float64(n)))
+	fmt.Fprintf(b, "#[Max     = %12.3f, Total count    = %12d]\n", sorted[n-1], n)
+	return b.Flush()
+}
+
+// SaveLatencyHistogram writes the run's latency distribution to path with WriteLatencyHistogram
+func SaveLatencyHistogram(path string, m *Metrics) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteLatencyHistogram(f, m.Latencies); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,38 @@
+package loadtest
+
+import (
+	"sort"
+	"time"
+)
+
+// scheduledSendTime returns when the n-th request (counting from 0) of an RPS run is meant to be
+// sent. A stalled service or generator delays later sends past this time, and measuring their
+// latency only from the actual send hides that wait (coordinated omission).
+func scheduledSendTime(start time.Time, interval time.Duration, n int) time.Time {
+	return start.Add(time.Duration(n+1) * interval)
+}
+
+// latencyPercentile returns the p-th percentile (0-100) of the latencies
+func latencyPercentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	idx := int(float64(len(sorted)) * p / 100)
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// CorrectedLatency returns the p-th percentile (0-100) of the latencies measured from each
+// request's scheduled send time, or 0 if the run didn't correct for coordinated omission
+func (m *Metrics) CorrectedLatency(p float64) time.Duration {
+	return latencyPercentile(m.CorrectedLatencies, p)
+}
@@ -0,0 +1,73 @@
+package loadtest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Kinds of request failure, by where the request failed
+const (
+	failureDNS     = "DNS lookup failed"
+	failureRefused = "connection refused"
+	failureTimeout = "timed out"
+	failureTLS     = "TLS handshake failed"
+	failureOther   = "request failed"
+)
+
+// ProbeTimeout bounds the reachability probe
+const ProbeTimeout = 10 * time.Second
+
+// requestErrorKind classifies the error of a request that got no response, so a target that
+// doesn't resolve can be told apart from one that refuses connections, times out, or fails TLS
+func requestErrorKind(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return failureDNS
+	case errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(err.Error(), "connection refused"):
+		return failureRefused
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return failureTimeout
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &unknownAuthority),
+		errors.As(err, &hostnameErr), strings.Contains(err.Error(), "tls: "):
+		return failureTLS
+	default:
+		return failureOther
+	}
+}
+
+// Probe sends a single GET request to the target, with the tester's transport and headers, to
+// confirm it can be load tested before a long run. It returns the response's status code. A
+// request that gets no response fails with ErrTargetUnreachable naming the kind of failure, and
+// an error status (400 and above) with ErrServiceUnavailable.
+func (t *Tester) Probe(ctx context.Context) (int, error) {
+	targetURL, err := TargetURL(t.target, t.opts)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+	defer cancel()
+
+	result := t.roundTrip(ctx, "GET", targetURL, "", nil)
+	if result.Error != nil {
+		return 0, fmt.Errorf("%w: %s: %s: %v", ErrTargetUnreachable, targetURL, requestErrorKind(result.Error), result.Error)
+	}
+	if result.StatusCode >= 400 {
+		return result.StatusCode, fmt.Errorf("%w: %s answered with HTTP %d", ErrServiceUnavailable, targetURL, result.StatusCode)
+	}
+	return result.StatusCode, nil
+}
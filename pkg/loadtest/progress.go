@@ -0,0 +1,38 @@
+package loadtest
+
+import (
+	"fmt"
+	"time"
+)
+
+// progressInterval is how many requests pass between progress lines
+const progressInterval = 100
+
+// progress reports how far a run has come, by request count when the total is known
+// and by elapsed time otherwise
+type progress struct {
+	start    time.Time
+	duration time.Duration
+	total    int // Expected number of requests (0 if unknown)
+}
+
+// report prints a progress line every progressInterval requests
+func (p progress) report(m *Metrics) {
+	if m.Requests%progressInterval != 0 {
+		return
+	}
+
+	if p.total > 0 {
+		fmt.Printf("Progress: %d/%d requests (%.0f%%), %.2f%% success\n",
+			m.Requests, p.total, float64(m.Requests)/float64(p.total)*100.0, m.SuccessRate())
+		return
+	}
+
+	elapsed := time.Since(p.start)
+	if elapsed > p.duration {
+		elapsed = p.duration
+	}
+	fmt.Printf("Progress: %d requests, %s/%s elapsed (%.0f%%), %.2f%% success\n",
+		m.Requests, elapsed.Round(time.Second), p.duration,
+		float64(elapsed)/float64(p.duration)*100.0, m.SuccessRate())
+}
@@ -0,0 +1,17 @@
+package loadtest
+
+import "time"
+
+// RampStartWorkers is the number of concurrent workers started right away when ramping up
+const RampStartWorkers = 1
+
+// workerStartDelay returns how long after the start of the test the worker with the given index
+// (0-based) starts. The workers after the first RampStartWorkers are spread evenly over the
+// ramp, so the last one starts as it ends.
+func workerStartDelay(worker, concurrency int, ramp time.Duration) time.Duration {
+	if ramp <= 0 || worker < RampStartWorkers || concurrency <= RampStartWorkers {
+		return 0
+	}
+	step := worker - RampStartWorkers + 1
+	return ramp * time.Duration(step) / time.Duration(concurrency-RampStartWorkers)
+}
@@ -0,0 +1,25 @@
+package loadtest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkerStartDelay(t *testing.T) {
+	ramp := 40 * time.Second
+
+	// The first worker starts right away and the other four join every 10s
+	want := []time.Duration{0, 10 * time.Second, 20 * time.Second, 30 * time.Second, 40 * time.Second}
+	for worker, delay := range want {
+		if got := workerStartDelay(worker, len(want), ramp); got != delay {
+			t.Errorf("worker %d: got %s, want %s", worker, got, delay)
+		}
+	}
+
+	if got := workerStartDelay(3, 5, 0); got != 0 {
+		t.Errorf("without a ramp: got %s, want 0s", got)
+	}
+	if got := workerStartDelay(0, 1, ramp); got != 0 {
+		t.Errorf("single worker: got %s, want 0s", got)
+	}
+}
@@ -0,0 +1,122 @@
+package loadtest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResultRecord is one request's entry in a saved load results file
+type ResultRecord struct {
+	Timestamp time.Time `json:"timestamp"` // When the request was sent
+	LatencyMs float64   `json:"latencyMs"`
+	Status    int       `json:"status"` // 0 if no response was received
+	Error     string    `json:"error,omitempty"`
+}
+
+// resultsCSVHeader is the header row of CSV load results files, in ResultRecord field order
+var resultsCSVHeader = []string{"timestamp", "latency_ms", "status", "error"}
+
+// NewResultRecord converts a request's result into its saved form
+func NewResultRecord(r *Result) ResultRecord {
+	record := ResultRecord{
+		Timestamp: r.Start.UTC(),
+		LatencyMs: float64(r.Latency.Microseconds()) / 1000.0,
+		Status:    r.StatusCode,
+	}
+	if r.Error != nil {
+		record.Error = r.Error.Error()
+	}
+	return record
+}
+
+// ResultWriter streams the result of every request to a file as the results are collected, as
+// CSV if the file name ends in .csv and as JSON lines otherwise. Results aren't kept in memory,
+// so it's suited to long or high-RPS runs. It is safe for concurrent use.
+type ResultWriter struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf *bufio.Writer
+	csv *csv.Writer // nil for JSON lines
+	err error       // First write error; later results are dropped
+}
+
+// NewResultWriter creates or truncates the file at path and returns a writer for it
+func NewResultWriter(path string) (*ResultWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &ResultWriter{f: f, buf: bufio.NewWriter(f)}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		w.csv = csv.NewWriter(w.buf)
+		if err := w.csv.Write(resultsCSVHeader); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Write appends the result to the file. Errors are reported by Flush and Close.
+func (w *ResultWriter) Write(r *Result) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return
+	}
+
+	record := NewResultRecord(r)
+	if w.csv != nil {
+		w.err = w.csv.Write([]string{
+			record.Timestamp.Format(time.RFC3339Nano),
+			strconv.FormatFloat(record.LatencyMs, 'f', 3, 64),
+			strconv.Itoa(record.Status),
+			record.Error,
+		})
+		return
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		w.err = err
+		return
+	}
+	_, w.err = w.buf.Write(append(data, '\n'))
+}
+
+// Flush writes buffered results to the file and returns the first error writing any result
+func (w *ResultWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err == nil && w.csv != nil {
+		w.csv.Flush()
+		w.err = w.csv.Error()
+	}
+	if w.err == nil {
+		w.err = w.buf.Flush()
+	}
+	if w.err != nil {
+		return fmt.Errorf("error writing load results: %v", w.err)
+	}
+	return nil
+}
+
+// Close flushes the buffered results and closes the file
+func (w *ResultWriter) Close() error {
+	err := w.Flush()
+	if closeErr := w.f.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retry defaults
+const (
+	DefaultMaxRetries   = 3                      // Retries per request after the first attempt
+	DefaultRetryBackoff = 100 * time.Millisecond // Delay before the first retry, doubled for each further one
+	MaxRetries          = 10                     // Most retries allowed per request
+	MaxRetryBackoff     = 30 * time.Second       // Longest delay before any retry
+)
+
+// ParseStatusCodes parses a comma-separated list of HTTP status codes such as "503,502"
+func ParseStatusCodes(value string) ([]int, error) {
+	var codes []int
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		code, err := strconv.Atoi(field)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %q", field)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// shouldRetry reports whether a response with the given status code is retried
+func (t *Tester) shouldRetry(statusCode int) bool {
+	for _, code := range t.opts.RetryOnStatus {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// waitRetry sleeps for the backoff before the given retry (1 for the first) and reports
+// whether the request should still be retried, i.e. the context wasn't canceled meanwhile
+func (t *Tester) waitRetry(ctx context.Context, retry int) bool {
+	backoff := retryBackoff(t.opts.RetryBackoff, retry)
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(backoff):
+		return true
+	}
+}
+
+// retryBackoff returns the delay before the given retry (1 for the first): base doubled for each
+// retry after the first, capped at MaxRetryBackoff
+func retryBackoff(base time.Duration, retry int) time.Duration {
+	if base <= 0 {
+		base = DefaultRetryBackoff
+	}
+
+	backoff := base
+	for i := 1; i < retry && backoff < MaxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > MaxRetryBackoff {
+		backoff = MaxRetryBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,44 @@
+package loadtest
+
+import (
+	"math/rand"
+	"time"
+)
+
+// DefaultLatencySamples is how many latencies a run keeps before it switches to sampling them
+const DefaultLatencySamples = 100000
+
+// addLatency records a response's latency, and its latency from the scheduled send time when
+// the run corrects for coordinated omission. Once more than LatencySampleSize were measured, the
+// kept latencies become a uniform random sample of all of them (reservoir sampling), so a long
+// high-RPS run doesn't hold every latency in memory. The two slices are sampled together.
+func (m *Metrics) addLatency(latency, corrected time.Duration) {
+	m.LatencyCount++
+	if m.LatencySampleSize <= 0 || len(m.Latencies) < m.LatencySampleSize {
+		m.Latencies = append(m.Latencies, latency)
+		if m.OmissionCorrected {
+			m.CorrectedLatencies = append(m.CorrectedLatencies, corrected)
+		}
+		return
+	}
+
+	m.LatencySampled = true
+	if m.sampler == nil {
+		m.sampler = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if i := m.sampler.Int63n(int64(m.LatencyCount)); i < int64(len(m.Latencies)) {
+		m.Latencies[i] = latency
+		if m.OmissionCorrected {
+			m.CorrectedLatencies[i] = corrected
+		}
+	}
+}
+
+// newSampler returns a source for a run's latency sampling, seeded from the tester's own so that
+// a --seed run samples the same latencies. Each run's metrics are only updated from a single
+// goroutine, so the sampler needs no lock of its own.
+func (t *Tester) newSampler() *rand.Rand {
+	t.randMu.Lock()
+	defer t.randMu.Unlock()
+	return rand.New(rand.NewSource(t.rand.Int63()))
+}
@@ -0,0 +1,77 @@
+package loadtest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Body template placeholders, expanded per request
+var bodyPlaceholders = map[string]func(t *Tester) string{
+	"randInt": func(t *Tester) string {
+		return strconv.Itoa(t.rand.Intn(1000000000))
+	},
+	"uuid": func(t *Tester) string {
+		var b [16]byte
+		t.rand.Read(b[:])
+		b[6] = (b[6] & 0x0f) | 0x40 // Version 4
+		b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+	},
+}
+
+// ValidateBodyTemplate checks that every {{placeholder}} in the template is supported
+func ValidateBodyTemplate(template string) error {
+	rest := template
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			return nil
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return fmt.Errorf("unterminated placeholder in body template at %q", rest[start:])
+		}
+
+		name := strings.TrimSpace(rest[start+2 : start+end])
+		if _, ok := bodyPlaceholders[name]; !ok {
+			return fmt.Errorf("unknown placeholder {{%s}} in body template (supported: {{randInt}}, {{uuid}})", name)
+		}
+		rest = rest[start+end+2:]
+	}
+}
+
+// expandBody replaces the placeholders in a request body with fresh values, drawn from the
+// tester's seeded random source. Unknown placeholders are left as they are.
+func (t *Tester) expandBody(body string) string {
+	if !strings.Contains(body, "{{") {
+		return body
+	}
+
+	t.randMu.Lock()
+	defer t.randMu.Unlock()
+
+	var b strings.Builder
+	rest := body
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			break
+		}
+
+		b.WriteString(rest[:start])
+		if generate, ok := bodyPlaceholders[strings.TrimSpace(rest[start+2:start+end])]; ok {
+			b.WriteString(generate(t))
+		} else {
+			b.WriteString(rest[start : start+end+2])
+		}
+		rest = rest[start+end+2:]
+	}
+	b.WriteString(rest)
+
+	return b.String()
+}
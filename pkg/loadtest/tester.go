@@ -2,16 +2,19 @@ package loadtest
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,35 +25,114 @@ type Tester struct {
 	concurrency int
 	client      *http.Client
 	results     chan *Result
+	endpoints   []Endpoint // Weighted request mix; empty means GET on the target URL
+	total       int        // Stop after this many requests (0 runs for the full duration)
+	thinkTime   ThinkTime  // Pause between a concurrent worker's requests
+	opts        Options
+	headers     http.Header // Added to every request
+
+	resultWriter *ResultWriter // Receives every request's result if set
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	metricsMu   sync.Mutex
+	lastMetrics *Metrics // Metrics of the most recent run
 }
 
 // Result represents the result of a single request
 type Result struct {
+	Start      time.Time // When the request was sent
 	Latency    time.Duration
 	StatusCode int
 	Error      error
+	ConnReused bool          // Whether the request was sent over a reused keep-alive connection
+	Retries    int           // Retries made after the first attempt because of a retryable status code
+	SendDelay  time.Duration // How late the request was sent after its scheduled time (RPS mode only)
+}
+
+// Options holds optional settings for the load tester
+//
+// The connection pool settings matter at high RPS: Go's default transport keeps only 2 idle
+// connections per host, so most requests open a new connection. That makes the generator
+// itself the bottleneck and the service can look less loaded than intended.
+type Options struct {
+	TLSMinVersion     uint16            // Minimum TLS version for HTTPS targets (0 uses Go's default)
+	TLSCipherSuites   []uint16          // Allowed TLS 1.2 cipher suites (empty uses Go's default)
+	MaxIdleConns      int               // Idle keep-alive connections kept per host and in total (0 uses Go's default)
+	MaxConnsPerHost   int               // Cap on total connections per host, and on RPS-mode requests in flight (0 means no limit)
+	Endpoints         []Endpoint        // Weighted request mix (empty sends GET requests to the target URL)
+	Resolve           map[string]string // Dial address overrides from "host:port" to "addr:port"
+	ThinkTime         *ThinkTime        // Pause between a concurrent worker's requests (nil uses DefaultThinkTime)
+	BodyTemplate      string            // Body POSTed to the target, with {{randInt}} and {{uuid}} expanded per request (empty sends GET requests)
+	Seed              int64             // Seed for endpoint selection, think times, and body templates, for reproducible runs (0 seeds from the clock)
+	FailFast          bool              // Abort when the success rate stays below FailFastThreshold for FailFastWindow
+	FailFastThreshold float64           // Success rate percentage for fail-fast (0 uses DefaultFailFastThreshold)
+	FailFastWindow    time.Duration     // How long the success rate must stay low for fail-fast (0 uses DefaultFailFastWindow)
+	TotalRequests     int               // Stop after this many requests, or at the end of the duration if first (0 for no limit)
+	RetryOnStatus     []int             // Status codes that are retried instead of counted as failures right away
+	MaxRetries        int               // Retries per request for RetryOnStatus codes (0 disables retries)
+	RetryBackoff      time.Duration     // Delay before the first retry, doubled for each further one (0 uses DefaultRetryBackoff)
+	ConcurrencyRamp   time.Duration     // Window over which concurrent workers are added after RampStartWorkers (0 starts all at once)
+	CorrectOmission   bool              // Also measure RPS-mode latency from each request's scheduled send time
+	TargetPort        int               // Port that replaces or adds to the target URL's port (0 keeps the URL's)
+	ErrorBackoff      time.Duration     // Pause of a concurrent worker after a failed request (0 uses DefaultErrorBackoff)
+	ErrorBackoffExp   bool              // Double ErrorBackoff for each consecutive failure of a worker, up to MaxErrorBackoff
+	LatencySamples    int               // Latencies kept exactly, beyond which percentiles are estimated from a sample (0 keeps all)
 }
 
-// NewTester creates a new load tester
-func NewTester(target string, rps, concurrency int) *Tester {
-	return &Tester{
+// NewTester creates a new load tester. Requests go through a transport built from opts unless
+// a TesterOption such as WithTransport or WithClient replaces it.
+func NewTester(target string, rps, concurrency int, opts Options, testerOpts ...TesterOption) *Tester {
+	thinkTime := DefaultThinkTime
+	if opts.ThinkTime != nil {
+		thinkTime = *opts.ThinkTime
+	}
+
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	t := &Tester{
 		target:      target,
 		rps:         rps,
 		concurrency: concurrency,
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: NewTransport(opts),
 		},
-		results: make(chan *Result, 10000), // Buffer for results
+		results:   make(chan *Result, 10000), // Buffer for results
+		endpoints: opts.Endpoints,
+		total:     opts.TotalRequests,
+		thinkTime: thinkTime,
+		opts:      opts,
+		rand:      rand.New(rand.NewSource(seed)),
+	}
+	for _, apply := range testerOpts {
+		apply(t)
 	}
+	return t
 }
 
-// Run executes a load test for the specified duration
+// Run executes a load test for the specified duration. It returns an error wrapping
+// ErrTargetUnreachable if the run completed without a single response from the target.
 func (t *Tester) Run(ctx context.Context, duration time.Duration) error {
+	var err error
 	// Check if we should use RPS or Concurrency mode
 	if t.concurrency > 0 {
-		return t.runConcurrentTest(ctx, duration)
+		err = t.runConcurrentTest(ctx, duration)
+	} else {
+		err = t.runRPSTest(ctx, duration)
+	}
+	if err != nil || ctx.Err() != nil {
+		return err
+	}
+
+	if m := t.Metrics(); m != nil && m.Requests > 0 && len(m.StatusCodes) == 0 {
+		return fmt.Errorf("%w: none of the %d requests to %s got a response", ErrTargetUnreachable, m.Requests, t.target)
 	}
-	return t.runRPSTest(ctx, duration)
+	return nil
 }
 
 // runRPSTest runs a load test at a specified RPS
@@ -77,6 +159,9 @@ func (t *Tester) runRPSTest(ctx context.Context, duration time.Duration) error {
 
 	// Record the start time of the test
 	testStartTime := time.Now()
+	prog := progress{start: testStartTime, duration: duration, total: t.ExpectedRequests(duration)}
+	ff := newFailFast(t.opts)
+	var abortErr error // Set by the result collector if fail-fast tripped, read after it's done
 
 	// Collect and process results
 	go func() {
@@ -84,9 +169,13 @@ func (t *Tester) runRPSTest(ctx context.Context, duration time.Duration) error {
 		defer close(resultsDone)
 
 		var metrics Metrics
+		defer t.storeMetrics(&metrics)
 		// Initialize metrics with the test start time
 		metrics.StartTime = testStartTime
 		metrics.TestDuration = duration // Store the intended duration
+		metrics.OmissionCorrected = t.opts.CorrectOmission
+		metrics.LatencySampleSize = t.opts.LatencySamples
+		metrics.sampler = t.newSampler()
 
 		for {
 			select {
@@ -106,11 +195,15 @@ func (t *Tester) runRPSTest(ctx context.Context, duration time.Duration) error {
 				}
 
 				metrics.Add(result)
+				t.recordResult(result)
 
 				// Log progress periodically
-				if metrics.Requests%100 == 0 {
-					fmt.Printf("Progress: %d requests, %.2f%% success\n",
-						metrics.Requests, metrics.SuccessRate())
+				prog.report(&metrics)
+
+				if ff.record(result, time.Now()) {
+					abortErr = ff.err()
+					fmt.Printf("Aborting load test: %v\n", abortErr)
+					testCancel()
 				}
 			}
 		}
@@ -162,6 +255,13 @@ func (t *Tester) runRPSTest(ctx context.Context, duration time.Duration) error {
 
 		var requestWg sync.WaitGroup
 		sent := 0
+		expected := t.ExpectedRequests(duration)
+
+		// With a connection cap, a request is only sent once a connection is free
+		var slots chan struct{}
+		if t.opts.MaxConnsPerHost > 0 {
+			slots = make(chan struct{}, t.opts.MaxConnsPerHost)
+		}
 
 		for {
 			select {
@@ -170,53 +270,40 @@ func (t *Tester) runRPSTest(ctx context.Context, duration time.Duration) error {
 				requestWg.Wait()
 				return
 			case <-ticker.C:
-				requestWg.Add(1)
-				go func() {
-					defer requestWg.Done()
-
-					start := time.Now()
-					// Create request with special user agent
-					req, err := http.NewRequestWithContext(testCtx, "GET", targetURL.String(), nil)
-					if err != nil {
-						fmt.Printf("Error creating request to %s: %v\n", targetURL.String(), err)
-						safeSend(&Result{Error: err})
-						return
-					}
-
-					// Add custom headers to help identify our requests
-					req.Header.Add("User-Agent", "Pod-Rightsizer/1.0")
-
-					// Make the request
-					resp, err := t.client.Do(req)
-					latency := time.Since(start)
-
-					if err != nil {
-						// Extract more details about the error
-						var netErr net.Error
-						if errors.As(err, &netErr) && netErr.Timeout() {
-							fmt.Printf("Network timeout error: %v\n", err)
-						} else if strings.Contains(err.Error(), "connection refused") {
-							fmt.Printf("Connection refused: %v (is the service running?)\n", err)
-						} else {
-							fmt.Printf("HTTP request error: %v\n", err)
+				// Requests follow a fixed schedule. Those whose time passed while the loop waited
+				// for a free connection, including ticks the ticker dropped meanwhile, are sent
+				// now, late, and their delay counts toward the corrected latency.
+				due := int(time.Since(testStartTime) / interval)
+				if due > expected {
+					due = expected
+				}
+				for ; sent < due; sent++ {
+					if slots != nil {
+						select {
+						case slots <- struct{}{}:
+						case <-testCtx.Done():
+							requestWg.Wait()
+							return
 						}
-
-						safeSend(&Result{Latency: latency, Error: err})
-						return
 					}
-					defer resp.Body.Close()
 
-					// Discard body to properly reuse connections
-					io.Copy(io.Discard, resp.Body)
-
-					safeSend(&Result{
-						Latency:    latency,
-						StatusCode: resp.StatusCode,
-					})
-				}()
+					scheduled := scheduledSendTime(testStartTime, interval, sent)
+					requestWg.Add(1)
+					go func() {
+						defer requestWg.Done()
+						sendDelay := time.Since(scheduled)
+						result := t.doRequest(testCtx, targetURL)
+						if slots != nil {
+							<-slots
+						}
+						if sendDelay > 0 {
+							result.SendDelay = sendDelay
+						}
+						safeSend(result)
+					}()
+				}
 
-				sent++
-				if sent >= t.rps*int(duration.Seconds()) {
+				if sent >= expected {
 					// Wait for all request goroutines to complete before exiting
 					go func() {
 						requestWg.Wait()
@@ -243,7 +330,7 @@ func (t *Tester) runRPSTest(ctx context.Context, duration time.Duration) error {
 	// Wait for all goroutines to complete
 	wg.Wait()
 
-	return nil
+	return abortErr
 }
 
 // runConcurrentTest runs a test with a fixed number of concurrent workers
@@ -254,8 +341,13 @@ func (t *Tester) runConcurrentTest(ctx context.Context, duration time.Duration)
 		return err
 	}
 
-	fmt.Printf("Starting concurrent load test with %d workers for %s...\n",
-		t.concurrency, duration)
+	if t.opts.ConcurrencyRamp > 0 {
+		fmt.Printf("Starting concurrent load test with %d workers for %s, ramping up from %d over %s...\n",
+			t.concurrency, duration, RampStartWorkers, t.opts.ConcurrencyRamp)
+	} else {
+		fmt.Printf("Starting concurrent load test with %d workers for %s...\n",
+			t.concurrency, duration)
+	}
 
 	// Create contexts for the test
 	testCtx, testCancel := context.WithTimeout(ctx, duration)
@@ -271,6 +363,9 @@ func (t *Tester) runConcurrentTest(ctx context.Context, duration time.Duration)
 
 	// Record the start time of the test
 	testStartTime := time.Now()
+	prog := progress{start: testStartTime, duration: duration, total: t.ExpectedRequests(duration)}
+	ff := newFailFast(t.opts)
+	var abortErr error // Set by the result collector if fail-fast tripped, read after it's done
 
 	// Collect and process results
 	go func() {
@@ -278,9 +373,12 @@ func (t *Tester) runConcurrentTest(ctx context.Context, duration time.Duration)
 		defer close(resultsDone)
 
 		var metrics Metrics
+		defer t.storeMetrics(&metrics)
 		// Initialize metrics with the test start time
 		metrics.StartTime = testStartTime
 		metrics.TestDuration = duration // Store the intended duration
+		metrics.LatencySampleSize = t.opts.LatencySamples
+		metrics.sampler = t.newSampler()
 
 		for {
 			select {
@@ -300,11 +398,15 @@ func (t *Tester) runConcurrentTest(ctx context.Context, duration time.Duration)
 				}
 
 				metrics.Add(result)
+				t.recordResult(result)
 
 				// Log progress periodically
-				if metrics.Requests%100 == 0 {
-					fmt.Printf("Progress: %d requests, %.2f%% success\n",
-						metrics.Requests, metrics.SuccessRate())
+				prog.report(&metrics)
+
+				if ff.record(result, time.Now()) {
+					abortErr = ff.err()
+					fmt.Printf("Aborting load test: %v\n", abortErr)
+					testCancel()
 				}
 			}
 		}
@@ -346,63 +448,51 @@ func (t *Tester) runConcurrentTest(ctx context.Context, duration time.Duration)
 
 	// Start worker goroutines
 	var workerWg sync.WaitGroup
+	var sent int64
 	for i := 0; i < t.concurrency; i++ {
 		workerWg.Add(1)
 		go func(id int) {
 			defer workerWg.Done()
 
+			// Later workers join gradually when ramping up
+			if delay := workerStartDelay(id, t.concurrency, t.opts.ConcurrencyRamp); delay > 0 {
+				select {
+				case <-testCtx.Done():
+					return
+				case <-time.After(delay):
+				}
+			}
+
+			failures := 0 // Consecutive failed requests of this worker
 			for {
 				select {
 				case <-testCtx.Done():
 					return
 				default:
-					start := time.Now()
-					// Create request with special user agent
-					req, err := http.NewRequestWithContext(testCtx, "GET", targetURL.String(), nil)
-					if err != nil {
-						fmt.Printf("Error creating request to %s: %v\n", targetURL.String(), err)
-						safeSend(&Result{Error: err})
-						time.Sleep(100 * time.Millisecond) // Back off on errors
-						continue
+					// Reserve a request slot when the run is bounded by a request count
+					if t.total > 0 && atomic.AddInt64(&sent, 1) > int64(t.total) {
+						return
 					}
 
-					// Add custom headers to help identify our requests
-					req.Header.Add("User-Agent", "Pod-Rightsizer/1.0")
-
-					// Make the request
-					resp, err := t.client.Do(req)
-					latency := time.Since(start)
-
-					if err != nil {
-						// Extract more details about the error
-						var netErr net.Error
-						if errors.As(err, &netErr) && netErr.Timeout() {
-							fmt.Printf("Network timeout error: %v\n", err)
-						} else if strings.Contains(err.Error(), "connection refused") {
-							fmt.Printf("Connection refused: %v (is the service running?)\n", err)
-						} else {
-							fmt.Printf("HTTP request error: %v\n", err)
+					result := t.doRequest(testCtx, targetURL)
+					safeSend(result)
+					if result.Error != nil {
+						// Back off on errors
+						failures++
+						select {
+						case <-testCtx.Done():
+							return
+						case <-time.After(t.errorBackoff(failures)):
 						}
-
-						safeSend(&Result{Latency: latency, Error: err})
-						time.Sleep(100 * time.Millisecond) // Back off on errors
 						continue
 					}
+					failures = 0
 
-					// Discard and close body
-					io.Copy(io.Discard, resp.Body)
-					resp.Body.Close()
-
-					safeSend(&Result{
-						Latency:    latency,
-						StatusCode: resp.StatusCode,
-					})
-
-					// Small delay to prevent excessive CPU usage
+					// Pause for the configured think time before the next request
 					select {
 					case <-testCtx.Done():
 						return
-					case <-time.After(10 * time.Millisecond):
+					case <-time.After(t.nextThinkTime()):
 						// Continue after delay
 					}
 				}
@@ -410,6 +500,14 @@ func (t *Tester) runConcurrentTest(ctx context.Context, duration time.Duration)
 		}(i)
 	}
 
+	// A request-count bounded run completes once every worker has used up its slots
+	if t.total > 0 {
+		go func() {
+			workerWg.Wait()
+			testCancel()
+		}()
+	}
+
 	// Wait for test completion
 	select {
 	case <-ctx.Done():
@@ -431,28 +529,198 @@ func (t *Tester) runConcurrentTest(ctx context.Context, duration time.Duration)
 	// Wait for all goroutines to complete
 	wg.Wait()
 
-	return nil
+	return abortErr
+}
+
+// storeMetrics records the metrics of a finished run and flushes the results written so far
+func (t *Tester) storeMetrics(m *Metrics) {
+	t.metricsMu.Lock()
+	defer t.metricsMu.Unlock()
+	t.lastMetrics = m
+
+	if t.resultWriter != nil {
+		if err := t.resultWriter.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+}
+
+// recordResult streams the result to the result writer, if any
+func (t *Tester) recordResult(r *Result) {
+	if t.resultWriter != nil {
+		t.resultWriter.Write(r)
+	}
+}
+
+// Metrics returns the metrics of the most recent run, or nil if no run has finished
+func (t *Tester) Metrics() *Metrics {
+	t.metricsMu.Lock()
+	defer t.metricsMu.Unlock()
+	return t.lastMetrics
+}
+
+// doRequest sends a single request to the target and reports its outcome. Responses with a
+// retryable status code are retried with backoff, and the reported latency covers all attempts.
+func (t *Tester) doRequest(ctx context.Context, targetURL *url.URL) *Result {
+	method, requestURL := "GET", targetURL
+	var body string
+	ep := t.pickEndpoint()
+	if ep != nil {
+		method, requestURL = ep.Method, endpointURL(targetURL, ep)
+		if ep.Body != "" {
+			body = t.expandBody(ep.Body)
+		}
+	} else if t.opts.BodyTemplate != "" {
+		method = "POST"
+		body = t.expandBody(t.opts.BodyTemplate)
+	}
+
+	start := time.Now()
+	retries := 0
+	for {
+		result := t.sendRequest(ctx, method, requestURL, body, ep)
+		if result.Error != nil || !t.shouldRetry(result.StatusCode) ||
+			retries >= t.opts.MaxRetries || !t.waitRetry(ctx, retries+1) {
+			result.Start = start
+			result.Latency = time.Since(start)
+			result.Retries = retries
+			return result
+		}
+		retries++
+	}
+}
+
+// sendRequest makes one attempt at a request, logging why it failed if it did
+func (t *Tester) sendRequest(ctx context.Context, method string, requestURL *url.URL, body string, ep *Endpoint) *Result {
+	result := t.roundTrip(ctx, method, requestURL, body, ep)
+	if result.Error != nil {
+		if requestErrorKind(result.Error) == failureRefused {
+			fmt.Printf("Connection refused: %v (is the service running?)\n", result.Error)
+		} else {
+			fmt.Printf("HTTP request error (%s): %v\n", requestErrorKind(result.Error), result.Error)
+		}
+	}
+	return result
+}
+
+// roundTrip makes one attempt at a request
+func (t *Tester) roundTrip(ctx context.Context, method string, requestURL *url.URL, body string, ep *Endpoint) *Result {
+	var bodyReader io.Reader
+	if body != "" {
+		bodyReader = strings.NewReader(body)
+	}
+
+	start := time.Now()
+	// Create request with special user agent
+	req, err := http.NewRequestWithContext(ctx, method, requestURL.String(), bodyReader)
+	if err != nil {
+		return &Result{Error: err}
+	}
+
+	// Add custom headers to help identify our requests
+	req.Header.Add("User-Agent", "Pod-Rightsizer/1.0")
+	if ep == nil && t.opts.BodyTemplate != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, values := range t.headers {
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	if ep != nil {
+		for name, value := range ep.Headers {
+			req.Header.Set(name, value)
+		}
+	}
+
+	// Trace whether the transport reused a pooled connection for this request
+	connReused := false
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			connReused = info.Reused
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	// Make the request
+	resp, err := t.client.Do(req)
+	latency := time.Since(start)
+
+	if err != nil {
+		return &Result{Latency: latency, Error: err}
+	}
+
+	// Discard and close body to properly reuse connections
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return &Result{
+		Latency:    latency,
+		StatusCode: resp.StatusCode,
+		ConnReused: connReused,
+	}
 }
 
 // validateTarget ensures the target is a valid URL and normalizes it
 func (t *Tester) validateTarget() (*url.URL, error) {
-	target := t.target
+	if !isURL(t.target) {
+		fmt.Printf("Added http:// prefix, target is now: http://%s\n", t.target)
+	}
+
+	parsedURL, err := TargetURL(t.target, t.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Validated target URL: %s\n", parsedURL.String())
+	return parsedURL, nil
+}
 
-	// Make sure target has a valid URL scheme
+// TargetURL returns the URL requests are sent to: the normalized target with the port of
+// opts.TargetPort, if set
+func TargetURL(target string, opts Options) (*url.URL, error) {
+	parsedURL, err := NormalizeTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.TargetPort != 0 {
+		if opts.TargetPort < 0 || opts.TargetPort > 65535 {
+			return nil, fmt.Errorf("%w: port %d out of range", ErrInvalidTarget, opts.TargetPort)
+		}
+		parsedURL.Host = net.JoinHostPort(parsedURL.Hostname(), strconv.Itoa(opts.TargetPort))
+	}
+	return parsedURL, nil
+}
+
+// NormalizeTarget parses the target as a URL, adding an http:// scheme if none is present
+func NormalizeTarget(target string) (*url.URL, error) {
 	if !isURL(target) {
 		target = "http://" + target
-		fmt.Printf("Added http:// prefix, target is now: %s\n", target)
 	}
 
 	parsedURL, err := url.Parse(target)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTarget, err)
 	}
-
-	fmt.Printf("Validated target URL: %s\n", parsedURL.String())
 	return parsedURL, nil
 }
 
+// ExpectedRequests returns how many requests a test of the given duration sends. In concurrency
+// mode it returns the configured total request count, or 0 if there is none, since the total
+// then depends on the service's response time.
+func (t *Tester) ExpectedRequests(duration time.Duration) int {
+	if t.concurrency > 0 {
+		return t.total
+	}
+	expected := t.rps * int(duration.Seconds())
+	if t.total > 0 && t.total < expected {
+		return t.total
+	}
+	return expected
+}
+
 // isURL checks if a string looks like a URL with a scheme
 func isURL(s string) bool {
 	// Check for http:// prefix
@@ -465,18 +733,48 @@ func isURL(s string) bool {
 }
 
 // Metrics holds load test metrics
+// Durations are serialized as nanoseconds; raw latencies are not serialized.
 type Metrics struct {
-	Requests     int
-	Success      int
-	Failures     int
-	StatusCodes  map[int]int
-	TotalLatency time.Duration
-	StartTime    time.Time     // When the test started
-	EndTime      time.Time     // When the test ended
-	TestDuration time.Duration // Actual duration of the test
-	MinLatency   time.Duration
-	MaxLatency   time.Duration
-	Latencies    []time.Duration
+	Requests       int             `json:"requests"`
+	Success        int             `json:"success"`
+	Failures       int             `json:"failures"`
+	StatusCodes    map[int]int     `json:"statusCodes"`
+	TotalLatency   time.Duration   `json:"totalLatency"`
+	StartTime      time.Time       `json:"startTime"`    // When the test started
+	EndTime        time.Time       `json:"endTime"`      // When the test ended
+	TestDuration   time.Duration   `json:"testDuration"` // Actual duration of the test
+	MinLatency     time.Duration   `json:"minLatency"`
+	MaxLatency     time.Duration   `json:"maxLatency"`
+	Latencies      []time.Duration `json:"-"`
+	ReusedConns    int             `json:"reusedConns"`    // Successful responses served over a reused connection
+	NewConns       int             `json:"newConns"`       // Successful responses that required a new connection
+	Retries        int             `json:"retries"`        // Retries made because of a retryable status code
+	RetriedSuccess int             `json:"retriedSuccess"` // Successful requests that needed at least one retry
+
+	// Latencies measured from each request's scheduled send time, when the run corrected for
+	// coordinated omission
+	OmissionCorrected  bool            `json:"omissionCorrected,omitempty"`
+	CorrectedLatencies []time.Duration `json:"-"`
+	MaxSendDelay       time.Duration   `json:"maxSendDelay,omitempty"` // Longest a request was sent after its scheduled time
+
+	// Latencies kept for percentiles before they are sampled (0 keeps every one). Once
+	// LatencySampled is set, percentiles are estimates from a sample of LatencyCount latencies.
+	LatencySampleSize int  `json:"-"`
+	LatencySampled    bool `json:"latencySampled,omitempty"`
+	LatencyCount      int  `json:"latencyCount"`
+
+	sampler *rand.Rand // Picks the latencies to keep once sampling; seeded from the tester's
+}
+
+// SortedStatusCodes returns the status codes of the run in ascending order, so they print the
+// same way on every run
+func (m *Metrics) SortedStatusCodes() []int {
+	codes := make([]int, 0, len(m.StatusCodes))
+	for code := range m.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	return codes
 }
 
 // Add adds a result to the metrics
@@ -487,6 +785,7 @@ func (m *Metrics) Add(r *Result) {
 	}
 
 	m.Requests++
+	m.Retries += r.Retries
 
 	if r.Error != nil {
 		m.Failures++
@@ -497,9 +796,19 @@ func (m *Metrics) Add(r *Result) {
 	// Count status codes
 	m.StatusCodes[r.StatusCode]++
 
+	// Track connection reuse
+	if r.ConnReused {
+		m.ReusedConns++
+	} else {
+		m.NewConns++
+	}
+
 	// Track latency stats
 	m.TotalLatency += r.Latency
-	m.Latencies = append(m.Latencies, r.Latency)
+	m.addLatency(r.Latency, r.Latency+r.SendDelay)
+	if r.SendDelay > m.MaxSendDelay {
+		m.MaxSendDelay = r.SendDelay
+	}
 
 	// Update min/max latency
 	if r.Latency < m.MinLatency {
@@ -512,6 +821,9 @@ func (m *Metrics) Add(r *Result) {
 	// Count successes (2xx and 3xx status codes)
 	if r.StatusCode >= 200 && r.StatusCode < 400 {
 		m.Success++
+		if r.Retries > 0 {
+			m.RetriedSuccess++
+		}
 		// Debug logging to see success codes
 		if m.Success%100 == 0 {
 			fmt.Printf("Success count: %d for status code %d\n", m.Success, r.StatusCode)
@@ -522,6 +834,57 @@ func (m *Metrics) Add(r *Result) {
 	}
 }
 
+// MergeMetrics combines the metrics of several runs, such as the iterations of a test, into one
+// covering all of their requests. The test duration is the sum of the runs', so throughput
+// excludes any pause between them. Nil runs are skipped; it returns nil if every run is nil.
+func MergeMetrics(runs ...*Metrics) *Metrics {
+	var merged *Metrics
+	for _, run := range runs {
+		if run == nil {
+			continue
+		}
+		if merged == nil {
+			merged = &Metrics{
+				StatusCodes:       make(map[int]int),
+				StartTime:         run.StartTime,
+				MinLatency:        run.MinLatency,
+				LatencySampleSize: run.LatencySampleSize,
+			}
+		}
+
+		merged.Requests += run.Requests
+		merged.Success += run.Success
+		merged.Failures += run.Failures
+		for code, count := range run.StatusCodes {
+			merged.StatusCodes[code] += count
+		}
+		merged.TotalLatency += run.TotalLatency
+		merged.EndTime = run.EndTime
+		merged.TestDuration += run.TestDuration
+		if run.MinLatency < merged.MinLatency {
+			merged.MinLatency = run.MinLatency
+		}
+		if run.MaxLatency > merged.MaxLatency {
+			merged.MaxLatency = run.MaxLatency
+		}
+		merged.Latencies = append(merged.Latencies, run.Latencies...)
+		merged.ReusedConns += run.ReusedConns
+		merged.NewConns += run.NewConns
+		merged.Retries += run.Retries
+		merged.RetriedSuccess += run.RetriedSuccess
+
+		merged.OmissionCorrected = merged.OmissionCorrected || run.OmissionCorrected
+		merged.CorrectedLatencies = append(merged.CorrectedLatencies, run.CorrectedLatencies...)
+		if run.MaxSendDelay > merged.MaxSendDelay {
+			merged.MaxSendDelay = run.MaxSendDelay
+		}
+
+		merged.LatencySampled = merged.LatencySampled || run.LatencySampled
+		merged.LatencyCount += run.LatencyCount
+	}
+	return merged
+}
+
 // MeanLatency calculates the mean latency
 func (m *Metrics) MeanLatency() time.Duration {
 	if m.Requests == 0 || m.TotalLatency == 0 {
@@ -540,26 +903,12 @@ func (m *Metrics) SuccessRate() float64 {
 
 // P95Latency calculates the 95th percentile latency
 func (m *Metrics) P95Latency() time.Duration {
-	if len(m.Latencies) == 0 {
-		return 0
-	}
-
-	// Sort latencies
-	sortedLatencies := make([]time.Duration, len(m.Latencies))
-	copy(sortedLatencies, m.Latencies)
-
-	// Use sort.Slice to sort the durations
-	sort.Slice(sortedLatencies, func(i, j int) bool {
-		return sortedLatencies[i] < sortedLatencies[j]
-	})
-
-	// Get index for 95th percentile
-	idx := int(float64(len(sortedLatencies)) * 0.95)
-	if idx >= len(sortedLatencies) {
-		idx = len(sortedLatencies) - 1
-	}
+	return latencyPercentile(m.Latencies, 95)
+}
 
-	return sortedLatencies[idx]
+// P99Latency calculates the 99th percentile latency
+func (m *Metrics) P99Latency() time.Duration {
+	return latencyPercentile(m.Latencies, 99)
 }
 
 // Throughput calculates requests per second
@@ -622,12 +971,33 @@ func (m *Metrics) PrintSummary() {
 		}
 	}
 
+	if total := m.ReusedConns + m.NewConns; total > 0 {
+		fmt.Fprintf(os.Stdout, "Connection Reuse: %d reused, %d new (%.2f%% reused)\n",
+			m.ReusedConns, m.NewConns, float64(m.ReusedConns)/float64(total)*100.0)
+	}
+
+	if m.Retries > 0 {
+		fmt.Fprintf(os.Stdout, "Retries: %d (%d first-try successes, %d successes after retrying)\n",
+			m.Retries, m.Success-m.RetriedSuccess, m.RetriedSuccess)
+	}
+
+	if m.LatencySampled {
+		fmt.Fprintf(os.Stdout, "Latency percentiles are estimated from a sample of %d of %d latencies\n",
+			len(m.Latencies), m.LatencyCount)
+	}
+
+	if m.OmissionCorrected && len(m.CorrectedLatencies) > 0 {
+		fmt.Fprintf(os.Stdout, "Corrected Latency (from scheduled send time): p50 %.2fms, p95 %.2fms, p99 %.2fms (max send delay %.2fms)\n",
+			float64(m.CorrectedLatency(50).Microseconds())/1000.0, float64(m.CorrectedLatency(95).Microseconds())/1000.0,
+			float64(m.CorrectedLatency(99).Microseconds())/1000.0, float64(m.MaxSendDelay.Microseconds())/1000.0)
+	}
+
 	fmt.Fprintf(os.Stdout, "\nStatus Code Distribution:\n")
 	if len(m.StatusCodes) == 0 {
 		fmt.Fprintf(os.Stdout, "No status codes recorded (all requests may have failed with errors)\n")
 	} else {
-		for code, count := range m.StatusCodes {
-			fmt.Fprintf(os.Stdout, "[%d]: %d responses\n", code, count)
+		for _, code := range m.SortedStatusCodes() {
+			fmt.Fprintf(os.Stdout, "[%d]: %d responses\n", code, m.StatusCodes[code])
 		}
 	}
 
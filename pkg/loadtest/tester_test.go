@@ -0,0 +1,300 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSortedStatusCodes(t *testing.T) {
+	m := &Metrics{StatusCodes: map[int]int{503: 2, 200: 90, 404: 1, 201: 7}}
+
+	want := []int{200, 201, 404, 503}
+	for i := 0; i < 10; i++ {
+		if got := m.SortedStatusCodes(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestCorrectedLatency(t *testing.T) {
+	m := &Metrics{OmissionCorrected: true}
+	for i := 0; i < 99; i++ {
+		m.Add(&Result{StatusCode: 200, Latency: 10 * time.Millisecond})
+	}
+	// A request sent a second late, behind a stall
+	m.Add(&Result{StatusCode: 200, Latency: 10 * time.Millisecond, SendDelay: time.Second})
+
+	if got := m.P95Latency(); got != 10*time.Millisecond {
+		t.Errorf("P95Latency() = %s, want 10ms", got)
+	}
+	if got := m.CorrectedLatency(99); got != 1010*time.Millisecond {
+		t.Errorf("CorrectedLatency(99) = %s, want 1.01s", got)
+	}
+	if got := m.CorrectedLatency(50); got != 10*time.Millisecond {
+		t.Errorf("CorrectedLatency(50) = %s, want 10ms", got)
+	}
+	if m.MaxSendDelay != time.Second {
+		t.Errorf("MaxSendDelay = %s, want 1s", m.MaxSendDelay)
+	}
+
+	uncorrected := &Metrics{}
+	uncorrected.Add(&Result{StatusCode: 200, Latency: time.Millisecond, SendDelay: time.Second})
+	if got := uncorrected.CorrectedLatency(95); got != 0 {
+		t.Errorf("CorrectedLatency(95) without correction = %s, want 0", got)
+	}
+}
+
+func TestRunRPSTestCorrectsOmission(t *testing.T) {
+	// The service stalls for 300ms on its first request, holding the only connection
+	var stalled int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.CompareAndSwapInt32(&stalled, 0, 1) {
+			time.Sleep(300 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	tester := NewTester(server.URL, 100, 0, Options{CorrectOmission: true, MaxConnsPerHost: 1})
+	if err := tester.Run(context.Background(), 2*time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The requests queued behind the stall were sent late: measured from their send they look
+	// fast, measured from their scheduled time they include the stall
+	m := tester.Metrics()
+	raw, corrected := latencyPercentile(m.Latencies, 99), m.CorrectedLatency(99)
+	if m.Requests < 150 || corrected < raw+100*time.Millisecond {
+		t.Errorf("got %d requests, raw p99 %s, corrected p99 %s, want the corrected p99 well above the raw one", m.Requests, raw, corrected)
+	}
+	if m.MaxSendDelay < 200*time.Millisecond {
+		t.Errorf("max send delay = %s, want the stall", m.MaxSendDelay)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		base  time.Duration
+		retry int
+		want  time.Duration
+	}{
+		{0, 1, DefaultRetryBackoff},
+		{100 * time.Millisecond, 3, 400 * time.Millisecond},
+		{10 * time.Second, 3, MaxRetryBackoff},
+		{time.Second, 100, MaxRetryBackoff}, // would overflow without the cap
+		{time.Minute, 1, MaxRetryBackoff},
+	} {
+		if got := retryBackoff(tt.base, tt.retry); got != tt.want {
+			t.Errorf("retryBackoff(%s, %d) = %s, want %s", tt.base, tt.retry, got, tt.want)
+		}
+	}
+}
+
+func TestMergeMetrics(t *testing.T) {
+	start := time.Now()
+	first := &Metrics{StartTime: start, EndTime: start.Add(10 * time.Second), TestDuration: 10 * time.Second}
+	for i := 0; i < 10; i++ {
+		first.Add(&Result{StatusCode: 200, Latency: 10 * time.Millisecond})
+	}
+	second := &Metrics{StartTime: start.Add(time.Minute), EndTime: start.Add(70 * time.Second), TestDuration: 10 * time.Second}
+	for i := 0; i < 10; i++ {
+		second.Add(&Result{StatusCode: 503, Latency: 30 * time.Millisecond})
+	}
+
+	m := MergeMetrics(first, nil, second)
+	if m.Requests != 20 || m.Success != 10 || m.StatusCodes[200] != 10 || m.StatusCodes[503] != 10 {
+		t.Fatalf("got %d requests, %d successes, codes %v, want 20, 10, and 10 of each", m.Requests, m.Success, m.StatusCodes)
+	}
+	if len(m.Latencies) != 20 || m.MinLatency != 10*time.Millisecond || m.MaxLatency != 30*time.Millisecond {
+		t.Errorf("got %d latencies from %s to %s, want 20 from 10ms to 30ms", len(m.Latencies), m.MinLatency, m.MaxLatency)
+	}
+	// The pause between the runs isn't load test time
+	if m.Throughput() != 1 || !m.StartTime.Equal(first.StartTime) || !m.EndTime.Equal(second.EndTime) {
+		t.Errorf("got %.2f req/s from %s to %s, want 1 req/s over both runs", m.Throughput(), m.StartTime, m.EndTime)
+	}
+	if first.Requests != 10 || len(first.Latencies) != 10 {
+		t.Error("merging must leave the runs untouched")
+	}
+
+	if MergeMetrics(nil, nil) != nil {
+		t.Error("merging no runs: want nil")
+	}
+}
+
+func TestLatencySampling(t *testing.T) {
+	m := &Metrics{LatencySampleSize: 1000, OmissionCorrected: true}
+	for i := 1; i <= 1000; i++ {
+		m.addLatency(time.Duration(i)*time.Millisecond, time.Duration(i)*time.Millisecond)
+	}
+	if m.LatencySampled || m.P95Latency() != 951*time.Millisecond {
+		t.Errorf("at the sample size: sampled %v, p95 %s, want exact 951ms", m.LatencySampled, m.P95Latency())
+	}
+
+	for i := 1001; i <= 20000; i++ {
+		m.addLatency(time.Duration(i)*time.Millisecond, time.Duration(i)*time.Millisecond)
+	}
+	if !m.LatencySampled || len(m.Latencies) != 1000 || len(m.CorrectedLatencies) != 1000 || m.LatencyCount != 20000 {
+		t.Fatalf("past the sample size: sampled %v, kept %d/%d of %d, want a sample of 1000 of 20000",
+			m.LatencySampled, len(m.Latencies), len(m.CorrectedLatencies), m.LatencyCount)
+	}
+	// The p95 of 1..20000ms is 19000ms; a uniform sample of 1000 lands well within 3%
+	if p95 := m.P95Latency(); p95 < 18430*time.Millisecond || p95 > 19570*time.Millisecond {
+		t.Errorf("estimated p95 = %s, want about 19s", p95)
+	}
+
+	// Runs seeded alike keep the same sample
+	first := &Metrics{LatencySampleSize: 10, sampler: rand.New(rand.NewSource(1))}
+	second := &Metrics{LatencySampleSize: 10, sampler: rand.New(rand.NewSource(1))}
+	for i := 1; i <= 1000; i++ {
+		first.addLatency(time.Duration(i)*time.Millisecond, 0)
+		second.addLatency(time.Duration(i)*time.Millisecond, 0)
+	}
+	if !reflect.DeepEqual(first.Latencies, second.Latencies) {
+		t.Errorf("same seed, different samples: %v and %v", first.Latencies, second.Latencies)
+	}
+
+	unbounded := &Metrics{}
+	for i := 0; i < 5000; i++ {
+		unbounded.addLatency(time.Millisecond, 0)
+	}
+	if unbounded.LatencySampled || len(unbounded.Latencies) != 5000 {
+		t.Errorf("without a sample size: sampled %v, kept %d, want all 5000", unbounded.LatencySampled, len(unbounded.Latencies))
+	}
+}
+
+func TestResultWriter(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	results := []*Result{
+		{Start: start, Latency: 12500 * time.Microsecond, StatusCode: 200},
+		{Start: start.Add(time.Second), Latency: 30 * time.Second, Error: errors.New("timeout, giving up")},
+	}
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"results.csv", "timestamp,latency_ms,status,error\n" +
+			"2024-05-01T12:00:00Z,12.500,200,\n" +
+			"2024-05-01T12:00:01Z,30000.000,0,\"timeout, giving up\"\n"},
+		{"results.jsonl", `{"timestamp":"2024-05-01T12:00:00Z","latencyMs":12.5,"status":200}` + "\n" +
+			`{"timestamp":"2024-05-01T12:00:01Z","latencyMs":30000,"status":0,"error":"timeout, giving up"}` + "\n"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.file)
+		w, err := NewResultWriter(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range results {
+			w.Write(r)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.file, data, tt.want)
+		}
+	}
+}
+
+func TestWriteLatencyHistogram(t *testing.T) {
+	// 1ms, 2ms, ..., 100ms
+	var latencies []time.Duration
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	var b strings.Builder
+	if err := WriteLatencyHistogram(&b, latencies); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+
+	if fields := strings.Fields(lines[0]); !reflect.DeepEqual(fields, []string{"Value", "Percentile", "TotalCount", "1/(1-Percentile)"}) || lines[1] != "" {
+		t.Fatalf("unexpected header: %q", lines[:2])
+	}
+	if fields := strings.Fields(lines[2]); !reflect.DeepEqual(fields, []string{"1.000", "0.000000000000", "1", "1.00"}) {
+		t.Errorf("first level: got %v", fields)
+	}
+	if fields := strings.Fields(lines[3]); !reflect.DeepEqual(fields, []string{"10.000", "0.100000000000", "10", "1.11"}) {
+		t.Errorf("second level: got %v", fields)
+	}
+
+	last := lines[len(lines)-3]
+	if fields := strings.Fields(last); !reflect.DeepEqual(fields, []string{"100.000", "1.000000000000", "100"}) {
+		t.Errorf("last level: got %v", fields)
+	}
+	if !strings.HasPrefix(lines[len(lines)-2], "#[Mean    =       50.500") ||
+		!strings.HasSuffix(lines[len(lines)-1], "Total count    =          100]") {
+		t.Errorf("unexpected footer:\n%s\n%s", lines[len(lines)-2], lines[len(lines)-1])
+	}
+
+	// Levels must only increase, both in value and percentile
+	for i := 3; i < len(lines)-2; i++ {
+		prev, cur := strings.Fields(lines[i-1]), strings.Fields(lines[i])
+		if cur[1] <= prev[1] {
+			t.Errorf("percentile not increasing at line %d: %s after %s", i, cur[1], prev[1])
+		}
+	}
+}
+
+func TestTargetURL(t *testing.T) {
+	tests := []struct {
+		target string
+		port   int
+		want   string
+	}{
+		{"orders:8080/api", 0, "http://orders:8080/api"},
+		{"orders/api", 9090, "http://orders:9090/api"},
+		{"https://orders:8443/api?x=1", 443, "https://orders:443/api?x=1"},
+		{"http://[::1]:8080/", 9090, "http://[::1]:9090/"},
+	}
+	for _, tt := range tests {
+		got, err := TargetURL(tt.target, Options{TargetPort: tt.port})
+		if err != nil {
+			t.Errorf("TargetURL(%q, %d): %v", tt.target, tt.port, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("TargetURL(%q, %d) = %s, want %s", tt.target, tt.port, got, tt.want)
+		}
+	}
+
+	if _, err := TargetURL("orders", Options{TargetPort: 70000}); !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("out of range port: got %v, want ErrInvalidTarget", err)
+	}
+}
+
+func TestErrorBackoff(t *testing.T) {
+	fixed := &Tester{}
+	if got := fixed.errorBackoff(5); got != DefaultErrorBackoff {
+		t.Errorf("default back-off = %s, want %s", got, DefaultErrorBackoff)
+	}
+
+	exp := &Tester{opts: Options{ErrorBackoff: time.Second, ErrorBackoffExp: true}}
+	for failures, want := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		4:  8 * time.Second,
+		6:  MaxErrorBackoff,
+		60: MaxErrorBackoff,
+	} {
+		if got := exp.errorBackoff(failures); got != want {
+			t.Errorf("errorBackoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package loadtest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultThinkTime is the pause between a concurrent worker's requests when none is configured
+var DefaultThinkTime = ThinkTime{Mean: 10 * time.Millisecond}
+
+// ThinkTime models the pause between a concurrent worker's requests, either fixed or
+// exponentially distributed around the mean to approximate real user pacing
+type ThinkTime struct {
+	Mean        time.Duration
+	Exponential bool
+}
+
+// ParseThinkTime parses a think time such as "10ms" (fixed) or "exp:200ms" (exponential
+// with a 200ms mean)
+func ParseThinkTime(s string) (ThinkTime, error) {
+	var tt ThinkTime
+	value := s
+	if strings.HasPrefix(s, "exp:") {
+		tt.Exponential = true
+		value = strings.TrimPrefix(s, "exp:")
+	} else if strings.HasPrefix(s, "fixed:") {
+		value = strings.TrimPrefix(s, "fixed:")
+	}
+
+	mean, err := time.ParseDuration(value)
+	if err != nil {
+		return ThinkTime{}, fmt.Errorf("invalid think time %q (expected e.g. 10ms, fixed:10ms, or exp:200ms): %v", s, err)
+	}
+	if mean < 0 {
+		return ThinkTime{}, fmt.Errorf("think time %q must not be negative", s)
+	}
+	tt.Mean = mean
+
+	return tt, nil
+}
+
+// String formats the think time in the form accepted by ParseThinkTime
+func (tt ThinkTime) String() string {
+	if tt.Exponential {
+		return "exp:" + tt.Mean.String()
+	}
+	return tt.Mean.String()
+}
+
+// nextThinkTime draws the pause before a worker's next request
+func (t *Tester) nextThinkTime() time.Duration {
+	if !t.thinkTime.Exponential || t.thinkTime.Mean == 0 {
+		return t.thinkTime.Mean
+	}
+
+	t.randMu.Lock()
+	defer t.randMu.Unlock()
+	return time.Duration(t.rand.ExpFloat64() * float64(t.thinkTime.Mean))
+}
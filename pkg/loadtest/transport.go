@@ -0,0 +1,109 @@
+package loadtest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseTLSVersion converts a version string such as "1.2" or "1.3" to its crypto/tls constant
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "":
+		return 0, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q (supported: 1.2, 1.3)", version)
+	}
+}
+
+// ParseCipherSuites converts a comma-separated list of cipher suite names to their IDs.
+// Only suites considered secure by crypto/tls are accepted.
+func ParseCipherSuites(list string) ([]uint16, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure TLS cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// ParseResolve converts curl-style host:port:addr entries into a map from the "host:port" the
+// client dials to the "addr:port" it connects to instead. IPv6 addresses may be bracketed.
+func ParseResolve(entries []string) (map[string]string, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	resolve := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid resolve entry %q (expected host:port:addr)", entry)
+		}
+
+		host, port := parts[0], parts[1]
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port %q in resolve entry %q", port, entry)
+		}
+
+		addr := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+		if net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("invalid address %q in resolve entry %q (expected an IP address)", parts[2], entry)
+		}
+
+		resolve[net.JoinHostPort(host, port)] = net.JoinHostPort(addr, port)
+	}
+
+	return resolve, nil
+}
+
+// NewTransport builds the HTTP transport the load tester uses by default from the connection
+// pool, TLS, and resolve settings of the given options
+func NewTransport(opts Options) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:   opts.TLSMinVersion,
+		CipherSuites: opts.TLSCipherSuites,
+	}
+	if opts.MaxIdleConns > 0 {
+		transport.MaxIdleConns = opts.MaxIdleConns
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConns
+	}
+	if opts.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	}
+	if len(opts.Resolve) > 0 {
+		// Connect to the overridden address while the URL, and so the Host header and SNI, keep the hostname
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			if override, ok := opts.Resolve[address]; ok {
+				address = override
+			}
+			return dialer.DialContext(ctx, network, address)
+		}
+	}
+	return transport
+}
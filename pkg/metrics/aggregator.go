@@ -0,0 +1,35 @@
+package metrics
+
+import "sync"
+
+// Aggregator collects samples keyed by target, such as a Deployment, container, or pod name. It
+// is safe for concurrent use, so goroutines sampling several targets in parallel can share one.
+type Aggregator struct {
+	mu      sync.Mutex
+	samples map[string][]ResourceMetrics
+}
+
+// NewAggregator creates an empty aggregator
+func NewAggregator() *Aggregator {
+	return &Aggregator{samples: make(map[string][]ResourceMetrics)}
+}
+
+// Add appends a sample of the target
+func (a *Aggregator) Add(target string, sample ResourceMetrics) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.samples[target] = append(a.samples[target], sample)
+}
+
+// Snapshot returns a copy of the samples collected so far, in the order they were added for each
+// target. Later calls to Add don't modify it.
+func (a *Aggregator) Snapshot() map[string][]ResourceMetrics {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	snapshot := make(map[string][]ResourceMetrics, len(a.samples))
+	for target, samples := range a.samples {
+		snapshot[target] = append([]ResourceMetrics(nil), samples...)
+	}
+	return snapshot
+}
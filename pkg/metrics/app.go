@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AppMetrics is a point-in-time sample of the runtime gauges an application exposes on its own
+// Prometheus endpoint. Values the endpoint doesn't expose are left at zero.
+type AppMetrics struct {
+	Timestamp    time.Time `json:"timestamp"`
+	HeapUsed     float64   `json:"heapUsed"`     // in Mi
+	HeapMax      float64   `json:"heapMax"`      // in Mi (0 if unbounded or not exposed)
+	GCPauseTotal float64   `json:"gcPauseTotal"` // Cumulative GC pause time in seconds
+	GCCount      float64   `json:"gcCount"`      // Cumulative GC cycles
+}
+
+// AppSummary summarizes the runtime samples of a run. GC figures only cover the cycles
+// between the first and last sample.
+type AppSummary struct {
+	Samples        int     `json:"samples"`
+	PeakHeap       float64 `json:"peakHeap"`       // in Mi
+	AverageHeap    float64 `json:"averageHeap"`    // in Mi
+	HeapMax        float64 `json:"heapMax"`        // in Mi (0 if unbounded or not exposed)
+	GCCount        float64 `json:"gcCount"`        // GC cycles during the run
+	GCPauseTotal   float64 `json:"gcPauseTotal"`   // GC pause time during the run in seconds
+	AverageGCPause float64 `json:"averageGCPause"` // Pause per GC cycle in seconds
+}
+
+// appMetricsClient scrapes application metrics endpoints, which should answer quickly
+var appMetricsClient = &http.Client{Timeout: 5 * time.Second}
+
+// ScrapeAppMetrics collects a single sample of the heap and GC metrics exposed at url in the
+// Prometheus text format. Go runtime metrics and the JVM metrics of the Prometheus Java client
+// and Micrometer are recognized.
+func ScrapeAppMetrics(ctx context.Context, url string) (AppMetrics, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return AppMetrics{}, err
+	}
+
+	resp, err := appMetricsClient.Do(req)
+	if err != nil {
+		return AppMetrics{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return AppMetrics{}, fmt.Errorf("unexpected status %s from %s", resp.Status, url)
+	}
+
+	m, err := ParseAppMetrics(resp.Body)
+	if err != nil {
+		return AppMetrics{}, err
+	}
+	m.Timestamp = time.Now()
+	return m, nil
+}
+
+// ParseAppMetrics reads the heap and GC metrics from a Prometheus text exposition. Series
+// split by pool or collector are summed. It fails if none of the known metrics is present.
+func ParseAppMetrics(r io.Reader) (AppMetrics, error) {
+	var m AppMetrics
+	found := false
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, labels, value, ok := parseSample(line)
+		if !ok {
+			continue
+		}
+		heap := strings.Contains(labels, `area="heap"`)
+
+		switch name {
+		case "go_memstats_heap_inuse_bytes":
+			m.HeapUsed += value / (1024 * 1024)
+		case "go_gc_gomemlimit_bytes":
+			// The default limit of math.MaxInt64 means there is none
+			if value > 0 && value < 1<<62 {
+				m.HeapMax += value / (1024 * 1024)
+			}
+		case "jvm_memory_bytes_used", "jvm_memory_used_bytes":
+			if !heap {
+				continue
+			}
+			m.HeapUsed += value / (1024 * 1024)
+		case "jvm_memory_bytes_max", "jvm_memory_max_bytes":
+			// Pools without a maximum report -1
+			if !heap || value <= 0 {
+				continue
+			}
+			m.HeapMax += value / (1024 * 1024)
+		case "go_gc_duration_seconds_sum", "jvm_gc_collection_seconds_sum", "jvm_gc_pause_seconds_sum":
+			m.GCPauseTotal += value
+		case "go_gc_duration_seconds_count", "jvm_gc_collection_seconds_count", "jvm_gc_pause_seconds_count":
+			m.GCCount += value
+		default:
+			continue
+		}
+		found = true
+	}
+	if err := scanner.Err(); err != nil {
+		return AppMetrics{}, err
+	}
+
+	if !found {
+		return AppMetrics{}, fmt.Errorf("no known heap or GC metrics exposed")
+	}
+	return m, nil
+}
+
+// parseSample splits an exposition line such as `name{label="v"} 1.5 1700000000` into the
+// metric name, its raw labels, and its value
+func parseSample(line string) (string, string, float64, bool) {
+	name, labels, rest := line, "", ""
+	if i := strings.IndexByte(line, '{'); i >= 0 {
+		end := strings.LastIndexByte(line, '}')
+		if end < i {
+			return "", "", 0, false
+		}
+		name, labels, rest = line[:i], line[i+1:end], line[end+1:]
+	} else if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, rest = line[:i], line[i:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", "", 0, false
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", "", 0, false
+	}
+	return name, labels, value, true
+}
+
+// SummarizeApp computes the heap usage and GC activity over the samples, or returns nil if
+// there are none. GC counters are only counted while they increase, so a restarted or
+// different pod answering a scrape doesn't skew the totals.
+func SummarizeApp(samples []AppMetrics) *AppSummary {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	ordered := make([]AppMetrics, len(samples))
+	copy(ordered, samples)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Timestamp.Before(ordered[j].Timestamp)
+	})
+
+	summary := &AppSummary{Samples: len(ordered)}
+	var totalHeap float64
+	for i, s := range ordered {
+		totalHeap += s.HeapUsed
+		if s.HeapUsed > summary.PeakHeap {
+			summary.PeakHeap = s.HeapUsed
+		}
+		if s.HeapMax > summary.HeapMax {
+			summary.HeapMax = s.HeapMax
+		}
+
+		if i > 0 && s.GCCount >= ordered[i-1].GCCount {
+			summary.GCCount += s.GCCount - ordered[i-1].GCCount
+			summary.GCPauseTotal += s.GCPauseTotal - ordered[i-1].GCPauseTotal
+		}
+	}
+	summary.AverageHeap = totalHeap / float64(len(ordered))
+	if summary.GCCount > 0 {
+		summary.AverageGCPause = summary.GCPauseTotal / summary.GCCount
+	}
+
+	return summary
+}
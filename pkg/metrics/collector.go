@@ -2,6 +2,9 @@ package metrics
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"sort"
 	"time"
 
 	"github.com/BogdanDolia/pod-rightsizer/pkg/kubernetes"
@@ -9,9 +12,9 @@ import (
 
 // ResourceMetrics represents a point-in-time metrics collection
 type ResourceMetrics struct {
-	Timestamp   time.Time
-	CPUUsage    float64 // in cores
-	MemoryUsage float64 // in Mi
+	Timestamp   time.Time `json:"timestamp"`
+	CPUUsage    float64   `json:"cpuUsage"`    // in cores
+	MemoryUsage float64   `json:"memoryUsage"` // in Mi
 }
 
 // Collector is responsible for collecting Kubernetes pod metrics
@@ -19,6 +22,7 @@ type Collector struct {
 	k8sClient *kubernetes.Client
 	namespace string
 	target    string
+	reported  int // Pods metrics-server reported usage for in the last sample
 }
 
 // NewCollector creates a new metrics collector
@@ -30,13 +34,15 @@ func NewCollector(k8sClient *kubernetes.Client, namespace, target string) *Colle
 	}
 }
 
-// CollectMetrics collects a single metrics point
+// CollectMetrics collects a single metrics point, averaging the usage of the pods
 func (c *Collector) CollectMetrics(ctx context.Context) (ResourceMetrics, error) {
-	cpu, memory, err := c.k8sClient.GetPodMetrics(ctx, c.namespace, c.target)
+	usage, err := c.k8sClient.GetPodUsage(ctx, c.namespace, c.target)
 	if err != nil {
 		return ResourceMetrics{}, err
 	}
+	c.reported = len(usage)
 
+	cpu, memory := kubernetes.AverageUsage(usage)
 	return ResourceMetrics{
 		Timestamp:   time.Now(),
 		CPUUsage:    cpu,
@@ -44,6 +50,102 @@ func (c *Collector) CollectMetrics(ctx context.Context) (ResourceMetrics, error)
 	}, nil
 }
 
+// Coverage compares the pods the last sample of CollectMetrics covered with the pods running now,
+// to detect metrics-server responses that silently miss replicas
+func (c *Collector) Coverage(ctx context.Context) (kubernetes.MetricsCoverage, error) {
+	running, err := c.k8sClient.CountRunningPods(ctx, c.namespace, c.target)
+	if err != nil {
+		return kubernetes.MetricsCoverage{}, err
+	}
+	return kubernetes.MetricsCoverage{Reported: c.reported, Running: running}, nil
+}
+
+// CollectGroupedMetrics collects a single metrics point for each group of pods, averaging the
+// usage of the pods in the group. Groups without any pod metrics are left out of the result.
+func (c *Collector) CollectGroupedMetrics(ctx context.Context, groups map[string][]string) (map[string]ResourceMetrics, error) {
+	usage, err := c.k8sClient.GetPodUsage(ctx, c.namespace, c.target)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	grouped := make(map[string]ResourceMetrics, len(groups))
+	for name, pods := range groups {
+		var totalCPU, totalMemory float64
+		var podCount int
+		for _, pod := range pods {
+			if u, ok := usage[pod]; ok {
+				totalCPU += u.CPU
+				totalMemory += u.Memory
+				podCount++
+			}
+		}
+
+		if podCount > 0 {
+			grouped[name] = ResourceMetrics{
+				Timestamp:   now,
+				CPUUsage:    totalCPU / float64(podCount),
+				MemoryUsage: totalMemory / float64(podCount),
+			}
+		}
+	}
+
+	return grouped, nil
+}
+
+// CollectPodMetrics collects a single metrics point for each pod by pod name
+func (c *Collector) CollectPodMetrics(ctx context.Context) (map[string]ResourceMetrics, error) {
+	usage, err := c.k8sClient.GetPodUsage(ctx, c.namespace, c.target)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	pods := make(map[string]ResourceMetrics, len(usage))
+	for name, u := range usage {
+		pods[name] = ResourceMetrics{Timestamp: now, CPUUsage: u.CPU, MemoryUsage: u.Memory}
+	}
+
+	return pods, nil
+}
+
+// CollectContainerMetrics collects a single metrics point for each container that isn't ignored,
+// averaging the usage of that container across the pods
+func (c *Collector) CollectContainerMetrics(ctx context.Context) (map[string]ResourceMetrics, error) {
+	usage, err := c.k8sClient.GetContainerUsage(ctx, c.namespace, c.target)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	containers := make(map[string]ResourceMetrics, len(usage))
+	for name, u := range usage {
+		containers[name] = ResourceMetrics{Timestamp: now, CPUUsage: u.CPU, MemoryUsage: u.Memory}
+	}
+
+	return containers, nil
+}
+
+// CollectPodContainerMetrics collects a single metrics point for each container that isn't
+// ignored in each pod, keyed by container name and then by pod name
+func (c *Collector) CollectPodContainerMetrics(ctx context.Context) (map[string]map[string]ResourceMetrics, error) {
+	usage, err := c.k8sClient.GetPodContainerUsage(ctx, c.namespace, c.target)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	containers := make(map[string]map[string]ResourceMetrics, len(usage))
+	for name, pods := range usage {
+		containers[name] = make(map[string]ResourceMetrics, len(pods))
+		for pod, u := range pods {
+			containers[name][pod] = ResourceMetrics{Timestamp: now, CPUUsage: u.CPU, MemoryUsage: u.Memory}
+		}
+	}
+
+	return containers, nil
+}
+
 // CalculateAverageMetrics calculates average metrics from a collection
 func CalculateAverageMetrics(metrics []ResourceMetrics) (float64, float64) {
 	if len(metrics) == 0 {
@@ -59,6 +161,50 @@ func CalculateAverageMetrics(metrics []ResourceMetrics) (float64, float64) {
 	return totalCPU / float64(len(metrics)), totalMemory / float64(len(metrics))
 }
 
+// CalculateWeightedAverage calculates average metrics with exponentially decaying weights that
+// favor later samples: the most recent sample has weight 1, the one before it decay, then
+// decay², and so on. A decay of 1 (or outside (0, 1]) weights all samples equally.
+func CalculateWeightedAverage(metrics []ResourceMetrics, decay float64) (float64, float64) {
+	if decay <= 0 || decay >= 1 {
+		return CalculateAverageMetrics(metrics)
+	}
+
+	return weightedAverage(metrics, func(i int) float64 {
+		return math.Pow(decay, float64(len(metrics)-1-i))
+	})
+}
+
+// CalculateLinearWeightedAverage calculates average metrics with linearly increasing weights,
+// so the i-th sample counts i+1 times as much as the first
+func CalculateLinearWeightedAverage(metrics []ResourceMetrics) (float64, float64) {
+	return weightedAverage(metrics, func(i int) float64 {
+		return float64(i + 1)
+	})
+}
+
+// weightedAverage averages the samples in chronological order using the given weight per index
+func weightedAverage(metrics []ResourceMetrics, weight func(i int) float64) (float64, float64) {
+	if len(metrics) == 0 {
+		return 0, 0
+	}
+
+	ordered := make([]ResourceMetrics, len(metrics))
+	copy(ordered, metrics)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Timestamp.Before(ordered[j].Timestamp)
+	})
+
+	var totalCPU, totalMemory, totalWeight float64
+	for i, m := range ordered {
+		w := weight(i)
+		totalCPU += m.CPUUsage * w
+		totalMemory += m.MemoryUsage * w
+		totalWeight += w
+	}
+
+	return totalCPU / totalWeight, totalMemory / totalWeight
+}
+
 // CalculatePeakMetrics finds the peak CPU and memory usage
 func CalculatePeakMetrics(metrics []ResourceMetrics) (float64, float64) {
 	if len(metrics) == 0 {
@@ -79,3 +225,154 @@ func CalculatePeakMetrics(metrics []ResourceMetrics) (float64, float64) {
 
 	return peakCPU, peakMemory
 }
+
+// RobustPeak returns the highest level that at least minCount values reach, so a peak set by
+// fewer samples, such as a single metrics-server glitch, gives way to the next-highest value
+// that is sustained. A minCount of 1 or less, or one above the number of values, returns the
+// maximum, as too few samples were collected to tell a spike from a sustained level.
+func RobustPeak(values []float64, minCount int) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := sortedCopy(values)
+	if minCount < 1 || minCount > len(sorted) {
+		minCount = 1
+	}
+	return sorted[len(sorted)-minCount]
+}
+
+// BucketMetrics groups samples into fixed time windows starting at the first sample and
+// reduces each window to a single sample using agg ("mean" or "max"). Samples are expected
+// in chronological order; each bucket is stamped with its window start time.
+func BucketMetrics(metrics []ResourceMetrics, window time.Duration, agg string) ([]ResourceMetrics, error) {
+	if agg != "mean" && agg != "max" {
+		return nil, fmt.Errorf("unsupported aggregation %q (supported: mean, max)", agg)
+	}
+	if window <= 0 || len(metrics) == 0 {
+		return metrics, nil
+	}
+
+	start := metrics[0].Timestamp
+	var buckets []ResourceMetrics
+	var current []ResourceMetrics
+	currentIndex := int64(-1)
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		var cpu, memory float64
+		if agg == "max" {
+			cpu, memory = CalculatePeakMetrics(current)
+		} else {
+			cpu, memory = CalculateAverageMetrics(current)
+		}
+		buckets = append(buckets, ResourceMetrics{
+			Timestamp:   start.Add(time.Duration(currentIndex) * window),
+			CPUUsage:    cpu,
+			MemoryUsage: memory,
+		})
+		current = nil
+	}
+
+	for _, m := range metrics {
+		index := int64(m.Timestamp.Sub(start) / window)
+		if index != currentIndex {
+			flush()
+			currentIndex = index
+		}
+		current = append(current, m)
+	}
+	flush()
+
+	return buckets, nil
+}
+
+// DedupMetrics collapses runs of consecutive samples with exactly the same CPU and memory usage
+// into their first sample, and returns how many were dropped. metrics-server only refreshes on
+// its own scrape interval, so identical readings are one scrape collected several times and
+// would otherwise weigh several times as much in averages and percentiles.
+func DedupMetrics(metrics []ResourceMetrics) ([]ResourceMetrics, int) {
+	if len(metrics) == 0 {
+		return metrics, 0
+	}
+
+	deduped := []ResourceMetrics{metrics[0]}
+	for _, m := range metrics[1:] {
+		last := deduped[len(deduped)-1]
+		if m.CPUUsage == last.CPUUsage && m.MemoryUsage == last.MemoryUsage {
+			continue
+		}
+		deduped = append(deduped, m)
+	}
+
+	return deduped, len(metrics) - len(deduped)
+}
+
+// CPUValues extracts the CPU usage series from the samples
+func CPUValues(metrics []ResourceMetrics) []float64 {
+	values := make([]float64, len(metrics))
+	for i, m := range metrics {
+		values[i] = m.CPUUsage
+	}
+	return values
+}
+
+// MemoryValues extracts the memory usage series from the samples
+func MemoryValues(metrics []ResourceMetrics) []float64 {
+	values := make([]float64, len(metrics))
+	for i, m := range metrics {
+		values[i] = m.MemoryUsage
+	}
+	return values
+}
+
+// PercentileRank returns the percentage (0-100) of values that are less than or equal to value
+func PercentileRank(values []float64, value float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := sortedCopy(values)
+	// Index of the first element greater than value equals the count of elements <= value
+	count := sort.Search(len(sorted), func(i int) bool { return sorted[i] > value })
+
+	return float64(count) / float64(len(sorted)) * 100.0
+}
+
+// sortedCopy returns an ascending copy of values, leaving the input untouched
+func sortedCopy(values []float64) []float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	return sorted
+}
+
+// Percentile returns the p-th percentile (0-100) of values, linearly interpolating between the
+// two closest ranks so that high percentiles such as 99.9 are meaningful on small sample sets
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := sortedCopy(values)
+	if p <= 0 {
+		return sorted[0]
+	}
+	if p >= 100 {
+		return sorted[len(sorted)-1]
+	}
+
+	rank := p / 100.0 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	fraction := rank - float64(lower)
+
+	return sorted[lower] + (sorted[upper]-sorted[lower])*fraction
+}
+
+// CalculatePercentileMetrics returns the p-th percentile (0-100) of CPU and memory usage
+func CalculatePercentileMetrics(metrics []ResourceMetrics, p float64) (float64, float64) {
+	return Percentile(CPUValues(metrics), p), Percentile(MemoryValues(metrics), p)
+}
@@ -0,0 +1,290 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPercentileInterpolation(t *testing.T) {
+	// 1, 2, ..., 100 in shuffled order
+	values := make([]float64, 100)
+	for i := range values {
+		values[i] = float64((i*37)%100 + 1)
+	}
+
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{0, 1},
+		{50, 50.5},
+		{90, 90.1},
+		{99, 99.01},
+		{99.9, 99.901},
+		{100, 100},
+	}
+
+	for _, tt := range tests {
+		if got := Percentile(values, tt.p); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Percentile(p=%v): got %.4f, want %.4f", tt.p, got, tt.want)
+		}
+	}
+
+	// High percentiles on a small sample interpolate toward the maximum instead of snapping to it
+	small := []float64{10, 20, 30, 40}
+	if got, want := Percentile(small, 99.9), 39.97; math.Abs(got-want) > 1e-9 {
+		t.Errorf("Percentile(small, 99.9): got %.4f, want %.4f", got, want)
+	}
+	if got := Percentile([]float64{42}, 99.9); got != 42 {
+		t.Errorf("Percentile(single, 99.9): got %.4f, want 42", got)
+	}
+	if got := Percentile(nil, 50); got != 0 {
+		t.Errorf("Percentile(empty): got %.4f, want 0", got)
+	}
+}
+
+func TestCalculateWeightedAverage(t *testing.T) {
+	start := time.Now()
+	// Ramp-up from 0.1 to 0.3 cores, passed out of order
+	samples := []ResourceMetrics{
+		{Timestamp: start.Add(20 * time.Second), CPUUsage: 0.3, MemoryUsage: 300},
+		{Timestamp: start, CPUUsage: 0.1, MemoryUsage: 100},
+		{Timestamp: start.Add(10 * time.Second), CPUUsage: 0.2, MemoryUsage: 200},
+	}
+
+	// Weights 0.25, 0.5, 1: (0.025 + 0.1 + 0.3) / 1.75
+	cpu, memory := CalculateWeightedAverage(samples, 0.5)
+	if want := 0.425 / 1.75; math.Abs(cpu-want) > 1e-9 {
+		t.Errorf("exponential CPU: got %.4f, want %.4f", cpu, want)
+	}
+	if want := 425 / 1.75; math.Abs(memory-want) > 1e-9 {
+		t.Errorf("exponential memory: got %.4f, want %.4f", memory, want)
+	}
+
+	// Weights 1, 2, 3: (0.1 + 0.4 + 0.9) / 6
+	if cpu, _ := CalculateLinearWeightedAverage(samples); math.Abs(cpu-1.4/6) > 1e-9 {
+		t.Errorf("linear CPU: got %.4f, want %.4f", cpu, 1.4/6)
+	}
+
+	// A decay of 1 is the plain average
+	if cpu, _ := CalculateWeightedAverage(samples, 1); math.Abs(cpu-0.2) > 1e-9 {
+		t.Errorf("equal weights CPU: got %.4f, want 0.2000", cpu)
+	}
+}
+
+func TestDetectMemoryGrowth(t *testing.T) {
+	start := time.Now()
+	var leaking, stable []ResourceMetrics
+	for i := 0; i < 10; i++ {
+		ts := start.Add(time.Duration(i) * 30 * time.Second)
+		// Climbs 20Mi per minute with a little noise
+		leaking = append(leaking, ResourceMetrics{Timestamp: ts, MemoryUsage: 200 + float64(i)*10 + float64(i%2)})
+		// Oscillates around a stable working set
+		stable = append(stable, ResourceMetrics{Timestamp: ts, MemoryUsage: 200 + float64(i%3)*5})
+	}
+
+	slope, rSquared := DetectMemoryGrowth(leaking)
+	if math.Abs(slope-20) > 1 {
+		t.Errorf("leaking slope: got %.2f Mi/min, want about 20", slope)
+	}
+	if rSquared < 0.99 {
+		t.Errorf("leaking R²: got %.4f, want at least 0.99", rSquared)
+	}
+	if !MemoryGrowing(leaking) {
+		t.Error("MemoryGrowing(leaking): got false, want true")
+	}
+
+	if _, rSquared := DetectMemoryGrowth(stable); rSquared >= MemoryGrowthMinRSquared {
+		t.Errorf("stable R²: got %.4f, want below %.2f", rSquared, MemoryGrowthMinRSquared)
+	}
+	if MemoryGrowing(stable) {
+		t.Error("MemoryGrowing(stable): got true, want false")
+	}
+
+	// Too few samples to call a trend, however steep
+	if MemoryGrowing(leaking[:MemoryGrowthMinSamples-1]) {
+		t.Error("MemoryGrowing(few samples): got true, want false")
+	}
+	if slope, rSquared := DetectMemoryGrowth(nil); slope != 0 || rSquared != 0 {
+		t.Errorf("DetectMemoryGrowth(empty): got %.2f, %.2f, want 0, 0", slope, rSquared)
+	}
+}
+
+func TestRobustPeak(t *testing.T) {
+	values := []float64{200, 210, 900, 205, 230, 230, 220}
+
+	for _, tt := range []struct {
+		minCount int
+		want     float64
+	}{
+		{1, 900},  // the maximum, spike included
+		{2, 230},  // a single spike is rejected for the sustained 230
+		{3, 230},  // the spike also reaches 230
+		{4, 220},  // 230 is only reached three times
+		{0, 900},  // like 1
+		{10, 900}, // more than there are values, like 1
+	} {
+		if got := RobustPeak(values, tt.minCount); got != tt.want {
+			t.Errorf("RobustPeak(%d): got %.0f, want %.0f", tt.minCount, got, tt.want)
+		}
+	}
+
+	if got := RobustPeak(nil, 2); got != 0 {
+		t.Errorf("RobustPeak of no values: got %.0f, want 0", got)
+	}
+}
+
+func TestCoefficientOfVariation(t *testing.T) {
+	samples := []ResourceMetrics{
+		{CPUUsage: 0.1, MemoryUsage: 100},
+		{CPUUsage: 0.3, MemoryUsage: 100},
+	}
+	cpu, memory := CoefficientOfVariation(samples)
+	if math.Abs(cpu-0.5) > 1e-9 || memory != 0 {
+		t.Errorf("got CPU %.3f, memory %.3f, want 0.5 and 0", cpu, memory)
+	}
+
+	if cpu, memory := CoefficientOfVariation(samples[:1]); cpu != 0 || memory != 0 {
+		t.Errorf("single sample: got %.3f/%.3f, want 0/0", cpu, memory)
+	}
+}
+
+func TestScheduleJitter(t *testing.T) {
+	interval := 5 * time.Second
+
+	fixed := NewSchedule(interval, false, 1)
+	for n := 0; n < 5; n++ {
+		if got, want := fixed.at(n), time.Duration(n+1)*interval; got != want {
+			t.Errorf("without jitter, sample %d: got %v, want %v", n, got, want)
+		}
+	}
+
+	a, b := NewSchedule(interval, true, 42), NewSchedule(interval, true, 42)
+	if a.offset < 0 || a.offset >= interval {
+		t.Errorf("initial offset %v outside [0, %v)", a.offset, interval)
+	}
+	maxShift := time.Duration(SampleJitter * float64(interval))
+	for n := 0; n < 100; n++ {
+		got := a.at(n)
+		if other := b.at(n); got != other {
+			t.Fatalf("sample %d: same seed gave %v and %v", n, got, other)
+		}
+		base := a.offset + time.Duration(n)*interval
+		if got < 0 || got < base-maxShift || got > base+maxShift {
+			t.Errorf("sample %d at %v, want within %v of %v", n, got, maxShift, base)
+		}
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	a := NewAggregator()
+	var wg sync.WaitGroup
+	for _, target := range []string{"web", "api"} {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				a.Add(target, ResourceMetrics{CPUUsage: float64(i)})
+			}
+		}(target)
+	}
+	wg.Wait()
+
+	snapshot := a.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("got %d targets, want 2", len(snapshot))
+	}
+	for target, samples := range snapshot {
+		if len(samples) != 100 || samples[99].CPUUsage != 99 {
+			t.Errorf("%s: got %d samples, want 100 in the order they were added", target, len(samples))
+		}
+	}
+
+	a.Add("web", ResourceMetrics{})
+	if len(snapshot["web"]) != 100 {
+		t.Errorf("snapshot changed by a later Add")
+	}
+}
+
+func TestParseAppMetrics(t *testing.T) {
+	exposition := `# HELP jvm_memory_used_bytes The amount of used memory
+# TYPE jvm_memory_used_bytes gauge
+jvm_memory_used_bytes{area="heap",id="G1 Eden Space"} 1.048576E8
+jvm_memory_used_bytes{area="heap",id="G1 Old Gen"} 5.24288E7
+jvm_memory_used_bytes{area="nonheap",id="Metaspace"} 6.291456E7
+jvm_memory_max_bytes{area="heap",id="G1 Eden Space"} -1.0
+jvm_memory_max_bytes{area="heap",id="G1 Old Gen"} 5.36870912E8
+jvm_gc_pause_seconds_count{action="end of minor GC",cause="G1 Evacuation Pause"} 12.0
+jvm_gc_pause_seconds_sum{action="end of minor GC",cause="G1 Evacuation Pause"} 0.18
+jvm_gc_pause_seconds_count{action="end of major GC",cause="G1 Compaction"} 1.0
+jvm_gc_pause_seconds_sum{action="end of major GC",cause="G1 Compaction"} 0.07
+http_server_requests_seconds_count{uri="/"} 100.0
+`
+	m, err := ParseAppMetrics(strings.NewReader(exposition))
+	if err != nil {
+		t.Fatalf("ParseAppMetrics returned an error: %v", err)
+	}
+
+	// Heap pools are summed, the non-heap pool and the unbounded pool's -1 maximum are skipped
+	if m.HeapUsed != 150 || m.HeapMax != 512 {
+		t.Errorf("expected 150Mi used of a 512Mi heap, got %.1fMi of %.1fMi", m.HeapUsed, m.HeapMax)
+	}
+	if m.GCCount != 13 || math.Abs(m.GCPauseTotal-0.25) > 1e-9 {
+		t.Errorf("expected 13 GC cycles with 0.25s paused, got %.0f with %.3fs", m.GCCount, m.GCPauseTotal)
+	}
+
+	if _, err := ParseAppMetrics(strings.NewReader("http_server_requests_seconds_count 100\n")); err == nil {
+		t.Error("expected an error for an exposition without heap or GC metrics")
+	}
+}
+
+func TestSummarizeApp(t *testing.T) {
+	start := time.Now()
+	samples := []AppMetrics{
+		{Timestamp: start, HeapUsed: 100, GCCount: 10, GCPauseTotal: 1},
+		{Timestamp: start.Add(5 * time.Second), HeapUsed: 200, GCCount: 14, GCPauseTotal: 1.4},
+		// A different pod answered: its lower counters are not counted as negative activity
+		{Timestamp: start.Add(10 * time.Second), HeapUsed: 150, GCCount: 3, GCPauseTotal: 0.3},
+		{Timestamp: start.Add(15 * time.Second), HeapUsed: 150, GCCount: 5, GCPauseTotal: 0.5},
+	}
+
+	s := SummarizeApp(samples)
+	if s.PeakHeap != 200 || s.AverageHeap != 150 {
+		t.Errorf("expected a 200Mi peak and 150Mi average heap, got %.0fMi and %.0fMi", s.PeakHeap, s.AverageHeap)
+	}
+	if s.GCCount != 6 || math.Abs(s.GCPauseTotal-0.6) > 1e-9 || math.Abs(s.AverageGCPause-0.1) > 1e-9 {
+		t.Errorf("expected 6 GC cycles with 0.6s paused, got %.0f with %.3fs", s.GCCount, s.GCPauseTotal)
+	}
+
+	if SummarizeApp(nil) != nil {
+		t.Error("expected no summary without samples")
+	}
+}
+
+func TestDedupMetrics(t *testing.T) {
+	start := time.Now()
+	samples := []ResourceMetrics{
+		{Timestamp: start, CPUUsage: 0.1, MemoryUsage: 100},
+		{Timestamp: start.Add(5 * time.Second), CPUUsage: 0.1, MemoryUsage: 100},
+		{Timestamp: start.Add(10 * time.Second), CPUUsage: 0.1, MemoryUsage: 100},
+		{Timestamp: start.Add(15 * time.Second), CPUUsage: 0.3, MemoryUsage: 100},
+		{Timestamp: start.Add(20 * time.Second), CPUUsage: 0.3, MemoryUsage: 120},
+		{Timestamp: start.Add(25 * time.Second), CPUUsage: 0.1, MemoryUsage: 100},
+	}
+
+	deduped, dropped := DedupMetrics(samples)
+	if dropped != 2 || len(deduped) != 4 {
+		t.Fatalf("got %d samples with %d dropped, want 4 with 2 dropped", len(deduped), dropped)
+	}
+	// The first sample of a run is kept, and a value returning later isn't a duplicate
+	if !deduped[0].Timestamp.Equal(start) || deduped[3].CPUUsage != 0.1 {
+		t.Errorf("unexpected samples kept: %+v", deduped)
+	}
+
+	if _, dropped := DedupMetrics(nil); dropped != 0 {
+		t.Errorf("no samples: got %d dropped, want 0", dropped)
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import "sort"
+
+// Memory growth detection thresholds
+const (
+	MemoryGrowthMinSamples  = 6   // Fewer samples are too few to call a trend
+	MemoryGrowthMinRSquared = 0.8 // How closely the samples must follow a straight line
+	MemoryGrowthMinIncrease = 0.1 // Fraction of the average memory the trend must add over the run
+)
+
+// DetectMemoryGrowth fits a least-squares line through the memory samples over time and returns
+// its slope in Mi per minute and its coefficient of determination R² (0-1). A flat series or
+// one without elapsed time has a slope and R² of 0.
+func DetectMemoryGrowth(metrics []ResourceMetrics) (float64, float64) {
+	if len(metrics) < 2 {
+		return 0, 0
+	}
+
+	ordered := make([]ResourceMetrics, len(metrics))
+	copy(ordered, metrics)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Timestamp.Before(ordered[j].Timestamp)
+	})
+
+	start := ordered[0].Timestamp
+	n := float64(len(ordered))
+	var sumX, sumY float64
+	for _, m := range ordered {
+		sumX += m.Timestamp.Sub(start).Minutes()
+		sumY += m.MemoryUsage
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var sxx, sxy, syy float64
+	for _, m := range ordered {
+		dx := m.Timestamp.Sub(start).Minutes() - meanX
+		dy := m.MemoryUsage - meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, 0
+	}
+
+	slope := sxy / sxx
+	rSquared := sxy * sxy / (sxx * syy)
+	return slope, rSquared
+}
+
+// MemoryGrowing reports whether memory climbed steadily enough over the run that the samples
+// more likely reflect unbounded growth, such as a leak, than a stable working set
+func MemoryGrowing(metrics []ResourceMetrics) bool {
+	if len(metrics) < MemoryGrowthMinSamples {
+		return false
+	}
+
+	slope, rSquared := DetectMemoryGrowth(metrics)
+	if slope <= 0 || rSquared < MemoryGrowthMinRSquared {
+		return false
+	}
+
+	first, last := metrics[0].Timestamp, metrics[0].Timestamp
+	for _, m := range metrics {
+		if m.Timestamp.Before(first) {
+			first = m.Timestamp
+		}
+		if m.Timestamp.After(last) {
+			last = m.Timestamp
+		}
+	}
+	_, memory := CalculateAverageMetrics(metrics)
+	increase := slope * last.Sub(first).Minutes()
+
+	return increase >= memory*MemoryGrowthMinIncrease
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// NodeSaturationThreshold is the fraction of allocatable CPU or memory above which a node is
+// considered saturated
+const NodeSaturationThreshold = 0.9
+
+// NodeMetrics represents a point-in-time usage sample of a node hosting target pods
+type NodeMetrics struct {
+	Timestamp         time.Time `json:"timestamp"`
+	Node              string    `json:"node"`
+	CPUUsage          float64   `json:"cpuUsage"`          // in cores
+	MemoryUsage       float64   `json:"memoryUsage"`       // in Mi
+	CPUAllocatable    float64   `json:"cpuAllocatable"`    // in cores
+	MemoryAllocatable float64   `json:"memoryAllocatable"` // in Mi
+}
+
+// NodeSummary is the peak saturation of a node over the run, as fractions of allocatable
+type NodeSummary struct {
+	Node                    string  `json:"node"`
+	PeakCPUSaturation       float64 `json:"peakCPUSaturation"`
+	PeakMemorySaturation    float64 `json:"peakMemorySaturation"`
+	AverageCPUSaturation    float64 `json:"averageCPUSaturation"`
+	AverageMemorySaturation float64 `json:"averageMemorySaturation"`
+}
+
+// Saturated reports whether the node's peak CPU or memory saturation reached the threshold
+func (s NodeSummary) Saturated() bool {
+	return s.PeakCPUSaturation >= NodeSaturationThreshold || s.PeakMemorySaturation >= NodeSaturationThreshold
+}
+
+// CollectNodeMetrics collects a single usage sample of each node hosting the target pods
+func (c *Collector) CollectNodeMetrics(ctx context.Context) ([]NodeMetrics, error) {
+	usage, err := c.k8sClient.GetNodeUsage(ctx, c.namespace, c.target)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	samples := make([]NodeMetrics, 0, len(usage))
+	for _, u := range usage {
+		samples = append(samples, NodeMetrics{
+			Timestamp:         now,
+			Node:              u.Node,
+			CPUUsage:          u.CPUUsage,
+			MemoryUsage:       u.MemoryUsage,
+			CPUAllocatable:    u.CPUAllocatable,
+			MemoryAllocatable: u.MemoryAllocatable,
+		})
+	}
+
+	return samples, nil
+}
+
+// SummarizeNodes computes the peak and average saturation of each node, sorted by node name
+func SummarizeNodes(samples []NodeMetrics) []NodeSummary {
+	byNode := make(map[string]*NodeSummary)
+	counts := make(map[string]int)
+	for _, s := range samples {
+		if s.CPUAllocatable <= 0 || s.MemoryAllocatable <= 0 {
+			continue
+		}
+
+		summary, ok := byNode[s.Node]
+		if !ok {
+			summary = &NodeSummary{Node: s.Node}
+			byNode[s.Node] = summary
+		}
+
+		cpuSat := s.CPUUsage / s.CPUAllocatable
+		memorySat := s.MemoryUsage / s.MemoryAllocatable
+		if cpuSat > summary.PeakCPUSaturation {
+			summary.PeakCPUSaturation = cpuSat
+		}
+		if memorySat > summary.PeakMemorySaturation {
+			summary.PeakMemorySaturation = memorySat
+		}
+		summary.AverageCPUSaturation += cpuSat
+		summary.AverageMemorySaturation += memorySat
+		counts[s.Node]++
+	}
+
+	summaries := make([]NodeSummary, 0, len(byNode))
+	for node, summary := range byNode {
+		summary.AverageCPUSaturation /= float64(counts[node])
+		summary.AverageMemorySaturation /= float64(counts[node])
+		summaries = append(summaries, *summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Node < summaries[j].Node
+	})
+
+	return summaries
+}
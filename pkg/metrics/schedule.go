@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// DefaultSampleInterval is how often metrics are sampled during a run
+const DefaultSampleInterval = 5 * time.Second
+
+// SampleJitter is the largest fraction of the interval a jittered sample is moved by
+const SampleJitter = 0.2
+
+// Schedule decides when metrics are sampled. Without jitter samples are taken every interval.
+// With jitter the first sample comes after a random offset within the first interval and each
+// later one is moved by up to SampleJitter of the interval, so sampling isn't phase-locked to
+// periodic work of the service such as GC cycles or cron jobs, which would systematically hit or
+// miss its spikes. The sample times still average one per interval and never drift.
+type Schedule struct {
+	interval time.Duration
+	jitter   bool
+	offset   time.Duration // Time of the first sample before jitter
+	rand     *rand.Rand
+}
+
+// NewSchedule creates a sample schedule. Jitter is drawn from seed, or from the clock if it is 0.
+func NewSchedule(interval time.Duration, jitter bool, seed int64) *Schedule {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s := &Schedule{interval: interval, jitter: jitter, offset: interval, rand: rand.New(rand.NewSource(seed))}
+	if jitter {
+		s.offset = time.Duration(s.rand.Int63n(int64(interval)))
+	}
+	return s
+}
+
+// at returns when sample n (counting from 0) is due, relative to the start of collection
+func (s *Schedule) at(n int) time.Duration {
+	due := s.offset + time.Duration(n)*s.interval
+	if s.jitter {
+		due += time.Duration((s.rand.Float64()*2 - 1) * SampleJitter * float64(s.interval))
+	}
+	if due < 0 {
+		return 0
+	}
+	return due
+}
+
+// Ticks returns a channel that receives the time of each sample until ctx is done
+func (s *Schedule) Ticks(ctx context.Context) <-chan time.Time {
+	ticks := make(chan time.Time)
+	go func() {
+		start := time.Now()
+		for n := 0; ; n++ {
+			timer := time.NewTimer(time.Until(start.Add(s.at(n))))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case t := <-timer.C:
+				select {
+				case ticks <- t:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ticks
+}
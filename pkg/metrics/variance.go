@@ -0,0 +1,28 @@
+package metrics
+
+import "math"
+
+// CoefficientOfVariation returns the standard deviation of the CPU and memory samples relative to
+// their mean: near 0 for a steady workload, around 1 or more for a bursty one. A resource with
+// fewer than two samples or a zero mean has a coefficient of 0.
+func CoefficientOfVariation(metrics []ResourceMetrics) (float64, float64) {
+	if len(metrics) < 2 {
+		return 0, 0
+	}
+
+	meanCPU, meanMemory := CalculateAverageMetrics(metrics)
+	var cpuSquares, memorySquares float64
+	for _, m := range metrics {
+		cpuSquares += (m.CPUUsage - meanCPU) * (m.CPUUsage - meanCPU)
+		memorySquares += (m.MemoryUsage - meanMemory) * (m.MemoryUsage - meanMemory)
+	}
+
+	n := float64(len(metrics))
+	cv := func(squares, mean float64) float64 {
+		if mean <= 0 {
+			return 0
+		}
+		return math.Sqrt(squares/n) / mean
+	}
+	return cv(cpuSquares, meanCPU), cv(memorySquares, meanMemory)
+}
@@ -0,0 +1,39 @@
+package output
+
+import (
+	"fmt"
+	"os"
+)
+
+// ANSI escape codes used to highlight the text output
+const (
+	ansiReset = "\033[0m"
+	ansiRed   = "\033[31m"
+	ansiGreen = "\033[32m"
+)
+
+// ColorEnabled resolves a --color mode ("always", "never", or "auto") to whether the text output
+// should be colorized. In auto mode color is used only when stdout is a terminal.
+func ColorEnabled(mode string) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	default:
+		info, err := os.Stdout.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0
+	}
+}
+
+// highlightChange colors a formatted recommended value green when it is lower than the current
+// value (a saving) and red when it is higher. Unset current values are left uncolored.
+func highlightChange(formatted string, recommended, current float64, currentSet, color bool) string {
+	if !color || !currentSet || recommended == current {
+		return formatted
+	}
+	if recommended < current {
+		return fmt.Sprintf("%s%s%s", ansiGreen, formatted, ansiReset)
+	}
+	return fmt.Sprintf("%s%s%s", ansiRed, formatted, ansiReset)
+}
@@ -0,0 +1,82 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/kubernetes"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/recommender"
+)
+
+// ContainerResult holds the recommendation for one container of a multi-container pod, sized
+// from that container's usage only
+type ContainerResult struct {
+	Name            string                      `json:"name"`
+	CurrentSettings kubernetes.ResourceSettings `json:"currentSettings"`
+	Metrics         []metrics.ResourceMetrics   `json:"metrics"`
+	Recommendations recommender.Recommendations `json:"recommendations"`
+	OmitCPULimit    bool                        `json:"omitCPULimit"`
+	OmitMemoryLimit bool                        `json:"omitMemoryLimit"`
+}
+
+// forContainer returns the result narrowed to a single container
+func (r Result) forContainer(c ContainerResult) Result {
+	r.CurrentSettings = c.CurrentSettings
+	r.Metrics = c.Metrics
+	r.Recommendations = c.Recommendations
+	r.OmitCPULimit = c.OmitCPULimit
+	r.OmitMemoryLimit = c.OmitMemoryLimit
+	r.Containers = nil
+	return r
+}
+
+// writeContainers writes the containers list of a patch at the given indent: one entry per
+// container with its own resources, or a single entry for the assumed "app" container. The
+// strategic merge patch matches entries by name, so only the listed containers are updated.
+func writeContainers(b *strings.Builder, indent string, r Result) {
+	fmt.Fprintf(b, "%scontainers:\n", indent)
+	if len(r.Containers) == 0 {
+		fmt.Fprintf(b, "%s- name: app # This assumes the container name is \"app\"\n", indent)
+		fmt.Fprintf(b, "%s  resources:\n", indent)
+		writeResources(b, indent+"    ", r)
+		return
+	}
+
+	for _, c := range r.Containers {
+		fmt.Fprintf(b, "%s- name: %s\n", indent, c.Name)
+		fmt.Fprintf(b, "%s  resources:\n", indent)
+		writeResources(b, indent+"    ", r.forContainer(c))
+	}
+}
+
+// printContainerSummary prints the per-container recommendations in the text output
+func printContainerSummary(w io.Writer, r Result) {
+	fmt.Fprintf(w, "\nThe pod runs %d containers; the combined figures above add them up.\n", len(r.Containers))
+	fmt.Fprintln(w, "Per-Container Recommendations (request/limit), all included in the patch:")
+	for _, c := range r.Containers {
+		rec := c.Recommendations
+		fmt.Fprintf(w, "  %s: CPU %s/%s, Memory %s/%s\n", c.Name,
+			formatCPU(rec.CPURequest, true), formatCPU(rec.CPULimit, !c.OmitCPULimit),
+			formatMemory(rec.MemoryRequest, true), formatMemory(rec.MemoryLimit, !c.OmitMemoryLimit))
+	}
+}
+
+// containersJSON returns the per-container recommendations for the json output
+func containersJSON(r Result) []map[string]interface{} {
+	containers := make([]map[string]interface{}, 0, len(r.Containers))
+	for _, c := range r.Containers {
+		rec := c.Recommendations
+		containers = append(containers, map[string]interface{}{
+			"name": c.Name,
+			"recommendations": map[string]interface{}{
+				"cpuRequest":    formatCPU(rec.CPURequest, true),
+				"cpuLimit":      formatCPU(rec.CPULimit, !c.OmitCPULimit),
+				"memoryRequest": formatMemory(rec.MemoryRequest, true),
+				"memoryLimit":   formatMemory(rec.MemoryLimit, !c.OmitMemoryLimit),
+			},
+		})
+	}
+	return containers
+}
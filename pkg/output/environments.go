@@ -0,0 +1,158 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+)
+
+// environmentRow is one setting or usage figure compared across environments
+type environmentRow struct {
+	name   string
+	values []float64
+	set    []bool
+	format func(float64, bool) string
+}
+
+// environmentLabel returns the label an environment is shown with in a comparison
+func environmentLabel(r Result) string {
+	return r.Namespace + "/" + r.ServiceName
+}
+
+// environmentRows returns the current settings, observed usage, and recommendations of each
+// result, row by row
+func environmentRows(results []Result) []environmentRow {
+	rows := []environmentRow{
+		{name: "Current CPU Request", format: formatCPU},
+		{name: "Current CPU Limit", format: formatCPU},
+		{name: "Current Memory Request", format: formatMemory},
+		{name: "Current Memory Limit", format: formatMemory},
+		{name: "Average CPU", format: formatCPU},
+		{name: "Peak CPU", format: formatCPU},
+		{name: "Average Memory", format: formatMemory},
+		{name: "Peak Memory", format: formatMemory},
+		{name: "Recommended CPU Request", format: formatCPU},
+		{name: "Recommended CPU Limit", format: formatCPU},
+		{name: "Recommended Memory Request", format: formatMemory},
+		{name: "Recommended Memory Limit", format: formatMemory},
+	}
+
+	for _, r := range results {
+		cur, rec := r.CurrentSettings, r.Recommendations
+		avgCPU, avgMemory := metrics.CalculateAverageMetrics(r.Metrics)
+		peakCPU, peakMemory := metrics.CalculatePeakMetrics(r.Metrics)
+
+		values := []float64{
+			cur.CPURequest, cur.CPULimit, cur.MemoryRequest, cur.MemoryLimit,
+			avgCPU, peakCPU, avgMemory, peakMemory,
+			rec.CPURequest, rec.CPULimit, rec.MemoryRequest, rec.MemoryLimit,
+		}
+		set := []bool{
+			cur.HasCPURequest, cur.HasCPULimit, cur.HasMemoryRequest, cur.HasMemoryLimit,
+			true, true, true, true,
+			true, !r.OmitCPULimit, true, !r.OmitMemoryLimit,
+		}
+		for i := range rows {
+			rows[i].values = append(rows[i].values, values[i])
+			rows[i].set = append(rows[i].set, set[i])
+		}
+	}
+	return rows
+}
+
+// difference returns how much the last environment's value differs from the first one's, e.g.
+// "+50%", or "" if either isn't set or the first is zero
+func (row environmentRow) difference() string {
+	last := len(row.values) - 1
+	if last < 1 || !row.set[0] || !row.set[last] || row.values[0] == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%+.0f%%", (row.values[last]-row.values[0])/row.values[0]*100)
+}
+
+// PrintEnvironmentComparison writes the results of the same service sized in several namespaces,
+// e.g. staging and prod. The text format prints their settings, usage, and recommendations side
+// by side, and the json format both results labeled by environment along with the comparison.
+// The other formats print each environment's output in turn, as PrintMultiResults does.
+func PrintEnvironmentComparison(w io.Writer, files FileWriter, results []Result, format string) {
+	switch format {
+	case "text":
+		printEnvironmentComparison(w, results)
+		for _, r := range results {
+			savePatch(w, files, r)
+		}
+	case "json":
+		environments := make([]map[string]interface{}, 0, len(results))
+		for _, r := range results {
+			data := jsonData(r)
+			data["environment"] = environmentLabel(r)
+			environments = append(environments, data)
+		}
+
+		var comparison []map[string]interface{}
+		for _, row := range environmentRows(results) {
+			values := make(map[string]string, len(results))
+			for i, r := range results {
+				values[environmentLabel(r)] = row.format(row.values[i], row.set[i])
+			}
+			entry := map[string]interface{}{"name": row.name, "values": values}
+			if diff := row.difference(); diff != "" {
+				entry["difference"] = diff
+			}
+			comparison = append(comparison, entry)
+		}
+
+		jsonBytes, err := marshalJSON(map[string]interface{}{
+			"schemaVersion": OutputSchemaVersion,
+			"environments":  environments,
+			"comparison":    comparison,
+		}, len(results) > 0 && results[0].CompactJSON)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling JSON: %v\n", err)
+			return
+		}
+		fmt.Fprintln(w, string(jsonBytes))
+
+		for _, r := range results {
+			savePatch(w, files, r)
+		}
+	default:
+		PrintMultiResults(w, files, results, format)
+	}
+}
+
+// printEnvironmentComparison prints a table with a column per environment, and the difference
+// of the last environment from the first
+func printEnvironmentComparison(w io.Writer, results []Result) {
+	fmt.Fprintln(w, "\n===== Environment Comparison =====")
+	fmt.Fprintf(w, "%-28s", "")
+	for _, r := range results {
+		fmt.Fprintf(w, " %-20s", environmentLabel(r))
+	}
+	fmt.Fprintln(w, " Difference")
+
+	for _, row := range environmentRows(results) {
+		fmt.Fprintf(w, "%-28s", row.name)
+		for i := range results {
+			fmt.Fprintf(w, " %-20s", row.format(row.values[i], row.set[i]))
+		}
+		if diff := row.difference(); diff != "" {
+			fmt.Fprintf(w, " %s", diff)
+		}
+		fmt.Fprintln(w)
+	}
+
+	for _, r := range results {
+		if r.Partial > 0 {
+			fmt.Fprintf(w, "Warning: %s: %s\n", environmentLabel(r), partialWarning(r))
+		}
+		for _, problem := range r.CurrentSettings.Inconsistencies() {
+			fmt.Fprintf(w, "Warning: %s: %s\n", environmentLabel(r), problem)
+		}
+		if r.Divergence != nil {
+			fmt.Fprintf(w, "Warning: %s: %s\n", environmentLabel(r), divergenceWarning(r.Divergence))
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package output
+
+import "os"
+
+// FileWriter saves the files generated alongside the printed output, such as the YAML patch
+type FileWriter interface {
+	WriteFile(name string, data []byte) error
+}
+
+// DiskFiles writes generated files to the current working directory
+type DiskFiles struct{}
+
+// WriteFile writes data to the named file, creating or truncating it
+func (DiskFiles) WriteFile(name string, data []byte) error {
+	return os.WriteFile(name, data, 0644)
+}
@@ -0,0 +1,278 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/recommender"
+)
+
+// HistoryRecord is one run's entry in the recommendation history.
+// CPU values are in millicores and memory values in Mi.
+type HistoryRecord struct {
+	Timestamp                time.Time `json:"timestamp"`
+	Service                  string    `json:"service"`
+	Namespace                string    `json:"namespace"`
+	CurrentCPURequest        float64   `json:"currentCPURequest"`
+	CurrentCPULimit          float64   `json:"currentCPULimit"`
+	CurrentMemoryRequest     float64   `json:"currentMemoryRequest"`
+	CurrentMemoryLimit       float64   `json:"currentMemoryLimit"`
+	AverageCPU               float64   `json:"averageCPU"`
+	PeakCPU                  float64   `json:"peakCPU"`
+	AverageMemory            float64   `json:"averageMemory"`
+	PeakMemory               float64   `json:"peakMemory"`
+	RecommendedCPURequest    float64   `json:"recommendedCPURequest"`
+	RecommendedCPULimit      float64   `json:"recommendedCPULimit"`
+	RecommendedMemoryRequest float64   `json:"recommendedMemoryRequest"`
+	RecommendedMemoryLimit   float64   `json:"recommendedMemoryLimit"`
+
+	// This run's own recommendation before it was blended with earlier runs, which later runs
+	// blend with. Records written before these were added leave them at zero.
+	RawCPURequest    float64 `json:"rawCPURequest,omitempty"`
+	RawCPULimit      float64 `json:"rawCPULimit,omitempty"`
+	RawMemoryRequest float64 `json:"rawMemoryRequest,omitempty"`
+	RawMemoryLimit   float64 `json:"rawMemoryLimit,omitempty"`
+}
+
+// historyCSVHeader is the header row of CSV history files, in HistoryRecord field order
+var historyCSVHeader = []string{
+	"timestamp", "service", "namespace",
+	"current_cpu_request_m", "current_cpu_limit_m", "current_memory_request_mi", "current_memory_limit_mi",
+	"average_cpu_m", "peak_cpu_m", "average_memory_mi", "peak_memory_mi",
+	"recommended_cpu_request_m", "recommended_cpu_limit_m", "recommended_memory_request_mi", "recommended_memory_limit_mi",
+	"raw_cpu_request_m", "raw_cpu_limit_m", "raw_memory_request_mi", "raw_memory_limit_mi",
+}
+
+// historyCSVColumnsV1 is the number of columns of CSV history files written before the raw
+// recommendation was recorded
+const historyCSVColumnsV1 = 15
+
+// NewHistoryRecord summarizes the result as a history entry stamped with the given time
+func NewHistoryRecord(r Result, at time.Time) HistoryRecord {
+	avgCPU, avgMemory := metrics.CalculateAverageMetrics(r.Metrics)
+	peakCPU, peakMemory := metrics.CalculatePeakMetrics(r.Metrics)
+
+	raw := recommender.Record{
+		CPURequest:    r.Recommendations.CPURequest,
+		CPULimit:      r.Recommendations.CPULimit,
+		MemoryRequest: r.Recommendations.MemoryRequest,
+		MemoryLimit:   r.Recommendations.MemoryLimit,
+	}
+	if r.Recommendations.Unblended != nil {
+		raw = *r.Recommendations.Unblended
+	}
+
+	return HistoryRecord{
+		Timestamp:                at.UTC(),
+		Service:                  r.ServiceName,
+		Namespace:                r.Namespace,
+		CurrentCPURequest:        r.CurrentSettings.CPURequest * 1000,
+		CurrentCPULimit:          r.CurrentSettings.CPULimit * 1000,
+		CurrentMemoryRequest:     r.CurrentSettings.MemoryRequest,
+		CurrentMemoryLimit:       r.CurrentSettings.MemoryLimit,
+		AverageCPU:               avgCPU * 1000,
+		PeakCPU:                  peakCPU * 1000,
+		AverageMemory:            avgMemory,
+		PeakMemory:               peakMemory,
+		RecommendedCPURequest:    r.Recommendations.CPURequest * 1000,
+		RecommendedCPULimit:      r.Recommendations.CPULimit * 1000,
+		RecommendedMemoryRequest: r.Recommendations.MemoryRequest,
+		RecommendedMemoryLimit:   r.Recommendations.MemoryLimit,
+		RawCPURequest:            raw.CPURequest * 1000,
+		RawCPULimit:              raw.CPULimit * 1000,
+		RawMemoryRequest:         raw.MemoryRequest,
+		RawMemoryLimit:           raw.MemoryLimit,
+	}
+}
+
+// AppendHistory appends the result's history record to path, as CSV if the file name ends in
+// .csv and as JSON lines otherwise. The file is locked while writing so that concurrent runs,
+// such as overlapping CronJob invocations, don't interleave their records.
+func AppendHistory(path string, r Result) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening history file: %v", err)
+	}
+	defer f.Close()
+
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("error locking history file: %v", err)
+	}
+	defer unlockFile(f)
+
+	record := NewHistoryRecord(r, time.Now())
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		err = appendHistoryCSV(f, record)
+	} else {
+		err = appendHistoryJSON(f, record)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing history file: %v", err)
+	}
+
+	return nil
+}
+
+// appendHistoryJSON writes the record as a single JSON line
+func appendHistoryJSON(f *os.File, record HistoryRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// appendHistoryCSV writes the record as a CSV row, preceded by the header if the file is empty
+func appendHistoryCSV(f *os.File, record HistoryRecord) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	if info.Size() == 0 {
+		if err := w.Write(historyCSVHeader); err != nil {
+			return err
+		}
+	}
+
+	number := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 1, 64)
+	}
+	row := []string{
+		record.Timestamp.Format(time.RFC3339), record.Service, record.Namespace,
+		number(record.CurrentCPURequest), number(record.CurrentCPULimit),
+		number(record.CurrentMemoryRequest), number(record.CurrentMemoryLimit),
+		number(record.AverageCPU), number(record.PeakCPU),
+		number(record.AverageMemory), number(record.PeakMemory),
+		number(record.RecommendedCPURequest), number(record.RecommendedCPULimit),
+		number(record.RecommendedMemoryRequest), number(record.RecommendedMemoryLimit),
+		number(record.RawCPURequest), number(record.RawCPULimit),
+		number(record.RawMemoryRequest), number(record.RawMemoryLimit),
+	}
+	if err := w.Write(row); err != nil {
+		return err
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// Recommendation returns the run's own recommended settings in cores and Mi, before any
+// blending, so blending again with them doesn't compound earlier blends. Older records without
+// them return the recommended settings.
+func (h HistoryRecord) Recommendation() recommender.Record {
+	if h.RawCPURequest != 0 || h.RawMemoryRequest != 0 {
+		return recommender.Record{
+			CPURequest:    h.RawCPURequest / 1000,
+			CPULimit:      h.RawCPULimit / 1000,
+			MemoryRequest: h.RawMemoryRequest,
+			MemoryLimit:   h.RawMemoryLimit,
+		}
+	}
+	return recommender.Record{
+		CPURequest:    h.RecommendedCPURequest / 1000,
+		CPULimit:      h.RecommendedCPULimit / 1000,
+		MemoryRequest: h.RecommendedMemoryRequest,
+		MemoryLimit:   h.RecommendedMemoryLimit,
+	}
+}
+
+// ReadHistory reads the records of the given service from a history file written by
+// AppendHistory, in the order they were appended. A file that doesn't exist yet has no records.
+func ReadHistory(path, namespace, service string) ([]HistoryRecord, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening history file: %v", err)
+	}
+	defer f.Close()
+
+	var records []HistoryRecord
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		records, err = readHistoryCSV(f)
+	} else {
+		records, err = readHistoryJSON(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading history file: %v", err)
+	}
+
+	var matching []HistoryRecord
+	for _, record := range records {
+		if record.Namespace == namespace && record.Service == service {
+			matching = append(matching, record)
+		}
+	}
+	return matching, nil
+}
+
+// readHistoryJSON reads JSON lines records
+func readHistoryJSON(f *os.File) ([]HistoryRecord, error) {
+	var records []HistoryRecord
+	decoder := json.NewDecoder(f)
+	for decoder.More() {
+		var record HistoryRecord
+		if err := decoder.Decode(&record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// readHistoryCSV reads CSV records, skipping the header row. Rows written before the raw
+// recommendation was recorded lack its columns.
+func readHistoryCSV(f *os.File) ([]HistoryRecord, error) {
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []HistoryRecord
+	for i, row := range rows {
+		if i == 0 && row[0] == historyCSVHeader[0] {
+			continue
+		}
+		if len(row) != len(historyCSVHeader) && len(row) != historyCSVColumnsV1 {
+			return nil, fmt.Errorf("row %d: expected %d columns, got %d", i+1, len(historyCSVHeader), len(row))
+		}
+
+		timestamp, err := time.Parse(time.RFC3339, row[0])
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", i+1, err)
+		}
+		values := make([]float64, len(row)-3)
+		for j := range values {
+			if values[j], err = strconv.ParseFloat(row[j+3], 64); err != nil {
+				return nil, fmt.Errorf("row %d: invalid %s %q", i+1, historyCSVHeader[j+3], row[j+3])
+			}
+		}
+
+		record := HistoryRecord{
+			Timestamp: timestamp, Service: row[1], Namespace: row[2],
+			CurrentCPURequest: values[0], CurrentCPULimit: values[1], CurrentMemoryRequest: values[2], CurrentMemoryLimit: values[3],
+			AverageCPU: values[4], PeakCPU: values[5], AverageMemory: values[6], PeakMemory: values[7],
+			RecommendedCPURequest: values[8], RecommendedCPULimit: values[9],
+			RecommendedMemoryRequest: values[10], RecommendedMemoryLimit: values[11],
+		}
+		if len(values) > 12 {
+			record.RawCPURequest, record.RawCPULimit = values[12], values[13]
+			record.RawMemoryRequest, record.RawMemoryLimit = values[14], values[15]
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
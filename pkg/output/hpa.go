@@ -0,0 +1,138 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// hpaNote describes the recommended HPA target and how much of the recommended CPU request the
+// tested load uses
+func hpaNote(r Result) string {
+	t := r.Recommendations.HPA
+	note := fmt.Sprintf("HPA target utilization %d%% of the CPU request keeps %.0f%% of it as headroom; the tested load uses %.0f%% of the recommended request",
+		t.Utilization, t.Headroom*100, t.LoadUtilization)
+	if t.RequestRaised {
+		note += ", which was raised so the HPA doesn't scale out at this load"
+	}
+	return note
+}
+
+// hpaWarnings explains an HPA target that contradicts the recommended CPU request: one the
+// tested load already exceeds, so the HPA would keep adding replicas at it
+func hpaWarnings(r Result) []string {
+	t := r.Recommendations.HPA
+	if t == nil {
+		return nil
+	}
+
+	var warnings []string
+	if t.OverTarget() {
+		warnings = append(warnings, fmt.Sprintf("the tested load uses %.0f%% of the recommended CPU request, above the HPA target of %d%%; the HPA would scale out at this load",
+			t.LoadUtilization, t.Utilization))
+	}
+	if hpa := r.HPA; hpa != nil && hpa.CPUTarget > 0 && float64(hpa.CPUTarget) < t.LoadUtilization {
+		warnings = append(warnings, fmt.Sprintf("the current target of %d%% of HorizontalPodAutoscaler %s is below the %.0f%% the tested load uses of the recommended CPU request; apply the HPA patch along with the resource patch",
+			hpa.CPUTarget, hpa.Name, t.LoadUtilization))
+	}
+	if hpa := r.HPA; hpa != nil && hpa.Metrics > 1 {
+		warnings = append(warnings, fmt.Sprintf("HorizontalPodAutoscaler %s scales on %d metrics, and applying the HPA patch replaces them with the CPU target",
+			hpa.Name, hpa.Metrics))
+	}
+	return warnings
+}
+
+// printHPATarget prints the recommended HPA target next to the current one
+func printHPATarget(w io.Writer, r Result) {
+	t := r.Recommendations.HPA
+	fmt.Fprintln(w, "\nHPA Target:")
+	var current string
+	switch {
+	case r.HPA == nil:
+		current = "no HorizontalPodAutoscaler targets the Deployment"
+	case r.HPA.CPUTarget > 0:
+		current = fmt.Sprintf("%d%% (HorizontalPodAutoscaler %s, %d-%d replicas)", r.HPA.CPUTarget, r.HPA.Name, r.HPA.MinReplicas, r.HPA.MaxReplicas)
+	default:
+		current = fmt.Sprintf("HorizontalPodAutoscaler %s doesn't scale on CPU utilization", r.HPA.Name)
+	}
+	fmt.Fprintf(w, "%-22s %s\n", "Current target:", current)
+	fmt.Fprintf(w, "%-22s %d%% (%.0f%% headroom)\n", "Recommended target:", t.Utilization, t.Headroom*100)
+	fmt.Fprintf(w, "%-22s %.0f%% of %s\n", "Utilization at load:", t.LoadUtilization, formatCPU(r.Recommendations.CPURequest, true))
+	fmt.Fprintf(w, "Note: %s.\n", hpaNote(r))
+	for _, warning := range hpaWarnings(r) {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+}
+
+// hpaJSON returns the recommended and current HPA targets for the json output
+func hpaJSON(r Result) map[string]interface{} {
+	t := r.Recommendations.HPA
+	data := map[string]interface{}{
+		"targetUtilization": t.Utilization,
+		"headroom":          t.Headroom,
+		"loadUtilization":   t.LoadUtilization,
+		"cpuRequestRaised":  t.RequestRaised,
+		"overTarget":        t.OverTarget(),
+	}
+	if r.HPA != nil {
+		data["current"] = r.HPA
+	}
+	if warnings := hpaWarnings(r); len(warnings) > 0 {
+		data["warnings"] = warnings
+	}
+	return data
+}
+
+// generateHPAPatch creates a HorizontalPodAutoscaler manifest scaling the Deployment on the
+// recommended CPU target. An existing HPA keeps its name and replica bounds; without one, the
+// bounds are a starting point to review.
+func generateHPAPatch(r Result) string {
+	deployment, _ := deploymentName(r)
+	name, minReplicas, maxReplicas := deployment, int32(1), int32(2)
+	boundsComment := " # No HPA targets the Deployment yet; review the replica bounds"
+	if r.Replicas > 0 {
+		minReplicas, maxReplicas = int32(r.Replicas), int32(2*r.Replicas)
+	}
+	if r.HPA != nil {
+		name, minReplicas, maxReplicas, boundsComment = r.HPA.Name, r.HPA.MinReplicas, r.HPA.MaxReplicas, ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  namespace: %s
+  name: %s
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: %s
+  minReplicas: %d
+  maxReplicas: %d%s
+  metrics:
+  - type: Resource
+    resource:
+      name: cpu
+      target:
+        type: Utilization
+        averageUtilization: %d
+`,
+		r.Namespace, name, patchName(r), minReplicas, maxReplicas, boundsComment, r.Recommendations.HPA.Utilization)
+	return b.String()
+}
+
+// saveHPAPatch saves the HPA manifest alongside the resource patch when an HPA target was
+// recommended
+func saveHPAPatch(w io.Writer, files FileWriter, r Result) {
+	if r.Recommendations.HPA == nil {
+		return
+	}
+
+	fileName := r.fileName("hpa-patch.yaml")
+	if err := files.WriteFile(fileName, []byte(generateHPAPatch(r))); err != nil {
+		fmt.Fprintf(w, "\nError writing HPA patch file: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "\nHPA patch generated in '%s'\n", fileName)
+}
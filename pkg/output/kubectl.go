@@ -0,0 +1,164 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// printKubectl prints ready-to-run kubectl patch commands with the recommended resources inlined
+func printKubectl(w io.Writer, r Result) {
+	if r.Unchanged() {
+		printNoChange(w, r, true)
+		return
+	}
+
+	results := []Result{r}
+	if len(r.Workloads) > 0 {
+		results = results[:0]
+		for _, wl := range r.Workloads {
+			results = append(results, r.forWorkload(wl))
+		}
+	}
+
+	for _, res := range results {
+		command, err := generateKubectlPatch(res)
+		if err != nil {
+			fmt.Fprintf(w, "Error generating kubectl patch: %v\n", err)
+			continue
+		}
+		if _, guessed := deploymentName(res); guessed && len(res.Containers) > 0 {
+			fmt.Fprintln(w, "# This assumes the deployment name matches the service name")
+		} else if guessed {
+			fmt.Fprintln(w, "# This assumes the deployment name matches the service name and the container is named \"app\"")
+		}
+		for _, line := range utilizationLines(res) {
+			fmt.Fprintf(w, "# Current utilization of %s\n", line)
+		}
+		fmt.Fprintln(w, command)
+	}
+}
+
+// generateKubectlPatch builds a kubectl patch command for the recommended resources. It uses a
+// strategic merge patch, which merges containers by name; a JSON merge patch would replace the
+// whole container list.
+func generateKubectlPatch(r Result) (string, error) {
+	patchJSON, err := strategicMergePatch(r)
+	if err != nil {
+		return "", err
+	}
+
+	name, _ := deploymentName(r)
+	return fmt.Sprintf("kubectl patch deployment %s -n %s --type strategic -p %s",
+		shellQuote(name), shellQuote(r.Namespace), shellQuote(string(patchJSON))), nil
+}
+
+// DeploymentPatch is the strategic merge patch, in JSON, for the resources of one Deployment
+type DeploymentPatch struct {
+	Deployment string
+	Patch      []byte
+}
+
+// Patches returns the strategic merge patch of each Deployment the result patches, the same
+// ones the kubectl output inlines: one per Deployment when the selector matched several
+func Patches(r Result) ([]DeploymentPatch, error) {
+	results := []Result{r}
+	if len(r.Workloads) > 0 {
+		results = results[:0]
+		for _, wl := range r.Workloads {
+			results = append(results, r.forWorkload(wl))
+		}
+	}
+
+	var patches []DeploymentPatch
+	for _, res := range results {
+		patch, err := strategicMergePatch(res)
+		if err != nil {
+			return nil, err
+		}
+		name, _ := deploymentName(res)
+		patches = append(patches, DeploymentPatch{Deployment: name, Patch: patch})
+	}
+	return patches, nil
+}
+
+// strategicMergePatch returns the recommended resources as a strategic merge patch in JSON
+func strategicMergePatch(r Result) ([]byte, error) {
+	containers := []interface{}{
+		map[string]interface{}{
+			"name":      "app",
+			"resources": kubectlResources(r),
+		},
+	}
+	if len(r.Containers) > 0 {
+		containers = containers[:0]
+		for _, c := range r.Containers {
+			containers = append(containers, map[string]interface{}{
+				"name":      c.Name,
+				"resources": kubectlResources(r.forContainer(c)),
+			})
+		}
+	}
+
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": containers,
+				},
+			},
+		},
+	}
+
+	patchJSON, err := json.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling patch: %v", err)
+	}
+	return patchJSON, nil
+}
+
+// kubectlResources returns the resources block of a container in the kubectl patch
+func kubectlResources(r Result) map[string]interface{} {
+	requests := map[string]interface{}{
+		"cpu":    fmt.Sprintf("%dm", int(r.Recommendations.CPURequest*1000)),
+		"memory": fmt.Sprintf("%dMi", int(r.Recommendations.MemoryRequest)),
+	}
+
+	// Limits follow the same rules as the YAML patch: omitted, or null to remove an existing one
+	limits := map[string]interface{}{}
+	if r.OmitCPULimit {
+		if r.CurrentSettings.HasCPULimit {
+			limits["cpu"] = nil
+		}
+	} else {
+		limits["cpu"] = fmt.Sprintf("%dm", int(r.Recommendations.CPULimit*1000))
+	}
+	if r.OmitMemoryLimit {
+		if r.CurrentSettings.HasMemoryLimit {
+			limits["memory"] = nil
+		}
+	} else {
+		limits["memory"] = fmt.Sprintf("%dMi", int(r.Recommendations.MemoryLimit))
+	}
+
+	// Other resources such as GPUs are carried over unchanged, like in the YAML patch
+	for name, quantity := range r.CurrentSettings.OtherRequests {
+		requests[name] = quantity
+	}
+	for name, quantity := range r.CurrentSettings.OtherLimits {
+		limits[name] = quantity
+	}
+
+	// Kept limits are left out, like in the YAML patch
+	resources := map[string]interface{}{"requests": requests}
+	if len(limits) > 0 && !r.Recommendations.LimitsKept {
+		resources["limits"] = limits
+	}
+	return resources
+}
+
+// shellQuote quotes s for POSIX shells, wrapping it in single quotes and escaping any it contains
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
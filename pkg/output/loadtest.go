@@ -0,0 +1,120 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/loadtest"
+)
+
+// LoadTestFormats lists the output formats of a load test run without rightsizing
+var LoadTestFormats = []string{"text", "json"}
+
+// IsLoadTestFormat reports whether format is one of the load test output formats
+func IsLoadTestFormat(format string) bool {
+	for _, f := range LoadTestFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintLoadTest writes the report of a load test run on its own, without any rightsizing, in
+// the text or json format. compact prints the json format on a single line.
+func PrintLoadTest(w io.Writer, target string, m *loadtest.Metrics, format string, compact bool) {
+	if format == "json" {
+		jsonBytes, err := marshalJSON(loadTestData(target, m), compact)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling JSON: %v\n", err)
+			return
+		}
+		fmt.Fprintln(w, string(jsonBytes))
+		return
+	}
+
+	printLoadTestReport(w, target, m)
+	fmt.Fprintln(w, "\nNo Kubernetes metrics were collected and no resources were recommended (--loadtest-only).")
+}
+
+// printLoadTestReport prints the requests, throughput, latency, and status codes of a load test
+func printLoadTestReport(w io.Writer, target string, m *loadtest.Metrics) {
+	fmt.Fprintln(w, "\n===== Load Test Report =====")
+	fmt.Fprintf(w, "\nTarget: %s\n", target)
+	fmt.Fprintf(w, "Requests: %d (%d successful, %d failed, %.2f%% success rate)\n",
+		m.Requests, m.Success, m.Failures, m.SuccessRate())
+	fmt.Fprintf(w, "Throughput: %.2f req/s\n", m.Throughput())
+	if m.Requests > 0 {
+		fmt.Fprintf(w, "Latency: mean %s, p95 %s, max %s\n",
+			formatLatency(m.MeanLatency()), formatLatency(m.P95Latency()), formatLatency(m.MaxLatency))
+	}
+	if len(m.CorrectedLatencies) > 0 {
+		fmt.Fprintf(w, "Corrected latency (from scheduled send time): p50 %s, p95 %s, p99 %s, max send delay %s\n",
+			formatLatency(m.CorrectedLatency(50)), formatLatency(m.CorrectedLatency(95)),
+			formatLatency(m.CorrectedLatency(99)), formatLatency(m.MaxSendDelay))
+	}
+	if m.LatencySampled {
+		fmt.Fprintf(w, "Note: latency percentiles are estimates from a sample of %d of %d latencies (--latency-sampling)\n",
+			len(m.Latencies), m.LatencyCount)
+	}
+	if len(m.StatusCodes) > 0 {
+		fmt.Fprintln(w, "Status codes:")
+		for _, code := range m.SortedStatusCodes() {
+			fmt.Fprintf(w, "  %d: %d\n", code, m.StatusCodes[code])
+		}
+	}
+}
+
+// loadTestData returns the data shown by the json format of a load test run
+func loadTestData(target string, m *loadtest.Metrics) map[string]interface{} {
+	statusCodes := make(map[string]int, len(m.StatusCodes))
+	for code, count := range m.StatusCodes {
+		statusCodes[fmt.Sprint(code)] = count
+	}
+
+	data := map[string]interface{}{
+		"schemaVersion":  OutputSchemaVersion,
+		"loadTestTarget": target,
+		"duration":       m.TestDuration.String(),
+		"requests":       m.Requests,
+		"success":        m.Success,
+		"failures":       m.Failures,
+		"successRate":    m.SuccessRate(),
+		"throughput":     m.Throughput(),
+		"statusCodes":    statusCodes,
+		"retries":        m.Retries,
+		"connections": map[string]interface{}{
+			"reused": m.ReusedConns,
+			"new":    m.NewConns,
+		},
+	}
+	if m.Requests > 0 {
+		data["latency"] = map[string]interface{}{
+			"mean": formatLatency(m.MeanLatency()),
+			"p95":  formatLatency(m.P95Latency()),
+			"max":  formatLatency(m.MaxLatency),
+		}
+	}
+	if len(m.CorrectedLatencies) > 0 {
+		data["correctedLatency"] = map[string]interface{}{
+			"p50":          formatLatency(m.CorrectedLatency(50)),
+			"p95":          formatLatency(m.CorrectedLatency(95)),
+			"p99":          formatLatency(m.CorrectedLatency(99)),
+			"maxSendDelay": formatLatency(m.MaxSendDelay),
+		}
+	}
+	if m.LatencySampled {
+		data["latencySample"] = map[string]interface{}{
+			"sampled":   len(m.Latencies),
+			"latencies": m.LatencyCount,
+		}
+	}
+	return data
+}
+
+// formatLatency formats a latency in milliseconds
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d.Microseconds())/1000.0)
+}
@@ -0,0 +1,88 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// fileName returns the name a generated file is saved under, with the result's prefix
+func (r Result) fileName(name string) string {
+	return r.FilePrefix + name
+}
+
+// TargetFilePrefix returns a file name prefix unique to a service, so that the files generated
+// for several targets of one run don't overwrite each other
+func TargetFilePrefix(namespace, serviceName string) string {
+	sanitize := func(s string) string {
+		return strings.Map(func(c rune) rune {
+			if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '.' {
+				return c
+			}
+			return '-'
+		}, s)
+	}
+	return sanitize(namespace) + "_" + sanitize(serviceName) + "_"
+}
+
+// PrintMultiResults writes the results of a run that sized several independent targets. Each
+// result's generated files are named with its FilePrefix. The json format prints a single array
+// and the prometheus format a single exposition covering every target; the other formats print
+// each target's output in turn.
+func PrintMultiResults(w io.Writer, files FileWriter, results []Result, format string) {
+	switch format {
+	case "json":
+		data := make([]map[string]interface{}, 0, len(results))
+		for _, r := range results {
+			data = append(data, jsonData(r))
+		}
+		jsonBytes, err := marshalJSON(data, len(results) > 0 && results[0].CompactJSON)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling JSON: %v\n", err)
+			return
+		}
+		fmt.Fprintln(w, string(jsonBytes))
+
+		for _, r := range results {
+			savePatch(w, files, r)
+		}
+	case "prometheus":
+		content := generatePrometheusMetrics(results)
+		fmt.Fprint(w, content)
+
+		if err := files.WriteFile("resource-metrics.prom", []byte(content)); err != nil {
+			fmt.Fprintf(w, "\nError writing Prometheus metrics file: %v\n", err)
+			return
+		}
+		fmt.Fprintln(w, "\nPrometheus metrics saved to 'resource-metrics.prom'")
+	case "text":
+		for _, r := range results {
+			fmt.Fprintf(w, "\n########## %s/%s ##########\n", r.Namespace, r.ServiceName)
+			printText(w, files, r)
+		}
+		printMultiSummary(w, results)
+	default:
+		for _, r := range results {
+			fmt.Fprintf(w, "\n# %s/%s\n", r.Namespace, r.ServiceName)
+			PrintResults(w, files, r, format)
+		}
+	}
+}
+
+// printMultiSummary prints the recommendations of every target in one table, with the requests
+// each pod would free up
+func printMultiSummary(w io.Writer, results []Result) {
+	fmt.Fprintln(w, "\n===== Multi-Target Summary =====")
+	fmt.Fprintf(w, "%-40s %-12s %-12s %-15s %-13s %-16s %s\n",
+		"Service", "CPU Request", "CPU Limit", "Memory Request", "Memory Limit", "Reclaimable CPU", "Reclaimable Memory")
+	for _, r := range results {
+		rec := r.Recommendations
+		fmt.Fprintf(w, "%-40s %-12s %-12s %-15s %-13s %-16s %s\n",
+			r.Namespace+"/"+r.ServiceName,
+			formatCPU(rec.CPURequest, true), formatCPU(rec.CPULimit, !r.OmitCPULimit),
+			formatMemory(rec.MemoryRequest, true), formatMemory(rec.MemoryLimit, !r.OmitMemoryLimit),
+			formatCPU(reclaimableCPU(r), r.CurrentSettings.HasCPURequest),
+			formatMemory(reclaimableMemory(r), r.CurrentSettings.HasMemoryRequest))
+	}
+}
@@ -3,93 +3,376 @@ package output
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/BogdanDolia/pod-rightsizer/pkg/kubernetes"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/loadtest"
 	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
 	"github.com/BogdanDolia/pod-rightsizer/pkg/recommender"
 )
 
 // Result contains all data to be presented in the output
 type Result struct {
-	Target          string
-	ServiceName     string
-	Namespace       string
-	Duration        time.Duration
-	RPS             int
-	CurrentSettings kubernetes.ResourceSettings
-	Metrics         []metrics.ResourceMetrics
-	Recommendations recommender.Recommendations
-}
-
-// PrintResults displays the results in the specified format
-func PrintResults(result Result, format string) {
+	Target          string                      `json:"target"`
+	ServiceName     string                      `json:"serviceName"`
+	Namespace       string                      `json:"namespace"`
+	Duration        time.Duration               `json:"duration"` // in nanoseconds
+	RPS             int                         `json:"rps"`
+	Replicas        int                         `json:"replicas,omitempty"` // Replica count the RPS was scaled to (0 if it wasn't)
+	CurrentSettings kubernetes.ResourceSettings `json:"currentSettings"`
+	Metrics         []metrics.ResourceMetrics   `json:"metrics"`
+	Duplicates      int                         `json:"duplicateSamples,omitempty"` // Repeated metrics-server readings left out of Metrics
+	Partial         int                         `json:"partialSamples,omitempty"`   // Samples covering far fewer pods than were running
+	Recommendations recommender.Recommendations `json:"recommendations"`
+	LoadTest        *loadtest.Metrics           `json:"loadTest,omitempty"`
+	HelmValuesPath  string                      `json:"-"` // Dot-separated values path used by the helm output format
+	Color           bool                        `json:"-"` // Colorize recommended values in the text output
+	Comparisons     []recommender.Comparison    `json:"comparisons,omitempty"`
+	OmitCPULimit    bool                        `json:"omitCPULimit"`         // Leave the CPU limit out of generated patches
+	OmitMemoryLimit bool                        `json:"omitMemoryLimit"`      // Leave the memory limit out of generated patches
+	Deployment      string                      `json:"deployment,omitempty"` // Patched Deployment name (derived from the service name if empty)
+	Workloads       []WorkloadResult            `json:"workloads,omitempty"`  // Per-Deployment results when the selector matched several
+	Containers      []ContainerResult           `json:"containers,omitempty"` // Per-container results when the pod runs several containers
+	Nodes           []metrics.NodeSummary       `json:"nodes,omitempty"`      // Saturation of the nodes hosting the target pods
+	App             *metrics.AppSummary         `json:"app,omitempty"`        // Heap and GC activity scraped from the application
+	Iterations      []IterationResult           `json:"iterations,omitempty"` // Per-iteration results when the load test ran several times
+	FilePrefix      string                      `json:"-"`                    // Prepended to the names of generated files
+
+	// Requests and limits that differ between the target's pods, e.g. mid-rollout, when the
+	// current settings read from one pod are no reliable baseline
+	Divergence *kubernetes.SettingsDivergence `json:"settingsDivergence,omitempty"`
+
+	// Containers lacking requests or limits, when they were audited
+	LimitsAudited bool                          `json:"-"`
+	MissingLimits []kubernetes.MissingResources `json:"missingLimits,omitempty"`
+
+	// Liveness and startup probes the CPU limit was sized around with --probe-aware
+	Probes *kubernetes.ProbeSettings `json:"probes,omitempty"`
+
+	// Outcome of the server-side dry run of each patch with --validate
+	Validation []PatchValidation `json:"patchValidation,omitempty"`
+
+	// Recommendation of the workload's VerticalPodAutoscaler with --compare-with-vpa
+	VPA *kubernetes.VPARecommendation `json:"vpa,omitempty"`
+
+	// HorizontalPodAutoscaler targeting the workload when an HPA target was recommended with
+	// --hpa-headroom (nil if there is none)
+	HPA *kubernetes.HPASettings `json:"hpa,omitempty"`
+
+	// Tolerance percentage within which recommended values count as unchanged, in which case no
+	// patch is generated (0 disables)
+	SkipIfWithin float64 `json:"-"`
+
+	// Print the json format on a single line instead of indented
+	CompactJSON bool `json:"-"`
+}
+
+// IterationResult is the recommendation from the samples of a single load test iteration
+type IterationResult struct {
+	Iteration       int                         `json:"iteration"`
+	Samples         int                         `json:"samples"`
+	Recommendations recommender.Recommendations `json:"recommendations"`
+	LoadTest        *loadtest.Metrics           `json:"loadTest,omitempty"`
+}
+
+// OutputSchemaVersion identifies the layout of the json output and is printed as a comment
+// ahead of the yaml and helm output. Fields may be added within a version; renaming, removing,
+// or changing the type of a field requires a new version.
+const OutputSchemaVersion = "v1"
+
+// Formats lists the supported output formats
+var Formats = []string{"text", "json", "yaml", "helm", "prometheus", "kubectl"}
+
+// IsValidFormat reports whether format is one of the supported output formats
+func IsValidFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintResults writes the results in the specified format to w, saving generated files such as
+// the YAML patch through files
+func PrintResults(w io.Writer, files FileWriter, result Result, format string) {
 	switch format {
 	case "json":
-		printJSON(result)
+		printJSON(w, files, result)
 	case "yaml":
-		printYAML(result)
+		printYAML(w, files, result)
+	case "helm":
+		printHelm(w, files, result)
+	case "prometheus":
+		printPrometheus(w, files, result)
+	case "kubectl":
+		printKubectl(w, result)
 	default:
-		printText(result)
+		printText(w, files, result)
 	}
 }
 
 // printText displays the results in a human-readable text format
-func printText(r Result) {
+func printText(w io.Writer, files FileWriter, r Result) {
 	avgCPU, avgMemory := metrics.CalculateAverageMetrics(r.Metrics)
 	peakCPU, peakMemory := metrics.CalculatePeakMetrics(r.Metrics)
 
-	fmt.Println("\n===== Pod Rightsizer Results =====")
-	fmt.Printf("\nLoad Test Target: %s\n", r.Target)
+	fmt.Fprintln(w, "\n===== Pod Rightsizer Results =====")
+	fmt.Fprintf(w, "\nLoad Test Target: %s\n", r.Target)
 	if r.ServiceName != r.Target {
-		fmt.Printf("Service Name: %s\n", r.ServiceName)
-	}
-	fmt.Printf("Namespace: %s\n", r.Namespace)
-	fmt.Printf("Load test: %d RPS for %s\n", r.RPS, r.Duration)
-
-	fmt.Println("\nCurrent Settings:")
-	fmt.Printf("CPU Request: %.0fm\n", r.CurrentSettings.CPURequest*1000)
-	fmt.Printf("CPU Limit: %.0fm\n", r.CurrentSettings.CPULimit*1000)
-	fmt.Printf("Memory Request: %.0fMi\n", r.CurrentSettings.MemoryRequest)
-	fmt.Printf("Memory Limit: %.0fMi\n", r.CurrentSettings.MemoryLimit)
-
-	fmt.Println("\nMetrics Collected:")
-	fmt.Printf("Peak CPU: %.0fm\n", peakCPU*1000)
-	fmt.Printf("Average CPU: %.0fm\n", avgCPU*1000)
-	fmt.Printf("Peak Memory: %.0fMi\n", peakMemory)
-	fmt.Printf("Average Memory: %.0fMi\n", avgMemory)
-
-	fmt.Println("\nRecommended Settings:")
-	fmt.Printf("CPU Request: %.0fm\n", r.Recommendations.CPURequest*1000)
-	fmt.Printf("CPU Limit: %.0fm\n", r.Recommendations.CPULimit*1000)
-	fmt.Printf("Memory Request: %.0fMi\n", r.Recommendations.MemoryRequest)
-	fmt.Printf("Memory Limit: %.0fMi\n", r.Recommendations.MemoryLimit)
-
-	// Generate and save YAML if using text output mode
+		fmt.Fprintf(w, "Service Name: %s\n", r.ServiceName)
+	}
+	fmt.Fprintf(w, "Namespace: %s\n", r.Namespace)
+	if r.Replicas > 0 {
+		fmt.Fprintf(w, "Load test: %d RPS for %s (%d RPS per replica x %d replicas)\n",
+			r.RPS, r.Duration, r.RPS/r.Replicas, r.Replicas)
+	} else {
+		fmt.Fprintf(w, "Load test: %d RPS for %s\n", r.RPS, r.Duration)
+	}
+
+	printCurrentSettings(w, r)
+
+	fmt.Fprintln(w, "\nMetrics Collected:")
+	fmt.Fprintf(w, "Peak CPU: %.0fm\n", peakCPU*1000)
+	fmt.Fprintf(w, "Average CPU: %.0fm\n", avgCPU*1000)
+	fmt.Fprintf(w, "Peak Memory: %.0fMi\n", peakMemory)
+	fmt.Fprintf(w, "Average Memory: %.0fMi\n", avgMemory)
+	if r.Duplicates > 0 {
+		fmt.Fprintf(w, "Duplicate samples collapsed: %d (repeated metrics-server readings)\n", r.Duplicates)
+	}
+	if r.Partial > 0 {
+		fmt.Fprintf(w, "Warning: %s\n", partialWarning(r))
+	}
+
+	if len(r.Nodes) > 0 {
+		printNodeSummary(w, r.Nodes)
+	}
+
+	if r.App != nil {
+		printAppSummary(w, *r.App)
+	}
+
+	printUtilization(w, r)
+
+	cpuRank, memoryRank := currentRequestRanks(r)
+	fmt.Fprintln(w, "\nCurrent Requests vs Observed Usage:")
+	fmt.Fprintf(w, "Current CPU request is at the %s percentile of observed usage\n", ordinal(cpuRank))
+	fmt.Fprintf(w, "Current memory request is at the %s percentile of observed usage\n", ordinal(memoryRank))
+
+	rec, cur := r.Recommendations, r.CurrentSettings
+	if rec.ThrottlingDetected {
+		fmt.Fprintf(w, "\n*** CPU THROTTLING DETECTED: %.0f%% of samples were at the current CPU limit of %.0fm ***\n",
+			rec.ThrottleRatio*100, cur.CPULimit*1000)
+		fmt.Fprintln(w, "The recommended CPU limit was raised above the current limit; observed CPU usage understates real demand.")
+	}
+
+	if metrics.MemoryGrowing(r.Metrics) {
+		slope, rSquared := metrics.DetectMemoryGrowth(r.Metrics)
+		fmt.Fprintf(w, "\n*** MEMORY GROWTH DETECTED: memory climbed steadily by %.1fMi/min (R² %.2f) ***\n", slope, rSquared)
+		fmt.Fprintln(w, "The memory recommendation reflects unbounded growth, possibly a leak, rather than a stable working set. Run longer to confirm.")
+	}
+
+	fmt.Fprintln(w, "\nRecommended Settings:")
+	fmt.Fprintf(w, "CPU Request: %s%s\n", highlightChange(fmt.Sprintf("%.0fm", rec.CPURequest*1000),
+		rec.CPURequest, cur.CPURequest, cur.HasCPURequest, r.Color), clampNote(rec.CPURequestClamped)+floorNote(rec.CPURequestFloored))
+	if r.OmitCPULimit {
+		fmt.Fprintln(w, "CPU Limit: none (no CPU limit is set)")
+	} else {
+		fmt.Fprintf(w, "CPU Limit: %s%s\n", highlightChange(fmt.Sprintf("%.0fm", rec.CPULimit*1000),
+			rec.CPULimit, cur.CPULimit, cur.HasCPULimit, r.Color), floorNote(rec.CPULimitFloored))
+	}
+	fmt.Fprintf(w, "Memory Request: %s%s\n", highlightChange(fmt.Sprintf("%.0fMi", rec.MemoryRequest),
+		rec.MemoryRequest, cur.MemoryRequest, cur.HasMemoryRequest, r.Color), clampNote(rec.MemoryRequestClamped)+floorNote(rec.MemoryRequestFloored))
+	if r.OmitMemoryLimit {
+		fmt.Fprintln(w, "Memory Limit: none (no memory limit is set)")
+	} else {
+		fmt.Fprintf(w, "Memory Limit: %s%s\n", highlightChange(fmt.Sprintf("%.0fMi", rec.MemoryLimit),
+			rec.MemoryLimit, cur.MemoryLimit, cur.HasMemoryLimit, r.Color), floorNote(rec.MemoryLimitFloored))
+	}
+
+	if rec.CPURequestClamped || rec.MemoryRequestClamped {
+		fmt.Fprintln(w, "\nNote: requests were held back by --max-downsize; a follow-up run will continue tightening them.")
+	}
+	if rec.LimitsKept {
+		fmt.Fprintln(w, "\nNote: only requests were sized (--requests-only); the current limits are kept and left out of the patch.")
+	}
+	if rec.CPURequestAtLimit || rec.MemoryRequestAtLimit {
+		fmt.Fprintf(w, "\nWarning: %s\n", atLimitWarning(rec))
+	}
+	if rec.AdaptiveMargin {
+		fmt.Fprintf(w, "\nNote: adaptive margin of %d%% for CPU and %d%% for memory, scaled with the variance of their usage.\n",
+			rec.CPUMargin, rec.MemoryMargin)
+	}
+	if rec.ColdStart != nil {
+		fmt.Fprintf(w, "\nNote: %s.\n", coldStartNote(r))
+	}
+	if rec.Unblended != nil {
+		fmt.Fprintf(w, "\nNote: %s.\n", blendNote(r))
+	}
+	if note := spikeNote(r); note != "" {
+		fmt.Fprintf(w, "\nNote: %s.\n", note)
+	}
+	if rec.MemoryRequestRaised {
+		fmt.Fprintln(w, "\nNote: the memory request was raised to keep the limit within --max-limit-request-ratio of it.")
+	}
+	if len(flooredFields(rec)) > 0 {
+		fmt.Fprintln(w, "\nNote: values below the current settings were kept at them by --never-downsize; review downsizing manually.")
+	}
+	if rec.CPULimitProbeRaised && !r.OmitCPULimit && r.Probes != nil {
+		fmt.Fprintf(w, "\nNote: the CPU limit was raised to %.0f%% above peak CPU usage for the %s of container %s.\n",
+			recommender.ProbeHeadroom*100, r.Probes, r.Probes.Container)
+	}
+	for _, warning := range capWarnings(rec) {
+		fmt.Fprintf(w, "\nWarning: %s\n", warning)
+	}
+	for _, warning := range probeWarnings(r) {
+		fmt.Fprintf(w, "\nWarning: %s\n", warning)
+	}
+
+	if len(r.Iterations) > 0 {
+		printIterationTable(w, r.Iterations)
+	}
+
+	if len(r.Comparisons) > 0 {
+		printComparisonTable(w, r.Comparisons)
+	}
+
+	if r.VPA != nil {
+		printVPAComparison(w, r)
+	}
+
+	if rec.HPA != nil {
+		printHPATarget(w, r)
+	}
+
+	// Size each Deployment separately when the selector matched several
+	if len(r.Workloads) > 0 {
+		printWorkloadSummary(w, r)
+	}
+
+	if len(r.Containers) > 0 {
+		printContainerSummary(w, r)
+	}
+
+	if len(r.Validation) > 0 {
+		printPatchValidation(w, r.Validation)
+	}
+
+	savePatch(w, files, r)
+}
+
+// printCurrentSettings prints the current requests and limits, any inconsistency between them,
+// and the containers missing requests or limits if they were audited
+func printCurrentSettings(w io.Writer, r Result) {
+	fmt.Fprintln(w, "\nCurrent Settings:")
+	fmt.Fprintf(w, "CPU Request: %s\n", formatCPU(r.CurrentSettings.CPURequest, r.CurrentSettings.HasCPURequest))
+	fmt.Fprintf(w, "CPU Limit: %s\n", formatCPU(r.CurrentSettings.CPULimit, r.CurrentSettings.HasCPULimit))
+	fmt.Fprintf(w, "Memory Request: %s\n", formatMemory(r.CurrentSettings.MemoryRequest, r.CurrentSettings.HasMemoryRequest))
+	fmt.Fprintf(w, "Memory Limit: %s\n", formatMemory(r.CurrentSettings.MemoryLimit, r.CurrentSettings.HasMemoryLimit))
+	if len(r.CurrentSettings.IgnoredContainers) > 0 {
+		fmt.Fprintf(w, "Ignored containers: %s\n", strings.Join(r.CurrentSettings.IgnoredContainers, ", "))
+	}
+	for _, problem := range r.CurrentSettings.Inconsistencies() {
+		fmt.Fprintf(w, "Warning: %s\n", problem)
+	}
+	if r.Divergence != nil {
+		printDivergence(w, r.Divergence)
+	}
+	if r.LimitsAudited {
+		printMissingLimits(w, r.MissingLimits)
+	}
+}
+
+// PatchFiles returns the names of the YAML patch files PrintResults writes for the result in the
+// given format: one per Deployment when the selector matched several, and none for the formats
+// that don't write a patch
+func PatchFiles(r Result, format string) []string {
+	if format != "text" && format != "json" && format != "yaml" || r.Unchanged() {
+		return nil
+	}
+	if len(r.Workloads) == 0 {
+		return []string{r.fileName("resource-patch.yaml")}
+	}
+
+	names := make([]string, 0, len(r.Workloads))
+	for _, wl := range r.Workloads {
+		names = append(names, r.fileName(workloadPatchFile(wl.Deployment)))
+	}
+	return names
+}
+
+// savePatch generates and saves the YAML patch alongside the text and json output, one per
+// Deployment when the selector matched several
+func savePatch(w io.Writer, files FileWriter, r Result) {
+	saveHPAPatch(w, files, r)
+
+	if r.Unchanged() {
+		printNoChange(w, r, false)
+		return
+	}
+
+	if len(r.Workloads) > 0 {
+		saveWorkloadPatches(w, files, r, false)
+		return
+	}
+
 	patchContent, err := generateYAMLPatch(r)
 	if err != nil {
-		fmt.Printf("\nError generating YAML patch: %v\n", err)
+		fmt.Fprintf(w, "\nError generating YAML patch: %v\n", err)
 		return
 	}
 
-	err = os.WriteFile("resource-patch.yaml", []byte(patchContent), 0644)
+	fileName := r.fileName("resource-patch.yaml")
+	err = files.WriteFile(fileName, []byte(patchContent))
 	if err != nil {
-		fmt.Printf("\nError writing YAML patch file: %v\n", err)
+		fmt.Fprintf(w, "\nError writing YAML patch file: %v\n", err)
 		return
 	}
 
-	fmt.Println("\nYAML patch generated in 'resource-patch.yaml'")
+	fmt.Fprintf(w, "\nYAML patch generated in '%s'\n", fileName)
+}
+
+// marshalJSON encodes the data of the json output format, indented by two spaces unless compact,
+// in which case it is a single line for piping into jq or log ingestion
+func marshalJSON(v interface{}, compact bool) ([]byte, error) {
+	if compact {
+		return json.Marshal(v)
+	}
+	return json.MarshalIndent(v, "", "  ")
 }
 
 // printJSON displays the results in JSON format
-func printJSON(r Result) {
+func printJSON(w io.Writer, files FileWriter, r Result) {
+	// Marshal to JSON and print
+	jsonBytes, err := marshalJSON(jsonData(r), r.CompactJSON)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling JSON: %v\n", err)
+		return
+	}
+
+	fmt.Fprintln(w, string(jsonBytes))
+
+	savePatch(w, files, r)
+}
+
+// Summary returns the data of the json output format as JSON
+func Summary(r Result) ([]byte, error) {
+	return json.Marshal(jsonData(r))
+}
+
+// jsonData returns the data shown by the json output format
+func jsonData(r Result) map[string]interface{} {
 	avgCPU, avgMemory := metrics.CalculateAverageMetrics(r.Metrics)
 	peakCPU, peakMemory := metrics.CalculatePeakMetrics(r.Metrics)
+	cpuRank, memoryRank := currentRequestRanks(r)
 
 	// Create a map with the relevant data
 	data := map[string]interface{}{
+		"schemaVersion":  OutputSchemaVersion,
 		"loadTestTarget": r.Target,
 		"serviceName":    r.ServiceName,
 		"namespace":      r.Namespace,
@@ -107,88 +390,743 @@ func printJSON(r Result) {
 			"peakMemory": fmt.Sprintf("%.0fMi", peakMemory),
 			"avgMemory":  fmt.Sprintf("%.0fMi", avgMemory),
 		},
+		"currentRequestPercentile": map[string]interface{}{
+			"cpu":    cpuRank,
+			"memory": memoryRank,
+		},
+		"currentUtilization": currentUtilization(r),
 		"recommendations": map[string]interface{}{
 			"cpuRequest":    fmt.Sprintf("%.0fm", r.Recommendations.CPURequest*1000),
-			"cpuLimit":      fmt.Sprintf("%.0fm", r.Recommendations.CPULimit*1000),
+			"cpuLimit":      formatCPU(r.Recommendations.CPULimit, !r.OmitCPULimit),
 			"memoryRequest": fmt.Sprintf("%.0fMi", r.Recommendations.MemoryRequest),
-			"memoryLimit":   fmt.Sprintf("%.0fMi", r.Recommendations.MemoryLimit),
+			"memoryLimit":   formatMemory(r.Recommendations.MemoryLimit, !r.OmitMemoryLimit),
 		},
 	}
 
-	// Marshal to JSON and print
-	jsonBytes, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error marshaling JSON: %v\n", err)
+	if r.Unchanged() {
+		data["noChangeRecommended"] = true
+	}
+
+	if r.Duplicates > 0 {
+		data["duplicateSamples"] = r.Duplicates
+	}
+
+	if r.Partial > 0 {
+		data["partialSamples"] = r.Partial
+	}
+
+	if r.Replicas > 0 {
+		data["replicas"] = r.Replicas
+		data["rpsPerReplica"] = r.RPS / r.Replicas
+	}
+
+	if r.Recommendations.CPURequestClamped || r.Recommendations.MemoryRequestClamped {
+		data["downsizeClamped"] = map[string]interface{}{
+			"cpuRequest":    r.Recommendations.CPURequestClamped,
+			"memoryRequest": r.Recommendations.MemoryRequestClamped,
+		}
+	}
+
+	if r.Recommendations.MemoryRequestRaised {
+		data["memoryRequestRaised"] = true
+	}
+
+	if r.Recommendations.LimitsKept {
+		data["limitsKept"] = true
+	}
+	if r.Recommendations.CPURequestAtLimit || r.Recommendations.MemoryRequestAtLimit {
+		data["requestsAtLimit"] = map[string]interface{}{
+			"cpu":    r.Recommendations.CPURequestAtLimit,
+			"memory": r.Recommendations.MemoryRequestAtLimit,
+		}
+	}
+
+	if r.Recommendations.AdaptiveMargin {
+		data["adaptiveMargin"] = map[string]interface{}{
+			"cpu":    r.Recommendations.CPUMargin,
+			"memory": r.Recommendations.MemoryMargin,
+		}
+	}
+
+	if cs := r.Recommendations.ColdStart; cs != nil {
+		data["coldStart"] = map[string]interface{}{
+			"window":            cs.Window.String(),
+			"samples":           cs.Samples,
+			"peakCPU":           fmt.Sprintf("%.0fm", cs.PeakCPU*1000),
+			"peakMemory":        fmt.Sprintf("%.0fMi", cs.PeakMemory),
+			"cpuLimitRaised":    cs.CPULimitRaised && !r.OmitCPULimit,
+			"memoryLimitRaised": cs.MemoryLimitRaised && !r.OmitMemoryLimit,
+		}
+	}
+
+	if u := r.Recommendations.Unblended; u != nil {
+		data["historyBlend"] = map[string]interface{}{
+			"runs": r.Recommendations.BlendedRuns,
+			"unblended": map[string]interface{}{
+				"cpuRequest":    formatCPU(u.CPURequest, true),
+				"cpuLimit":      formatCPU(u.CPULimit, !r.OmitCPULimit),
+				"memoryRequest": formatMemory(u.MemoryRequest, true),
+				"memoryLimit":   formatMemory(u.MemoryLimit, !r.OmitMemoryLimit),
+			},
+		}
+	}
+
+	if floored := flooredFields(r.Recommendations); len(floored) > 0 {
+		data["flooredToCurrent"] = floored
+	}
+
+	if spikeNote(r) != "" {
+		data["memorySpike"] = fmt.Sprintf("%.0fMi", r.Recommendations.MemorySpike)
+	}
+
+	if r.Recommendations.CPUCapped || r.Recommendations.MemoryCapped {
+		data["capped"] = map[string]interface{}{
+			"cpu":    r.Recommendations.CPUCapped,
+			"memory": r.Recommendations.MemoryCapped,
+		}
+	}
+
+	if problems := r.CurrentSettings.Inconsistencies(); len(problems) > 0 {
+		data["currentSettingsWarnings"] = problems
+	}
+
+	if r.Divergence != nil {
+		data["settingsDivergence"] = r.Divergence
+	}
+
+	if r.Probes != nil {
+		data["probes"] = map[string]interface{}{
+			"container":      r.Probes.Container,
+			"probes":         r.Probes.Probes,
+			"timeout":        r.Probes.Timeout.String(),
+			"cpuLimitRaised": r.Recommendations.CPULimitProbeRaised,
+			"starvationRisk": r.Recommendations.ProbeStarvationRisk && !r.OmitCPULimit,
+		}
+	}
+
+	if len(r.Validation) > 0 {
+		data["patchValidation"] = r.Validation
+	}
+
+	if r.VPA != nil {
+		data["vpaComparison"] = vpaJSON(r)
+	}
+
+	if r.Recommendations.HPA != nil {
+		data["hpaTarget"] = hpaJSON(r)
+	}
+
+	if r.LimitsAudited {
+		containers := r.MissingLimits
+		if containers == nil {
+			containers = []kubernetes.MissingResources{}
+		}
+		data["missingLimits"] = map[string]interface{}{
+			"count":      len(containers),
+			"containers": containers,
+		}
+	}
+
+	if r.Recommendations.ThrottlingDetected {
+		data["throttlingDetected"] = true
+		data["throttleRatio"] = r.Recommendations.ThrottleRatio
+	}
+
+	if metrics.MemoryGrowing(r.Metrics) {
+		slope, rSquared := metrics.DetectMemoryGrowth(r.Metrics)
+		data["memoryGrowth"] = map[string]interface{}{
+			"slopeMiPerMinute": slope,
+			"rSquared":         rSquared,
+		}
+	}
+
+	if len(r.Workloads) > 0 {
+		data["workloads"] = workloadsJSON(r)
+	}
+
+	if len(r.Containers) > 0 {
+		data["containers"] = containersJSON(r)
+	}
+
+	if len(r.Nodes) > 0 {
+		data["nodes"] = r.Nodes
+	}
+
+	if r.App != nil {
+		data["appMetrics"] = map[string]interface{}{
+			"samples":        r.App.Samples,
+			"peakHeap":       fmt.Sprintf("%.0fMi", r.App.PeakHeap),
+			"averageHeap":    fmt.Sprintf("%.0fMi", r.App.AverageHeap),
+			"heapMax":        formatMemory(r.App.HeapMax, r.App.HeapMax > 0),
+			"gcCount":        r.App.GCCount,
+			"gcPauseTotal":   fmt.Sprintf("%.0fms", r.App.GCPauseTotal*1000),
+			"averageGCPause": fmt.Sprintf("%.1fms", r.App.AverageGCPause*1000),
+		}
+	}
+
+	if len(r.Iterations) > 0 {
+		iterations := make([]map[string]interface{}, 0, len(r.Iterations))
+		for _, it := range r.Iterations {
+			iteration := map[string]interface{}{
+				"iteration":     it.Iteration,
+				"samples":       it.Samples,
+				"cpuRequest":    fmt.Sprintf("%.0fm", it.Recommendations.CPURequest*1000),
+				"cpuLimit":      fmt.Sprintf("%.0fm", it.Recommendations.CPULimit*1000),
+				"memoryRequest": fmt.Sprintf("%.0fMi", it.Recommendations.MemoryRequest),
+				"memoryLimit":   fmt.Sprintf("%.0fMi", it.Recommendations.MemoryLimit),
+			}
+			if m := it.LoadTest; m != nil {
+				iteration["requests"] = m.Requests
+				iteration["successRate"] = m.SuccessRate()
+				iteration["p99"] = formatLatency(m.P99Latency())
+			}
+			iterations = append(iterations, iteration)
+		}
+		data["iterations"] = iterations
+	}
+
+	if len(r.Comparisons) > 0 {
+		comparisons := make([]map[string]interface{}, 0, len(r.Comparisons))
+		for _, c := range r.Comparisons {
+			comparisons = append(comparisons, map[string]interface{}{
+				"algorithm":     c.Algorithm,
+				"description":   c.Description,
+				"cpuRequest":    fmt.Sprintf("%.0fm", c.Recommendations.CPURequest*1000),
+				"cpuLimit":      fmt.Sprintf("%.0fm", c.Recommendations.CPULimit*1000),
+				"memoryRequest": fmt.Sprintf("%.0fMi", c.Recommendations.MemoryRequest),
+				"memoryLimit":   fmt.Sprintf("%.0fMi", c.Recommendations.MemoryLimit),
+			})
+		}
+		data["algorithmComparison"] = comparisons
+	}
+
+	return data
+}
+
+// printMissingLimits reports the audited containers that lack requests or limits
+func printMissingLimits(w io.Writer, missing []kubernetes.MissingResources) {
+	if len(missing) == 0 {
+		fmt.Fprintln(w, "Missing requests/limits: none")
+		return
+	}
+
+	fmt.Fprintf(w, "\n*** MISSING REQUESTS/LIMITS: %d container(s) ***\n", len(missing))
+	for _, m := range missing {
+		fmt.Fprintf(w, "  - %s: no %s\n", m.Container, strings.Join(m.Missing, ", "))
+	}
+	fmt.Fprintln(w, "Containers without limits can starve their neighbors, and without requests they are scheduled as if they used nothing.")
+}
+
+// divergenceWarning explains requests and limits that differ between the target's pods
+func divergenceWarning(d *kubernetes.SettingsDivergence) string {
+	return fmt.Sprintf("container %s runs with %d different resource settings across %d pods, e.g. mid-rollout; "+
+		"the current settings are read from one pod and may not be a reliable baseline", d.Container, d.Variants, d.Pods)
+}
+
+// printDivergence prints the divergence warning and the spread of each differing value
+func printDivergence(w io.Writer, d *kubernetes.SettingsDivergence) {
+	fmt.Fprintf(w, "Warning: %s:\n", divergenceWarning(d))
+	for _, spread := range d.Resources {
+		fmt.Fprintf(w, "  %s\n", formatSpread(spread))
+	}
+}
+
+// formatSpread formats how a request or limit varies across pods, e.g.
+// "cpu request: 100m to 200m, most pods 200m, 1 unset"
+func formatSpread(s kubernetes.ResourceSpread) string {
+	format := formatMemory
+	if strings.HasPrefix(s.Resource, "cpu") {
+		format = formatCPU
+	}
+	line := fmt.Sprintf("%s: %s to %s, most pods %s", s.Resource, format(s.Min, true), format(s.Max, true), format(s.Mode, true))
+	if s.Min == s.Max {
+		line = fmt.Sprintf("%s: %s", s.Resource, format(s.Min, true))
+	}
+	if s.Unset > 0 {
+		line += fmt.Sprintf(", %d unset", s.Unset)
+	}
+	return line
+}
+
+// capWarnings explains each resource held at a policy cap below what observed usage suggests,
+// a sign the workload needs more than the policy allows
+func capWarnings(rec recommender.Recommendations) []string {
+	var warnings []string
+	if rec.CPUCapped {
+		warnings = append(warnings, "the CPU recommendation is capped by --max-cpu below what observed usage suggests; the workload needs more CPU than policy allows")
+	}
+	if rec.MemoryCapped {
+		warnings = append(warnings, "the memory recommendation is capped by --max-memory below what observed usage suggests; the workload needs more memory than policy allows and may be OOM-killed")
+	}
+	return warnings
+}
+
+// atLimitWarning describes requests held at their kept limits, which usage would push past them
+func atLimitWarning(rec recommender.Recommendations) string {
+	var resources []string
+	if rec.CPURequestAtLimit {
+		resources = append(resources, "CPU")
+	}
+	if rec.MemoryRequestAtLimit {
+		resources = append(resources, "memory")
+	}
+	return fmt.Sprintf("the %s request was held at the current limit, which observed usage exceeds; raise the limit too",
+		strings.Join(resources, " and "))
+}
+
+// coldStartNote describes the cold start window and how the limits were sized around its peak
+func coldStartNote(r Result) string {
+	cs := r.Recommendations.ColdStart
+	var raised []string
+	if cs.CPULimitRaised && !r.OmitCPULimit {
+		raised = append(raised, "CPU")
+	}
+	if cs.MemoryLimitRaised && !r.OmitMemoryLimit {
+		raised = append(raised, "memory")
+	}
+	limits := "the limits already cover it"
+	if len(raised) > 0 {
+		limits = fmt.Sprintf("the %s limit was raised to cover it", strings.Join(raised, " and "))
+	}
+	return fmt.Sprintf("cold start (first %s, %d samples) peaked at %.0fm CPU and %.0fMi memory; "+
+		"requests are sized from the steady state after it, and %s", cs.Window, cs.Samples, cs.PeakCPU*1000, cs.PeakMemory, limits)
+}
+
+// blendNote describes the blending of the recommendation with earlier runs, and what this run
+// alone recommended
+func blendNote(r Result) string {
+	u := r.Recommendations.Unblended
+	return fmt.Sprintf("blended with %d earlier runs from the history; this run alone recommends CPU %s/%s and memory %s/%s (request/limit)",
+		r.Recommendations.BlendedRuns, formatCPU(u.CPURequest, true), formatCPU(u.CPULimit, !r.OmitCPULimit),
+		formatMemory(u.MemoryRequest, true), formatMemory(u.MemoryLimit, !r.OmitMemoryLimit))
+}
+
+// spikeNote describes a memory sample set aside as a spike when sizing the memory limit, or
+// returns "" if there was none or the limit isn't sized
+func spikeNote(r Result) string {
+	rec := r.Recommendations
+	if rec.MemorySpike == 0 || r.OmitMemoryLimit || rec.LimitsKept {
+		return ""
+	}
+	return fmt.Sprintf("a memory peak of %.0fMi was reached by too few samples (--max-memory-samples-for-peak) and set aside as a spike; "+
+		"the memory limit is sized from the highest sustained level", rec.MemorySpike)
+}
+
+// partialWarning explains samples for which metrics-server reported far fewer pods than were
+// running, so the averages may not represent every replica
+func partialWarning(r Result) string {
+	return fmt.Sprintf("%d samples covered fewer than %.0f%% of the running pods; metrics-server may have returned partial data",
+		r.Partial, kubernetes.MinMetricsCoverage*100)
+}
+
+// probeWarnings explains a recommended CPU limit that leaves too little headroom over peak
+// usage for the workload's probes, which throttling can delay past their timeout
+func probeWarnings(r Result) []string {
+	if !r.Recommendations.ProbeStarvationRisk || r.OmitCPULimit || r.Probes == nil {
+		return nil
+	}
+	return []string{fmt.Sprintf("the recommended CPU limit leaves less than %.0f%% headroom over peak CPU usage; "+
+		"GC or startup bursts may be throttled enough to time out the %s and restart container %s",
+		recommender.ProbeHeadroom*100, r.Probes, r.Probes.Container)}
+}
+
+// clampNote annotates a recommended request that was held back by the downsize guardrail
+func clampNote(clamped bool) string {
+	if !clamped {
+		return ""
+	}
+	return " (held back by --max-downsize)"
+}
+
+// floorNote annotates a recommended value that was kept at the current setting by the
+// never-downsize policy
+func floorNote(floored bool) string {
+	if !floored {
+		return ""
+	}
+	return " (kept at current by --never-downsize)"
+}
+
+// flooredFields lists the recommended values kept at the current setting by the never-downsize
+// policy, by their JSON names
+func flooredFields(rec recommender.Recommendations) []string {
+	var fields []string
+	if rec.CPURequestFloored {
+		fields = append(fields, "cpuRequest")
+	}
+	if rec.CPULimitFloored {
+		fields = append(fields, "cpuLimit")
+	}
+	if rec.MemoryRequestFloored {
+		fields = append(fields, "memoryRequest")
+	}
+	if rec.MemoryLimitFloored {
+		fields = append(fields, "memoryLimit")
+	}
+	return fields
+}
+
+// formatCPU formats a CPU value in millicores, or "not set" if the value is absent
+func formatCPU(cores float64, set bool) string {
+	if !set {
+		return "not set"
+	}
+	return fmt.Sprintf("%.0fm", cores*1000)
+}
+
+// formatMemory formats a memory value in Mi, or "not set" if the value is absent
+func formatMemory(mi float64, set bool) string {
+	if !set {
+		return "not set"
+	}
+	return fmt.Sprintf("%.0fMi", mi)
+}
+
+// printNodeSummary prints the saturation of the hosting nodes and warns if any was saturated,
+// since pod usage measured on a contended node understates what the pod needs
+func printNodeSummary(w io.Writer, nodes []metrics.NodeSummary) {
+	fmt.Fprintln(w, "\nHosting Node Saturation (of allocatable, peak/average):")
+	var saturated []string
+	for _, n := range nodes {
+		fmt.Fprintf(w, "%s: CPU %.0f%%/%.0f%%, Memory %.0f%%/%.0f%%\n", n.Node,
+			n.PeakCPUSaturation*100, n.AverageCPUSaturation*100,
+			n.PeakMemorySaturation*100, n.AverageMemorySaturation*100)
+		if n.Saturated() {
+			saturated = append(saturated, n.Node)
+		}
+	}
+
+	if len(saturated) > 0 {
+		fmt.Fprintf(w, "Warning: node(s) %s reached %.0f%% saturation during the run; the measured pod usage may be suppressed and the recommendation too low\n",
+			strings.Join(saturated, ", "), metrics.NodeSaturationThreshold*100)
+	}
+}
+
+// printAppSummary prints the heap usage and GC activity scraped from the application
+func printAppSummary(w io.Writer, app metrics.AppSummary) {
+	fmt.Fprintf(w, "\nApplication Runtime Metrics (%d samples):\n", app.Samples)
+	fmt.Fprintf(w, "Peak Heap: %.0fMi\n", app.PeakHeap)
+	fmt.Fprintf(w, "Average Heap: %.0fMi\n", app.AverageHeap)
+	fmt.Fprintf(w, "Heap Max: %s\n", formatMemory(app.HeapMax, app.HeapMax > 0))
+	fmt.Fprintf(w, "GC Cycles: %.0f (%.0fms paused, %.1fms per cycle)\n",
+		app.GCCount, app.GCPauseTotal*1000, app.AverageGCPause*1000)
+	if app.HeapMax > 0 && app.PeakHeap >= app.HeapMax*0.9 {
+		fmt.Fprintln(w, "The heap ran close to its maximum; the memory limit must leave room above the heap max for off-heap memory.")
+	}
+}
+
+// printIterationTable prints the recommendation each iteration would have produced on its own,
+// alongside the load it was measured under
+func printIterationTable(w io.Writer, iterations []IterationResult) {
+	fmt.Fprintln(w, "\nPer-Iteration Recommendations (the settings above combine all iterations):")
+	fmt.Fprintf(w, "%-10s %-8s %-12s %-12s %-15s %-13s %-9s %-9s %s\n",
+		"Iteration", "Samples", "CPU Request", "CPU Limit", "Memory Request", "Memory Limit", "Requests", "Success", "p99")
+	for _, it := range iterations {
+		requests, success, p99 := "-", "-", "-"
+		if m := it.LoadTest; m != nil {
+			requests = fmt.Sprint(m.Requests)
+			success = fmt.Sprintf("%.2f%%", m.SuccessRate())
+			p99 = formatLatency(m.P99Latency())
+		}
+		fmt.Fprintf(w, "%-10d %-8d %-12s %-12s %-15s %-13s %-9s %-9s %s\n",
+			it.Iteration, it.Samples,
+			fmt.Sprintf("%.0fm", it.Recommendations.CPURequest*1000),
+			fmt.Sprintf("%.0fm", it.Recommendations.CPULimit*1000),
+			fmt.Sprintf("%.0fMi", it.Recommendations.MemoryRequest),
+			fmt.Sprintf("%.0fMi", it.Recommendations.MemoryLimit),
+			requests, success, p99)
+	}
+}
+
+// printComparisonTable prints the per-algorithm recommendations side by side
+func printComparisonTable(w io.Writer, comparisons []recommender.Comparison) {
+	fmt.Fprintln(w, "\nAlgorithm Comparison:")
+	fmt.Fprintf(w, "%-12s %-12s %-12s %-15s %-15s %s\n",
+		"Algorithm", "CPU Request", "CPU Limit", "Memory Request", "Memory Limit", "Basis")
+	for _, c := range comparisons {
+		fmt.Fprintf(w, "%-12s %-12s %-12s %-15s %-15s %s\n",
+			c.Algorithm,
+			fmt.Sprintf("%.0fm", c.Recommendations.CPURequest*1000),
+			fmt.Sprintf("%.0fm", c.Recommendations.CPULimit*1000),
+			fmt.Sprintf("%.0fMi", c.Recommendations.MemoryRequest),
+			fmt.Sprintf("%.0fMi", c.Recommendations.MemoryLimit),
+			c.Description)
+	}
+}
+
+// printYAML displays and saves the results in YAML format (the patch file)
+func printYAML(w io.Writer, files FileWriter, r Result) {
+	if r.Unchanged() {
+		printSchemaComment(w)
+		printNoChange(w, r, true)
+		printRankComments(w, r)
+		saveHPAPatch(w, files, r)
 		return
 	}
 
-	fmt.Println(string(jsonBytes))
+	if len(r.Workloads) > 0 {
+		saveWorkloadPatches(w, files, r, true)
+		saveHPAPatch(w, files, r)
+		return
+	}
 
-	// Generate and save YAML if using json output mode
 	patchContent, err := generateYAMLPatch(r)
 	if err != nil {
-		fmt.Printf("\nError generating YAML patch: %v\n", err)
+		fmt.Fprintf(w, "Error generating YAML patch: %v\n", err)
 		return
 	}
 
-	err = os.WriteFile("resource-patch.yaml", []byte(patchContent), 0644)
+	printSchemaComment(w)
+	fmt.Fprintln(w, patchContent)
+	printRankComments(w, r)
+
+	fileName := r.fileName("resource-patch.yaml")
+	err = files.WriteFile(fileName, []byte(patchContent))
 	if err != nil {
-		fmt.Printf("\nError writing YAML patch file: %v\n", err)
+		fmt.Fprintf(w, "\nError writing YAML patch file: %v\n", err)
 		return
 	}
 
-	fmt.Println("\nYAML patch generated in 'resource-patch.yaml'")
+	fmt.Fprintf(w, "\nYAML patch saved to '%s'\n", fileName)
+	saveHPAPatch(w, files, r)
 }
 
-// printYAML displays and saves the results in YAML format (the patch file)
-func printYAML(r Result) {
-	patchContent, err := generateYAMLPatch(r)
-	if err != nil {
-		fmt.Printf("Error generating YAML patch: %v\n", err)
+// printHelm displays and saves the recommendations as a Helm values override fragment
+func printHelm(w io.Writer, files FileWriter, r Result) {
+	if r.Unchanged() {
+		printSchemaComment(w)
+		printNoChange(w, r, true)
+		printRankComments(w, r)
 		return
 	}
 
-	fmt.Println(patchContent)
+	valuesContent := generateHelmValues(r)
 
-	err = os.WriteFile("resource-patch.yaml", []byte(patchContent), 0644)
+	printSchemaComment(w)
+	fmt.Fprintln(w, valuesContent)
+	printRankComments(w, r)
+
+	fileName := r.fileName("resource-values.yaml")
+	err := files.WriteFile(fileName, []byte(valuesContent))
 	if err != nil {
-		fmt.Printf("\nError writing YAML patch file: %v\n", err)
+		fmt.Fprintf(w, "\nError writing Helm values file: %v\n", err)
 		return
 	}
 
-	fmt.Println("\nYAML patch saved to 'resource-patch.yaml'")
+	fmt.Fprintf(w, "\nHelm values override saved to '%s'\n", fileName)
+}
+
+// DefaultHelmValuesPath is the values path used when none is configured
+const DefaultHelmValuesPath = "resources"
+
+// generateHelmValues renders the recommended resources nested under the configured values path,
+// e.g. "app.resources" produces app: -> resources: -> requests/limits
+func generateHelmValues(r Result) string {
+	path := r.HelmValuesPath
+	if path == "" {
+		path = DefaultHelmValuesPath
+	}
+
+	var b strings.Builder
+	indent := ""
+	for _, key := range strings.Split(path, ".") {
+		fmt.Fprintf(&b, "%s%s:\n", indent, key)
+		indent += "  "
+	}
+
+	writeResources(&b, indent, r)
+
+	return b.String()
+}
+
+// currentRequestRanks returns where the current CPU and memory requests sit within the
+// observed usage distribution, as percentile ranks (0-100)
+func currentRequestRanks(r Result) (float64, float64) {
+	cpuRank := metrics.PercentileRank(metrics.CPUValues(r.Metrics), r.CurrentSettings.CPURequest)
+	memoryRank := metrics.PercentileRank(metrics.MemoryValues(r.Metrics), r.CurrentSettings.MemoryRequest)
+	return cpuRank, memoryRank
+}
+
+// printSchemaComment prints the output schema version as a YAML comment, which keeps the
+// printed manifest or values applicable as is
+func printSchemaComment(w io.Writer) {
+	fmt.Fprintf(w, "# pod-rightsizer schemaVersion: %s\n", OutputSchemaVersion)
+}
+
+// printRankComments prints the notes and warnings as YAML comments, so YAML output stays valid
+func printRankComments(w io.Writer, r Result) {
+	cpuRank, memoryRank := currentRequestRanks(r)
+	fmt.Fprintf(w, "# Current CPU request is at the %s percentile of observed usage\n", ordinal(cpuRank))
+	fmt.Fprintf(w, "# Current memory request is at the %s percentile of observed usage\n", ordinal(memoryRank))
+	for _, line := range utilizationLines(r) {
+		fmt.Fprintf(w, "# Current utilization of %s\n", line)
+	}
+	if r.Recommendations.ThrottlingDetected {
+		fmt.Fprintf(w, "# CPU throttling detected: %.0f%% of samples were at the current CPU limit, which was raised\n",
+			r.Recommendations.ThrottleRatio*100)
+	}
+	if floored := flooredFields(r.Recommendations); len(floored) > 0 {
+		fmt.Fprintf(w, "# Kept at current by --never-downsize: %s\n", strings.Join(floored, ", "))
+	}
+	if r.Recommendations.LimitsKept {
+		fmt.Fprintln(w, "# Only requests were sized (--requests-only); the current limits are left unchanged")
+	}
+	if r.Recommendations.CPURequestAtLimit || r.Recommendations.MemoryRequestAtLimit {
+		fmt.Fprintf(w, "# Warning: %s\n", atLimitWarning(r.Recommendations))
+	}
+	if r.Recommendations.ColdStart != nil {
+		fmt.Fprintf(w, "# Note: %s\n", coldStartNote(r))
+	}
+	if r.Recommendations.Unblended != nil {
+		fmt.Fprintf(w, "# Note: %s\n", blendNote(r))
+	}
+	if note := spikeNote(r); note != "" {
+		fmt.Fprintf(w, "# Note: %s\n", note)
+	}
+	for _, warning := range capWarnings(r.Recommendations) {
+		fmt.Fprintf(w, "# Warning: %s\n", warning)
+	}
+	if r.Partial > 0 {
+		fmt.Fprintf(w, "# Warning: %s\n", partialWarning(r))
+	}
+	for _, warning := range probeWarnings(r) {
+		fmt.Fprintf(w, "# Warning: %s\n", warning)
+	}
+	for _, problem := range r.CurrentSettings.Inconsistencies() {
+		fmt.Fprintf(w, "# Warning: %s\n", problem)
+	}
+	if r.Divergence != nil {
+		fmt.Fprintf(w, "# Warning: %s\n", divergenceWarning(r.Divergence))
+		for _, spread := range r.Divergence.Resources {
+			fmt.Fprintf(w, "#   %s\n", formatSpread(spread))
+		}
+	}
+	for _, m := range r.MissingLimits {
+		fmt.Fprintf(w, "# Warning: container %s sets no %s\n", m.Container, strings.Join(m.Missing, ", "))
+	}
+	for _, warning := range vpaWarnings(r) {
+		fmt.Fprintf(w, "# Warning: %s\n", warning)
+	}
+	if r.Recommendations.HPA != nil {
+		fmt.Fprintf(w, "# Note: %s\n", hpaNote(r))
+	}
+	for _, warning := range hpaWarnings(r) {
+		fmt.Fprintf(w, "# Warning: %s\n", warning)
+	}
+	for _, v := range r.Validation {
+		if !v.Accepted {
+			fmt.Fprintf(w, "# Warning: the API server rejected the patch of %s in a dry run: %s\n", v.Deployment, v.Error)
+		}
+	}
+	if metrics.MemoryGrowing(r.Metrics) {
+		slope, _ := metrics.DetectMemoryGrowth(r.Metrics)
+		fmt.Fprintf(w, "# Memory grew steadily by %.1fMi/min, possibly a leak; run longer to confirm the memory recommendation\n", slope)
+	}
+}
+
+// ordinal formats a rounded percentile as an English ordinal (1st, 2nd, 45th, ...)
+func ordinal(value float64) string {
+	n := int(value + 0.5)
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
 }
 
 // generateYAMLPatch creates a YAML patch for the resources
 func generateYAMLPatch(r Result) (string, error) {
 	// Create a simple deployment patch with the new resource settings
-	patch := fmt.Sprintf(`apiVersion: apps/v1
+	var b strings.Builder
+	fmt.Fprintf(&b, `apiVersion: apps/v1
 kind: Deployment
 metadata:
   namespace: %s
-  name: %s # This assumes the deployment name matches the service name
+  name: %s
 spec:
   template:
     spec:
-      containers:
-      - name: app # This assumes the container name is "app"
-        resources:
-          requests:
-            cpu: "%dm"
-            memory: "%dMi"
-          limits:
-            cpu: "%dm"
-            memory: "%dMi"
 `,
 		r.Namespace,
-		extractResourceName(r.ServiceName),
-		int(r.Recommendations.CPURequest*1000),
-		int(r.Recommendations.MemoryRequest),
-		int(r.Recommendations.CPULimit*1000),
-		int(r.Recommendations.MemoryLimit),
+		patchName(r),
 	)
+	writeContainers(&b, "      ", r)
+
+	return b.String(), nil
+}
 
-	return patch, nil
+// writeResources writes the recommended requests and limits blocks at the given indent.
+// Kept limits and omitted limits are left out entirely, or set to null when the current settings have one,
+// so that applying the patch removes the existing limit. Resources other than cpu and memory
+// are written with their current values, so applying the patch doesn't strip them.
+func writeResources(b *strings.Builder, indent string, r Result) {
+	fmt.Fprintf(b, "%srequests:\n", indent)
+	fmt.Fprintf(b, "%s  cpu: \"%dm\"\n", indent, int(r.Recommendations.CPURequest*1000))
+	fmt.Fprintf(b, "%s  memory: \"%dMi\"\n", indent, int(r.Recommendations.MemoryRequest))
+	writeOtherResources(b, indent, r.CurrentSettings.OtherRequests)
+
+	// Kept limits are left out, so applying the patch leaves the existing ones in place
+	if r.Recommendations.LimitsKept {
+		return
+	}
+
+	writeCPULimit := !r.OmitCPULimit || r.CurrentSettings.HasCPULimit
+	writeMemoryLimit := !r.OmitMemoryLimit || r.CurrentSettings.HasMemoryLimit
+	if !writeCPULimit && !writeMemoryLimit && len(r.CurrentSettings.OtherLimits) == 0 {
+		return
+	}
+
+	fmt.Fprintf(b, "%slimits:\n", indent)
+	if r.OmitCPULimit && r.CurrentSettings.HasCPULimit {
+		fmt.Fprintf(b, "%s  cpu: null # removes the existing CPU limit\n", indent)
+	} else if writeCPULimit {
+		fmt.Fprintf(b, "%s  cpu: \"%dm\"\n", indent, int(r.Recommendations.CPULimit*1000))
+	}
+	if r.OmitMemoryLimit && r.CurrentSettings.HasMemoryLimit {
+		fmt.Fprintf(b, "%s  memory: null # removes the existing memory limit\n", indent)
+	} else if writeMemoryLimit {
+		fmt.Fprintf(b, "%s  memory: \"%dMi\"\n", indent, int(r.Recommendations.MemoryLimit))
+	}
+	writeOtherResources(b, indent, r.CurrentSettings.OtherLimits)
+}
+
+// writeOtherResources writes the unchanged quantities of resources other than cpu and memory,
+// sorted by name so the output is stable
+func writeOtherResources(b *strings.Builder, indent string, resources map[string]string) {
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(b, "%s  %s: \"%s\"\n", indent, name, resources[name])
+	}
+}
+
+// patchName returns the name of the Deployment a YAML patch targets, followed by a comment
+// if the name is only guessed from the service name
+func patchName(r Result) string {
+	name, guessed := deploymentName(r)
+	if guessed {
+		return name + " # This assumes the deployment name matches the service name"
+	}
+	return name
+}
+
+// deploymentName returns the name of the Deployment to patch and whether it's only guessed
+// from the service name
+func deploymentName(r Result) (string, bool) {
+	if r.Deployment != "" {
+		return r.Deployment, false
+	}
+	return extractResourceName(r.ServiceName), true
 }
 
 // extractResourceName extracts a resource name from a URL or label selector
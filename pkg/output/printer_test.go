@@ -0,0 +1,826 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/kubernetes"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/loadtest"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/recommender"
+)
+
+// memFiles captures generated files in memory
+type memFiles map[string]string
+
+func (m memFiles) WriteFile(name string, data []byte) error {
+	m[name] = string(data)
+	return nil
+}
+
+func testResult() Result {
+	return Result{
+		Target:      "http://myservice:8080",
+		ServiceName: "myservice",
+		Namespace:   "default",
+		RPS:         50,
+		CurrentSettings: kubernetes.ResourceSettings{
+			CPURequest: 0.1, CPULimit: 0.2, MemoryRequest: 128, MemoryLimit: 256,
+			HasCPURequest: true, HasCPULimit: true, HasMemoryRequest: true, HasMemoryLimit: true,
+		},
+		Metrics: []metrics.ResourceMetrics{
+			{CPUUsage: 0.08, MemoryUsage: 90},
+			{CPUUsage: 0.12, MemoryUsage: 110},
+		},
+		Recommendations: recommender.Recommendations{
+			CPURequest: 0.12, CPULimit: 0.15, MemoryRequest: 120, MemoryLimit: 140,
+		},
+	}
+}
+
+func TestPrintResultsWritesToWriter(t *testing.T) {
+	for _, format := range []string{"text", "json", "yaml"} {
+		var out bytes.Buffer
+		files := memFiles{}
+		PrintResults(&out, files, testResult(), format)
+
+		patch, ok := files["resource-patch.yaml"]
+		if !ok {
+			t.Errorf("%s: resource-patch.yaml was not written", format)
+			continue
+		}
+		if !strings.Contains(patch, `cpu: "120m"`) || !strings.Contains(patch, `memory: "140Mi"`) {
+			t.Errorf("%s: unexpected patch content:\n%s", format, patch)
+		}
+		if !strings.Contains(out.String(), "120m") {
+			t.Errorf("%s: output does not contain the recommended CPU request:\n%s", format, out.String())
+		}
+	}
+}
+
+func TestPrintResultsHelm(t *testing.T) {
+	var out bytes.Buffer
+	files := memFiles{}
+	r := testResult()
+	r.HelmValuesPath = "app.resources"
+	PrintResults(&out, files, r, "helm")
+
+	values := files["resource-values.yaml"]
+	if !strings.HasPrefix(values, "app:\n  resources:\n    requests:\n") {
+		t.Errorf("unexpected helm values:\n%s", values)
+	}
+	if !strings.Contains(out.String(), values) {
+		t.Errorf("helm values were not printed:\n%s", out.String())
+	}
+}
+
+func TestPrintResultsKubectl(t *testing.T) {
+	var out bytes.Buffer
+	r := testResult()
+	r.Deployment = "my'app"
+	r.OmitCPULimit = true
+	PrintResults(&out, memFiles{}, r, "kubectl")
+
+	want := "# Current utilization of CPU: 100% average / 120% peak of request, 50% average / 60% peak of limit\n" +
+		"# Current utilization of Memory: 78% average / 86% peak of request, 39% average / 43% peak of limit\n" +
+		`kubectl patch deployment 'my'\''app' -n 'default' --type strategic -p ` +
+		`'{"spec":{"template":{"spec":{"containers":[{"name":"app","resources":` +
+		`{"limits":{"cpu":null,"memory":"140Mi"},"requests":{"cpu":"120m","memory":"120Mi"}}}]}}}}'` + "\n"
+	if out.String() != want {
+		t.Errorf("unexpected kubectl command:\ngot:  %s\nwant: %s", out.String(), want)
+	}
+}
+
+func TestPrintMultiResults(t *testing.T) {
+	first, second := testResult(), testResult()
+	second.ServiceName = "app=orders"
+	second.Namespace = "shop"
+	second.Recommendations.CPURequest = 0.3
+	first.FilePrefix = TargetFilePrefix(first.Namespace, first.ServiceName)
+	second.FilePrefix = TargetFilePrefix(second.Namespace, second.ServiceName)
+	results := []Result{first, second}
+
+	var out bytes.Buffer
+	files := memFiles{}
+	PrintMultiResults(&out, files, results, "json")
+	for _, name := range []string{"default_myservice_resource-patch.yaml", "shop_app-orders_resource-patch.yaml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("json: %s was not written (got %v)", name, files)
+		}
+	}
+	if !strings.HasPrefix(out.String(), "[") || !strings.Contains(out.String(), `"300m"`) {
+		t.Errorf("json: expected an array covering both targets:\n%s", out.String())
+	}
+
+	out.Reset()
+	PrintMultiResults(&out, memFiles{}, results, "prometheus")
+	if got := strings.Count(out.String(), "# TYPE pod_rightsizer_recommended_cpu_request_cores gauge"); got != 1 {
+		t.Errorf("prometheus: metric family declared %d times, want once", got)
+	}
+	if !strings.Contains(out.String(), `pod_rightsizer_recommended_cpu_request_cores{service="app=orders",namespace="shop"} 0.3`) {
+		t.Errorf("prometheus: missing sample for the second target:\n%s", out.String())
+	}
+}
+
+func TestRequestsOnlyPatch(t *testing.T) {
+	r := testResult()
+	r.Recommendations.LimitsKept = true
+	r.Recommendations.CPULimit, r.Recommendations.MemoryLimit = 0.2, 256
+
+	files := memFiles{}
+	var out bytes.Buffer
+	PrintResults(&out, files, r, "yaml")
+	patch := files["resource-patch.yaml"]
+	if !strings.Contains(patch, `cpu: "120m"`) || strings.Contains(patch, "limits:") {
+		t.Errorf("yaml: expected requests without limits:\n%s", patch)
+	}
+
+	out.Reset()
+	PrintResults(&out, memFiles{}, r, "kubectl")
+	if !strings.Contains(out.String(), `"requests"`) || strings.Contains(out.String(), `"limits"`) {
+		t.Errorf("kubectl: expected requests without limits:\n%s", out.String())
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	result := func(name string, cpuRequest, recommended float64) Result {
+		r := testResult()
+		r.ServiceName = name
+		r.CurrentSettings.CPURequest = cpuRequest
+		r.Recommendations.CPURequest = recommended
+		return r
+	}
+	names := func(results []Result) string {
+		var names []string
+		for _, r := range results {
+			names = append(names, r.ServiceName)
+		}
+		return strings.Join(names, ",")
+	}
+
+	// b and c tie on reclaimable CPU and keep name order either way
+	results := []Result{result("c", 1, 0.5), result("a", 0.2, 0.1), result("b", 2, 1.5), result("d", 4, 1)}
+	SortResults(results, SortByReclaimableCPU, false)
+	if got := names(results); got != "d,b,c,a" {
+		t.Errorf("reclaimable-cpu desc: got %s, want d,b,c,a", got)
+	}
+	SortResults(results, SortByReclaimableCPU, true)
+	if got := names(results); got != "a,b,c,d" {
+		t.Errorf("reclaimable-cpu asc: got %s, want a,b,c,d", got)
+	}
+	// a and c both request twice the recommendation
+	SortResults(results, SortByOverprovision, false)
+	if got := names(results); got != "d,a,c,b" {
+		t.Errorf("overprovision desc: got %s, want d,a,c,b", got)
+	}
+}
+
+func TestPrintResultsSchemaVersion(t *testing.T) {
+	var out bytes.Buffer
+	PrintResults(&out, memFiles{}, testResult(), "json")
+	if !strings.Contains(out.String(), `"schemaVersion": "`+OutputSchemaVersion+`"`) {
+		t.Errorf("json: schemaVersion missing:\n%s", out.String())
+	}
+
+	for _, format := range []string{"yaml", "helm"} {
+		out.Reset()
+		files := memFiles{}
+		PrintResults(&out, files, testResult(), format)
+		if !strings.HasPrefix(out.String(), "# pod-rightsizer schemaVersion: "+OutputSchemaVersion+"\n") {
+			t.Errorf("%s: schema comment missing:\n%s", format, out.String())
+		}
+		for name, content := range files {
+			if strings.Contains(content, "schemaVersion") {
+				t.Errorf("%s: %s should stay a plain manifest:\n%s", format, name, content)
+			}
+		}
+	}
+}
+
+func TestPrintResultsMissingLimits(t *testing.T) {
+	r := testResult()
+	r.LimitsAudited = true
+	r.MissingLimits = []kubernetes.MissingResources{
+		{Container: "app", Missing: []string{"cpu limit", "memory limit"}},
+	}
+
+	var out bytes.Buffer
+	PrintResults(&out, memFiles{}, r, "text")
+	if !strings.Contains(out.String(), "MISSING REQUESTS/LIMITS: 1 container(s)") ||
+		!strings.Contains(out.String(), "app: no cpu limit, memory limit") {
+		t.Errorf("text: missing limits not reported:\n%s", out.String())
+	}
+
+	out.Reset()
+	PrintResults(&out, memFiles{}, r, "json")
+	if !strings.Contains(out.String(), `"count": 1`) {
+		t.Errorf("json: missing limits count not reported:\n%s", out.String())
+	}
+
+	out.Reset()
+	r.MissingLimits = nil
+	PrintResults(&out, memFiles{}, r, "json")
+	if !strings.Contains(out.String(), `"count": 0`) {
+		t.Errorf("json: an audit without findings should report a zero count:\n%s", out.String())
+	}
+}
+
+func TestPrintResultsFlooredToCurrent(t *testing.T) {
+	r := testResult()
+	r.Recommendations.CPURequestFloored = true
+	r.Recommendations.MemoryLimitFloored = true
+
+	var out bytes.Buffer
+	PrintResults(&out, memFiles{}, r, "text")
+	if strings.Count(out.String(), "(kept at current by --never-downsize)") != 2 {
+		t.Errorf("text: floored fields not marked:\n%s", out.String())
+	}
+
+	out.Reset()
+	PrintResults(&out, memFiles{}, r, "yaml")
+	if !strings.Contains(out.String(), "# Kept at current by --never-downsize: cpuRequest, memoryLimit") {
+		t.Errorf("yaml: floored fields not listed:\n%s", out.String())
+	}
+}
+
+func TestPrintResultsReplicaScaledRPS(t *testing.T) {
+	r := testResult()
+	r.RPS, r.Replicas = 200, 10
+
+	var out bytes.Buffer
+	PrintResults(&out, memFiles{}, r, "text")
+	if !strings.Contains(out.String(), "200 RPS for 0s (20 RPS per replica x 10 replicas)") {
+		t.Errorf("text: effective RPS not reported:\n%s", out.String())
+	}
+
+	out.Reset()
+	PrintResults(&out, memFiles{}, r, "json")
+	if !strings.Contains(out.String(), `"rpsPerReplica": 20`) || !strings.Contains(out.String(), `"replicas": 10`) {
+		t.Errorf("json: replica scaling not reported:\n%s", out.String())
+	}
+}
+
+func TestPatchResourceName(t *testing.T) {
+	r := testResult()
+	patch, err := generateYAMLPatch(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(patch, "name: myservice # This assumes") {
+		t.Errorf("patch without a Deployment name does not flag the guessed name:\n%s", patch)
+	}
+
+	r.Deployment = "myservice-backend"
+	patch, err = generateYAMLPatch(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(patch, "  name: myservice-backend\n") {
+		t.Errorf("patch does not target the named Deployment:\n%s", patch)
+	}
+}
+
+func TestReadHistory(t *testing.T) {
+	for _, name := range []string{"history.jsonl", "history.csv"} {
+		path := filepath.Join(t.TempDir(), name)
+
+		other := testResult()
+		other.ServiceName = "other"
+		for _, r := range []Result{testResult(), other, testResult()} {
+			if err := AppendHistory(path, r); err != nil {
+				t.Fatalf("%s: AppendHistory: %v", name, err)
+			}
+		}
+
+		records, err := ReadHistory(path, "default", "myservice")
+		if err != nil {
+			t.Fatalf("%s: ReadHistory: %v", name, err)
+		}
+		if len(records) != 2 {
+			t.Fatalf("%s: got %d records, want the 2 of myservice", name, len(records))
+		}
+		want := recommender.Record{CPURequest: 0.12, CPULimit: 0.15, MemoryRequest: 120, MemoryLimit: 140}
+		if got := records[1].Recommendation(); got != want {
+			t.Errorf("%s: got %+v, want %+v", name, got, want)
+		}
+	}
+
+	if records, err := ReadHistory(filepath.Join(t.TempDir(), "missing.csv"), "default", "myservice"); err != nil || records != nil {
+		t.Errorf("missing file: got %v, %v, want no records", records, err)
+	}
+}
+
+func TestHistoryBlendsRawRecommendations(t *testing.T) {
+	for _, name := range []string{"history.jsonl", "history.csv"} {
+		path := filepath.Join(t.TempDir(), name)
+
+		// Each run recommends its CPU request, blended with the runs before it at a decay of 0.5
+		var blended float64
+		for _, cpu := range []float64{0.1, 0.2, 0.2} {
+			records, err := ReadHistory(path, "default", "myservice")
+			if err != nil {
+				t.Fatalf("%s: ReadHistory: %v", name, err)
+			}
+			var history []recommender.Record
+			for _, record := range records {
+				history = append(history, record.Recommendation())
+			}
+
+			r := testResult()
+			r.Recommendations = recommender.BlendWithHistory(recommender.Recommendations{
+				CPURequest: cpu, CPULimit: cpu, MemoryRequest: 100, MemoryLimit: 100,
+			}, history, 0.5)
+			blended = r.Recommendations.CPURequest
+			if err := AppendHistory(path, r); err != nil {
+				t.Fatalf("%s: AppendHistory: %v", name, err)
+			}
+		}
+
+		// The last run is blended with the runs' own 200m and 100m, not the second run's blend:
+		// (200 + 0.5×200 + 0.25×100) / 1.75
+		if want := 0.325 / 1.75; math.Abs(blended-want) > 0.0001 {
+			t.Errorf("%s: got a blended CPU request of %.4f, want %.4f", name, blended, want)
+		}
+	}
+}
+
+func TestPatchKeepsOtherResources(t *testing.T) {
+	r := testResult()
+	r.CurrentSettings.OtherRequests = map[string]string{"hugepages-2Mi": "64Mi"}
+	r.CurrentSettings.OtherLimits = map[string]string{"nvidia.com/gpu": "1", "hugepages-2Mi": "64Mi"}
+
+	patch, err := generateYAMLPatch(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `          requests:
+            cpu: "120m"
+            memory: "120Mi"
+            hugepages-2Mi: "64Mi"
+          limits:
+            cpu: "150m"
+            memory: "140Mi"
+            hugepages-2Mi: "64Mi"
+            nvidia.com/gpu: "1"
+`
+	if !strings.HasSuffix(patch, want) {
+		t.Errorf("patch does not keep the other resources:\n%s", patch)
+	}
+
+	command, err := generateKubectlPatch(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(command, `"nvidia.com/gpu":"1"`) {
+		t.Errorf("kubectl patch does not keep the GPU limit:\n%s", command)
+	}
+}
+
+func TestPrintResultsInconsistentSettings(t *testing.T) {
+	r := testResult()
+	r.CurrentSettings.CPURequest, r.CurrentSettings.CPULimit = 0.5, 0.3
+
+	for _, format := range []string{"text", "json", "yaml"} {
+		var out bytes.Buffer
+		PrintResults(&out, memFiles{}, r, format)
+		if !strings.Contains(out.String(), "current CPU request 500m exceeds the CPU limit 300m") {
+			t.Errorf("%s: request above the limit not reported:\n%s", format, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	PrintResults(&out, memFiles{}, testResult(), "text")
+	if strings.Contains(out.String(), "exceeds the") {
+		t.Errorf("consistent settings reported as inconsistent:\n%s", out.String())
+	}
+}
+
+func TestMultiContainerPatch(t *testing.T) {
+	r := testResult()
+	r.Containers = []ContainerResult{
+		{
+			Name:            "app",
+			CurrentSettings: r.CurrentSettings,
+			Recommendations: recommender.Recommendations{CPURequest: 0.25, CPULimit: 0.5, MemoryRequest: 200, MemoryLimit: 300},
+		},
+		{
+			Name:            "worker",
+			CurrentSettings: kubernetes.ResourceSettings{OtherLimits: map[string]string{"nvidia.com/gpu": "1"}},
+			Recommendations: recommender.Recommendations{CPURequest: 0.1, CPULimit: 0.2, MemoryRequest: 64, MemoryLimit: 96},
+			OmitCPULimit:    true,
+		},
+	}
+
+	patch, err := generateYAMLPatch(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want, err := os.ReadFile("testdata/multi-container-patch.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patch != string(want) {
+		t.Errorf("unexpected multi-container patch:\n%s\nwant:\n%s", patch, want)
+	}
+
+	command, err := generateKubectlPatch(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(command, `"name":"app"`) || !strings.Contains(command, `"name":"worker"`) {
+		t.Errorf("kubectl patch does not list every container:\n%s", command)
+	}
+}
+
+func TestPrintResultsPatchValidation(t *testing.T) {
+	r := testResult()
+	r.Validation = []PatchValidation{{Deployment: "myservice", Error: "exceeds the LimitRange maximum"}}
+
+	for _, format := range []string{"text", "json", "yaml"} {
+		var out bytes.Buffer
+		PrintResults(&out, memFiles{}, r, format)
+		if !strings.Contains(out.String(), "exceeds the LimitRange maximum") {
+			t.Errorf("%s: rejected patch not reported:\n%s", format, out.String())
+		}
+	}
+
+	patches, err := Patches(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(patches) != 1 || patches[0].Deployment != "myservice" || !strings.Contains(string(patches[0].Patch), `"cpu":"120m"`) {
+		t.Errorf("unexpected patches: %+v", patches)
+	}
+}
+
+func TestPrintResultsPartialSamples(t *testing.T) {
+	r := testResult()
+	r.Partial = 2
+
+	for _, format := range []string{"text", "json", "yaml"} {
+		var out bytes.Buffer
+		PrintResults(&out, memFiles{}, r, format)
+		if !strings.Contains(out.String(), "partial") {
+			t.Errorf("%s: partial samples not reported:\n%s", format, out.String())
+		}
+	}
+}
+
+func TestPrintResultsVPAComparison(t *testing.T) {
+	r := testResult()
+	r.VPA = &kubernetes.VPARecommendation{VPA: "myservice-vpa", Container: "app", CPUTarget: 0.5, MemoryTarget: 128}
+
+	for _, format := range []string{"text", "json", "yaml"} {
+		var out bytes.Buffer
+		PrintResults(&out, memFiles{}, r, format)
+		if !strings.Contains(out.String(), "myservice-vpa") {
+			t.Errorf("%s: VPA comparison not shown:\n%s", format, out.String())
+		}
+	}
+
+	// Only the CPU request of 120m is more than 50% below its VPA target
+	warnings := vpaWarnings(r)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "CPU request 120m differs by -76%") {
+		t.Errorf("unexpected warnings: %q", warnings)
+	}
+}
+
+func TestPrintResultsIterationLoadTest(t *testing.T) {
+	m := &loadtest.Metrics{}
+	for i := 0; i < 100; i++ {
+		m.Add(&loadtest.Result{StatusCode: 200, Latency: time.Duration(i+1) * time.Millisecond})
+	}
+	r := testResult()
+	r.Iterations = []IterationResult{
+		{Iteration: 1, Samples: 2, Recommendations: r.Recommendations, LoadTest: m},
+		{Iteration: 2, Samples: 2, Recommendations: r.Recommendations},
+	}
+
+	var out bytes.Buffer
+	PrintResults(&out, memFiles{}, r, "text")
+	if !strings.Contains(out.String(), "100.00%   100.00ms") {
+		t.Errorf("text: iteration load test not shown:\n%s", out.String())
+	}
+
+	out.Reset()
+	PrintResults(&out, memFiles{}, r, "json")
+	if !strings.Contains(out.String(), `"p99": "100.00ms"`) || !strings.Contains(out.String(), `"requests": 100`) {
+		t.Errorf("json: iteration load test not shown:\n%s", out.String())
+	}
+}
+
+func TestPatchFiles(t *testing.T) {
+	r := testResult()
+	if got := PatchFiles(r, "text"); len(got) != 1 || got[0] != "resource-patch.yaml" {
+		t.Errorf("text: got %v, want [resource-patch.yaml]", got)
+	}
+	if got := PatchFiles(r, "helm"); got != nil {
+		t.Errorf("helm: got %v, want none", got)
+	}
+
+	r.FilePrefix = "shop_"
+	r.Workloads = []WorkloadResult{{Deployment: "web"}, {Deployment: "api"}}
+	if got := PatchFiles(r, "yaml"); len(got) != 2 || got[0] != "shop_resource-patch-web.yaml" || got[1] != "shop_resource-patch-api.yaml" {
+		t.Errorf("workloads: got %v", got)
+	}
+
+	summary, err := Summary(r)
+	if err != nil || !strings.Contains(string(summary), `"serviceName":"myservice"`) {
+		t.Errorf("Summary: got %s (%v)", summary, err)
+	}
+}
+
+func TestPrintResultsWorkloadPatchesYAML(t *testing.T) {
+	r := testResult()
+	r.Workloads = []WorkloadResult{
+		{Deployment: "web", Recommendations: r.Recommendations},
+		{Deployment: "api", Recommendations: r.Recommendations},
+	}
+
+	var out bytes.Buffer
+	files := memFiles{}
+	PrintResults(&out, files, r, "yaml")
+	if len(files) != 2 {
+		t.Fatalf("got files %v, want a patch per Deployment", files)
+	}
+	// The messages are comments, so the printed stream is just the patches
+	if !strings.Contains(out.String(), "# YAML patch for api saved to 'resource-patch-api.yaml'") {
+		t.Errorf("saved patches not reported as comments:\n%s", out.String())
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.Contains(line, "saved to") && !strings.HasPrefix(line, "#") {
+			t.Errorf("message within the YAML stream: %q", line)
+		}
+	}
+}
+
+func TestPrintResultsUtilization(t *testing.T) {
+	r := testResult()
+	r.CurrentSettings.HasMemoryLimit = false
+
+	for format, want := range map[string][]string{
+		"text":       {"CPU: 100% average / 120% peak of request, 50% average / 60% peak of limit", "Memory: 78% average / 86% peak of request, no limit set"},
+		"yaml":       {"# Current utilization of CPU: 100% average / 120% peak of request"},
+		"json":       {`"currentUtilization": {`, `"peak": 0.6`},
+		"helm":       {"# Current utilization of Memory: 78% average / 86% peak of request, no limit set"},
+		"kubectl":    {"# Current utilization of CPU: 100% average / 120% peak of request", "# Current utilization of Memory: 78% average / 86% peak of request, no limit set"},
+		"prometheus": {`pod_rightsizer_cpu_limit_utilization_peak_ratio{service="myservice",namespace="default"} 0.6`, `pod_rightsizer_memory_limit_utilization_peak_ratio{service="myservice",namespace="default"} NaN`},
+	} {
+		var out bytes.Buffer
+		PrintResults(&out, memFiles{}, r, format)
+		for _, line := range want {
+			if !strings.Contains(out.String(), line) {
+				t.Errorf("%s: missing %q:\n%s", format, line, out.String())
+			}
+		}
+	}
+}
+
+func TestPrometheusThrottleGauges(t *testing.T) {
+	r := testResult()
+	content := GeneratePrometheusMetrics(r)
+	for _, line := range []string{
+		`pod_rightsizer_cpu_throttle_ratio{service="myservice",namespace="default"} 0`,
+		`pod_rightsizer_throttling_detected{service="myservice",namespace="default"} 0`,
+	} {
+		if !strings.Contains(content, line+"\n") {
+			t.Errorf("without throttling: missing %q:\n%s", line, content)
+		}
+	}
+
+	// One of two samples pinned at the 200m limit
+	r.Metrics = []metrics.ResourceMetrics{{CPUUsage: 0.2, MemoryUsage: 90}, {CPUUsage: 0.1, MemoryUsage: 110}}
+	r.Recommendations.ThrottlingDetected, r.Recommendations.ThrottleRatio = true, 0.5
+	content = GeneratePrometheusMetrics(r)
+	for _, line := range []string{
+		`pod_rightsizer_cpu_throttle_ratio{service="myservice",namespace="default"} 0.5`,
+		`pod_rightsizer_throttling_detected{service="myservice",namespace="default"} 1`,
+	} {
+		if !strings.Contains(content, line+"\n") {
+			t.Errorf("with throttling: missing %q:\n%s", line, content)
+		}
+	}
+}
+
+func TestSkipIfWithin(t *testing.T) {
+	r := testResult()
+	r.Recommendations = recommender.Recommendations{CPURequest: 0.104, CPULimit: 0.196, MemoryRequest: 125, MemoryLimit: 250}
+	r.SkipIfWithin = 5
+
+	if !r.Unchanged() {
+		t.Fatal("values within 5% of current: want unchanged")
+	}
+	for _, format := range []string{"text", "json", "yaml", "kubectl"} {
+		var out bytes.Buffer
+		files := memFiles{}
+		PrintResults(&out, files, r, format)
+		if _, ok := files["resource-patch.yaml"]; ok {
+			t.Errorf("%s: patch written for an unchanged result", format)
+		}
+		if !strings.Contains(out.String(), "No change recommended") && !strings.Contains(out.String(), `"noChangeRecommended": true`) {
+			t.Errorf("%s: no change not reported:\n%s", format, out.String())
+		}
+	}
+	if got := PatchFiles(r, "text"); got != nil {
+		t.Errorf("PatchFiles: got %v, want none", got)
+	}
+
+	tighter := r
+	tighter.SkipIfWithin = 1
+	if tighter.Unchanged() {
+		t.Error("4% change with a 1% tolerance: want changed")
+	}
+
+	// Removing the existing CPU limit is a change however close the values are
+	removed := r
+	removed.OmitCPULimit = true
+	if removed.Unchanged() {
+		t.Error("removed CPU limit: want changed")
+	}
+}
+
+func TestPrintResultsCompactJSON(t *testing.T) {
+	r := testResult()
+	r.CompactJSON = true
+
+	var out bytes.Buffer
+	PrintResults(&out, memFiles{}, r, "json")
+	line, _, _ := strings.Cut(out.String(), "\n")
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &data); err != nil || data["serviceName"] != "myservice" {
+		t.Errorf("compact json: first line is not the whole result (%v):\n%s", err, out.String())
+	}
+
+	out.Reset()
+	PrintMultiResults(&out, memFiles{}, []Result{r, r}, "json")
+	if !strings.HasPrefix(out.String(), `[{"`) {
+		t.Errorf("compact json: expected a single-line array:\n%s", out.String())
+	}
+}
+
+func TestPrintEnvironmentComparison(t *testing.T) {
+	staging, prod := testResult(), testResult()
+	staging.Namespace, prod.Namespace = "staging", "prod"
+	prod.Recommendations.CPURequest = 0.24
+	staging.FilePrefix = TargetFilePrefix(staging.Namespace, staging.ServiceName)
+	prod.FilePrefix = TargetFilePrefix(prod.Namespace, prod.ServiceName)
+	results := []Result{staging, prod}
+
+	var out bytes.Buffer
+	files := memFiles{}
+	PrintEnvironmentComparison(&out, files, results, "text")
+	if !strings.Contains(out.String(), "staging/myservice") || !strings.Contains(out.String(), "prod/myservice") {
+		t.Errorf("text: environments not labeled:\n%s", out.String())
+	}
+	if !regexp.MustCompile(`Recommended CPU Request +120m +240m +\+100%`).MatchString(out.String()) {
+		t.Errorf("text: expected the CPU requests side by side with their difference:\n%s", out.String())
+	}
+	for _, name := range []string{"staging_myservice_resource-patch.yaml", "prod_myservice_resource-patch.yaml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("text: %s was not written (got %v)", name, files)
+		}
+	}
+
+	out.Reset()
+	PrintEnvironmentComparison(&out, memFiles{}, results, "json")
+	var data struct {
+		Environments []struct {
+			Environment string `json:"environment"`
+		} `json:"environments"`
+		Comparison []struct {
+			Name       string            `json:"name"`
+			Values     map[string]string `json:"values"`
+			Difference string            `json:"difference"`
+		} `json:"comparison"`
+	}
+	if err := json.NewDecoder(&out).Decode(&data); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if len(data.Environments) != 2 || data.Environments[1].Environment != "prod/myservice" {
+		t.Errorf("json: environments = %+v, want staging and prod", data.Environments)
+	}
+	found := false
+	for _, row := range data.Comparison {
+		if row.Name == "Recommended CPU Request" {
+			found = row.Values["prod/myservice"] == "240m" && row.Difference == "+100%"
+		}
+	}
+	if !found {
+		t.Errorf("json: recommended CPU request comparison missing or wrong: %+v", data.Comparison)
+	}
+
+	out.Reset()
+	PrintEnvironmentComparison(&out, memFiles{}, results, "yaml")
+	if !strings.Contains(out.String(), "# staging/myservice") || !strings.Contains(out.String(), "# prod/myservice") {
+		t.Errorf("yaml: environments not labeled:\n%s", out.String())
+	}
+}
+
+func TestPrintLoadTest(t *testing.T) {
+	m := &loadtest.Metrics{
+		Requests: 4, Success: 3, Failures: 1,
+		StatusCodes:  map[int]int{200: 3, 503: 1},
+		TotalLatency: 40 * time.Millisecond,
+		TestDuration: 2 * time.Second,
+		MaxLatency:   20 * time.Millisecond,
+	}
+
+	var out bytes.Buffer
+	PrintLoadTest(&out, "http://example.com", m, "text", false)
+	for _, want := range []string{"Requests: 4 (3 successful, 1 failed, 75.00% success rate)", "Throughput: 2.00 req/s", "503: 1"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("text: missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	PrintLoadTest(&out, "http://example.com", m, "json", false)
+	if !strings.Contains(out.String(), `"503": 1`) || !strings.Contains(out.String(), `"mean": "10.00ms"`) {
+		t.Errorf("json: unexpected load test report:\n%s", out.String())
+	}
+}
+
+func TestHPAPatch(t *testing.T) {
+	r := testResult()
+	r.Deployment = "myservice"
+	r.Recommendations.HPA = &recommender.HPATarget{Utilization: 70, Headroom: 0.3, LoadUtilization: 83}
+	r.HPA = &kubernetes.HPASettings{Name: "myservice-hpa", MinReplicas: 2, MaxReplicas: 10, CPUTarget: 80, Metrics: 1}
+
+	for _, format := range []string{"text", "json", "yaml"} {
+		var out bytes.Buffer
+		files := memFiles{}
+		PrintResults(&out, files, r, format)
+
+		patch := files["hpa-patch.yaml"]
+		for _, want := range []string{"kind: HorizontalPodAutoscaler", "name: myservice-hpa", "minReplicas: 2", "maxReplicas: 10", "averageUtilization: 70"} {
+			if !strings.Contains(patch, want) {
+				t.Errorf("%s: HPA patch is missing %q:\n%s", format, want, patch)
+			}
+		}
+		// The tested load exceeds both the recommended and the current target
+		if !strings.Contains(out.String(), "the HPA would scale out at this load") || !strings.Contains(out.String(), "current target of 80%") {
+			t.Errorf("%s: missing HPA warnings:\n%s", format, out.String())
+		}
+	}
+
+	// Without an HPA, one is created for the Deployment
+	r.HPA = nil
+	files := memFiles{}
+	PrintResults(&bytes.Buffer{}, files, r, "text")
+	if patch := files["hpa-patch.yaml"]; !strings.Contains(patch, "name: myservice\n") || !strings.Contains(patch, "review the replica bounds") {
+		t.Errorf("unexpected HPA patch without an existing HPA:\n%s", patch)
+	}
+}
+
+func TestPrintSettingsReport(t *testing.T) {
+	r := testResult()
+	r.Metrics, r.Recommendations = nil, recommender.Recommendations{}
+	r.LoadTest = &loadtest.Metrics{Requests: 100, Success: 100, StatusCodes: map[int]int{200: 100}}
+	reason := fmt.Errorf("%w in this cluster", kubernetes.ErrMetricsUnavailable)
+
+	for format, want := range map[string][]string{
+		"text": {"CPU Request: 100m", "===== Load Test Report =====", "no resources were recommended: metrics-server not available in this cluster"},
+		"json": {`"metricsUnavailable": "metrics-server not available in this cluster"`, `"requests": 100`, `"cpuRequest": 0.1`},
+	} {
+		var out bytes.Buffer
+		PrintSettingsReport(&out, r, format, reason)
+		for _, line := range want {
+			if !strings.Contains(out.String(), line) {
+				t.Errorf("%s: missing %q:\n%s", format, line, out.String())
+			}
+		}
+		if strings.Contains(out.String(), "Recommend") {
+			t.Errorf("%s: the report shouldn't recommend anything:\n%s", format, out.String())
+		}
+	}
+}
+
+func TestPrintResultsDivergence(t *testing.T) {
+	r := testResult()
+	r.Divergence = &kubernetes.SettingsDivergence{Container: "app", Pods: 3, Variants: 2, Resources: []kubernetes.ResourceSpread{
+		{Resource: "cpu request", Min: 0.1, Max: 0.2, Mode: 0.2},
+		{Resource: "memory limit", Min: 256, Max: 256, Mode: 256, Unset: 1},
+	}}
+
+	for format, want := range map[string][]string{
+		"text": {"container app runs with 2 different resource settings across 3 pods", "  cpu request: 100m to 200m, most pods 200m", "  memory limit: 256Mi, 1 unset"},
+		"yaml": {"# Warning: container app runs with 2 different resource settings", "#   cpu request: 100m to 200m, most pods 200m"},
+		"json": {`"settingsDivergence": {`, `"unset": 1`},
+	} {
+		var out bytes.Buffer
+		PrintResults(&out, memFiles{}, r, format)
+		for _, line := range want {
+			if !strings.Contains(out.String(), line) {
+				t.Errorf("%s: missing %q:\n%s", format, line, out.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/recommender"
+)
+
+// printPrometheus displays and saves the results in the Prometheus text exposition format
+func printPrometheus(w io.Writer, files FileWriter, r Result) {
+	content := GeneratePrometheusMetrics(r)
+
+	fmt.Fprint(w, content)
+
+	fileName := r.fileName("resource-metrics.prom")
+	err := files.WriteFile(fileName, []byte(content))
+	if err != nil {
+		fmt.Fprintf(w, "\nError writing Prometheus metrics file: %v\n", err)
+		return
+	}
+
+	fmt.Fprintf(w, "\nPrometheus metrics saved to '%s'\n", fileName)
+}
+
+// GeneratePrometheusMetrics renders current, observed, and recommended resources as labeled gauges
+// in the Prometheus text exposition format. CPU values are in cores and memory values in bytes.
+func GeneratePrometheusMetrics(r Result) string {
+	return generatePrometheusMetrics([]Result{r})
+}
+
+// prometheusGauge is one gauge of the exposition, with a value per result
+type prometheusGauge struct {
+	name  string
+	help  string
+	value func(r Result) float64
+}
+
+// prometheusGauges lists the gauges exposed for each result
+var prometheusGauges = []prometheusGauge{
+	{"current_cpu_request_cores", "Current CPU request of the workload", func(r Result) float64 { return r.CurrentSettings.CPURequest }},
+	{"current_cpu_limit_cores", "Current CPU limit of the workload", func(r Result) float64 { return r.CurrentSettings.CPULimit }},
+	{"current_memory_request_bytes", "Current memory request of the workload", func(r Result) float64 { return miToBytes(r.CurrentSettings.MemoryRequest) }},
+	{"current_memory_limit_bytes", "Current memory limit of the workload", func(r Result) float64 { return miToBytes(r.CurrentSettings.MemoryLimit) }},
+	{"usage_cpu_average_cores", "Average CPU usage observed during the run", func(r Result) float64 {
+		cpu, _ := metrics.CalculateAverageMetrics(r.Metrics)
+		return cpu
+	}},
+	{"usage_cpu_peak_cores", "Peak CPU usage observed during the run", func(r Result) float64 {
+		cpu, _ := metrics.CalculatePeakMetrics(r.Metrics)
+		return cpu
+	}},
+	{"usage_memory_average_bytes", "Average memory usage observed during the run", func(r Result) float64 {
+		_, memory := metrics.CalculateAverageMetrics(r.Metrics)
+		return miToBytes(memory)
+	}},
+	{"usage_memory_peak_bytes", "Peak memory usage observed during the run", func(r Result) float64 {
+		_, memory := metrics.CalculatePeakMetrics(r.Metrics)
+		return miToBytes(memory)
+	}},
+	{"cpu_request_utilization_average_ratio", "Average CPU usage as a fraction of the current CPU request (NaN if unset)", func(r Result) float64 {
+		return utilizationRatio(currentUtilization(r).CPURequest, false)
+	}},
+	{"cpu_request_utilization_peak_ratio", "Peak CPU usage as a fraction of the current CPU request (NaN if unset)", func(r Result) float64 {
+		return utilizationRatio(currentUtilization(r).CPURequest, true)
+	}},
+	{"cpu_limit_utilization_average_ratio", "Average CPU usage as a fraction of the current CPU limit (NaN if unset)", func(r Result) float64 {
+		return utilizationRatio(currentUtilization(r).CPULimit, false)
+	}},
+	{"cpu_limit_utilization_peak_ratio", "Peak CPU usage as a fraction of the current CPU limit (NaN if unset)", func(r Result) float64 {
+		return utilizationRatio(currentUtilization(r).CPULimit, true)
+	}},
+	{"memory_request_utilization_average_ratio", "Average memory usage as a fraction of the current memory request (NaN if unset)", func(r Result) float64 {
+		return utilizationRatio(currentUtilization(r).MemoryRequest, false)
+	}},
+	{"memory_request_utilization_peak_ratio", "Peak memory usage as a fraction of the current memory request (NaN if unset)", func(r Result) float64 {
+		return utilizationRatio(currentUtilization(r).MemoryRequest, true)
+	}},
+	{"memory_limit_utilization_average_ratio", "Average memory usage as a fraction of the current memory limit (NaN if unset)", func(r Result) float64 {
+		return utilizationRatio(currentUtilization(r).MemoryLimit, false)
+	}},
+	{"memory_limit_utilization_peak_ratio", "Peak memory usage as a fraction of the current memory limit (NaN if unset)", func(r Result) float64 {
+		return utilizationRatio(currentUtilization(r).MemoryLimit, true)
+	}},
+	{"cpu_throttle_ratio", "Fraction of samples whose CPU usage sat at the current CPU limit (0 if unset)", func(r Result) float64 {
+		return recommender.ThrottleRatio(r.Metrics, r.CurrentSettings)
+	}},
+	{"throttling_detected", "1 if --target-cpu-throttle-aware found throttling above its threshold and raised the CPU limit, else 0", func(r Result) float64 {
+		if r.Recommendations.ThrottlingDetected {
+			return 1
+		}
+		return 0
+	}},
+	{"recommended_cpu_request_cores", "Recommended CPU request", func(r Result) float64 { return r.Recommendations.CPURequest }},
+	{"recommended_cpu_limit_cores", "Recommended CPU limit", func(r Result) float64 { return r.Recommendations.CPULimit }},
+	{"recommended_memory_request_bytes", "Recommended memory request", func(r Result) float64 { return miToBytes(r.Recommendations.MemoryRequest) }},
+	{"recommended_memory_limit_bytes", "Recommended memory limit", func(r Result) float64 { return miToBytes(r.Recommendations.MemoryLimit) }},
+}
+
+// generatePrometheusMetrics renders the gauges of several results, each metric family written
+// once with a sample per result, as the exposition format requires
+func generatePrometheusMetrics(results []Result) string {
+	var b strings.Builder
+	for _, g := range prometheusGauges {
+		name := "pod_rightsizer_" + g.name
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, g.help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		for _, r := range results {
+			labels := fmt.Sprintf(`service="%s",namespace="%s"`, escapeLabelValue(r.ServiceName), escapeLabelValue(r.Namespace))
+			fmt.Fprintf(&b, "%s{%s} %g\n", name, labels, g.value(r))
+		}
+	}
+
+	return b.String()
+}
+
+// miToBytes converts a value in Mi to bytes
+func miToBytes(mi float64) float64 {
+	return mi * 1024 * 1024
+}
+
+// escapeLabelValue escapes a string for use as a Prometheus label value
+func escapeLabelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
@@ -0,0 +1,32 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ResultSchemaVersion identifies the layout of saved results. Fields may be added within a
+// version; renaming or removing a field requires a new version.
+const ResultSchemaVersion = "v1"
+
+// savedResult is the on-disk representation of a Result
+type savedResult struct {
+	SchemaVersion string `json:"schemaVersion"`
+	Result
+}
+
+// SaveResult writes the complete result, including all samples and load test statistics, as
+// versioned JSON regardless of the display format
+func SaveResult(path string, r Result) error {
+	data, err := json.MarshalIndent(savedResult{SchemaVersion: ResultSchemaVersion, Result: r}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling result: %v", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing result file: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/kubernetes"
+)
+
+// PrintSettingsReport writes what a run found without metrics-server: the current settings and
+// the report of the load test, with the reason no usage was measured and no resources were
+// recommended. The json format prints them as a single object; the other formats print text.
+func PrintSettingsReport(w io.Writer, r Result, format string, reason error) {
+	if format == "json" {
+		data := map[string]interface{}{
+			"schemaVersion":      OutputSchemaVersion,
+			"loadTestTarget":     r.Target,
+			"serviceName":        r.ServiceName,
+			"namespace":          r.Namespace,
+			"currentSettings":    r.CurrentSettings,
+			"metricsUnavailable": reason.Error(),
+		}
+		if r.LoadTest != nil {
+			data["loadTest"] = loadTestData(r.Target, r.LoadTest)
+		}
+		if problems := r.CurrentSettings.Inconsistencies(); len(problems) > 0 {
+			data["currentSettingsWarnings"] = problems
+		}
+		if r.Divergence != nil {
+			data["settingsDivergence"] = r.Divergence
+		}
+		if r.LimitsAudited {
+			containers := r.MissingLimits
+			if containers == nil {
+				containers = []kubernetes.MissingResources{}
+			}
+			data["missingLimits"] = map[string]interface{}{
+				"count":      len(containers),
+				"containers": containers,
+			}
+		}
+
+		jsonBytes, err := marshalJSON(data, r.CompactJSON)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling JSON: %v\n", err)
+			return
+		}
+		fmt.Fprintln(w, string(jsonBytes))
+		return
+	}
+
+	fmt.Fprintln(w, "\n===== Pod Rightsizer Results =====")
+	fmt.Fprintf(w, "\nLoad Test Target: %s\n", r.Target)
+	if r.ServiceName != r.Target {
+		fmt.Fprintf(w, "Service Name: %s\n", r.ServiceName)
+	}
+	fmt.Fprintf(w, "Namespace: %s\n", r.Namespace)
+
+	printCurrentSettings(w, r)
+	if r.LoadTest != nil {
+		printLoadTestReport(w, r.Target, r.LoadTest)
+	}
+	fmt.Fprintf(w, "\nWarning: no usage was measured and no resources were recommended: %v\n", reason)
+}
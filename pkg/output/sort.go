@@ -0,0 +1,87 @@
+package output
+
+import (
+	"math"
+	"sort"
+)
+
+// Keys the results of a multi-target run can be sorted by
+const (
+	SortByReclaimableCPU    = "reclaimable-cpu"
+	SortByReclaimableMemory = "reclaimable-memory"
+	SortByOverprovision     = "overprovision"
+)
+
+// SortKeys lists the valid --sort-by keys
+var SortKeys = []string{SortByReclaimableCPU, SortByReclaimableMemory, SortByOverprovision}
+
+// IsValidSortKey reports whether key is one of SortKeys
+func IsValidSortKey(key string) bool {
+	for _, k := range SortKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// reclaimableCPU returns how many cores per pod the recommended CPU request frees up compared to
+// the current one, negative if it asks for more. A target without a current request has none.
+func reclaimableCPU(r Result) float64 {
+	if !r.CurrentSettings.HasCPURequest {
+		return 0
+	}
+	return r.CurrentSettings.CPURequest - r.Recommendations.CPURequest
+}
+
+// reclaimableMemory returns how many Mi per pod the recommended memory request frees up compared
+// to the current one, negative if it asks for more. A target without a current request has none.
+func reclaimableMemory(r Result) float64 {
+	if !r.CurrentSettings.HasMemoryRequest {
+		return 0
+	}
+	return r.CurrentSettings.MemoryRequest - r.Recommendations.MemoryRequest
+}
+
+// overprovisionFactor returns the larger of the current CPU and memory requests as a multiple of
+// the recommended ones, e.g. 4 for a service requesting four times what it needs, or 0 if
+// neither request is set
+func overprovisionFactor(r Result) float64 {
+	cur, rec := r.CurrentSettings, r.Recommendations
+	factor := 0.0
+	if cur.HasCPURequest && rec.CPURequest > 0 {
+		factor = math.Max(factor, cur.CPURequest/rec.CPURequest)
+	}
+	if cur.HasMemoryRequest && rec.MemoryRequest > 0 {
+		factor = math.Max(factor, cur.MemoryRequest/rec.MemoryRequest)
+	}
+	return factor
+}
+
+// SortResults orders the results of a multi-target run by key, largest first unless ascending,
+// so the services with the most to reclaim come first. Ties are ordered by namespace and
+// service name, so the order is the same on every run.
+func SortResults(results []Result, key string, ascending bool) {
+	value := map[string]func(Result) float64{
+		SortByReclaimableCPU:    reclaimableCPU,
+		SortByReclaimableMemory: reclaimableMemory,
+		SortByOverprovision:     overprovisionFactor,
+	}[key]
+	if value == nil {
+		return
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := value(results[i]), value(results[j])
+		if a != b && ascending {
+			return a < b
+		}
+		if a != b {
+			return a > b
+		}
+		if results[i].Namespace != results[j].Namespace {
+			return results[i].Namespace < results[j].Namespace
+		}
+		return results[i].ServiceName < results[j].ServiceName
+	})
+}
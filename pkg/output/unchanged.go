@@ -0,0 +1,72 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Unchanged reports whether every recommended value is within SkipIfWithin percent of the
+// current setting, for each Deployment or container the patch would cover, so that no patch is
+// generated. It is always false if SkipIfWithin isn't set.
+func (r Result) Unchanged() bool {
+	if r.SkipIfWithin <= 0 {
+		return false
+	}
+
+	switch {
+	case len(r.Workloads) > 0:
+		for _, wl := range r.Workloads {
+			if !r.forWorkload(wl).Unchanged() {
+				return false
+			}
+		}
+		return true
+	case len(r.Containers) > 0:
+		for _, c := range r.Containers {
+			if !r.forContainer(c).Unchanged() {
+				return false
+			}
+		}
+		return true
+	}
+
+	rec, cur, tolerance := r.Recommendations, r.CurrentSettings, r.SkipIfWithin
+	return withinTolerance(rec.CPURequest, cur.CPURequest, cur.HasCPURequest, tolerance) &&
+		withinTolerance(rec.MemoryRequest, cur.MemoryRequest, cur.HasMemoryRequest, tolerance) &&
+		limitUnchanged(rec.CPULimit, cur.CPULimit, cur.HasCPULimit, r.OmitCPULimit, tolerance) &&
+		limitUnchanged(rec.MemoryLimit, cur.MemoryLimit, cur.HasMemoryLimit, r.OmitMemoryLimit, tolerance)
+}
+
+// withinTolerance reports whether a recommended value is within tolerance percent of a current
+// setting. A setting that isn't set never is, since the patch would add it.
+func withinTolerance(recommended, current float64, set bool, tolerance float64) bool {
+	if !set || current <= 0 {
+		return false
+	}
+	return math.Abs(recommended-current)/current*100 <= tolerance
+}
+
+// limitUnchanged reports whether the patch would leave a limit as it is: left out while none is
+// set, or set within the tolerance of the current one. Leaving out an existing limit removes it.
+func limitUnchanged(recommended, current float64, set, omit bool, tolerance float64) bool {
+	if omit {
+		return !set
+	}
+	return withinTolerance(recommended, current, set, tolerance)
+}
+
+// noChangeMessage explains why no patch was generated for an unchanged result
+func noChangeMessage(r Result) string {
+	return fmt.Sprintf("No change recommended: every value is within %g%% of the current settings, so no patch was generated", r.SkipIfWithin)
+}
+
+// printNoChange prints the no change message, as a comment if the output should stay valid YAML
+// or shell
+func printNoChange(w io.Writer, r Result, comment bool) {
+	if comment {
+		fmt.Fprintf(w, "# %s\n", noChangeMessage(r))
+		return
+	}
+	fmt.Fprintf(w, "\n%s.\n", noChangeMessage(r))
+}
@@ -0,0 +1,84 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+)
+
+// Utilization is the observed usage as a fraction of a current request or limit
+type Utilization struct {
+	Average float64 `json:"average"`
+	Peak    float64 `json:"peak"`
+}
+
+// CurrentUtilization relates observed usage to the current settings, the way it's usually
+// reasoned about ("at 30% of requests, 15% of limits")
+type CurrentUtilization struct {
+	CPURequest    *Utilization `json:"cpuRequest,omitempty"` // nil if no CPU request is set
+	CPULimit      *Utilization `json:"cpuLimit,omitempty"`
+	MemoryRequest *Utilization `json:"memoryRequest,omitempty"`
+	MemoryLimit   *Utilization `json:"memoryLimit,omitempty"`
+}
+
+// currentUtilization computes the average and peak usage relative to each current request and
+// limit that is set
+func currentUtilization(r Result) CurrentUtilization {
+	avgCPU, avgMemory := metrics.CalculateAverageMetrics(r.Metrics)
+	peakCPU, peakMemory := metrics.CalculatePeakMetrics(r.Metrics)
+
+	utilization := func(average, peak, setting float64, set bool) *Utilization {
+		if !set || setting <= 0 {
+			return nil
+		}
+		return &Utilization{Average: average / setting, Peak: peak / setting}
+	}
+
+	cur := r.CurrentSettings
+	return CurrentUtilization{
+		CPURequest:    utilization(avgCPU, peakCPU, cur.CPURequest, cur.HasCPURequest),
+		CPULimit:      utilization(avgCPU, peakCPU, cur.CPULimit, cur.HasCPULimit),
+		MemoryRequest: utilization(avgMemory, peakMemory, cur.MemoryRequest, cur.HasMemoryRequest),
+		MemoryLimit:   utilization(avgMemory, peakMemory, cur.MemoryLimit, cur.HasMemoryLimit),
+	}
+}
+
+// formatUtilization describes the utilization of a request or limit, e.g.
+// "30% average / 45% peak of request"
+func formatUtilization(u *Utilization, setting string) string {
+	if u == nil {
+		return "no " + setting + " set"
+	}
+	return fmt.Sprintf("%.0f%% average / %.0f%% peak of %s", u.Average*100, u.Peak*100, setting)
+}
+
+// utilizationLines returns one line per resource describing its current utilization
+func utilizationLines(r Result) []string {
+	u := currentUtilization(r)
+	return []string{
+		fmt.Sprintf("CPU: %s, %s", formatUtilization(u.CPURequest, "request"), formatUtilization(u.CPULimit, "limit")),
+		fmt.Sprintf("Memory: %s, %s", formatUtilization(u.MemoryRequest, "request"), formatUtilization(u.MemoryLimit, "limit")),
+	}
+}
+
+// printUtilization prints the utilization of the current settings in the text output
+func printUtilization(w io.Writer, r Result) {
+	fmt.Fprintln(w, "\nUtilization of Current Settings:")
+	for _, line := range utilizationLines(r) {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// utilizationRatio returns the ratio a Prometheus gauge exposes, NaN if the setting isn't set
+func utilizationRatio(u *Utilization, peak bool) float64 {
+	switch {
+	case u == nil:
+		return math.NaN()
+	case peak:
+		return u.Peak
+	default:
+		return u.Average
+	}
+}
@@ -0,0 +1,25 @@
+package output
+
+import (
+	"fmt"
+	"io"
+)
+
+// PatchValidation is the outcome of applying a Deployment's patch in a server-side dry run
+type PatchValidation struct {
+	Deployment string `json:"deployment"`
+	Accepted   bool   `json:"accepted"`
+	Error      string `json:"error,omitempty"` // Why the API server or an admission webhook rejected it
+}
+
+// printPatchValidation prints the dry-run outcome of each patch in the text output
+func printPatchValidation(w io.Writer, validation []PatchValidation) {
+	fmt.Fprintln(w, "\nPatch Validation (server-side dry run):")
+	for _, v := range validation {
+		if v.Accepted {
+			fmt.Fprintf(w, "  %s: accepted\n", v.Deployment)
+		} else {
+			fmt.Fprintf(w, "  %s: REJECTED: %s\n", v.Deployment, v.Error)
+		}
+	}
+}
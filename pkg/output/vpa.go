@@ -0,0 +1,79 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// VPADivergenceThreshold is the relative difference between a recommended request and the VPA's
+// target above which the two are reported as diverging
+const VPADivergenceThreshold = 0.5
+
+// vpaDivergence returns the relative difference of a recommended request from the VPA target,
+// or 0 if the VPA has no target for it
+func vpaDivergence(recommended, target float64) float64 {
+	if target == 0 {
+		return 0
+	}
+	return (recommended - target) / target
+}
+
+// vpaWarnings explains recommended requests that diverge widely from the VPA's targets, which
+// means the load test and the workload's real traffic history disagree
+func vpaWarnings(r Result) []string {
+	if r.VPA == nil {
+		return nil
+	}
+
+	var warnings []string
+	if d := vpaDivergence(r.Recommendations.CPURequest, r.VPA.CPUTarget); math.Abs(d) > VPADivergenceThreshold {
+		warnings = append(warnings, fmt.Sprintf("the CPU request %.0fm differs by %+.0f%% from the target %.0fm of VerticalPodAutoscaler %s; check that the load test reflects real traffic",
+			r.Recommendations.CPURequest*1000, d*100, r.VPA.CPUTarget*1000, r.VPA.VPA))
+	}
+	if d := vpaDivergence(r.Recommendations.MemoryRequest, r.VPA.MemoryTarget); math.Abs(d) > VPADivergenceThreshold {
+		warnings = append(warnings, fmt.Sprintf("the memory request %.0fMi differs by %+.0f%% from the target %.0fMi of VerticalPodAutoscaler %s; check that the load test reflects real traffic",
+			r.Recommendations.MemoryRequest, d*100, r.VPA.MemoryTarget, r.VPA.VPA))
+	}
+	return warnings
+}
+
+// printVPAComparison prints the recommended requests next to the VPA's recommendation
+func printVPAComparison(w io.Writer, r Result) {
+	vpa, rec := r.VPA, r.Recommendations
+	fmt.Fprintf(w, "\nVPA Comparison (VerticalPodAutoscaler %s, container %s):\n", vpa.VPA, vpa.Container)
+	fmt.Fprintf(w, "%-16s %-12s %-12s %-20s %s\n", "Request", "Load test", "VPA target", "VPA bounds", "Difference")
+	fmt.Fprintf(w, "%-16s %-12s %-12s %-20s %+.0f%%\n", "CPU",
+		fmt.Sprintf("%.0fm", rec.CPURequest*1000), fmt.Sprintf("%.0fm", vpa.CPUTarget*1000),
+		fmt.Sprintf("%.0fm-%.0fm", vpa.CPULowerBound*1000, vpa.CPUUpperBound*1000),
+		vpaDivergence(rec.CPURequest, vpa.CPUTarget)*100)
+	fmt.Fprintf(w, "%-16s %-12s %-12s %-20s %+.0f%%\n", "Memory",
+		fmt.Sprintf("%.0fMi", rec.MemoryRequest), fmt.Sprintf("%.0fMi", vpa.MemoryTarget),
+		fmt.Sprintf("%.0fMi-%.0fMi", vpa.MemoryLowerBound, vpa.MemoryUpperBound),
+		vpaDivergence(rec.MemoryRequest, vpa.MemoryTarget)*100)
+	for _, warning := range vpaWarnings(r) {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+}
+
+// vpaJSON returns the VPA comparison for the json output
+func vpaJSON(r Result) map[string]interface{} {
+	vpa, rec := r.VPA, r.Recommendations
+	return map[string]interface{}{
+		"vpa":       vpa.VPA,
+		"container": vpa.Container,
+		"cpu": map[string]interface{}{
+			"target":     fmt.Sprintf("%.0fm", vpa.CPUTarget*1000),
+			"lowerBound": fmt.Sprintf("%.0fm", vpa.CPULowerBound*1000),
+			"upperBound": fmt.Sprintf("%.0fm", vpa.CPUUpperBound*1000),
+			"difference": vpaDivergence(rec.CPURequest, vpa.CPUTarget),
+		},
+		"memory": map[string]interface{}{
+			"target":     fmt.Sprintf("%.0fMi", vpa.MemoryTarget),
+			"lowerBound": fmt.Sprintf("%.0fMi", vpa.MemoryLowerBound),
+			"upperBound": fmt.Sprintf("%.0fMi", vpa.MemoryUpperBound),
+			"difference": vpaDivergence(rec.MemoryRequest, vpa.MemoryTarget),
+		},
+		"divergent": len(vpaWarnings(r)) > 0,
+	}
+}
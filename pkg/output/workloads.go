@@ -0,0 +1,107 @@
+package output
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/kubernetes"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/recommender"
+)
+
+// WorkloadResult holds the recommendation for one of several Deployments matched by the selector,
+// sized from that Deployment's pods only
+type WorkloadResult struct {
+	Deployment      string                      `json:"deployment"`
+	CurrentSettings kubernetes.ResourceSettings `json:"currentSettings"`
+	Metrics         []metrics.ResourceMetrics   `json:"metrics"`
+	Recommendations recommender.Recommendations `json:"recommendations"`
+	OmitCPULimit    bool                        `json:"omitCPULimit"`
+	OmitMemoryLimit bool                        `json:"omitMemoryLimit"`
+}
+
+// workloadPatchFile returns the name of the patch file written for a Deployment
+func workloadPatchFile(deployment string) string {
+	return fmt.Sprintf("resource-patch-%s.yaml", deployment)
+}
+
+// forWorkload returns the result narrowed to a single Deployment
+func (r Result) forWorkload(wl WorkloadResult) Result {
+	r.Deployment = wl.Deployment
+	r.CurrentSettings = wl.CurrentSettings
+	r.Metrics = wl.Metrics
+	r.Recommendations = wl.Recommendations
+	r.OmitCPULimit = wl.OmitCPULimit
+	r.OmitMemoryLimit = wl.OmitMemoryLimit
+	r.Workloads = nil
+	r.Containers = nil
+	r.Comparisons = nil
+	return r
+}
+
+// printWorkloadSummary prints the per-Deployment recommendations in the text output
+func printWorkloadSummary(w io.Writer, r Result) {
+	fmt.Fprintf(w, "\nWarning: the selector matched %d Deployments; the combined figures above mix their pods.\n", len(r.Workloads))
+	fmt.Fprintln(w, "Per-Deployment Recommendations (request/limit):")
+	for _, wl := range r.Workloads {
+		rec := wl.Recommendations
+		fmt.Fprintf(w, "  %s: CPU %s/%s, Memory %s/%s\n", wl.Deployment,
+			formatCPU(rec.CPURequest, true), formatCPU(rec.CPULimit, !wl.OmitCPULimit),
+			formatMemory(rec.MemoryRequest, true), formatMemory(rec.MemoryLimit, !wl.OmitMemoryLimit))
+	}
+}
+
+// workloadsJSON returns the per-Deployment recommendations for the json output
+func workloadsJSON(r Result) []map[string]interface{} {
+	workloads := make([]map[string]interface{}, 0, len(r.Workloads))
+	for _, wl := range r.Workloads {
+		rec := wl.Recommendations
+		workloads = append(workloads, map[string]interface{}{
+			"deployment": wl.Deployment,
+			"patchFile":  r.fileName(workloadPatchFile(wl.Deployment)),
+			"recommendations": map[string]interface{}{
+				"cpuRequest":    formatCPU(rec.CPURequest, true),
+				"cpuLimit":      formatCPU(rec.CPULimit, !wl.OmitCPULimit),
+				"memoryRequest": formatMemory(rec.MemoryRequest, true),
+				"memoryLimit":   formatMemory(rec.MemoryLimit, !wl.OmitMemoryLimit),
+			},
+		})
+	}
+	return workloads
+}
+
+// saveWorkloadPatches writes one YAML patch per Deployment, also printing the patches if show is
+// set. The printed patches form a YAML stream, so messages within it are printed as comments.
+func saveWorkloadPatches(w io.Writer, files FileWriter, r Result, show bool) {
+	report := func(format string, args ...interface{}) {
+		if show {
+			fmt.Fprintf(w, "# "+format+"\n", args...)
+		} else {
+			fmt.Fprintf(w, "\n"+format+"\n", args...)
+		}
+	}
+
+	for i, wl := range r.Workloads {
+		patchContent, err := generateYAMLPatch(r.forWorkload(wl))
+		if err != nil {
+			report("Error generating YAML patch for %s: %v", wl.Deployment, err)
+			continue
+		}
+
+		if show {
+			if i > 0 {
+				fmt.Fprintln(w, "---")
+			} else {
+				printSchemaComment(w)
+			}
+			fmt.Fprint(w, patchContent)
+		}
+
+		fileName := r.fileName(workloadPatchFile(wl.Deployment))
+		if err := files.WriteFile(fileName, []byte(patchContent)); err != nil {
+			report("Error writing YAML patch file: %v", err)
+			continue
+		}
+		report("YAML patch for %s saved to '%s'", wl.Deployment, fileName)
+	}
+}
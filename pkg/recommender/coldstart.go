@@ -0,0 +1,72 @@
+package recommender
+
+import (
+	"time"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+)
+
+// ColdStartProfile is the usage during the first part of a run, when JIT compilation, cache
+// warming, or connection pool setup can take far more than steady state does
+type ColdStartProfile struct {
+	Window     time.Duration `json:"window"`
+	Samples    int           `json:"samples"`
+	PeakCPU    float64       `json:"peakCPU"`    // in cores
+	PeakMemory float64       `json:"peakMemory"` // in Mi
+
+	// Set when a limit was raised to cover the cold start peak
+	CPULimitRaised    bool `json:"cpuLimitRaised,omitempty"`
+	MemoryLimitRaised bool `json:"memoryLimitRaised,omitempty"`
+}
+
+// splitColdStart separates the samples taken within window of the first one from the
+// steady-state samples after them
+func splitColdStart(samples []metrics.ResourceMetrics, window time.Duration) ([]metrics.ResourceMetrics, []metrics.ResourceMetrics) {
+	if len(samples) == 0 {
+		return nil, nil
+	}
+
+	start := samples[0].Timestamp
+	for _, s := range samples {
+		if s.Timestamp.Before(start) {
+			start = s.Timestamp
+		}
+	}
+
+	var cold, steady []metrics.ResourceMetrics
+	for _, s := range samples {
+		if s.Timestamp.Sub(start) < window {
+			cold = append(cold, s)
+		} else {
+			steady = append(steady, s)
+		}
+	}
+	return cold, steady
+}
+
+// coldStartProfile returns the profile of the cold start window and the steady-state samples the
+// rest of the sizing uses, or nil and all samples if they don't extend past the window
+func coldStartProfile(samples []metrics.ResourceMetrics, window time.Duration) (*ColdStartProfile, []metrics.ResourceMetrics) {
+	cold, steady := splitColdStart(samples, window)
+	if len(cold) == 0 || len(steady) == 0 {
+		return nil, samples
+	}
+
+	peakCPU, peakMemory := metrics.CalculatePeakMetrics(cold)
+	return &ColdStartProfile{Window: window, Samples: len(cold), PeakCPU: peakCPU, PeakMemory: peakMemory}, steady
+}
+
+// applyColdStart raises the limits to the cold start peak plus the margin, so the burst isn't
+// throttled or OOM-killed, while the requests stay sized for steady state
+func applyColdStart(r Recommendations, profile *ColdStartProfile, cpuMargin, memoryMargin int) Recommendations {
+	if limit := profile.PeakCPU * (1 + float64(cpuMargin)/100); r.CPULimit < limit {
+		r.CPULimit = limit
+		profile.CPULimitRaised = true
+	}
+	if limit := profile.PeakMemory * (1 + float64(memoryMargin)/100); r.MemoryLimit < limit {
+		r.MemoryLimit = limit
+		profile.MemoryLimitRaised = true
+	}
+	r.ColdStart = profile
+	return r
+}
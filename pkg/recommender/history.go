@@ -0,0 +1,55 @@
+package recommender
+
+import "math"
+
+// Record is a recommendation of an earlier run, e.g. read back from the history file.
+// CPU values are in cores and memory values in Mi.
+type Record struct {
+	CPURequest    float64 `json:"cpuRequest"`
+	CPULimit      float64 `json:"cpuLimit"`
+	MemoryRequest float64 `json:"memoryRequest"`
+	MemoryLimit   float64 `json:"memoryLimit"`
+}
+
+// BlendWithHistory averages the current recommendation with those of earlier runs, ordered from
+// the oldest to the most recent, weighting the current run 1, the most recent earlier run decay,
+// the one before decay², and so on. A single anomalous run then only moves the result part of the
+// way, which keeps a regularly scheduled run from swinging the settings back and forth. The
+// current run's own values are kept in Unblended. Without history or with decay outside (0, 1),
+// the recommendation is returned unchanged.
+func BlendWithHistory(current Recommendations, history []Record, decay float64) Recommendations {
+	if len(history) == 0 || decay <= 0 || decay >= 1 {
+		return current
+	}
+
+	raw := Record{
+		CPURequest:    current.CPURequest,
+		CPULimit:      current.CPULimit,
+		MemoryRequest: current.MemoryRequest,
+		MemoryLimit:   current.MemoryLimit,
+	}
+
+	sum, totalWeight := raw, 1.0
+	for i := range history {
+		h := history[len(history)-1-i]
+		weight := math.Pow(decay, float64(i+1))
+		sum.CPURequest += h.CPURequest * weight
+		sum.CPULimit += h.CPULimit * weight
+		sum.MemoryRequest += h.MemoryRequest * weight
+		sum.MemoryLimit += h.MemoryLimit * weight
+		totalWeight += weight
+	}
+
+	current.CPURequest = sum.CPURequest / totalWeight
+	current.CPULimit = sum.CPULimit / totalWeight
+	current.MemoryRequest = sum.MemoryRequest / totalWeight
+	current.MemoryLimit = sum.MemoryLimit / totalWeight
+
+	// Each run's limits are at least its requests, but a hand-edited record may not be
+	current.CPULimit = math.Max(current.CPULimit, current.CPURequest)
+	current.MemoryLimit = math.Max(current.MemoryLimit, current.MemoryRequest)
+
+	current.BlendedRuns = len(history)
+	current.Unblended = &raw
+	return current
+}
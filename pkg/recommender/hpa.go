@@ -0,0 +1,61 @@
+package recommender
+
+import (
+	"math"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+)
+
+// HPATarget is the averageUtilization target recommended for the workload's
+// HorizontalPodAutoscaler along with the CPU request. The HPA adds replicas once average usage
+// exceeds the target share of the request, so the rest of the request is the headroom that
+// absorbs bursts while new pods start.
+type HPATarget struct {
+	Utilization     int     `json:"utilization"`     // averageUtilization percentage of the CPU request
+	Headroom        float64 `json:"headroom"`        // Fraction of the CPU request kept free at the target
+	LoadUtilization float64 `json:"loadUtilization"` // Percentage of the recommended CPU request used on average under the tested load
+	RequestRaised   bool    `json:"requestRaised,omitempty"`
+}
+
+// OverTarget reports whether the tested load uses more of the CPU request than the target, so
+// the HPA would keep adding replicas at it, e.g. when a cap held the request down
+func (t HPATarget) OverTarget() bool {
+	return t.LoadUtilization > float64(t.Utilization)
+}
+
+// hpaUtilization returns the averageUtilization target that keeps the headroom free, between
+// 1 and 100 percent
+func hpaUtilization(headroom float64) int {
+	return int(math.Max(1, math.Min(100, math.Round((1-headroom)*100))))
+}
+
+// applyHPAHeadroom raises the CPU request so that average usage under the tested load sits at
+// most at the HPA target. A smaller request would make the HPA scale out as soon as the load the
+// run sized for arrives, so the two knobs would contradict each other.
+func applyHPAHeadroom(r Recommendations, allMetrics []metrics.ResourceMetrics, opts Options) Recommendations {
+	target := &HPATarget{Utilization: hpaUtilization(opts.HPAHeadroom), Headroom: opts.HPAHeadroom}
+	avgCPU, _ := averageUsage(allMetrics, opts)
+
+	if needed := avgCPU * 100 / float64(target.Utilization); r.CPURequest < needed {
+		r.CPURequest = needed
+		target.RequestRaised = true
+	}
+	if r.CPULimit < r.CPURequest {
+		r.CPULimit = r.CPURequest
+	}
+
+	r.HPA = target
+	return r
+}
+
+// finishHPATarget records the utilization of the final CPU request under the tested load
+func finishHPATarget(r Recommendations, allMetrics []metrics.ResourceMetrics, opts Options) Recommendations {
+	if r.HPA == nil || r.CPURequest <= 0 {
+		return r
+	}
+	avgCPU, _ := averageUsage(allMetrics, opts)
+	target := *r.HPA
+	target.LoadUtilization = avgCPU / r.CPURequest * 100
+	r.HPA = &target
+	return r
+}
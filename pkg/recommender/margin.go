@@ -0,0 +1,78 @@
+package recommender
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+)
+
+// HighMargin is the margin percentage above which a margin is likely a mistake, such as a
+// multiplier written as a percentage
+const HighMargin = 500
+
+// ParseMargin normalizes a safety margin to a percentage. It accepts a percentage ("20" or
+// "20%") or a multiplier of usage ("1.2" or "1.2x"); a plain integer is always a percentage.
+// Negative margins are rejected, since they size resources below the observed usage.
+func ParseMargin(value string) (int, error) {
+	value = strings.TrimSpace(value)
+
+	var margin float64
+	switch {
+	case strings.HasSuffix(value, "%"):
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid margin %q", value)
+		}
+		margin = percent
+	case strings.HasSuffix(value, "x") || strings.Contains(value, "."):
+		multiplier, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid margin %q", value)
+		}
+		margin = (multiplier - 1) * 100
+	default:
+		percent, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid margin %q", value)
+		}
+		margin = float64(percent)
+	}
+
+	if math.IsNaN(margin) || math.IsInf(margin, 0) {
+		return 0, fmt.Errorf("invalid margin %q", value)
+	}
+	if margin < 0 {
+		return 0, fmt.Errorf("margin %q is negative and would size resources below observed usage", value)
+	}
+	return int(math.Round(margin)), nil
+}
+
+// Bounds of the adaptive margin percentage, by default
+const (
+	DefaultMinMargin = 10
+	DefaultMaxMargin = 50
+)
+
+// AdaptiveMarginFullCV is the coefficient of variation at which the adaptive margin reaches its
+// maximum. Steadier usage gets proportionally less, down to the minimum for perfectly flat usage.
+const AdaptiveMarginFullCV = 0.5
+
+// AdaptiveMargin scales a margin percentage between min and max linearly with the coefficient of
+// variation of usage, so a steady workload gets little headroom and a volatile one plenty
+func AdaptiveMargin(cv float64, min, max int) int {
+	scale := math.Min(math.Max(cv/AdaptiveMarginFullCV, 0), 1)
+	return min + int(math.Round(float64(max-min)*scale))
+}
+
+// margins returns the margin percentages for CPU and memory: with AdaptiveMargin each scaled with
+// the variance of that resource's samples, and otherwise Margin for both
+func (o Options) margins(samples []metrics.ResourceMetrics) (int, int) {
+	if !o.AdaptiveMargin {
+		return o.Margin, o.Margin
+	}
+	cpuCV, memoryCV := metrics.CoefficientOfVariation(samples)
+	return AdaptiveMargin(cpuCV, o.MinMargin, o.MaxMargin), AdaptiveMargin(memoryCV, o.MinMargin, o.MaxMargin)
+}
@@ -0,0 +1,24 @@
+package recommender
+
+import "github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+
+// ProbeHeadroom is the headroom over peak CPU usage, as a fraction of it, that the CPU limit
+// keeps for probe-aware sizing. A limit close to the peak throttles GC and startup bursts,
+// which delays probe responses past their timeout and can put the pod in a restart loop.
+const ProbeHeadroom = 0.5
+
+// probeSafeLimit returns the lowest CPU limit that keeps ProbeHeadroom over the peak CPU usage.
+// The peak covers startup only if the run observed it, e.g. right after a rollout.
+func probeSafeLimit(allMetrics []metrics.ResourceMetrics) float64 {
+	peakCPU, _ := metrics.CalculatePeakMetrics(allMetrics)
+	return peakCPU * (1 + ProbeHeadroom)
+}
+
+// applyProbeHeadroom raises the CPU limit to the probe-safe limit if it's below it
+func applyProbeHeadroom(r Recommendations, allMetrics []metrics.ResourceMetrics) Recommendations {
+	if safe := probeSafeLimit(allMetrics); r.CPULimit < safe {
+		r.CPULimit = safe
+		r.CPULimitProbeRaised = true
+	}
+	return r
+}
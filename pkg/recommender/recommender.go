@@ -1,12 +1,127 @@
 package recommender
 
 import (
+	"fmt"
+	"math"
+	"time"
+
 	"github.com/BogdanDolia/pod-rightsizer/pkg/kubernetes"
 	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
 )
 
 // Recommendations holds the recommended resource settings
 type Recommendations struct {
+	CPURequest    float64 `json:"cpuRequest"`    // in cores
+	CPULimit      float64 `json:"cpuLimit"`      // in cores
+	MemoryRequest float64 `json:"memoryRequest"` // in Mi
+	MemoryLimit   float64 `json:"memoryLimit"`   // in Mi
+
+	// Set when the CPU limit was raised because usage was pinned at the current limit
+	ThrottlingDetected bool    `json:"throttlingDetected,omitempty"`
+	ThrottleRatio      float64 `json:"throttleRatio,omitempty"` // Fraction of samples at the current CPU limit
+
+	// Set when a request was held back by the maximum downsize guardrail
+	CPURequestClamped    bool `json:"cpuRequestClamped,omitempty"`
+	MemoryRequestClamped bool `json:"memoryRequestClamped,omitempty"`
+
+	// Set when the memory request was raised to keep the limit within the maximum limit/request ratio
+	MemoryRequestRaised bool `json:"memoryRequestRaised,omitempty"`
+
+	// Set when a policy cap held a value below what usage suggests
+	CPUCapped    bool `json:"cpuCapped,omitempty"`
+	MemoryCapped bool `json:"memoryCapped,omitempty"`
+
+	// Set when a value was raised to the current setting by the never-downsize policy
+	CPURequestFloored    bool `json:"cpuRequestFloored,omitempty"`
+	CPULimitFloored      bool `json:"cpuLimitFloored,omitempty"`
+	MemoryRequestFloored bool `json:"memoryRequestFloored,omitempty"`
+	MemoryLimitFloored   bool `json:"memoryLimitFloored,omitempty"`
+
+	// Set by probe-aware sizing when the CPU limit was raised to leave headroom for probes, or
+	// when a cap still keeps it too close to peak usage for probes to answer in time
+	CPULimitProbeRaised bool `json:"cpuLimitProbeRaised,omitempty"`
+	ProbeStarvationRisk bool `json:"probeStarvationRisk,omitempty"`
+
+	// Margins picked by the adaptive margin from the variance of each resource's usage
+	AdaptiveMargin bool `json:"adaptiveMargin,omitempty"`
+	CPUMargin      int  `json:"cpuMargin,omitempty"`
+	MemoryMargin   int  `json:"memoryMargin,omitempty"`
+
+	// Set when only requests were sized and the limits are the current ones, left out of patches.
+	// A request that would exceed its kept limit is held at the limit.
+	LimitsKept           bool `json:"limitsKept,omitempty"`
+	CPURequestAtLimit    bool `json:"cpuRequestAtLimit,omitempty"`
+	MemoryRequestAtLimit bool `json:"memoryRequestAtLimit,omitempty"`
+
+	// Usage of the cold start window, when the limits were sized to cover its peak and everything
+	// else from the steady state after it
+	ColdStart *ColdStartProfile `json:"coldStart,omitempty"`
+
+	// Set when the recommendation was blended with those of earlier runs: how many, and what this
+	// run alone recommended
+	BlendedRuns int     `json:"blendedRuns,omitempty"`
+	Unblended   *Record `json:"unblended,omitempty"`
+
+	// Target utilization for the workload's HorizontalPodAutoscaler that the CPU request was sized
+	// to be compatible with
+	HPA *HPATarget `json:"hpa,omitempty"`
+
+	// Highest memory sample, when fewer than Options.MemoryPeakSamples samples reached it and it
+	// was set aside as a spike
+	MemorySpike float64 `json:"memorySpike,omitempty"`
+}
+
+// Options configures how recommendations are generated
+type Options struct {
+	Strategy          string  // Name of the sizing strategy (defaults to DefaultStrategy)
+	Margin            int     // Safety margin percentage added to usage
+	Percentile        float64 // Usage percentile (0-100) for the percentile and pod-peak strategies
+	CPURequestStat    string  // Usage statistic the margin strategy sizes the CPU request from (defaults to DefaultCPURequestStat)
+	MemoryRequestStat string  // Usage statistic the margin strategy sizes the memory request from (defaults to DefaultMemoryRequestStat)
+	TargetUtilization float64 // Target average utilization percentage of requests for the utilization strategy
+	ThrottleAware     bool    // Raise the CPU limit if usage is pinned at the current limit
+	ThrottleThreshold float64 // Fraction of throttled samples that triggers the throttle rule (defaults to DefaultThrottleThreshold)
+	RecencyLinear     bool    // Weight samples linearly toward recent ones when averaging
+	RecencyDecay      float64 // Exponential decay per older sample when averaging, in (0, 1) (0 weights samples equally)
+	MaxDownsize       float64 // Maximum percentage a request may drop below the current one in a single run (0 disables)
+	NeverDownsize     bool    // Never recommend less than a current request or limit
+	ProbeAware        bool    // Keep ProbeHeadroom over peak CPU in the CPU limit, for workloads with liveness or startup probes
+	MaxLimitRatio     float64 // Maximum memory limit as a multiple of the memory request, at least 1 (0 disables)
+	MaxCPU            float64 // Hard cap on the CPU request and limit in cores (0 disables)
+	MaxMemory         float64 // Hard cap on the memory request and limit in Mi (0 disables)
+
+	// Samples of each pod by pod name, which the pod-peak strategy sizes from
+	PodSamples map[string][]metrics.ResourceMetrics
+
+	// Scale the margin of each resource between MinMargin and MaxMargin with the variance of its
+	// usage instead of applying Margin
+	AdaptiveMargin bool
+	MinMargin      int
+	MaxMargin      int
+
+	// Size only requests and keep the current limits unchanged
+	RequestsOnly bool
+
+	// Size the limits to also cover the peak of the samples within this long of the first one,
+	// and everything else from the samples after it (0 disables)
+	ColdStartWindow time.Duration
+
+	// Recommendations of earlier runs, oldest first, blended in with BlendWithHistory using
+	// HistoryDecay (0 disables)
+	History      []Record
+	HistoryDecay float64
+
+	// Recommend an HPA target utilization that keeps this fraction of the CPU request free, in
+	// (0, 1), and raise the CPU request to be compatible with it (0 disables)
+	HPAHeadroom float64
+
+	// Samples that must reach a memory level before it counts as the peak the memory limit is
+	// sized from, so a single spike doesn't inflate it (0 or 1 uses the highest sample)
+	MemoryPeakSamples int
+}
+
+// Usage holds the usage statistics that each recommended value is derived from
+type Usage struct {
 	CPURequest    float64
 	CPULimit      float64
 	MemoryRequest float64
@@ -14,37 +129,269 @@ type Recommendations struct {
 }
 
 // GenerateRecommendations calculates recommended resource settings based on collected metrics
+// using the default strategy
 func GenerateRecommendations(
 	allMetrics []metrics.ResourceMetrics,
 	currentSettings kubernetes.ResourceSettings,
 	margin int,
 ) Recommendations {
-	// Calculate average and peak metrics
-	avgCPU, avgMemory := metrics.CalculateAverageMetrics(allMetrics)
-	peakCPU, peakMemory := metrics.CalculatePeakMetrics(allMetrics)
+	// The default strategy is always registered, so this can't fail
+	recommendations, _ := Generate(allMetrics, currentSettings, Options{Margin: margin})
+	return recommendations
+}
 
-	// Apply safety margin
-	marginMultiplier := 1.0 + (float64(margin) / 100.0)
+// Generate dispatches to the strategy named in the options and applies the common
+// post-processing steps to its result
+func Generate(
+	allMetrics []metrics.ResourceMetrics,
+	currentSettings kubernetes.ResourceSettings,
+	opts Options,
+) (Recommendations, error) {
+	name := opts.Strategy
+	if name == "" {
+		name = DefaultStrategy
+	}
 
-	// Generate recommendations
-	recommendations := Recommendations{
-		// CPU request based on average usage with margin
-		CPURequest: avgCPU * marginMultiplier,
+	strategy, ok := Lookup(name)
+	if !ok {
+		return Recommendations{}, fmt.Errorf("unknown strategy %q (available: %v)", name, StrategyNames())
+	}
 
-		// CPU limit based on peak usage with margin
-		CPULimit: peakCPU * marginMultiplier,
+	// A cold start burst only shapes the limits, so it's kept out of the steady-state sizing
+	var coldStart *ColdStartProfile
+	if opts.ColdStartWindow > 0 {
+		coldStart, allMetrics = coldStartProfile(allMetrics, opts.ColdStartWindow)
+	}
+
+	recommendations := strategy.Recommend(allMetrics, currentSettings, opts)
+
+	if opts.AdaptiveMargin {
+		recommendations.AdaptiveMargin = true
+		recommendations.CPUMargin, recommendations.MemoryMargin = opts.margins(allMetrics)
+	}
 
-		// Memory request based on average usage with margin
-		MemoryRequest: avgMemory * marginMultiplier,
+	if opts.ThrottleAware {
+		recommendations = applyThrottleRule(recommendations, allMetrics, currentSettings, opts)
+	}
 
-		// Memory limit based on peak usage with margin
-		MemoryLimit: peakMemory * marginMultiplier,
+	if opts.MaxLimitRatio >= 1 {
+		recommendations = applyMaxLimitRatio(recommendations, opts.MaxLimitRatio)
 	}
 
 	// Apply some reasonable minimum values
 	recommendations = applyMinimumValues(recommendations)
 
-	return recommendations
+	// A spike only counts as set aside if the limit, now at least the request, stayed below it
+	if opts.MemoryPeakSamples > 1 {
+		if spike := memorySpike(allMetrics, opts, name == PodPeakStrategyName); spike > recommendations.MemoryLimit {
+			recommendations.MemorySpike = spike
+		}
+	}
+
+	// Guardrails and caps below still apply to the blended values
+	if opts.HistoryDecay > 0 {
+		recommendations = BlendWithHistory(recommendations, opts.History, opts.HistoryDecay)
+	}
+
+	if opts.MaxDownsize > 0 {
+		recommendations = applyMaxDownsize(recommendations, currentSettings, opts.MaxDownsize)
+	}
+
+	if opts.NeverDownsize {
+		recommendations = applyNeverDownsize(recommendations, currentSettings)
+	}
+
+	if opts.ProbeAware {
+		recommendations = applyProbeHeadroom(recommendations, allMetrics)
+	}
+
+	if coldStart != nil {
+		cpuMargin, memoryMargin := opts.margins(allMetrics)
+		recommendations = applyColdStart(recommendations, coldStart, cpuMargin, memoryMargin)
+	}
+
+	if opts.HPAHeadroom > 0 {
+		recommendations = applyHPAHeadroom(recommendations, allMetrics, opts)
+	}
+
+	if opts.RequestsOnly {
+		recommendations = applyKeepLimits(recommendations, currentSettings)
+	}
+
+	// Policy caps are applied last, so nothing can push a value past them
+	recommendations = applyCaps(recommendations, opts.MaxCPU, opts.MaxMemory)
+
+	// A cap can undo the probe headroom, which is worth a warning rather than exceeding the cap
+	if opts.ProbeAware && recommendations.CPULimit < probeSafeLimit(allMetrics) {
+		recommendations.ProbeStarvationRisk = true
+	}
+
+	return finishHPATarget(recommendations, allMetrics, opts), nil
+}
+
+// applyCaps holds the requests and limits at the CPU and memory caps, marking the resources
+// whose recommendation had to be lowered. A zero cap is ignored.
+func applyCaps(r Recommendations, maxCPU, maxMemory float64) Recommendations {
+	if maxCPU > 0 && (r.CPURequest > maxCPU || r.CPULimit > maxCPU) {
+		r.CPURequest = math.Min(r.CPURequest, maxCPU)
+		r.CPULimit = math.Min(r.CPULimit, maxCPU)
+		r.CPUCapped = true
+	}
+	if maxMemory > 0 && (r.MemoryRequest > maxMemory || r.MemoryLimit > maxMemory) {
+		r.MemoryRequest = math.Min(r.MemoryRequest, maxMemory)
+		r.MemoryLimit = math.Min(r.MemoryLimit, maxMemory)
+		r.MemoryCapped = true
+	}
+	return r
+}
+
+// applyKeepLimits replaces the recommended limits with the current ones, for rollouts that tune
+// requests first. A request above its current limit would be rejected by the API server, so it
+// is held at the limit instead.
+func applyKeepLimits(r Recommendations, currentSettings kubernetes.ResourceSettings) Recommendations {
+	r.LimitsKept = true
+	r.CPULimit, r.MemoryLimit = currentSettings.CPULimit, currentSettings.MemoryLimit
+
+	if currentSettings.HasCPULimit && r.CPURequest > r.CPULimit {
+		r.CPURequest = r.CPULimit
+		r.CPURequestAtLimit = true
+	}
+	if currentSettings.HasMemoryLimit && r.MemoryRequest > r.MemoryLimit {
+		r.MemoryRequest = r.MemoryLimit
+		r.MemoryRequestAtLimit = true
+	}
+	return r
+}
+
+// applyMaxDownsize keeps the requests from dropping more than maxDownsize percent below the
+// current requests, so repeated runs tighten resources gradually
+func applyMaxDownsize(r Recommendations, currentSettings kubernetes.ResourceSettings, maxDownsize float64) Recommendations {
+	floor := 1.0 - maxDownsize/100.0
+
+	if currentSettings.HasCPURequest && r.CPURequest < currentSettings.CPURequest*floor {
+		r.CPURequest = currentSettings.CPURequest * floor
+		r.CPURequestClamped = true
+	}
+	if currentSettings.HasMemoryRequest && r.MemoryRequest < currentSettings.MemoryRequest*floor {
+		r.MemoryRequest = currentSettings.MemoryRequest * floor
+		r.MemoryRequestClamped = true
+	}
+
+	// Ensure limits are not smaller than the clamped requests
+	if r.CPULimit < r.CPURequest {
+		r.CPULimit = r.CPURequest
+	}
+	if r.MemoryLimit < r.MemoryRequest {
+		r.MemoryLimit = r.MemoryRequest
+	}
+
+	return r
+}
+
+// applyNeverDownsize raises every recommended value that is set on the workload to at least
+// its current setting, marking which values were floored
+func applyNeverDownsize(r Recommendations, currentSettings kubernetes.ResourceSettings) Recommendations {
+	floor := func(value *float64, current float64, set bool) bool {
+		if !set || *value >= current {
+			return false
+		}
+		*value = current
+		return true
+	}
+	r.CPURequestFloored = floor(&r.CPURequest, currentSettings.CPURequest, currentSettings.HasCPURequest)
+	r.CPULimitFloored = floor(&r.CPULimit, currentSettings.CPULimit, currentSettings.HasCPULimit)
+	r.MemoryRequestFloored = floor(&r.MemoryRequest, currentSettings.MemoryRequest, currentSettings.HasMemoryRequest)
+	r.MemoryLimitFloored = floor(&r.MemoryLimit, currentSettings.MemoryLimit, currentSettings.HasMemoryLimit)
+
+	// A floored request can exceed a limit that isn't set on the workload
+	if r.CPULimit < r.CPURequest {
+		r.CPULimit = r.CPURequest
+	}
+	if r.MemoryLimit < r.MemoryRequest {
+		r.MemoryLimit = r.MemoryRequest
+	}
+
+	return r
+}
+
+// applyMaxLimitRatio keeps the memory limit within ratio times the memory request. The limit
+// comes from peak usage and lowering it would invite OOM kills, so the request is raised to
+// narrow the Burstable gap instead.
+func applyMaxLimitRatio(r Recommendations, ratio float64) Recommendations {
+	if r.MemoryLimit > r.MemoryRequest*ratio {
+		r.MemoryRequest = r.MemoryLimit / ratio
+		r.MemoryRequestRaised = true
+	}
+	return r
+}
+
+// applyMargin applies the safety margins of each resource to the usage basis
+func applyMargin(u Usage, cpuMargin, memoryMargin int) Recommendations {
+	cpuMultiplier := 1.0 + (float64(cpuMargin) / 100.0)
+	memoryMultiplier := 1.0 + (float64(memoryMargin) / 100.0)
+
+	return Recommendations{
+		CPURequest:    u.CPURequest * cpuMultiplier,
+		CPULimit:      u.CPULimit * cpuMultiplier,
+		MemoryRequest: u.MemoryRequest * memoryMultiplier,
+		MemoryLimit:   u.MemoryLimit * memoryMultiplier,
+	}
+}
+
+// Comparison is the recommendation produced by one sizing algorithm
+type Comparison struct {
+	Algorithm       string          `json:"algorithm"`
+	Description     string          `json:"description"`
+	Recommendations Recommendations `json:"recommendations"`
+}
+
+// CompareAlgorithms runs the average-, peak-, and percentile-based sizing algorithms over the
+// same samples so their implied requests and limits can be compared side by side. Each applies
+// the margin of opts, adaptive or fixed, as the recommendation does.
+func CompareAlgorithms(
+	allMetrics []metrics.ResourceMetrics,
+	currentSettings kubernetes.ResourceSettings,
+	opts Options,
+) []Comparison {
+	cpuMargin, memoryMargin := opts.margins(allMetrics)
+	peakCPU, peakMemory := metrics.CalculatePeakMetrics(allMetrics)
+	p90CPU, p90Memory := metrics.CalculatePercentileMetrics(allMetrics, 90)
+	p99CPU, p99Memory := metrics.CalculatePercentileMetrics(allMetrics, 99)
+
+	return []Comparison{
+		{
+			Algorithm:   "average",
+			Description: "requests from average, limits from peak",
+			Recommendations: applyMinimumValues(MarginStrategy{}.Recommend(allMetrics, currentSettings, Options{
+				Margin:            opts.Margin,
+				AdaptiveMargin:    opts.AdaptiveMargin,
+				MinMargin:         opts.MinMargin,
+				MaxMargin:         opts.MaxMargin,
+				CPURequestStat:    StatAverage,
+				MemoryRequestStat: StatAverage,
+			})),
+		},
+		{
+			Algorithm:   "peak",
+			Description: "requests and limits from peak",
+			Recommendations: applyMinimumValues(applyMargin(Usage{
+				CPURequest:    peakCPU,
+				CPULimit:      peakCPU,
+				MemoryRequest: peakMemory,
+				MemoryLimit:   peakMemory,
+			}, cpuMargin, memoryMargin)),
+		},
+		{
+			Algorithm:   "percentile",
+			Description: "requests from p90, limits from p99",
+			Recommendations: applyMinimumValues(applyMargin(Usage{
+				CPURequest:    p90CPU,
+				CPULimit:      p99CPU,
+				MemoryRequest: p90Memory,
+				MemoryLimit:   p99Memory,
+			}, cpuMargin, memoryMargin)),
+		},
+	}
 }
 
 // applyMinimumValues ensures we don't recommend values that are too small
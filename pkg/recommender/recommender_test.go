@@ -1,6 +1,7 @@
 package recommender
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -41,14 +42,14 @@ func TestGenerateRecommendations(t *testing.T) {
 	recommendations := GenerateRecommendations(testMetrics, currentSettings, margin)
 
 	// Expected results (with 20% margin):
-	// Avg CPU: (0.1 + 0.15 + 0.2) / 3 = 0.15, with 20% margin = 0.18
+	// P90 CPU: 0.15 + (0.2 - 0.15) * 0.8 = 0.19, with 20% margin = 0.228
 	// Peak CPU: 0.2, with 20% margin = 0.24
 	// Avg Memory: (100 + 120 + 150) / 3 = 123.33, with 20% margin = 148
 	// Peak Memory: 150, with 20% margin = 180
 
 	// Test CPU request (tolerance for floating point comparison)
-	if diff := abs(recommendations.CPURequest - 0.18); diff > 0.001 {
-		t.Errorf("CPU Request: got %.3f, want %.3f", recommendations.CPURequest, 0.18)
+	if diff := abs(recommendations.CPURequest - 0.228); diff > 0.001 {
+		t.Errorf("CPU Request: got %.3f, want %.3f", recommendations.CPURequest, 0.228)
 	}
 
 	// Test CPU limit
@@ -101,3 +102,587 @@ func abs(x float64) float64 {
 	}
 	return x
 }
+
+func TestGenerateWithStrategies(t *testing.T) {
+	testMetrics := []metrics.ResourceMetrics{
+		{Timestamp: time.Now(), CPUUsage: 0.1, MemoryUsage: 100},
+		{Timestamp: time.Now(), CPUUsage: 0.2, MemoryUsage: 200},
+	}
+	currentSettings := kubernetes.ResourceSettings{}
+
+	// The default strategy matches GenerateRecommendations
+	defaultRecs, err := Generate(testMetrics, currentSettings, Options{Margin: 20})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if defaultRecs != GenerateRecommendations(testMetrics, currentSettings, 20) {
+		t.Errorf("default strategy: got %+v, want GenerateRecommendations result", defaultRecs)
+	}
+
+	// Utilization: avg CPU 0.15 at 50% target utilization = 0.3 request
+	utilRecs, err := Generate(testMetrics, currentSettings, Options{Strategy: "utilization", TargetUtilization: 50})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := abs(utilRecs.CPURequest - 0.3); diff > 0.001 {
+		t.Errorf("Utilization CPU Request: got %.3f, want %.3f", utilRecs.CPURequest, 0.3)
+	}
+
+	// Custom strategies can be registered by name
+	Register("fixed", StrategyFunc(func([]metrics.ResourceMetrics, kubernetes.ResourceSettings, Options) Recommendations {
+		return Recommendations{CPURequest: 1, CPULimit: 2, MemoryRequest: 512, MemoryLimit: 1024}
+	}))
+	fixedRecs, err := Generate(testMetrics, currentSettings, Options{Strategy: "fixed"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fixedRecs.CPULimit != 2 || fixedRecs.MemoryLimit != 1024 {
+		t.Errorf("custom strategy: got %+v", fixedRecs)
+	}
+
+	if _, err := Generate(testMetrics, currentSettings, Options{Strategy: "does-not-exist"}); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+func TestPodPeakStrategy(t *testing.T) {
+	// Pod i peaks at (i+1)*100m CPU and (i+1)*100Mi memory, after a quieter sample
+	podSamples := make(map[string][]metrics.ResourceMetrics)
+	for i := 0; i < 10; i++ {
+		peak := float64(i + 1)
+		podSamples[fmt.Sprintf("web-%d", i)] = []metrics.ResourceMetrics{
+			{Timestamp: time.Now(), CPUUsage: 0.05, MemoryUsage: 50},
+			{Timestamp: time.Now(), CPUUsage: peak * 0.1, MemoryUsage: peak * 100},
+		}
+	}
+	fleet := []metrics.ResourceMetrics{{Timestamp: time.Now(), CPUUsage: 0.3, MemoryUsage: 300}}
+
+	// p90 of the ten peaks interpolates between the 9th and 10th; limits come from the highest
+	recs, err := Generate(fleet, kubernetes.ResourceSettings{}, Options{
+		Strategy:   PodPeakStrategyName,
+		Percentile: 90,
+		PodSamples: podSamples,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if abs(recs.CPURequest-0.91) > 0.001 || abs(recs.CPULimit-1.0) > 0.001 {
+		t.Errorf("CPU: got %.3f/%.3f, want 0.910/1.000", recs.CPURequest, recs.CPULimit)
+	}
+	if abs(recs.MemoryRequest-910) > 0.1 || abs(recs.MemoryLimit-1000) > 0.1 {
+		t.Errorf("memory: got %.1f/%.1f, want 910/1000", recs.MemoryRequest, recs.MemoryLimit)
+	}
+
+	// Without per-pod samples the fleet samples count as a single pod
+	recs, err = Generate(fleet, kubernetes.ResourceSettings{}, Options{Strategy: PodPeakStrategyName, Percentile: 90})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if abs(recs.CPURequest-0.3) > 0.001 || abs(recs.MemoryRequest-300) > 0.1 {
+		t.Errorf("fallback: got %.3f CPU, %.1f memory, want 0.300, 300", recs.CPURequest, recs.MemoryRequest)
+	}
+}
+
+func TestAdaptiveMargin(t *testing.T) {
+	opts := Options{AdaptiveMargin: true, MinMargin: DefaultMinMargin, MaxMargin: DefaultMaxMargin}
+
+	// Flat usage gets the minimum margin for both resources
+	var steady, volatile []metrics.ResourceMetrics
+	for i := 0; i < 10; i++ {
+		steady = append(steady, metrics.ResourceMetrics{Timestamp: time.Now(), CPUUsage: 0.5, MemoryUsage: 100})
+		// CPU swings between 100m and 900m (CV 0.8), memory stays flat
+		volatile = append(volatile, metrics.ResourceMetrics{Timestamp: time.Now(), CPUUsage: 0.1 + 0.8*float64(i%2), MemoryUsage: 100})
+	}
+
+	recs, err := Generate(steady, kubernetes.ResourceSettings{}, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !recs.AdaptiveMargin || recs.CPUMargin != 10 || recs.MemoryMargin != 10 {
+		t.Errorf("steady: got margins %d%%/%d%%, want 10%%/10%%", recs.CPUMargin, recs.MemoryMargin)
+	}
+	if abs(recs.CPURequest-0.55) > 0.001 || abs(recs.MemoryRequest-110) > 0.1 {
+		t.Errorf("steady: got %.3f CPU, %.1f memory, want 0.550, 110", recs.CPURequest, recs.MemoryRequest)
+	}
+
+	recs, err = Generate(volatile, kubernetes.ResourceSettings{}, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if recs.CPUMargin != 50 || recs.MemoryMargin != 10 {
+		t.Errorf("volatile: got margins %d%%/%d%%, want 50%%/10%%", recs.CPUMargin, recs.MemoryMargin)
+	}
+	if abs(recs.CPURequest-1.35) > 0.001 || abs(recs.MemoryRequest-110) > 0.1 {
+		t.Errorf("volatile: got %.3f CPU, %.1f memory, want 1.350, 110", recs.CPURequest, recs.MemoryRequest)
+	}
+
+	// The compared algorithms apply the same adaptive margins
+	for _, c := range CompareAlgorithms(volatile, kubernetes.ResourceSettings{}, opts) {
+		if c.Algorithm == "peak" && (abs(c.Recommendations.CPURequest-1.35) > 0.001 || abs(c.Recommendations.MemoryRequest-110) > 0.1) {
+			t.Errorf("peak comparison: got %.3f CPU, %.1f memory, want 1.350, 110", c.Recommendations.CPURequest, c.Recommendations.MemoryRequest)
+		}
+	}
+
+	// Between the bounds the margin scales linearly up to AdaptiveMarginFullCV
+	if got := AdaptiveMargin(AdaptiveMarginFullCV/2, 10, 50); got != 30 {
+		t.Errorf("AdaptiveMargin at half the full CV = %d, want 30", got)
+	}
+}
+
+func TestRequestsOnly(t *testing.T) {
+	samples := []metrics.ResourceMetrics{
+		{Timestamp: time.Now(), CPUUsage: 0.2, MemoryUsage: 400},
+		{Timestamp: time.Now(), CPUUsage: 0.2, MemoryUsage: 400},
+	}
+	current := kubernetes.ResourceSettings{
+		CPURequest: 1, CPULimit: 2, MemoryRequest: 256, MemoryLimit: 300,
+		HasCPURequest: true, HasCPULimit: true, HasMemoryRequest: true, HasMemoryLimit: true,
+	}
+
+	recs, err := Generate(samples, current, Options{Margin: 20, RequestsOnly: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !recs.LimitsKept || recs.CPULimit != 2 || recs.MemoryLimit != 300 {
+		t.Errorf("limits: got %.3f/%.1f (kept %v), want the current 2/300", recs.CPULimit, recs.MemoryLimit, recs.LimitsKept)
+	}
+	if abs(recs.CPURequest-0.24) > 0.001 || recs.CPURequestAtLimit {
+		t.Errorf("CPU request: got %.3f (at limit %v), want 0.240", recs.CPURequest, recs.CPURequestAtLimit)
+	}
+	// 480Mi of usage plus margin would exceed the 300Mi limit that is kept
+	if recs.MemoryRequest != 300 || !recs.MemoryRequestAtLimit {
+		t.Errorf("memory request: got %.1f (at limit %v), want 300 held at the limit", recs.MemoryRequest, recs.MemoryRequestAtLimit)
+	}
+}
+
+func TestColdStart(t *testing.T) {
+	start := time.Now()
+	var samples []metrics.ResourceMetrics
+	for i := 0; i < 10; i++ {
+		s := metrics.ResourceMetrics{Timestamp: start.Add(time.Duration(i) * 5 * time.Second), CPUUsage: 0.2, MemoryUsage: 200}
+		if i < 3 {
+			s.CPUUsage, s.MemoryUsage = 1, 500
+		}
+		samples = append(samples, s)
+	}
+
+	recs, err := Generate(samples, kubernetes.ResourceSettings{}, Options{Margin: 20, ColdStartWindow: 15 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cs := recs.ColdStart
+	if cs == nil {
+		t.Fatal("no cold start profile")
+	}
+	if cs.Samples != 3 || cs.PeakCPU != 1 || cs.PeakMemory != 500 || !cs.CPULimitRaised || !cs.MemoryLimitRaised {
+		t.Errorf("profile: got %+v, want 3 samples peaking at 1 core and 500Mi with both limits raised", *cs)
+	}
+	if abs(recs.CPURequest-0.24) > 0.001 || abs(recs.MemoryRequest-240) > 0.001 {
+		t.Errorf("requests: got %.3f/%.1f, want the steady-state 0.240/240", recs.CPURequest, recs.MemoryRequest)
+	}
+	if abs(recs.CPULimit-1.2) > 0.001 || abs(recs.MemoryLimit-600) > 0.001 {
+		t.Errorf("limits: got %.3f/%.1f, want the cold start peak plus margin 1.200/600", recs.CPULimit, recs.MemoryLimit)
+	}
+
+	// Without samples after the window, everything is sized together
+	recs, err = Generate(samples, kubernetes.ResourceSettings{}, Options{Margin: 20, ColdStartWindow: time.Minute})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if recs.ColdStart != nil {
+		t.Errorf("got a cold start profile for a window covering every sample: %+v", *recs.ColdStart)
+	}
+}
+
+func TestBlendWithHistory(t *testing.T) {
+	current := Recommendations{CPURequest: 0.4, CPULimit: 0.8, MemoryRequest: 400, MemoryLimit: 800}
+	history := []Record{
+		{CPURequest: 0.1, CPULimit: 0.2, MemoryRequest: 100, MemoryLimit: 200},
+		{CPURequest: 0.2, CPULimit: 0.4, MemoryRequest: 200, MemoryLimit: 400},
+	}
+
+	// Weights 1 for the current run, 0.5 for the most recent earlier one, and 0.25 for the oldest
+	blended := BlendWithHistory(current, history, 0.5)
+	if want := (0.4 + 0.5*0.2 + 0.25*0.1) / 1.75; abs(blended.CPURequest-want) > 1e-9 {
+		t.Errorf("CPU request: got %.4f, want %.4f", blended.CPURequest, want)
+	}
+	if want := (800 + 0.5*400 + 0.25*200) / 1.75; abs(blended.MemoryLimit-want) > 1e-9 {
+		t.Errorf("memory limit: got %.1f, want %.1f", blended.MemoryLimit, want)
+	}
+	if blended.BlendedRuns != 2 || blended.Unblended == nil || blended.Unblended.CPURequest != 0.4 {
+		t.Errorf("got %d blended runs, unblended %+v, want 2 and the current values", blended.BlendedRuns, blended.Unblended)
+	}
+
+	if unchanged := BlendWithHistory(current, nil, 0.5); unchanged.CPURequest != 0.4 || unchanged.Unblended != nil {
+		t.Errorf("without history: got %+v", unchanged)
+	}
+}
+
+func TestHPAHeadroom(t *testing.T) {
+	testMetrics := []metrics.ResourceMetrics{
+		{Timestamp: time.Now(), CPUUsage: 0.4, MemoryUsage: 100},
+		{Timestamp: time.Now(), CPUUsage: 0.6, MemoryUsage: 100},
+	}
+
+	// A 50% target needs a 1 core request for the 0.5 core average, above what the margin gives
+	recs, err := Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20, HPAHeadroom: 0.5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hpa := recs.HPA
+	if hpa == nil || hpa.Utilization != 50 || !hpa.RequestRaised {
+		t.Fatalf("HPA target: got %+v, want 50%% with the request raised", hpa)
+	}
+	if abs(recs.CPURequest-1) > 0.001 || recs.CPULimit < recs.CPURequest {
+		t.Errorf("CPU: got %.3f/%.3f, want a 1 core request and a limit at least as high", recs.CPURequest, recs.CPULimit)
+	}
+	if abs(hpa.LoadUtilization-50) > 0.001 || hpa.OverTarget() {
+		t.Errorf("load utilization: got %.1f%%, want the 50%% target", hpa.LoadUtilization)
+	}
+
+	// A request above what the target needs is kept
+	plain, _ := Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20})
+	recs, _ = Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20, HPAHeadroom: 0.1})
+	if recs.HPA.Utilization != 90 || recs.HPA.RequestRaised || recs.CPURequest != plain.CPURequest {
+		t.Errorf("got %+v and a %.3f request, want a 90%% target and the %.3f request unchanged", *recs.HPA, recs.CPURequest, plain.CPURequest)
+	}
+
+	// A cap holding the request down leaves the load over the target
+	recs, _ = Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20, HPAHeadroom: 0.5, MaxCPU: 0.8})
+	if !recs.HPA.OverTarget() {
+		t.Errorf("got %+v, want the capped request to put the load over the target", *recs.HPA)
+	}
+}
+
+func TestMemoryPeakSamples(t *testing.T) {
+	// A single 1000Mi glitch among samples that peak at a sustained 300Mi
+	var testMetrics []metrics.ResourceMetrics
+	for i := 0; i < 23; i++ {
+		s := metrics.ResourceMetrics{Timestamp: time.Now(), CPUUsage: 0.1, MemoryUsage: 250}
+		switch i {
+		case 5, 15:
+			s.MemoryUsage = 300
+		case 10:
+			s.MemoryUsage = 1000
+		}
+		testMetrics = append(testMetrics, s)
+	}
+
+	plain, _ := Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20})
+	if abs(plain.MemoryLimit-1200) > 0.001 || plain.MemorySpike != 0 {
+		t.Errorf("without the option: got a %.1fMi limit and spike %.0f, want the spike's 1200Mi", plain.MemoryLimit, plain.MemorySpike)
+	}
+
+	recs, err := Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20, MemoryPeakSamples: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if abs(recs.MemoryLimit-360) > 0.001 {
+		t.Errorf("memory limit: got %.1fMi, want the sustained peak plus margin 360Mi", recs.MemoryLimit)
+	}
+	if recs.MemorySpike != 1000 {
+		t.Errorf("memory spike: got %.0f, want 1000", recs.MemorySpike)
+	}
+	if recs.CPULimit != plain.CPULimit || recs.MemoryRequest != plain.MemoryRequest {
+		t.Error("only the memory peak should change")
+	}
+
+	// Two of 41 pods glitch to 1000Mi once. Pooled, 1000Mi is reached twice, but pod-peak sets
+	// each pod's glitch aside, and the spike is noted because the limit was sized below it.
+	steady := append([]metrics.ResourceMetrics{}, testMetrics...)
+	steady[10].MemoryUsage = 250
+	podSamples := map[string][]metrics.ResourceMetrics{"glitch-a": testMetrics, "glitch-b": testMetrics}
+	pooled := append(append([]metrics.ResourceMetrics{}, testMetrics...), testMetrics...)
+	for i := 0; i < 39; i++ {
+		podSamples[fmt.Sprintf("steady-%d", i)] = steady
+		pooled = append(pooled, steady...)
+	}
+	opts := Options{Margin: 20, MemoryPeakSamples: 2, Strategy: PodPeakStrategyName, PodSamples: podSamples}
+	recs, err = Generate(pooled, kubernetes.ResourceSettings{}, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if abs(recs.MemoryLimit-360) > 0.001 || recs.MemorySpike != 1000 {
+		t.Errorf("pod-peak: got a %.1fMi limit and spike %.0f, want 360Mi and 1000", recs.MemoryLimit, recs.MemorySpike)
+	}
+
+	// Requests are still sized from each pod's actual peak, and a request that covers the spike
+	// lifts the limit over it, leaving nothing set aside
+	opts.PodSamples = map[string][]metrics.ResourceMetrics{"glitch-a": testMetrics, "glitch-b": testMetrics}
+	recs, err = Generate(pooled[:2*len(testMetrics)], kubernetes.ResourceSettings{}, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if abs(recs.MemoryRequest-1200) > 0.001 || recs.MemorySpike != 0 {
+		t.Errorf("pod-peak memory request: got %.1fMi and spike %.0f, want the pods' 1000Mi peaks plus margin 1200Mi and no spike", recs.MemoryRequest, recs.MemorySpike)
+	}
+}
+
+func TestThrottleAware(t *testing.T) {
+	// Usage pinned at the 200m limit in half of the samples
+	testMetrics := []metrics.ResourceMetrics{
+		{Timestamp: time.Now(), CPUUsage: 0.1, MemoryUsage: 100},
+		{Timestamp: time.Now(), CPUUsage: 0.2, MemoryUsage: 100},
+		{Timestamp: time.Now(), CPUUsage: 0.15, MemoryUsage: 100},
+		{Timestamp: time.Now(), CPUUsage: 0.199, MemoryUsage: 100},
+	}
+	currentSettings := kubernetes.ResourceSettings{CPULimit: 0.2, HasCPULimit: true}
+
+	if ratio := ThrottleRatio(testMetrics, currentSettings); ratio != 0.5 {
+		t.Errorf("ThrottleRatio: got %.2f, want 0.50", ratio)
+	}
+
+	recs, err := Generate(testMetrics, currentSettings, Options{Margin: 20, ThrottleAware: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !recs.ThrottlingDetected {
+		t.Error("expected throttling to be detected")
+	}
+	// The limit is raised to at least the current limit plus the margin: 0.2 + 20% = 0.24
+	if recs.CPULimit < 0.24-0.001 {
+		t.Errorf("CPU Limit: got %.3f, want at least 0.24", recs.CPULimit)
+	}
+
+	// Without the option, or without a CPU limit, nothing changes
+	plain, _ := Generate(testMetrics, currentSettings, Options{Margin: 20})
+	if plain.ThrottlingDetected {
+		t.Error("throttling reported without --target-cpu-throttle-aware")
+	}
+	noLimit, _ := Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20, ThrottleAware: true})
+	if noLimit.ThrottlingDetected {
+		t.Error("throttling reported for a workload without a CPU limit")
+	}
+}
+
+func TestMaxDownsize(t *testing.T) {
+	testMetrics := []metrics.ResourceMetrics{
+		{Timestamp: time.Now(), CPUUsage: 0.1, MemoryUsage: 100},
+		{Timestamp: time.Now(), CPUUsage: 0.1, MemoryUsage: 100},
+	}
+	currentSettings := kubernetes.ResourceSettings{
+		CPURequest: 1, HasCPURequest: true,
+		MemoryRequest: 110, HasMemoryRequest: true,
+	}
+
+	recs, err := Generate(testMetrics, currentSettings, Options{Margin: 20, MaxDownsize: 25})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The CPU request would drop from 1 to 0.12, so it's held at 1 - 25% = 0.75
+	if diff := abs(recs.CPURequest - 0.75); diff > 0.001 || !recs.CPURequestClamped {
+		t.Errorf("CPU Request: got %.3f (clamped %v), want 0.750 (clamped)", recs.CPURequest, recs.CPURequestClamped)
+	}
+	if recs.CPULimit < recs.CPURequest {
+		t.Errorf("CPU Limit %.3f is below the clamped request %.3f", recs.CPULimit, recs.CPURequest)
+	}
+
+	// The memory request of 120Mi is within the guardrail and left alone
+	if diff := abs(recs.MemoryRequest - 120); diff > 0.1 || recs.MemoryRequestClamped {
+		t.Errorf("Memory Request: got %.1f (clamped %v), want 120.0 (not clamped)", recs.MemoryRequest, recs.MemoryRequestClamped)
+	}
+}
+
+func TestNeverDownsize(t *testing.T) {
+	testMetrics := []metrics.ResourceMetrics{
+		{Timestamp: time.Now(), CPUUsage: 0.1, MemoryUsage: 500},
+		{Timestamp: time.Now(), CPUUsage: 0.1, MemoryUsage: 500},
+	}
+	currentSettings := kubernetes.ResourceSettings{
+		CPURequest: 1, HasCPURequest: true,
+		CPULimit: 2, HasCPULimit: true,
+		MemoryRequest: 256, HasMemoryRequest: true,
+	}
+
+	recs, err := Generate(testMetrics, currentSettings, Options{Margin: 20, NeverDownsize: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Both CPU values would drop to 0.12, so they're kept at the current settings
+	if diff := abs(recs.CPURequest - 1); diff > 0.001 || !recs.CPURequestFloored {
+		t.Errorf("CPU Request: got %.3f (floored %v), want 1.000 (floored)", recs.CPURequest, recs.CPURequestFloored)
+	}
+	if diff := abs(recs.CPULimit - 2); diff > 0.001 || !recs.CPULimitFloored {
+		t.Errorf("CPU Limit: got %.3f (floored %v), want 2.000 (floored)", recs.CPULimit, recs.CPULimitFloored)
+	}
+
+	// The memory request grows to 600Mi and the unset memory limit has nothing to floor to
+	if diff := abs(recs.MemoryRequest - 600); diff > 0.1 || recs.MemoryRequestFloored {
+		t.Errorf("Memory Request: got %.1f (floored %v), want 600.0 (not floored)", recs.MemoryRequest, recs.MemoryRequestFloored)
+	}
+	if recs.MemoryLimitFloored {
+		t.Errorf("Memory Limit: floored without a current limit")
+	}
+
+	// Off by default
+	recs, _ = Generate(testMetrics, currentSettings, Options{Margin: 20})
+	if recs.CPURequestFloored || recs.CPULimitFloored || recs.CPURequest >= 1 {
+		t.Errorf("expected downsizing without the option: %+v", recs)
+	}
+}
+
+func TestProbeAware(t *testing.T) {
+	testMetrics := []metrics.ResourceMetrics{
+		{Timestamp: time.Now(), CPUUsage: 0.4, MemoryUsage: 100},
+		{Timestamp: time.Now(), CPUUsage: 1.0, MemoryUsage: 100},
+	}
+
+	// Peak plus the margin gives a 1.2 core limit, below the 1.5 probe-safe limit
+	recs, err := Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20, ProbeAware: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := abs(recs.CPULimit - 1.5); diff > 0.001 || !recs.CPULimitProbeRaised || recs.ProbeStarvationRisk {
+		t.Errorf("CPU Limit: got %.3f (raised %v, risk %v), want 1.500 (raised, no risk)",
+			recs.CPULimit, recs.CPULimitProbeRaised, recs.ProbeStarvationRisk)
+	}
+
+	// A cap below the probe-safe limit wins, but is flagged
+	capped, _ := Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20, ProbeAware: true, MaxCPU: 1.2})
+	if capped.CPULimit > 1.2 || !capped.ProbeStarvationRisk {
+		t.Errorf("capped: got %.3f (risk %v), want at most 1.200 with the risk flagged", capped.CPULimit, capped.ProbeStarvationRisk)
+	}
+
+	// Without the option the limit follows the peak
+	plain, _ := Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20})
+	if diff := abs(plain.CPULimit - 1.2); diff > 0.001 || plain.CPULimitProbeRaised {
+		t.Errorf("without --probe-aware: got %.3f (raised %v), want 1.200", plain.CPULimit, plain.CPULimitProbeRaised)
+	}
+}
+
+func TestMaxLimitRatio(t *testing.T) {
+	// Low average memory with a high peak: 144Mi request vs 480Mi limit after the 20% margin
+	testMetrics := []metrics.ResourceMetrics{
+		{Timestamp: time.Now(), CPUUsage: 0.1, MemoryUsage: 50},
+		{Timestamp: time.Now(), CPUUsage: 0.1, MemoryUsage: 50},
+		{Timestamp: time.Now(), CPUUsage: 0.1, MemoryUsage: 50},
+		{Timestamp: time.Now(), CPUUsage: 0.1, MemoryUsage: 50},
+		{Timestamp: time.Now(), CPUUsage: 0.1, MemoryUsage: 400},
+	}
+
+	recs, err := Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20, MaxLimitRatio: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The limit stays at the peak and the request is raised to 480 / 2 = 240Mi
+	if diff := abs(recs.MemoryLimit - 480); diff > 0.1 {
+		t.Errorf("Memory Limit: got %.1f, want 480.0", recs.MemoryLimit)
+	}
+	if diff := abs(recs.MemoryRequest - 240); diff > 0.1 || !recs.MemoryRequestRaised {
+		t.Errorf("Memory Request: got %.1f (raised %v), want 240.0 (raised)", recs.MemoryRequest, recs.MemoryRequestRaised)
+	}
+
+	// A ratio that already holds leaves the request alone
+	loose, _ := Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20, MaxLimitRatio: 5})
+	if diff := abs(loose.MemoryRequest - 144); diff > 0.1 || loose.MemoryRequestRaised {
+		t.Errorf("Memory Request with ratio 5: got %.1f (raised %v), want 144.0 (not raised)", loose.MemoryRequest, loose.MemoryRequestRaised)
+	}
+}
+
+func TestCaps(t *testing.T) {
+	testMetrics := []metrics.ResourceMetrics{
+		{Timestamp: time.Now(), CPUUsage: 1, MemoryUsage: 300},
+		{Timestamp: time.Now(), CPUUsage: 2, MemoryUsage: 500},
+	}
+
+	// Average usage plus the margin suggests 1.8/2.4 cores and 480/600Mi
+	recs, err := Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20, CPURequestStat: StatAverage, MaxCPU: 2, MaxMemory: 1024})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The CPU limit binds at the cap while the request stays below it
+	if diff := abs(recs.CPULimit - 2); diff > 0.001 || !recs.CPUCapped {
+		t.Errorf("CPU Limit: got %.3f (capped %v), want 2.000 (capped)", recs.CPULimit, recs.CPUCapped)
+	}
+	if diff := abs(recs.CPURequest - 1.8); diff > 0.001 {
+		t.Errorf("CPU Request: got %.3f, want 1.800", recs.CPURequest)
+	}
+
+	// The memory cap doesn't bind
+	if diff := abs(recs.MemoryLimit - 600); diff > 0.1 || recs.MemoryCapped {
+		t.Errorf("Memory Limit: got %.1f (capped %v), want 600.0 (not capped)", recs.MemoryLimit, recs.MemoryCapped)
+	}
+
+	// Caps win over every earlier step, including the minimum values
+	tight, _ := Generate(testMetrics, kubernetes.ResourceSettings{}, Options{Margin: 20, MaxCPU: 0.005, MaxMemory: 16})
+	if tight.CPURequest > 0.005 || tight.CPULimit > 0.005 || tight.MemoryRequest > 16 || tight.MemoryLimit > 16 {
+		t.Errorf("values exceed the caps: %+v", tight)
+	}
+	if !tight.CPUCapped || !tight.MemoryCapped {
+		t.Errorf("expected both resources to be marked capped: %+v", tight)
+	}
+}
+
+func TestRequestStats(t *testing.T) {
+	// 1 to 10 cores and 100 to 1000Mi
+	var testMetrics []metrics.ResourceMetrics
+	for i := 1; i <= 10; i++ {
+		testMetrics = append(testMetrics, metrics.ResourceMetrics{
+			Timestamp: time.Now(), CPUUsage: float64(i), MemoryUsage: float64(i * 100),
+		})
+	}
+
+	tests := []struct {
+		name          string
+		opts          Options
+		cpuRequest    float64
+		memoryRequest float64
+	}{
+		// CPU from the 90th percentile (9.1), memory from the average (550)
+		{"defaults", Options{}, 9.1, 550},
+		{"average cpu", Options{CPURequestStat: "avg"}, 5.5, 550},
+		{"percentile memory", Options{MemoryRequestStat: "p75"}, 9.1, 775},
+		{"peak memory", Options{MemoryRequestStat: "max"}, 9.1, 1000},
+		{"invalid falls back", Options{CPURequestStat: "p0"}, 9.1, 550},
+	}
+	for _, tt := range tests {
+		recs, err := Generate(testMetrics, kubernetes.ResourceSettings{}, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if abs(recs.CPURequest-tt.cpuRequest) > 0.001 || abs(recs.MemoryRequest-tt.memoryRequest) > 0.1 {
+			t.Errorf("%s: got %.3f cores and %.1fMi, want %.3f and %.1fMi",
+				tt.name, recs.CPURequest, recs.MemoryRequest, tt.cpuRequest, tt.memoryRequest)
+		}
+	}
+
+	for value, want := range map[string]string{"average": "avg", "MEAN": "avg", "max": "peak", "P95": "p95", "p99.9": "p99.9"} {
+		if got, err := ParseRequestStat(value); err != nil || got != want {
+			t.Errorf("ParseRequestStat(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "median", "p", "p0", "p101", "95"} {
+		if _, err := ParseRequestStat(value); err == nil {
+			t.Errorf("ParseRequestStat(%q) should fail", value)
+		}
+	}
+}
+
+func TestParseMargin(t *testing.T) {
+	valid := map[string]int{
+		"20":    20,
+		"0":     0,
+		"20%":   20,
+		"12.5%": 13,
+		"1.2":   20,
+		"1.2x":  20,
+		"2x":    100,
+		"1.0":   0,
+	}
+	for value, want := range valid {
+		got, err := ParseMargin(value)
+		if err != nil || got != want {
+			t.Errorf("ParseMargin(%q) = %d, %v; want %d", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"-10", "-5%", "0.8", "0.9x", "", "abc", "NaN%"} {
+		if _, err := ParseMargin(value); err == nil {
+			t.Errorf("ParseMargin(%q) should fail", value)
+		}
+	}
+}
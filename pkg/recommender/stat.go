@@ -0,0 +1,81 @@
+package recommender
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+)
+
+// Usage statistics a resource's request can be sized from: the average, the peak, or a
+// percentile written as "p" followed by the percentile, e.g. "p90"
+const (
+	StatAverage = "avg"
+	StatPeak    = "peak"
+)
+
+// Default request statistics. Memory working sets are fairly stable, so the average is a fair
+// basis, while CPU is spiky and a request at its average leaves the pod throttled for much of
+// the time.
+const (
+	DefaultCPURequestStat    = "p90"
+	DefaultMemoryRequestStat = StatAverage
+)
+
+// ParseRequestStat normalizes a request statistic: "avg" (or "average" or "mean"), "peak" (or
+// "max"), or a percentile such as "p90"
+func ParseRequestStat(value string) (string, error) {
+	stat := strings.ToLower(strings.TrimSpace(value))
+	switch stat {
+	case StatAverage, "average", "mean":
+		return StatAverage, nil
+	case StatPeak, "max":
+		return StatPeak, nil
+	}
+
+	if _, err := statPercentile(stat); err != nil {
+		return "", fmt.Errorf("invalid statistic %q (expected avg, peak, or a percentile such as p90)", value)
+	}
+	return stat, nil
+}
+
+// statPercentile returns the percentile of a statistic such as "p90"
+func statPercentile(stat string) (float64, error) {
+	if !strings.HasPrefix(stat, "p") {
+		return 0, fmt.Errorf("not a percentile: %q", stat)
+	}
+	p, err := strconv.ParseFloat(strings.TrimPrefix(stat, "p"), 64)
+	if err != nil || p <= 0 || p > 100 {
+		return 0, fmt.Errorf("invalid percentile: %q", stat)
+	}
+	return p, nil
+}
+
+// requestUsage returns the CPU and memory usage that requests are sized from, each by its own
+// statistic. Averages are weighted toward recent samples if configured.
+func requestUsage(samples []metrics.ResourceMetrics, opts Options) (float64, float64) {
+	avgCPU, avgMemory := averageUsage(samples, opts)
+	cpu := usageStat(opts.CPURequestStat, DefaultCPURequestStat, metrics.CPUValues(samples), avgCPU)
+	memory := usageStat(opts.MemoryRequestStat, DefaultMemoryRequestStat, metrics.MemoryValues(samples), avgMemory)
+	return cpu, memory
+}
+
+// usageStat computes the statistic over the values, falling back to defaultStat if it's unset
+// or invalid
+func usageStat(stat, defaultStat string, values []float64, average float64) float64 {
+	stat, err := ParseRequestStat(stat)
+	if err != nil {
+		stat = defaultStat
+	}
+
+	switch stat {
+	case StatAverage:
+		return average
+	case StatPeak:
+		return metrics.Percentile(values, 100)
+	default:
+		p, _ := statPercentile(stat)
+		return metrics.Percentile(values, p)
+	}
+}
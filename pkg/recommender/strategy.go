@@ -0,0 +1,225 @@
+package recommender
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/BogdanDolia/pod-rightsizer/pkg/kubernetes"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+)
+
+// Strategy computes recommended resources from collected samples. Minimum values are
+// applied to the result by Generate, so strategies don't need to enforce them.
+type Strategy interface {
+	Recommend(samples []metrics.ResourceMetrics, current kubernetes.ResourceSettings, opts Options) Recommendations
+}
+
+// StrategyFunc adapts a function to the Strategy interface
+type StrategyFunc func(samples []metrics.ResourceMetrics, current kubernetes.ResourceSettings, opts Options) Recommendations
+
+// Recommend calls f
+func (f StrategyFunc) Recommend(samples []metrics.ResourceMetrics, current kubernetes.ResourceSettings, opts Options) Recommendations {
+	return f(samples, current, opts)
+}
+
+// DefaultStrategy is the strategy used when none is specified
+const DefaultStrategy = "margin"
+
+// PodPeakStrategyName is the name the PodPeakStrategy is registered under. It sizes from the
+// per-pod samples in Options.PodSamples, which callers only need to collect for it.
+const PodPeakStrategyName = "pod-peak"
+
+// Defaults for strategy options left unset
+const (
+	defaultPercentile        = 95.0
+	defaultTargetUtilization = 70.0
+)
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]Strategy{
+		"margin":      MarginStrategy{},
+		"percentile":  PercentileStrategy{},
+		"utilization": UtilizationStrategy{},
+
+		PodPeakStrategyName: PodPeakStrategy{},
+	}
+)
+
+// Register makes a strategy available by name, replacing any strategy already registered under it
+func Register(name string, s Strategy) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	strategies[name] = s
+}
+
+// Lookup returns the strategy registered under name
+func Lookup(name string) (Strategy, bool) {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	s, ok := strategies[name]
+	return s, ok
+}
+
+// StrategyNames returns the names of all registered strategies in sorted order
+func StrategyNames() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MarginStrategy sizes requests from a usage statistic per resource, by default the 90th
+// percentile of CPU and the average of memory, and limits from peak usage, plus the margin
+type MarginStrategy struct{}
+
+// Recommend implements Strategy
+func (MarginStrategy) Recommend(samples []metrics.ResourceMetrics, _ kubernetes.ResourceSettings, opts Options) Recommendations {
+	cpu, memory := requestUsage(samples, opts)
+	peakCPU, peakMemory := peakUsage(samples, opts)
+	cpuMargin, memoryMargin := opts.margins(samples)
+
+	// Requests are based on each resource's statistic, limits on peak usage
+	return applyMargin(Usage{
+		CPURequest:    cpu,
+		CPULimit:      peakCPU,
+		MemoryRequest: memory,
+		MemoryLimit:   peakMemory,
+	}, cpuMargin, memoryMargin)
+}
+
+// PercentileStrategy sizes requests from a usage percentile (95th by default) and limits from
+// peak usage, plus the margin. It ignores short spikes when sizing requests.
+type PercentileStrategy struct{}
+
+// Recommend implements Strategy
+func (PercentileStrategy) Recommend(samples []metrics.ResourceMetrics, _ kubernetes.ResourceSettings, opts Options) Recommendations {
+	percentile := opts.Percentile
+	if percentile <= 0 {
+		percentile = defaultPercentile
+	}
+
+	pCPU, pMemory := metrics.CalculatePercentileMetrics(samples, percentile)
+	peakCPU, peakMemory := peakUsage(samples, opts)
+	cpuMargin, memoryMargin := opts.margins(samples)
+
+	return applyMargin(Usage{
+		CPURequest:    pCPU,
+		CPULimit:      peakCPU,
+		MemoryRequest: pMemory,
+		MemoryLimit:   peakMemory,
+	}, cpuMargin, memoryMargin)
+}
+
+// UtilizationStrategy sizes requests so that average usage sits at the target utilization
+// (70% by default) of the request, and limits from peak usage plus the margin
+type UtilizationStrategy struct{}
+
+// Recommend implements Strategy
+func (UtilizationStrategy) Recommend(samples []metrics.ResourceMetrics, _ kubernetes.ResourceSettings, opts Options) Recommendations {
+	target := opts.TargetUtilization
+	if target <= 0 {
+		target = defaultTargetUtilization
+	}
+
+	avgCPU, avgMemory := averageUsage(samples, opts)
+	limits := MarginStrategy{}.Recommend(samples, kubernetes.ResourceSettings{}, opts)
+
+	return Recommendations{
+		CPURequest:    avgCPU / (target / 100.0),
+		CPULimit:      limits.CPULimit,
+		MemoryRequest: avgMemory / (target / 100.0),
+		MemoryLimit:   limits.MemoryLimit,
+	}
+}
+
+// PodPeakStrategy sizes requests from a percentile (95th by default) of the peak usage each pod
+// reached over the run, and limits from the highest pod peak, plus the margin. With
+// Options.MemoryPeakSamples, only the memory limit sets aside each pod's spikes. Unlike sizing from
+// the fleet average it covers most pods of a heterogeneous fleet, without sizing every pod for
+// the single worst outlier. Without Options.PodSamples the samples are treated as a single pod.
+type PodPeakStrategy struct{}
+
+// Recommend implements Strategy
+func (PodPeakStrategy) Recommend(samples []metrics.ResourceMetrics, _ kubernetes.ResourceSettings, opts Options) Recommendations {
+	percentile := opts.Percentile
+	if percentile <= 0 {
+		percentile = defaultPercentile
+	}
+
+	podSamples := opts.PodSamples
+	if len(podSamples) == 0 {
+		podSamples = map[string][]metrics.ResourceMetrics{"": samples}
+	}
+
+	var cpuPeaks, memoryPeaks, memoryLimitPeaks []float64
+	for _, s := range podSamples {
+		if len(s) == 0 {
+			continue
+		}
+		peakCPU, peakMemory := metrics.CalculatePeakMetrics(s)
+		_, limitMemory := peakUsage(s, opts)
+		cpuPeaks = append(cpuPeaks, peakCPU)
+		memoryPeaks = append(memoryPeaks, peakMemory)
+		memoryLimitPeaks = append(memoryLimitPeaks, limitMemory)
+	}
+	cpuMargin, memoryMargin := opts.margins(samples)
+
+	return applyMargin(Usage{
+		CPURequest:    metrics.Percentile(cpuPeaks, percentile),
+		CPULimit:      metrics.Percentile(cpuPeaks, 100),
+		MemoryRequest: metrics.Percentile(memoryPeaks, percentile),
+		MemoryLimit:   metrics.Percentile(memoryLimitPeaks, 100),
+	}, cpuMargin, memoryMargin)
+}
+
+// peakUsage returns the peak CPU and memory usage that limits are sized from. With
+// Options.MemoryPeakSamples, the memory peak is the highest level reached by at least that many
+// samples.
+func peakUsage(samples []metrics.ResourceMetrics, opts Options) (float64, float64) {
+	peakCPU, peakMemory := metrics.CalculatePeakMetrics(samples)
+	if opts.MemoryPeakSamples > 1 {
+		peakMemory = metrics.RobustPeak(metrics.MemoryValues(samples), opts.MemoryPeakSamples)
+	}
+	return peakCPU, peakMemory
+}
+
+// memorySpike returns the highest memory sample when the memory limit was sized from a lower,
+// sustained level, or 0. The pod-peak strategy sets spikes aside per pod, so with it each pod's
+// samples are checked on their own, matching what the limit was sized from.
+func memorySpike(samples []metrics.ResourceMetrics, opts Options, perPod bool) float64 {
+	groups := map[string][]metrics.ResourceMetrics{"": samples}
+	if perPod && len(opts.PodSamples) > 0 {
+		groups = opts.PodSamples
+	}
+
+	var peak, sustained float64
+	for _, s := range groups {
+		_, groupPeak := metrics.CalculatePeakMetrics(s)
+		_, groupSustained := peakUsage(s, opts)
+		peak = math.Max(peak, groupPeak)
+		sustained = math.Max(sustained, groupSustained)
+	}
+	if sustained < peak {
+		return peak
+	}
+	return 0
+}
+
+// averageUsage returns the average usage, weighted toward recent samples if configured
+func averageUsage(samples []metrics.ResourceMetrics, opts Options) (float64, float64) {
+	switch {
+	case opts.RecencyLinear:
+		return metrics.CalculateLinearWeightedAverage(samples)
+	case opts.RecencyDecay > 0 && opts.RecencyDecay < 1:
+		return metrics.CalculateWeightedAverage(samples, opts.RecencyDecay)
+	default:
+		return metrics.CalculateAverageMetrics(samples)
+	}
+}
@@ -0,0 +1,62 @@
+package recommender
+
+import (
+	"github.com/BogdanDolia/pod-rightsizer/pkg/kubernetes"
+	"github.com/BogdanDolia/pod-rightsizer/pkg/metrics"
+)
+
+// DefaultThrottleThreshold is the fraction of samples pinned at the CPU limit above which the
+// workload is considered throttled
+const DefaultThrottleThreshold = 0.05
+
+// throttleSaturation is how close to the CPU limit a sample must be to count as pinned at it
+const throttleSaturation = 0.95
+
+// ThrottleRatio returns the fraction of samples whose CPU usage sits at the current CPU limit.
+// metrics-server reports usage capped by CFS quota, so usage pinned at the limit is the signal
+// that the container was throttled. It returns 0 if no CPU limit is set.
+func ThrottleRatio(allMetrics []metrics.ResourceMetrics, currentSettings kubernetes.ResourceSettings) float64 {
+	if !currentSettings.HasCPULimit || currentSettings.CPULimit <= 0 || len(allMetrics) == 0 {
+		return 0
+	}
+
+	pinned := 0
+	for _, m := range allMetrics {
+		if m.CPUUsage >= currentSettings.CPULimit*throttleSaturation {
+			pinned++
+		}
+	}
+
+	return float64(pinned) / float64(len(allMetrics))
+}
+
+// applyThrottleRule raises the CPU limit when observed throttling exceeds the threshold.
+// Throttled usage hides the real demand, so the limit is raised above the current one by the
+// margin instead of being derived from the capped peak.
+func applyThrottleRule(
+	r Recommendations,
+	allMetrics []metrics.ResourceMetrics,
+	currentSettings kubernetes.ResourceSettings,
+	opts Options,
+) Recommendations {
+	threshold := opts.ThrottleThreshold
+	if threshold <= 0 {
+		threshold = DefaultThrottleThreshold
+	}
+
+	ratio := ThrottleRatio(allMetrics, currentSettings)
+	if ratio <= threshold {
+		return r
+	}
+
+	r.ThrottlingDetected = true
+	r.ThrottleRatio = ratio
+
+	cpuMargin, _ := opts.margins(allMetrics)
+	raised := currentSettings.CPULimit * (1.0 + float64(cpuMargin)/100.0)
+	if r.CPULimit < raised {
+		r.CPULimit = raised
+	}
+
+	return r
+}